@@ -1,5 +1,6 @@
 import { defineStore } from 'pinia';
 import { ref } from 'vue';
+import { isAxiosError } from 'axios';
 import request, { updateAxiosBaseUrl } from '@/utils/axios';
 import logger from '@/utils/logger';
 import { syncManager } from '@/utils/sync/syncManager';
@@ -73,11 +74,26 @@ export const useUserStore = defineStore('user', () => {
     let queryRoomId: number | null = null;
     
     try {
-      const queryUserResponse = await request.post('user/login', {
-        username: newUsername,
-      });
+      // Log in as a guest, registering the name the first time it is used
+      let queryUserResponse;
+      try {
+        queryUserResponse = await request.post('user/login', {
+          username: newUsername,
+        });
+      } catch (error) {
+        if (!isAxiosError(error) || error.response?.status !== 401) {
+          throw error;
+        }
+        queryUserResponse = await request.post('user/register', {
+          username: newUsername,
+        });
+      }
       queryUserId = queryUserResponse.data.id;
 
+      // The session token tells the server who joins the room
+      localStorage.setItem('authToken', queryUserResponse.data.token);
+      localStorage.setItem('refreshToken', queryUserResponse.data.refreshToken);
+
       const queryRoomResponse = await request.post('room/create', {
         name: newRoomName,
       });
@@ -6,6 +6,13 @@ import logger from './logger';
 // 创建axios实例
 let request: AxiosInstance;
 
+// Refreshing rotates the refresh token, so concurrent callers share one request
+let refreshing: Promise<string | null> | null = null;
+
+// Access tokens this close to expiring are refreshed before a connection
+// opens with them
+const TOKEN_EXPIRY_MARGIN_MS = 30 * 1000;
+
 function initAxios() {
   // 从cookie中获取URL配置
   const urlConfig = document.cookie
@@ -59,8 +66,18 @@ function initAxios() {
       logger.debug('Response:', response.status, response.config.url);
       return response;
     },
-    error => {
+    async error => {
     //   logger.error('Response error:', error);
+      // Access tokens are short-lived, renew an expired one once with the
+      // refresh token of the session and retry
+      const original = error.config;
+      if (error.response?.status === 401 && localStorage.getItem('refreshToken') && original && !original._retried
+        && !original.url?.startsWith('session/refresh')) {
+        original._retried = true;
+        if (await refreshSession()) {
+          return request(original);
+        }
+      }
       return Promise.reject(error);
     }
   );
@@ -68,6 +85,59 @@ function initAxios() {
   return request;
 }
 
+// refreshSession trades the refresh token of the session for a new access
+// token, resolving to null when that fails
+function refreshSession(): Promise<string | null> {
+  if (!refreshing) {
+    refreshing = requestRefresh().finally(() => {
+      refreshing = null;
+    });
+  }
+  return refreshing;
+}
+
+async function requestRefresh(): Promise<string | null> {
+  const refreshToken = localStorage.getItem('refreshToken');
+  if (!refreshToken) {
+    return null;
+  }
+  try {
+    const response = await request.post('session/refresh', { refreshToken });
+    localStorage.setItem('authToken', response.data.token);
+    localStorage.setItem('refreshToken', response.data.refreshToken);
+    return response.data.token;
+  } catch (refreshError: any) {
+    logger.error('Failed to refresh session:', refreshError);
+    // Keep the refresh token through network errors, only a refused one
+    // ends the session
+    if (refreshError.response?.status === 401) {
+      localStorage.removeItem('refreshToken');
+    }
+    return null;
+  }
+}
+
+// tokenExpiresSoon reports whether an access token has expired or is about to
+function tokenExpiresSoon(token: string): boolean {
+  try {
+    const payload = token.split('.')[1].replace(/-/g, '+').replace(/_/g, '/');
+    const { exp } = JSON.parse(atob(payload));
+    return typeof exp === 'number' && exp * 1000 - Date.now() < TOKEN_EXPIRY_MARGIN_MS;
+  } catch {
+    return false;
+  }
+}
+
+// getFreshToken returns the access token, refreshed first when it has
+// expired or is about to, for connections which cannot retry through axios
+async function getFreshToken(): Promise<string | null> {
+  const token = localStorage.getItem('authToken');
+  if (token && !tokenExpiresSoon(token)) {
+    return token;
+  }
+  return (await refreshSession()) ?? token;
+}
+
 function updateAxiosBaseUrl(apiBaseUrl?: string) {
   if (apiBaseUrl) {
     request.defaults.baseURL = apiBaseUrl;
@@ -89,4 +159,4 @@ function updateAxiosBaseUrl(apiBaseUrl?: string) {
 export default initAxios();
 
 // 导出重新初始化方法,以便需要时重新创建实例
-export { initAxios, updateAxiosBaseUrl }; 
\ No newline at end of file
+export { initAxios, updateAxiosBaseUrl, refreshSession, getFreshToken }; 
\ No newline at end of file
@@ -1,6 +1,7 @@
 // use sse(Server-Sent Events) to implement the ISyncAdapter interface.
 import type { ISyncAdapter, ISyncMessage, SyncEventHandler } from '@/types/sync';
 import logger from '@/utils/logger';
+import { getFreshToken, refreshSession } from '@/utils/axios';
 
 export class SSEAdapter implements ISyncAdapter {
   private es: EventSource | null = null;
@@ -11,7 +12,12 @@ export class SSEAdapter implements ISyncAdapter {
   private userId: number | null = null;
   private roomId: number | null = null;
   private reconnectInterval: number = 5000;
+  private maxReconnectInterval: number = 60000;
   private reconnectTimer: number | null = null;
+  // Connection attempts which failed since the last one that opened
+  private failures: number = 0;
+  private opened: boolean = false;
+  private stopped: boolean = false;
 
   constructor(url: string) {
     this.url = url;
@@ -25,16 +31,24 @@ export class SSEAdapter implements ISyncAdapter {
     this.url = url;
     this.userId = userId;
     this.roomId = roomId;
+    this.stopped = false;
+    this.open();
+  }
 
-    // Get JWT token from localStorage
-    const token = localStorage.getItem('authToken');
+  private async open(): Promise<void> {
+    // Access tokens are short-lived, a reconnect may find an expired one
+    const token = await getFreshToken();
+    if (this.stopped || this.es) {
+      return;
+    }
 
     // Add token as query parameter if available (EventSource doesn't support custom headers)
-    let fullUrl = `${this.url}/connect?userId=${userId}&roomId=${roomId}`;
+    let fullUrl = `${this.url}/connect?userId=${this.userId}&roomId=${this.roomId}`;
     if (token) {
       fullUrl += `&token=${encodeURIComponent(token)}`;
     }
 
+    this.opened = false;
     this.es = new EventSource(fullUrl);
 
     this.es.onmessage = (event) => this.handleMessage(event);
@@ -43,6 +57,11 @@ export class SSEAdapter implements ISyncAdapter {
   }
 
   disconnect(): void {
+    this.stopped = true;
+    this.closeSource();
+  }
+
+  private closeSource(): void {
     if (this.es) {
       this.es.close();
       this.es = null;
@@ -71,6 +90,8 @@ export class SSEAdapter implements ISyncAdapter {
   }
 
   private handleOpen(): void {
+    this.opened = true;
+    this.failures = 0;
     if (this.reconnectTimer) {
       clearTimeout(this.reconnectTimer);
       this.reconnectTimer = null;
@@ -83,10 +104,35 @@ export class SSEAdapter implements ISyncAdapter {
     }
   }
 
-  private handleError(): void {
-    this.disconnect();
+  private async handleError(): Promise<void> {
+    // EventSource hides the status of a refused connection, one which never
+    // opened may have been refused for an expired or revoked token
+    const refused = !this.opened;
+    this.closeSource();
+    if (this.stopped) {
+      return;
+    }
+
+    if (refused) {
+      this.failures++;
+      const hadRefreshToken = localStorage.getItem('refreshToken') !== null;
+      if (this.failures === 1 && hadRefreshToken && !(await refreshSession())
+        && !localStorage.getItem('refreshToken')) {
+        // The session is over, reconnecting cannot succeed
+        this.stopped = true;
+        this.errorHandler?.(new Error('Session expired or revoked'));
+        return;
+      }
+      if (this.stopped) {
+        return;
+      }
+    }
+
+    // Back off while the server keeps refusing
+    const delay = Math.min(this.reconnectInterval * 2 ** Math.max(this.failures - 1, 0), this.maxReconnectInterval);
     this.reconnectTimer = window.setTimeout(() => {
-      this.connect(this.url!, this.userId!, this.roomId!);
-    }, this.reconnectInterval);
+      this.reconnectTimer = null;
+      this.open();
+    }, delay);
   }
 }
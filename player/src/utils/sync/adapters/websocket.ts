@@ -1,61 +1,97 @@
 import type { ISyncAdapter, ISyncMessage, SyncEventHandler } from '@/types/sync';
 import logger from '@/utils/logger';
+import { getFreshToken, refreshSession } from '@/utils/axios';
 
 export class WebSocketAdapter implements ISyncAdapter {
   private ws: WebSocket | null = null;
   private messageHandler: SyncEventHandler | null = null;
   private closeHandler: (() => void) | null = null;
   private errorHandler: ((error: any) => void) | null = null;
+  private authRetried = false;
 
   connect(url: string, userId: number, roomId: number): void {
     logger.debug('连接WebSocket:', url);
-    this.ws = new WebSocket(url);
+    const ws = new WebSocket(url);
+    this.ws = ws;
+    this.authRetried = false;
 
-    this.ws.onopen = () => {
+    ws.onopen = async () => {
       logger.info('WebSocket连接已建立');
-      if (this.ws) {
-        // Get JWT token from localStorage
-        const token = localStorage.getItem('authToken');
+      // Access tokens are short-lived, a reconnect may find an expired one
+      const token = await getFreshToken();
+      this.sendAuth(ws, token, userId, roomId);
+    };
 
-        this.ws.send(JSON.stringify({
-          type: 'auth',
-          payload: {
-            token,
-            userId,
-            roomId
-          }
-        }));
+    ws.onmessage = async (event) => {
+      let data;
+      try {
+        data = JSON.parse(event.data);
+        // 如果是字符串，再次解析
+        if (typeof data === 'string') {
+          data = JSON.parse(data);
+        }
+      } catch (error) {
+        logger.error('WebSocket消息解析失败:', error);
+        return;
+      }
+
+      // The server refused the token, the connection stays open to retry
+      // once with a refreshed one
+      if (data.type === 'error') {
+        logger.error('WebSocket认证失败:', data.error);
+        const token = this.authRetried ? null : await refreshSession();
+        this.authRetried = true;
+        if (token) {
+          this.sendAuth(ws, token, userId, roomId);
+        } else if (localStorage.getItem('refreshToken')) {
+          // The refresh may have failed on the network, reconnect later
+          ws.close();
+        } else {
+          // The session is over, reconnecting cannot succeed
+          ws.onclose = null;
+          ws.close();
+          this.errorHandler?.(new Error(data.error));
+        }
+        return;
       }
-    };
 
-    this.ws.onmessage = (event) => {
       if (this.messageHandler) {
         try {
-          let data = JSON.parse(event.data);
-          // 如果是字符串，再次解析
-          if (typeof data === 'string') {
-            data = JSON.parse(data);
-          }
           this.messageHandler(data);
         } catch (error) {
-          logger.error('WebSocket消息解析失败:', error);
+          logger.error('WebSocket消息处理失败:', error);
         }
       }
     };
 
-    this.ws.onclose = () => {
+    ws.onclose = () => {
       if (this.closeHandler) {
         this.closeHandler();
       }
     };
 
-    this.ws.onerror = (error) => {
+    ws.onerror = (error) => {
       if (this.errorHandler) {
         this.errorHandler(error);
       }
     };
   }
 
+  private sendAuth(ws: WebSocket, token: string | null, userId: number, roomId: number): void {
+    // The socket may have been replaced or closed while refreshing
+    if (this.ws !== ws || ws.readyState !== WebSocket.OPEN) {
+      return;
+    }
+    ws.send(JSON.stringify({
+      type: 'auth',
+      payload: {
+        token,
+        userId,
+        roomId
+      }
+    }));
+  }
+
   disconnect(): void {
     if (this.ws) {
       this.ws.close();
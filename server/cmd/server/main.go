@@ -7,10 +7,19 @@ import (
 	"strings"
 	"sync-player-server/internal/config"
 	"sync-player-server/internal/database"
+	"sync-player-server/internal/health"
+	"sync-player-server/internal/mediaurl"
+	"sync-player-server/internal/probe"
+	"sync-player-server/internal/proxy"
+	"sync-player-server/internal/resolve"
 	"sync-player-server/internal/routes"
+	"sync-player-server/internal/storage"
 	"sync-player-server/internal/sync"
 	"sync-player-server/internal/sync/adapters"
+	"sync-player-server/internal/transcode"
+	"sync-player-server/internal/utils"
 	"syscall"
+	"time"
 
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
@@ -39,6 +48,18 @@ func main() {
 	}
 	r := gin.Default()
 
+	// Client addresses throttle logins, so forwarded ones are only taken
+	// from the configured reverse proxies
+	var trustedProxies []string
+	for _, address := range strings.Split(config.Env.TrustedProxies, ",") {
+		if address = strings.TrimSpace(address); address != "" {
+			trustedProxies = append(trustedProxies, address)
+		}
+	}
+	if err := r.SetTrustedProxies(trustedProxies); err != nil {
+		config.Logger.Fatalf("Invalid TRUSTED_PROXIES: %v", err)
+	}
+
 	corsConfig := cors.DefaultConfig()
 	allowOrigins := strings.Split(config.Env.CorsAllowOrigins, ",")
 	for i, origin := range allowOrigins {
@@ -46,8 +67,10 @@ func main() {
 	}
 	corsConfig.AllowOrigins = allowOrigins
 	corsConfig.AllowCredentials = true
-	corsConfig.AllowHeaders = []string{"Origin", "Content-Type", "Accept", "Authorization", "Cookie"}
-	corsConfig.AllowMethods = []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"}
+	corsConfig.AllowHeaders = []string{"Origin", "Content-Type", "Accept", "Authorization", "Cookie",
+		"Upload-Length", "Upload-Offset", "Upload-Metadata", "Tus-Resumable"}
+	corsConfig.AllowMethods = []string{"GET", "HEAD", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"}
+	corsConfig.ExposeHeaders = []string{"Location", "Upload-Offset", "Upload-Length", "Tus-Resumable"}
 	r.Use(cors.New(corsConfig))
 
 	adapter, err := adapters.NewAdapter(config.Env.SyncProtocol)
@@ -56,6 +79,94 @@ func main() {
 	}
 
 	sync.InitSyncManager(adapter)
+	sync.GetSyncManager().StartSessionCheck(
+		time.Duration(config.Env.SessionCheckIntervalSeconds)*time.Second,
+		database.FilterActiveSessionIDs,
+	)
+
+	if config.Env.ProbeEnabled {
+		probe.InitProber(probe.Options{
+			Timeout:              time.Duration(config.Env.ProbeTimeoutSeconds) * time.Second,
+			AllowPrivateNetworks: config.Env.OutboundAllowPrivateNetworks,
+		})
+		config.Logger.Info("Media probing enabled")
+	}
+
+	if config.Env.ResolveEnabled {
+		resolve.InitRegistry(resolve.Options{
+			Timeout:              time.Duration(config.Env.ResolveTimeoutSeconds) * time.Second,
+			AllowPrivateNetworks: config.Env.OutboundAllowPrivateNetworks,
+		})
+		config.Logger.Info("Link resolving enabled")
+	}
+
+	signingKeys := make([][]byte, 0)
+	for _, key := range strings.Split(config.Env.MediaSigningKeys, ",") {
+		if key = strings.TrimSpace(key); key != "" {
+			signingKeys = append(signingKeys, []byte(key))
+		}
+	}
+	if len(signingKeys) == 0 {
+		key, err := utils.GenerateToken(32)
+		if err != nil {
+			config.Logger.Fatalf("Failed to generate media signing key: %v", err)
+		}
+		signingKeys = append(signingKeys, []byte(key))
+		config.Logger.Warn("MEDIA_SIGNING_KEYS is not set, media URLs stop working when the server restarts")
+	}
+	if err := mediaurl.InitSigner(mediaurl.Options{
+		Keys: signingKeys,
+		TTL:  time.Duration(config.Env.MediaURLTTLMinutes) * time.Minute,
+	}); err != nil {
+		config.Logger.Fatalf("Failed to create media URL signer: %v", err)
+	}
+
+	if config.Env.ProxyEnabled {
+		proxy.InitProxy(proxy.Options{
+			PathPrefix:           "/api/proxy",
+			Secret:               signingKeys[0],
+			Timeout:              time.Duration(config.Env.ProxyTimeoutSeconds) * time.Second,
+			RoomBandwidth:        int64(config.Env.ProxyRoomBandwidthKBps) * 1024,
+			AllowPrivateNetworks: config.Env.OutboundAllowPrivateNetworks,
+		})
+		config.Logger.Info("Media proxy enabled")
+	}
+
+	if config.Env.UploadEnabled {
+		localStorage, err := storage.NewLocalStorage(config.Env.UploadDir)
+		if err != nil {
+			config.Logger.Fatalf("Failed to create upload storage: %v", err)
+		}
+		storage.InitStorage(localStorage)
+		config.Logger.Infof("Media uploads enabled, storing in %s", config.Env.UploadDir)
+	}
+
+	var transcodeQueue *transcode.Queue
+	if config.Env.TranscodeEnabled {
+		transcodeQueue, err = transcode.InitQueue(transcode.Options{
+			Executor: &transcode.FFmpegExecutor{
+				Path:    config.Env.FFmpegPath,
+				Threads: config.Env.TranscodeThreads,
+			},
+			OutputDir:            config.Env.TranscodeDir,
+			Workers:              config.Env.TranscodeWorkers,
+			Renditions:           strings.Split(config.Env.TranscodeRenditions, ","),
+			AllowPrivateNetworks: config.Env.OutboundAllowPrivateNetworks,
+		})
+		if err != nil {
+			config.Logger.Fatalf("Failed to create transcode queue: %v", err)
+		}
+		transcodeQueue.Start()
+	}
+
+	healthChecker := health.InitChecker(health.Options{
+		Interval:             time.Duration(config.Env.HealthCheckIntervalSeconds) * time.Second,
+		Timeout:              time.Duration(config.Env.HealthCheckTimeoutSeconds) * time.Second,
+		FailureThreshold:     config.Env.HealthFailureThreshold,
+		ReportThreshold:      config.Env.HealthReportThreshold,
+		AllowPrivateNetworks: config.Env.OutboundAllowPrivateNetworks,
+	})
+	healthChecker.Start()
 
 	var wsAdapter *adapters.WebSocketAdapter
 	var sseAdapter *adapters.SSEAdapter
@@ -88,6 +199,12 @@ func main() {
 
 	config.Logger.Info("Shutting down server...")
 
+	healthChecker.Stop()
+	sync.GetSyncManager().StopSessionCheck()
+	if transcodeQueue != nil {
+		transcodeQueue.Stop()
+	}
+
 	if adapter != nil {
 		if err := adapter.Stop(); err != nil {
 			config.Logger.Errorf("Error stopping sync adapter: %v", err)
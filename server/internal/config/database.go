@@ -2,6 +2,7 @@ package config
 
 import (
 	"fmt"
+	"strings"
 
 	"gorm.io/driver/mysql"
 	"gorm.io/driver/postgres"
@@ -14,7 +15,14 @@ import (
 func GetDatabaseDialector() gorm.Dialector {
 	switch Env.DBDialect {
 	case "sqlite":
-		return sqlite.Open(Env.DBStorage)
+		// Writers wait for each other instead of failing with "database is
+		// locked", transactions take the write lock up front so that two of
+		// them never deadlock upgrading a read lock
+		separator := "?"
+		if strings.Contains(Env.DBStorage, "?") {
+			separator = "&"
+		}
+		return sqlite.Open(Env.DBStorage + separator + "_busy_timeout=5000&_txlock=immediate")
 
 	case "mysql":
 		dsn := fmt.Sprintf("%s:%s@tcp(%s:%d)/%s?charset=utf8mb4&parseTime=True&loc=Local",
@@ -4,6 +4,8 @@ import (
 	"fmt"
 	"os"
 	"strconv"
+	"strings"
+	"sync-player-server/internal/models"
 
 	"github.com/joho/godotenv"
 	"github.com/sirupsen/logrus"
@@ -34,9 +36,72 @@ type EnvConfig struct {
 	SyncProtocol     string
 	CorsAllowOrigins string
 	JWTSecret        string
-	JWTExpiryHours   int
+
+	JWTAccessTTLMinutes         int
+	JWTRefreshTTLDays           int
+	SessionCheckIntervalSeconds int
+
+	LoginMaxFailedAttempts int
+	LoginLockoutMinutes    int
+	LoginIPMaxFailures     int
+	TrustedProxies         string
+
+	InviteDefaultTTLHours int
+	InviteMaxTTLDays      int
+
+	OutboundAllowPrivateNetworks bool
+
+	ProbeEnabled        bool
+	ProbeTimeoutSeconds int
+
+	ResolveEnabled        bool
+	ResolveTimeoutSeconds int
+
+	ProxyEnabled           bool
+	ProxyTimeoutSeconds    int
+	ProxyRoomBandwidthKBps int
+
+	UploadEnabled     bool
+	UploadDir         string
+	UploadMaxFileMB   int
+	UploadUserQuotaMB int
+	UploadRoomQuotaMB int
+	UploadExpiryHours int
+	MediaPublicURL    string
+
+	MediaSigningKeys   string
+	MediaURLTTLMinutes int
+	MediaURLBindUser   bool
+
+	TranscodeEnabled    bool
+	FFmpegPath          string
+	TranscodeDir        string
+	TranscodeWorkers    int
+	TranscodeThreads    int
+	TranscodeRenditions string
+
+	HealthCheckIntervalSeconds int
+	HealthCheckTimeoutSeconds  int
+	HealthFailureThreshold     int
+	HealthReportThreshold      int
+
+	SkipVoteRatio float64
+
+	SyncToleranceSeconds float64
+
+	PlaylistUndoSeconds         int
+	PlaylistTrashRetentionHours int
+
+	MediaURLSchemes      string
+	MediaURLAllowedHosts string
+	MediaURLDeniedHosts  string
+	MediaURLMaxLength    int
 }
 
+// MaxSyncToleranceSeconds is the most a player may be allowed to drift from
+// its room
+const MaxSyncToleranceSeconds = 60
+
 var Env *EnvConfig
 
 // getEnvValue gets environment variable with default value
@@ -61,6 +126,19 @@ func getEnvInt(key string, defaultValue int) int {
 	return intValue
 }
 
+// getEnvFloat gets environment variable as float
+func getEnvFloat(key string, defaultValue float64) float64 {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+	floatValue, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return defaultValue
+	}
+	return floatValue
+}
+
 // getEnvBool gets environment variable as boolean
 func getEnvBool(key string, defaultValue bool) bool {
 	value := os.Getenv(key)
@@ -99,7 +177,66 @@ func LoadEnv() error {
 		SyncProtocol:     getEnvValue("SYNC_PROTOCOL", "websocket"),
 		CorsAllowOrigins: getEnvValue("CORS_ALLOW_ORIGINS", "http://localhost:3000,http://localhost:5173,http://localhost:8080,http://127.0.0.1:3000,http://127.0.0.1:5173,http://127.0.0.1:8080"),
 		JWTSecret:        getEnvValue("JWT_SECRET", "your-default-secret-key-change-this"),
-		JWTExpiryHours:   getEnvInt("JWT_EXPIRY_HOURS", 24),
+
+		JWTAccessTTLMinutes:         getEnvInt("JWT_ACCESS_TTL_MINUTES", 15),
+		JWTRefreshTTLDays:           getEnvInt("JWT_REFRESH_TTL_DAYS", 30),
+		SessionCheckIntervalSeconds: getEnvInt("SESSION_CHECK_INTERVAL_SECONDS", 60),
+
+		LoginMaxFailedAttempts: getEnvInt("LOGIN_MAX_FAILED_ATTEMPTS", 5),
+		LoginLockoutMinutes:    getEnvInt("LOGIN_LOCKOUT_MINUTES", 15),
+		LoginIPMaxFailures:     getEnvInt("LOGIN_IP_MAX_FAILURES", 20),
+		TrustedProxies:         getEnvValue("TRUSTED_PROXIES", ""),
+
+		InviteDefaultTTLHours: getEnvInt("INVITE_DEFAULT_TTL_HOURS", 24),
+		InviteMaxTTLDays:      getEnvInt("INVITE_MAX_TTL_DAYS", 30),
+
+		OutboundAllowPrivateNetworks: getEnvBool("OUTBOUND_ALLOW_PRIVATE_NETWORKS", false),
+
+		ProbeEnabled:        getEnvBool("PROBE_ENABLED", true),
+		ProbeTimeoutSeconds: getEnvInt("PROBE_TIMEOUT_SECONDS", 15),
+
+		ResolveEnabled:        getEnvBool("RESOLVE_ENABLED", true),
+		ResolveTimeoutSeconds: getEnvInt("RESOLVE_TIMEOUT_SECONDS", 10),
+
+		ProxyEnabled:           getEnvBool("PROXY_ENABLED", false),
+		ProxyTimeoutSeconds:    getEnvInt("PROXY_TIMEOUT_SECONDS", 15),
+		ProxyRoomBandwidthKBps: getEnvInt("PROXY_ROOM_BANDWIDTH_KBPS", 8192),
+
+		UploadEnabled:     getEnvBool("UPLOAD_ENABLED", true),
+		UploadDir:         getEnvValue("UPLOAD_DIR", "./data/uploads"),
+		UploadMaxFileMB:   getEnvInt("UPLOAD_MAX_FILE_MB", 4096),
+		UploadUserQuotaMB: getEnvInt("UPLOAD_USER_QUOTA_MB", 10240),
+		UploadRoomQuotaMB: getEnvInt("UPLOAD_ROOM_QUOTA_MB", 20480),
+		UploadExpiryHours: getEnvInt("UPLOAD_EXPIRY_HOURS", 24),
+		MediaPublicURL:    getEnvValue("MEDIA_PUBLIC_URL", ""),
+
+		MediaSigningKeys:   getEnvValue("MEDIA_SIGNING_KEYS", ""),
+		MediaURLTTLMinutes: getEnvInt("MEDIA_URL_TTL_MINUTES", 360),
+		MediaURLBindUser:   getEnvBool("MEDIA_URL_BIND_USER", false),
+
+		TranscodeEnabled:    getEnvBool("TRANSCODE_ENABLED", false),
+		FFmpegPath:          getEnvValue("FFMPEG_PATH", "ffmpeg"),
+		TranscodeDir:        getEnvValue("TRANSCODE_DIR", "./data/transcode"),
+		TranscodeWorkers:    getEnvInt("TRANSCODE_WORKERS", 1),
+		TranscodeThreads:    getEnvInt("TRANSCODE_THREADS", 0),
+		TranscodeRenditions: getEnvValue("TRANSCODE_RENDITIONS", "720p,480p"),
+
+		HealthCheckIntervalSeconds: getEnvInt("HEALTH_CHECK_INTERVAL_SECONDS", 300),
+		HealthCheckTimeoutSeconds:  getEnvInt("HEALTH_CHECK_TIMEOUT_SECONDS", 10),
+		HealthFailureThreshold:     getEnvInt("HEALTH_FAILURE_THRESHOLD", 2),
+		HealthReportThreshold:      getEnvInt("HEALTH_REPORT_THRESHOLD", 2),
+
+		SkipVoteRatio: getEnvFloat("SKIP_VOTE_RATIO", 0.5),
+
+		SyncToleranceSeconds: getEnvFloat("SYNC_TOLERANCE_SECONDS", 1),
+
+		PlaylistUndoSeconds:         getEnvInt("PLAYLIST_UNDO_SECONDS", 60),
+		PlaylistTrashRetentionHours: getEnvInt("PLAYLIST_TRASH_RETENTION_HOURS", 72),
+
+		MediaURLSchemes:      getEnvValue("MEDIA_URL_SCHEMES", "http,https"),
+		MediaURLAllowedHosts: getEnvValue("MEDIA_URL_ALLOWED_HOSTS", ""),
+		MediaURLDeniedHosts:  getEnvValue("MEDIA_URL_DENIED_HOSTS", ""),
+		MediaURLMaxLength:    getEnvInt("MEDIA_URL_MAX_LENGTH", 8192),
 	}
 
 	return validateEnv()
@@ -154,5 +291,116 @@ func validateEnv() error {
 		Env.SyncProtocol = "websocket"
 	}
 
+	// Validate SKIP_VOTE_RATIO
+	if Env.SkipVoteRatio <= 0 || Env.SkipVoteRatio > 1 {
+		logger.Warnf("Invalid SKIP_VOTE_RATIO: %f, defaulting to 0.5", Env.SkipVoteRatio)
+		Env.SkipVoteRatio = 0.5
+	}
+
+	// Validate SYNC_TOLERANCE_SECONDS
+	if Env.SyncToleranceSeconds <= 0 || Env.SyncToleranceSeconds > MaxSyncToleranceSeconds {
+		logger.Warnf("Invalid SYNC_TOLERANCE_SECONDS: %f, defaulting to 1", Env.SyncToleranceSeconds)
+		Env.SyncToleranceSeconds = 1
+	}
+
+	// Validate playlist trash settings
+	if Env.PlaylistUndoSeconds <= 0 {
+		logger.Warnf("Invalid PLAYLIST_UNDO_SECONDS: %d, defaulting to 60", Env.PlaylistUndoSeconds)
+		Env.PlaylistUndoSeconds = 60
+	}
+	if Env.PlaylistTrashRetentionHours <= 0 {
+		logger.Warnf("Invalid PLAYLIST_TRASH_RETENTION_HOURS: %d, defaulting to 72", Env.PlaylistTrashRetentionHours)
+		Env.PlaylistTrashRetentionHours = 72
+	}
+
+	// Validate session settings
+	if Env.JWTAccessTTLMinutes <= 0 {
+		logger.Warnf("Invalid JWT_ACCESS_TTL_MINUTES: %d, defaulting to 15", Env.JWTAccessTTLMinutes)
+		Env.JWTAccessTTLMinutes = 15
+	}
+	if Env.JWTRefreshTTLDays <= 0 {
+		logger.Warnf("Invalid JWT_REFRESH_TTL_DAYS: %d, defaulting to 30", Env.JWTRefreshTTLDays)
+		Env.JWTRefreshTTLDays = 30
+	}
+	if Env.SessionCheckIntervalSeconds <= 0 {
+		logger.Warnf("Invalid SESSION_CHECK_INTERVAL_SECONDS: %d, defaulting to 60", Env.SessionCheckIntervalSeconds)
+		Env.SessionCheckIntervalSeconds = 60
+	}
+
+	// Validate login settings
+	if Env.LoginMaxFailedAttempts <= 0 {
+		logger.Warnf("Invalid LOGIN_MAX_FAILED_ATTEMPTS: %d, defaulting to 5", Env.LoginMaxFailedAttempts)
+		Env.LoginMaxFailedAttempts = 5
+	}
+	if Env.LoginLockoutMinutes <= 0 {
+		logger.Warnf("Invalid LOGIN_LOCKOUT_MINUTES: %d, defaulting to 15", Env.LoginLockoutMinutes)
+		Env.LoginLockoutMinutes = 15
+	}
+	if Env.LoginIPMaxFailures <= 0 {
+		logger.Warnf("Invalid LOGIN_IP_MAX_FAILURES: %d, defaulting to 20", Env.LoginIPMaxFailures)
+		Env.LoginIPMaxFailures = 20
+	}
+
+	// Validate invite settings
+	if Env.InviteMaxTTLDays <= 0 {
+		logger.Warnf("Invalid INVITE_MAX_TTL_DAYS: %d, defaulting to 30", Env.InviteMaxTTLDays)
+		Env.InviteMaxTTLDays = 30
+	}
+	if Env.InviteDefaultTTLHours <= 0 || Env.InviteDefaultTTLHours > Env.InviteMaxTTLDays*24 {
+		logger.Warnf("Invalid INVITE_DEFAULT_TTL_HOURS: %d, defaulting to 24", Env.InviteDefaultTTLHours)
+		Env.InviteDefaultTTLHours = 24
+	}
+
+	// Validate media proxy settings
+	if Env.ProxyRoomBandwidthKBps < 0 {
+		logger.Warnf("Invalid PROXY_ROOM_BANDWIDTH_KBPS: %d, defaulting to 8192", Env.ProxyRoomBandwidthKBps)
+		Env.ProxyRoomBandwidthKBps = 8192
+	}
+
+	// Validate upload settings
+	if Env.UploadMaxFileMB <= 0 {
+		logger.Warnf("Invalid UPLOAD_MAX_FILE_MB: %d, defaulting to 4096", Env.UploadMaxFileMB)
+		Env.UploadMaxFileMB = 4096
+	}
+	if Env.UploadUserQuotaMB < 0 {
+		logger.Warnf("Invalid UPLOAD_USER_QUOTA_MB: %d, defaulting to 10240", Env.UploadUserQuotaMB)
+		Env.UploadUserQuotaMB = 10240
+	}
+	if Env.UploadRoomQuotaMB < 0 {
+		logger.Warnf("Invalid UPLOAD_ROOM_QUOTA_MB: %d, defaulting to 20480", Env.UploadRoomQuotaMB)
+		Env.UploadRoomQuotaMB = 20480
+	}
+	if Env.UploadExpiryHours <= 0 {
+		logger.Warnf("Invalid UPLOAD_EXPIRY_HOURS: %d, defaulting to 24", Env.UploadExpiryHours)
+		Env.UploadExpiryHours = 24
+	}
+	Env.MediaPublicURL = strings.TrimRight(Env.MediaPublicURL, "/")
+
+	// Validate signed media URL settings
+	if Env.MediaURLTTLMinutes <= 0 {
+		logger.Warnf("Invalid MEDIA_URL_TTL_MINUTES: %d, defaulting to 360", Env.MediaURLTTLMinutes)
+		Env.MediaURLTTLMinutes = 360
+	}
+
+	// Validate transcode settings
+	if Env.TranscodeWorkers <= 0 {
+		logger.Warnf("Invalid TRANSCODE_WORKERS: %d, defaulting to 1", Env.TranscodeWorkers)
+		Env.TranscodeWorkers = 1
+	}
+	if Env.TranscodeThreads < 0 {
+		logger.Warnf("Invalid TRANSCODE_THREADS: %d, defaulting to 0", Env.TranscodeThreads)
+		Env.TranscodeThreads = 0
+	}
+
+	// Validate media URL settings
+	if Env.MediaURLMaxLength <= 0 {
+		logger.Warnf("Invalid MEDIA_URL_MAX_LENGTH: %d, defaulting to 8192", Env.MediaURLMaxLength)
+		Env.MediaURLMaxLength = 8192
+	}
+	if Env.MediaURLMaxLength > models.MaxVideoSourceURLLength {
+		logger.Warnf("MEDIA_URL_MAX_LENGTH %d exceeds what sources can store, capping at %d", Env.MediaURLMaxLength, models.MaxVideoSourceURLLength)
+		Env.MediaURLMaxLength = models.MaxVideoSourceURLLength
+	}
+
 	return nil
 }
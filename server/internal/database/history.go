@@ -0,0 +1,131 @@
+package database
+
+import (
+	"sync-player-server/internal/models"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// StartWatchHistory records that a room started playing a playlist item with
+// the given members present
+func StartWatchHistory(roomID uint, item *models.PlaylistItem, memberIDs []uint) (*models.WatchHistory, error) {
+	entry := &models.WatchHistory{
+		RoomID:         roomID,
+		PlaylistItemID: item.ID,
+		Title:          item.Title,
+		StartedTime:    time.Now(),
+	}
+	for _, source := range item.VideoSources {
+		entry.Sources = append(entry.Sources, models.HistorySource{URL: source.URL, Label: source.Label})
+		if entry.Duration == 0 {
+			entry.Duration = source.Duration
+		}
+	}
+
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(entry).Error; err != nil {
+			return err
+		}
+		return addWatchHistoryMembers(tx, entry.ID, memberIDs)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return entry, nil
+}
+
+// FinishWatchHistory closes the open history entry of a room, recording the
+// playback position reached and the members present at the end
+func FinishWatchHistory(roomID uint, watchedSeconds float64, memberIDs []uint) error {
+	var entry models.WatchHistory
+	err := DB.Where("room_id = ? AND ended_time IS NULL", roomID).
+		Order("started_time DESC").
+		First(&entry).Error
+	if err == gorm.ErrRecordNotFound {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if entry.Duration > 0 && watchedSeconds > entry.Duration {
+		watchedSeconds = entry.Duration
+	}
+
+	now := time.Now()
+	return DB.Transaction(func(tx *gorm.DB) error {
+		// Entries left open by earlier runs are closed as well
+		if err := tx.Model(&models.WatchHistory{}).
+			Where("room_id = ? AND ended_time IS NULL", roomID).
+			Update("ended_time", now).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Model(&models.WatchHistory{}).
+			Where("id = ?", entry.ID).
+			Update("watched_seconds", watchedSeconds).Error; err != nil {
+			return err
+		}
+
+		return addWatchHistoryMembers(tx, entry.ID, memberIDs)
+	})
+}
+
+func addWatchHistoryMembers(tx *gorm.DB, watchHistoryID uint, memberIDs []uint) error {
+	if len(memberIDs) == 0 {
+		return nil
+	}
+
+	members := make([]models.WatchHistoryMember, 0, len(memberIDs))
+	for _, userID := range memberIDs {
+		members = append(members, models.WatchHistoryMember{
+			WatchHistoryID: watchHistoryID,
+			UserID:         userID,
+		})
+	}
+	return tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&members).Error
+}
+
+// GetRoomWatchHistory retrieves a page of a room's watch history, newest first
+func GetRoomWatchHistory(roomID uint, offset, limit int) ([]models.WatchHistory, int64, error) {
+	return queryWatchHistory(DB.Where("room_id = ?", roomID), offset, limit)
+}
+
+// GetUserWatchHistory retrieves a page of the entries a user was present for, newest first
+func GetUserWatchHistory(userID uint, offset, limit int) ([]models.WatchHistory, int64, error) {
+	return queryWatchHistory(DB.Where("id IN (?)",
+		DB.Model(&models.WatchHistoryMember{}).Select("watch_history_id").Where("user_id = ?", userID),
+	), offset, limit)
+}
+
+func queryWatchHistory(query *gorm.DB, offset, limit int) ([]models.WatchHistory, int64, error) {
+	var total int64
+	if err := query.Session(&gorm.Session{}).Model(&models.WatchHistory{}).Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	entries := make([]models.WatchHistory, 0)
+	err := query.Preload("Members.User", func(db *gorm.DB) *gorm.DB {
+		// Never load password hashes
+		return db.Select("id", "username", "created_time", "last_active_time")
+	}).
+		Order("started_time DESC").
+		Offset(offset).
+		Limit(limit).
+		Find(&entries).Error
+	if err != nil {
+		return nil, 0, err
+	}
+	return entries, total, nil
+}
+
+// GetWatchHistoryByID retrieves a watch history entry with its members
+func GetWatchHistoryByID(watchHistoryID uint) (*models.WatchHistory, error) {
+	var entry models.WatchHistory
+	if err := DB.Preload("Members").First(&entry, watchHistoryID).Error; err != nil {
+		return nil, err
+	}
+	return &entry, nil
+}
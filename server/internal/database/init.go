@@ -26,14 +26,40 @@ func AutoMigrate() error {
 		&models.User{},
 		&models.Room{},
 		&models.RoomMember{},
+		&models.RoomBan{},
+		&models.RoomInvite{},
+		&models.RoomInviteRedemption{},
 		&models.PlaylistItem{},
 		&models.VideoSource{},
+		&models.SubtitleTrack{},
+		&models.Marker{},
+		&models.PlaylistVote{},
+		&models.PlaylistDeletion{},
+		&models.WatchHistory{},
+		&models.WatchHistoryMember{},
+		&models.SavedPlaylist{},
+		&models.SavedPlaylistItem{},
+		&models.MediaUpload{},
+		&models.TranscodeJob{},
 		&models.RoomPlayStatus{},
+		&models.Session{},
 	)
 	if err != nil {
 		return fmt.Errorf("failed to migrate database: %w", err)
 	}
 
+	if err := migratePlaylistOrder(); err != nil {
+		return fmt.Errorf("failed to migrate playlist order: %w", err)
+	}
+
+	if err := migrateGuestUsers(); err != nil {
+		return fmt.Errorf("failed to migrate guest users: %w", err)
+	}
+
+	if err := migrateMemberRoles(); err != nil {
+		return fmt.Errorf("failed to migrate member roles: %w", err)
+	}
+
 	config.Logger.Info("Database models synced")
 	return nil
 }
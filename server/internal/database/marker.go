@@ -0,0 +1,70 @@
+package database
+
+import (
+	"sync-player-server/internal/models"
+
+	"gorm.io/gorm"
+)
+
+// CreateMarker creates a marker on a playlist item
+func CreateMarker(marker *models.Marker) error {
+	return DB.Create(marker).Error
+}
+
+// GetMarkerByID retrieves a marker with its playlist item
+func GetMarkerByID(markerID uint) (*models.Marker, error) {
+	var marker models.Marker
+	if err := DB.Preload("PlaylistItem").First(&marker, markerID).Error; err != nil {
+		return nil, err
+	}
+	return &marker, nil
+}
+
+// GetMarkersByPlaylistItemID retrieves the markers of a playlist item ordered by time
+func GetMarkersByPlaylistItemID(playlistItemID uint, markerType *models.MarkerType) ([]models.Marker, error) {
+	var markers []models.Marker
+
+	query := DB.Where("playlist_item_id = ?", playlistItemID)
+	if markerType != nil {
+		query = query.Where("type = ?", *markerType)
+	}
+
+	// Never load the password hash of the author
+	err := query.Preload("User", func(db *gorm.DB) *gorm.DB {
+		return db.Select("id", "username", "created_time", "last_active_time")
+	}).
+		Order("time ASC").
+		Find(&markers).Error
+	if err != nil {
+		return nil, err
+	}
+	return markers, nil
+}
+
+// UpdateMarker updates the given columns of a marker
+func UpdateMarker(markerID uint, data map[string]interface{}) error {
+	return DB.Model(&models.Marker{}).Where("id = ?", markerID).Updates(data).Error
+}
+
+// DeleteMarker deletes a marker
+func DeleteMarker(markerID uint) error {
+	return DB.Delete(&models.Marker{}, markerID).Error
+}
+
+// ReplaceChapterMarkers creates chapter markers for a playlist item in a
+// transaction, removing its existing chapters first when replace is set
+func ReplaceChapterMarkers(playlistItemID uint, markers []models.Marker, replace bool) error {
+	return DB.Transaction(func(tx *gorm.DB) error {
+		if replace {
+			if err := tx.Where("playlist_item_id = ? AND type = ?", playlistItemID, models.MarkerTypeChapter).
+				Delete(&models.Marker{}).Error; err != nil {
+				return err
+			}
+		}
+
+		if len(markers) == 0 {
+			return nil
+		}
+		return tx.Create(&markers).Error
+	})
+}
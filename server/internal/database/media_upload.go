@@ -0,0 +1,137 @@
+package database
+
+import (
+	"errors"
+	"sync-player-server/internal/models"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// ErrUploadOffsetConflict is returned when an upload moved on since its offset was read
+var ErrUploadOffsetConflict = errors.New("upload offset changed concurrently")
+
+// CreateMediaUpload creates a new media upload
+func CreateMediaUpload(upload *models.MediaUpload, tx ...*gorm.DB) error {
+	return getDB(tx...).Create(upload).Error
+}
+
+// GetMediaUploadByID retrieves a media upload by ID
+func GetMediaUploadByID(uploadID uint) (*models.MediaUpload, error) {
+	var upload models.MediaUpload
+	if err := DB.First(&upload, uploadID).Error; err != nil {
+		return nil, err
+	}
+	return &upload, nil
+}
+
+// GetMediaUploadByKey retrieves a media upload by its key
+func GetMediaUploadByKey(uploadKey string) (*models.MediaUpload, error) {
+	var upload models.MediaUpload
+	if err := DB.Where("upload_key = ?", uploadKey).First(&upload).Error; err != nil {
+		return nil, err
+	}
+	return &upload, nil
+}
+
+// GetMediaUploadsByUserID retrieves the uploads of a user, newest first
+func GetMediaUploadsByUserID(userID uint) ([]models.MediaUpload, error) {
+	var uploads []models.MediaUpload
+	if err := DB.Where("user_id = ?", userID).
+		Order("id DESC").
+		Find(&uploads).Error; err != nil {
+		return nil, err
+	}
+	return uploads, nil
+}
+
+// GetMediaUploadUsage returns the bytes a user and a room have uploaded or
+// reserved for uploads in progress
+func GetMediaUploadUsage(userID, roomID uint) (int64, int64, error) {
+	var userBytes, roomBytes int64
+	if err := DB.Model(&models.MediaUpload{}).
+		Where("user_id = ?", userID).
+		Select("COALESCE(SUM(size), 0)").
+		Scan(&userBytes).Error; err != nil {
+		return 0, 0, err
+	}
+	if err := DB.Model(&models.MediaUpload{}).
+		Where("room_id = ?", roomID).
+		Select("COALESCE(SUM(size), 0)").
+		Scan(&roomBytes).Error; err != nil {
+		return 0, 0, err
+	}
+	return userBytes, roomBytes, nil
+}
+
+// AdvanceMediaUpload moves the offset of an upload forward, provided it is
+// still at from
+func AdvanceMediaUpload(uploadID uint, from, to int64) error {
+	result := DB.Model(&models.MediaUpload{}).
+		Where("id = ? AND offset = ?", uploadID, from).
+		Update("offset", to)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrUploadOffsetConflict
+	}
+	return nil
+}
+
+// CompleteMediaUpload marks an upload whose bytes all arrived as complete
+func CompleteMediaUpload(uploadID uint, mimeType string) error {
+	now := time.Now()
+	return DB.Model(&models.MediaUpload{}).
+		Where("id = ?", uploadID).
+		Updates(map[string]interface{}{
+			"status":         models.UploadStatusComplete,
+			"mime_type":      mimeType,
+			"completed_time": &now,
+		}).Error
+}
+
+// CountMediaUploadSources counts the video sources of live playlist items
+// which serve an upload
+func CountMediaUploadSources(uploadID uint) (int64, error) {
+	var count int64
+	err := DB.Model(&models.VideoSource{}).
+		Joins("JOIN playlist_items ON playlist_items.id = video_sources.playlist_item_id AND playlist_items.deleted_at IS NULL").
+		Where("video_sources.upload_id = ?", uploadID).
+		Count(&count).Error
+	return count, err
+}
+
+// DeleteMediaUpload deletes an upload together with the video sources in the
+// trash which still serve it
+func DeleteMediaUpload(uploadID uint) error {
+	return DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Unscoped().
+			Where("upload_id = ?", uploadID).
+			Delete(&models.VideoSource{}).Error; err != nil {
+			return err
+		}
+		return tx.Unscoped().Delete(&models.MediaUpload{}, uploadID).Error
+	})
+}
+
+// DeleteStaleMediaUploads deletes the uploads which did not complete and saw
+// no data since before, returning their keys so that the files can go too
+func DeleteStaleMediaUploads(before time.Time) ([]string, error) {
+	var keys []string
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		query := tx.Model(&models.MediaUpload{}).
+			Where("status = ? AND last_active_time < ?", models.UploadStatusUploading, before)
+		if err := query.Pluck("upload_key", &keys).Error; err != nil {
+			return err
+		}
+		if len(keys) == 0 {
+			return nil
+		}
+		return tx.Unscoped().Where("upload_key IN ?", keys).Delete(&models.MediaUpload{}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
@@ -1,55 +1,100 @@
 package database
 
 import (
+	"errors"
 	"sync-player-server/internal/models"
+	"sync-player-server/internal/sortkey"
+	"time"
 
 	"gorm.io/gorm"
 )
 
-// VideoSourceInput represents the input for creating a video source
+var (
+	// ErrVideoSourceNotFound is returned when a video source to change is not part of the playlist item
+	ErrVideoSourceNotFound = errors.New("video source not found in playlist item")
+	// ErrNoVideoSources is returned when a change would leave a playlist item without video sources
+	ErrNoVideoSources = errors.New("playlist item needs at least one video source")
+)
+
+// VideoSourceInput represents the input for creating a video source. The
+// fields not bound from requests are filled in for sources found by a link
+// resolver or served from an upload or a transcode job.
 type VideoSourceInput struct {
-	URL   string `json:"url"`
-	Label string `json:"label"`
+	URL     string            `json:"url"`
+	Label   string            `json:"label"`
+	Headers map[string]string `json:"headers"`
+
+	PageURL        string           `json:"-"`
+	Resolver       string           `json:"-"`
+	MediaInfo      models.MediaInfo `json:"-"`
+	UploadID       *uint            `json:"-"`
+	TranscodeJobID *uint            `json:"-"`
 }
 
-// AddItemToPlaylist adds an item to the playlist
-func AddItemToPlaylist(roomID uint, title string, sources []VideoSourceInput, tx ...*gorm.DB) (uint, error) {
-	db := getDB(tx...)
+// newVideoSource builds the video source of a playlist item from its input
+func newVideoSource(playlistItemID uint, source VideoSourceInput) *models.VideoSource {
+	return &models.VideoSource{
+		PlaylistItemID: playlistItemID,
+		URL:            source.URL,
+		Label:          source.Label,
+		ProxyHeaders:   source.Headers,
+		PageURL:        source.PageURL,
+		Resolver:       source.Resolver,
+		MediaInfo:      source.MediaInfo,
+		UploadID:       source.UploadID,
+		TranscodeJobID: source.TranscodeJobID,
+	}
+}
 
-	var maxOrderIndex *int
-	db.Model(&models.PlaylistItem{}).
-		Where("room_id = ?", roomID).
-		Select("MAX(order_index)").
-		Scan(&maxOrderIndex)
+// AddItemToPlaylist appends an item added by a member to the playlist
+func AddItemToPlaylist(roomID, userID uint, title string, sources []VideoSourceInput) (uint, error) {
+	playlistOrderMu.Lock()
+	defer playlistOrderMu.Unlock()
 
-	orderIndex := 0
-	if maxOrderIndex != nil {
-		orderIndex = *maxOrderIndex + 1
+	var playlistItemID uint
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		lastKey, err := lastSortKey(tx, roomID)
+		if err != nil {
+			return err
+		}
+		playlistItemID, _, err = appendPlaylistItem(tx, roomID, userID, title, sources, lastKey)
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return playlistItemID, nil
+}
+
+// appendPlaylistItem creates an item after the item with lastKey and returns
+// it with its sort key. The caller holds playlistOrderMu.
+func appendPlaylistItem(tx *gorm.DB, roomID, userID uint, title string, sources []VideoSourceInput, lastKey string) (uint, string, error) {
+	sortKey, err := sortkey.Between(lastKey, "")
+	if err != nil {
+		return 0, "", err
 	}
 
 	playlistItem := &models.PlaylistItem{
 		RoomID:     roomID,
+		AddedBy:    userID,
 		Title:      title,
-		OrderIndex: orderIndex,
+		SortKey:    sortKey,
 		PlayStatus: models.PlayStatusNew,
 	}
 
-	if err := db.Create(playlistItem).Error; err != nil {
-		return 0, err
+	if err := tx.Create(playlistItem).Error; err != nil {
+		return 0, "", err
 	}
 
 	for _, source := range sources {
-		videoSource := &models.VideoSource{
-			PlaylistItemID: playlistItem.ID,
-			URL:            source.URL,
-			Label:          source.Label,
-		}
-		if err := db.Create(videoSource).Error; err != nil {
-			return 0, err
+		videoSource := newVideoSource(playlistItem.ID, source)
+		if err := tx.Create(videoSource).Error; err != nil {
+			return 0, "", err
 		}
 	}
 
-	return playlistItem.ID, nil
+	return playlistItem.ID, sortKey, nil
 }
 
 // QueryPlaylistItems retrieves playlist items based on filters
@@ -67,118 +112,295 @@ func QueryPlaylistItems(roomID uint, playlistItemID *uint, playStatus *models.Pl
 	}
 
 	err := query.Preload("VideoSources").
-		Order("order_index ASC").
+		Preload("SubtitleTracks", func(db *gorm.DB) *gorm.DB {
+			return db.Omit("content").Order("id ASC")
+		}).
+		Preload("Markers", func(db *gorm.DB) *gorm.DB {
+			return db.Order("time ASC")
+		}).
+		Order("sort_key ASC, id ASC").
 		Find(&items).Error
 
 	if err != nil {
 		return nil, err
 	}
 
+	if playlistItemID == nil && playStatus == nil {
+		for i := range items {
+			items[i].OrderIndex = i
+		}
+		return items, nil
+	}
+
+	positions, err := playlistPositions(DB, roomID)
+	if err != nil {
+		return nil, err
+	}
+	for i := range items {
+		items[i].OrderIndex = positions[items[i].ID]
+	}
+
 	return items, nil
 }
 
-// DeletePlaylistItem deletes a playlist item and its video sources
-func DeletePlaylistItem(playlistItemID uint) error {
+// DeletePlaylistItem moves a playlist item of the deletion's room with its
+// video sources, subtitle tracks and markers to the trash and records the
+// deletion. Votes on the item are dropped.
+func DeletePlaylistItem(deletion *models.PlaylistDeletion, playlistItemID uint) error {
 	return DB.Transaction(func(tx *gorm.DB) error {
-		if err := tx.Where("playlist_item_id = ?", playlistItemID).Delete(&models.VideoSource{}).Error; err != nil {
+		var count int64
+		if err := tx.Model(&models.PlaylistItem{}).
+			Where("id = ? AND room_id = ?", playlistItemID, deletion.RoomID).
+			Count(&count).Error; err != nil {
 			return err
 		}
+		if count == 0 {
+			return ErrPlaylistItemNotFound
+		}
 
-		if err := tx.Delete(&models.PlaylistItem{}, playlistItemID).Error; err != nil {
+		deletion.DeletedTime = trashTime()
+		if err := trashPlaylistItems(tx, []uint{playlistItemID}, deletion.DeletedTime); err != nil {
 			return err
 		}
 
-		return nil
+		deletion.ItemCount = 1
+		return tx.Create(deletion).Error
 	})
 }
 
-// ClearPlaylist clears all playlist items in a room
-func ClearPlaylist(roomID uint) error {
+// ClearPlaylist moves all playlist items of the deletion's room to the trash
+// and records the deletion when there was anything to clear
+func ClearPlaylist(deletion *models.PlaylistDeletion) error {
 	return DB.Transaction(func(tx *gorm.DB) error {
-		var playlistItemIDs []uint
-		if err := tx.Model(&models.PlaylistItem{}).
-			Where("room_id = ?", roomID).
-			Pluck("id", &playlistItemIDs).Error; err != nil {
+		deletion.DeletedTime = trashTime()
+		count, err := clearPlaylist(tx, deletion.RoomID, deletion.DeletedTime)
+		if err != nil {
 			return err
 		}
 
-		if len(playlistItemIDs) > 0 {
-			if err := tx.Where("playlist_item_id IN ?", playlistItemIDs).Delete(&models.VideoSource{}).Error; err != nil {
+		deletion.Cleared = true
+		deletion.ItemCount = count
+		if count == 0 {
+			return nil
+		}
+		return tx.Create(deletion).Error
+	})
+}
+
+func clearPlaylist(tx *gorm.DB, roomID uint, deletedTime time.Time) (int, error) {
+	var playlistItemIDs []uint
+	if err := tx.Model(&models.PlaylistItem{}).
+		Where("room_id = ?", roomID).
+		Pluck("id", &playlistItemIDs).Error; err != nil {
+		return 0, err
+	}
+
+	if len(playlistItemIDs) == 0 {
+		return 0, nil
+	}
+
+	if err := trashPlaylistItems(tx, playlistItemIDs, deletedTime); err != nil {
+		return 0, err
+	}
+
+	return len(playlistItemIDs), nil
+}
+
+// PlaylistItemInput represents the input for creating a playlist item
+type PlaylistItemInput struct {
+	Title   string
+	Sources []VideoSourceInput
+}
+
+// ImportPlaylistItems appends items added by a member to a room's playlist in
+// a transaction, clearing the existing playlist first when replace is set
+func ImportPlaylistItems(roomID, userID uint, items []PlaylistItemInput, replace bool) ([]uint, error) {
+	playlistItemIDs := make([]uint, 0, len(items))
+
+	playlistOrderMu.Lock()
+	defer playlistOrderMu.Unlock()
+
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		if replace {
+			if _, err := clearPlaylist(tx, roomID, trashTime()); err != nil {
 				return err
 			}
 		}
 
-		if err := tx.Where("room_id = ?", roomID).Delete(&models.PlaylistItem{}).Error; err != nil {
+		lastKey, err := lastSortKey(tx, roomID)
+		if err != nil {
 			return err
 		}
 
+		for _, item := range items {
+			var playlistItemID uint
+			playlistItemID, lastKey, err = appendPlaylistItem(tx, roomID, userID, item.Title, item.Sources, lastKey)
+			if err != nil {
+				return err
+			}
+			playlistItemIDs = append(playlistItemIDs, playlistItemID)
+		}
+
 		return nil
 	})
+	if err != nil {
+		return nil, err
+	}
+
+	return playlistItemIDs, nil
 }
 
-// UpdatePlaylistItem updates a playlist item
-func UpdatePlaylistItem(playlistItemID uint, title *string, sources []VideoSourceInput, orderIndex *int) error {
-	return DB.Transaction(func(tx *gorm.DB) error {
-		updates := make(map[string]interface{})
+// VideoSourceUpdate changes the URL or label of an existing video source,
+// nil fields are left alone
+type VideoSourceUpdate struct {
+	ID      uint              `json:"id" binding:"required"`
+	URL     *string           `json:"url"`
+	Label   *string           `json:"label"`
+	Headers map[string]string `json:"headers"`
+}
+
+// PlaylistItemUpdate holds the changes to a playlist item, nil and empty
+// fields are left alone
+type PlaylistItemUpdate struct {
+	Title         *string
+	AddSources    []VideoSourceInput
+	UpdateSources []VideoSourceUpdate
+	RemoveSources []uint
+}
+
+// UpdatePlaylistItem applies changes to a playlist item of a room in a
+// transaction. Sources which are kept keep their ids, a source whose URL
+// changes loses its probed media info and health. It returns the ids of the
+// sources with a new URL. Items are moved with MovePlaylistItem.
+func UpdatePlaylistItem(roomID, playlistItemID uint, update PlaylistItemUpdate) ([]uint, error) {
+	var changedSourceIDs []uint
 
-		if title != nil {
-			updates["title"] = *title
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		var count int64
+		if err := tx.Model(&models.PlaylistItem{}).
+			Where("id = ? AND room_id = ?", playlistItemID, roomID).
+			Count(&count).Error; err != nil {
+			return err
+		}
+		if count == 0 {
+			return ErrPlaylistItemNotFound
+		}
+
+		var sourceIDs []uint
+		if err := tx.Model(&models.VideoSource{}).
+			Where("playlist_item_id = ?", playlistItemID).
+			Pluck("id", &sourceIDs).Error; err != nil {
+			return err
+		}
+		remaining := make(map[uint]bool, len(sourceIDs))
+		for _, id := range sourceIDs {
+			remaining[id] = true
 		}
 
-		if orderIndex != nil {
-			updates["order_index"] = *orderIndex
+		for _, id := range update.RemoveSources {
+			if !remaining[id] {
+				return ErrVideoSourceNotFound
+			}
+			delete(remaining, id)
+		}
+		for _, source := range update.UpdateSources {
+			if !remaining[source.ID] {
+				return ErrVideoSourceNotFound
+			}
+		}
+		if len(remaining)+len(update.AddSources) == 0 {
+			return ErrNoVideoSources
 		}
 
-		if len(updates) > 0 {
-			if err := tx.Model(&models.PlaylistItem{}).Where("id = ?", playlistItemID).Updates(updates).Error; err != nil {
+		if update.Title != nil {
+			if err := tx.Model(&models.PlaylistItem{}).
+				Where("id = ?", playlistItemID).
+				Update("title", *update.Title).Error; err != nil {
 				return err
 			}
 		}
 
-		if sources != nil {
-			if err := tx.Where("playlist_item_id = ?", playlistItemID).Delete(&models.VideoSource{}).Error; err != nil {
+		if len(update.RemoveSources) > 0 {
+			if err := tx.Where("id IN ?", update.RemoveSources).Delete(&models.VideoSource{}).Error; err != nil {
 				return err
 			}
+		}
 
-			for _, source := range sources {
-				videoSource := &models.VideoSource{
-					PlaylistItemID: playlistItemID,
-					URL:            source.URL,
-					Label:          source.Label,
+		for _, source := range update.UpdateSources {
+			if source.Label != nil {
+				if err := tx.Model(&models.VideoSource{}).
+					Where("id = ?", source.ID).
+					Update("label", *source.Label).Error; err != nil {
+					return err
 				}
-				if err := tx.Create(videoSource).Error; err != nil {
+			}
+			if source.Headers != nil {
+				if err := tx.Model(&models.VideoSource{}).
+					Where("id = ?", source.ID).
+					Select("proxy_headers").
+					Updates(&models.VideoSource{ProxyHeaders: source.Headers}).Error; err != nil {
 					return err
 				}
 			}
+			if source.URL != nil {
+				// What was resolved, probed and checked belongs to the old URL
+				result := tx.Model(&models.VideoSource{}).
+					Where("id = ? AND url <> ?", source.ID, *source.URL).
+					Select("url", "page_url", "resolver", "upload_id", "transcode_job_id", "duration", "container", "is_live", "width", "height", "video_codec", "audio_codec",
+						"variants", "audio_tracks", "chapters", "probe_status", "probe_error", "probed_time",
+						"health_status", "health_latency_ms", "health_error", "health_failures", "health_checked_time").
+					Updates(&models.VideoSource{
+						URL:          *source.URL,
+						SourceHealth: models.SourceHealth{HealthStatus: models.HealthStatusUnknown},
+					})
+				if result.Error != nil {
+					return result.Error
+				}
+				if result.RowsAffected > 0 {
+					changedSourceIDs = append(changedSourceIDs, source.ID)
+				}
+			}
 		}
 
-		return nil
-	})
-}
-
-// OrderIndexUpdate represents an order index update
-type OrderIndexUpdate struct {
-	PlaylistItemID uint `json:"playlistItemId"`
-	OrderIndex     int  `json:"orderIndex"`
-}
-
-// UpdatePlaylistOrderBatch updates multiple playlist items' order indices in a transaction
-func UpdatePlaylistOrderBatch(updates []OrderIndexUpdate) error {
-	return DB.Transaction(func(tx *gorm.DB) error {
-		for _, update := range updates {
-			if err := tx.Model(&models.PlaylistItem{}).
-				Where("id = ?", update.PlaylistItemID).
-				Update("order_index", update.OrderIndex).Error; err != nil {
+		for _, source := range update.AddSources {
+			videoSource := newVideoSource(playlistItemID, source)
+			if err := tx.Create(videoSource).Error; err != nil {
 				return err
 			}
+			changedSourceIDs = append(changedSourceIDs, videoSource.ID)
 		}
+
 		return nil
 	})
+	if err != nil {
+		return nil, err
+	}
+
+	return changedSourceIDs, nil
+}
+
+// CountQueuedItemsByMember counts the items a member queued in a room which have not been played yet
+func CountQueuedItemsByMember(roomID, userID uint) (int64, error) {
+	var count int64
+	err := DB.Model(&models.PlaylistItem{}).
+		Where("room_id = ? AND added_by = ? AND play_status = ?", roomID, userID, models.PlayStatusNew).
+		Count(&count).Error
+	return count, err
 }
 
-// UpdatePlayStatus updates the play status of a playlist item
-func UpdatePlayStatus(playlistItemID uint, playStatus models.PlayStatus) error {
+// UpdatePlayStatus updates the play status of a playlist item of a room
+func UpdatePlayStatus(roomID, playlistItemID uint, playStatus models.PlayStatus) error {
+	var count int64
+	if err := DB.Model(&models.PlaylistItem{}).
+		Where("id = ? AND room_id = ?", playlistItemID, roomID).
+		Count(&count).Error; err != nil {
+		return err
+	}
+	if count == 0 {
+		return ErrPlaylistItemNotFound
+	}
+
 	return DB.Model(&models.PlaylistItem{}).
-		Where("id = ?", playlistItemID).
+		Where("id = ? AND room_id = ?", playlistItemID, roomID).
 		Update("play_status", playStatus).Error
 }
@@ -0,0 +1,320 @@
+package database
+
+import (
+	"errors"
+	"sort"
+	"sync"
+	"sync-player-server/internal/models"
+	"sync-player-server/internal/sortkey"
+
+	"gorm.io/gorm"
+)
+
+var (
+	// ErrPlaylistItemNotFound is returned when an item to order is not part of the room playlist
+	ErrPlaylistItemNotFound = errors.New("playlist item not found in room")
+	// ErrPlaylistOrderConflict is returned when the playlist changed since the caller last saw it
+	ErrPlaylistOrderConflict = errors.New("playlist order changed concurrently")
+)
+
+// playlistOrderMu serializes every change of sort keys so that concurrent
+// adds and moves never hand out the same key. The server is the only writer
+// of the database, so a process wide lock is enough.
+var playlistOrderMu sync.Mutex
+
+type orderedItem struct {
+	ID      uint
+	SortKey string
+}
+
+// OrderIndexUpdate represents an order index update. SortKey is optional and
+// holds the key the client last saw for the item, the update conflicts when
+// the item has been moved since.
+type OrderIndexUpdate struct {
+	PlaylistItemID uint   `json:"playlistItemId" binding:"required"`
+	OrderIndex     int    `json:"orderIndex" binding:"min=0"`
+	SortKey        string `json:"sortKey"`
+}
+
+// MovePlaylistItem places an item of a room playlist right after another
+// one, or first when afterID is zero, and returns its new sort key. When
+// beforeID is set the item must end up right before that item, zero meaning
+// last, otherwise the playlist changed in between and the move conflicts.
+func MovePlaylistItem(roomID, playlistItemID, afterID uint, beforeID *uint) (string, error) {
+	playlistOrderMu.Lock()
+	defer playlistOrderMu.Unlock()
+
+	var newKey string
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		items, err := loadOrderedItems(tx, roomID)
+		if err != nil {
+			return err
+		}
+
+		rest := make([]orderedItem, 0, len(items))
+		found := false
+		for _, item := range items {
+			if item.ID == playlistItemID {
+				found = true
+				continue
+			}
+			rest = append(rest, item)
+		}
+		if !found {
+			return ErrPlaylistItemNotFound
+		}
+
+		position := 0
+		if afterID != 0 {
+			position = -1
+			for i, item := range rest {
+				if item.ID == afterID {
+					position = i + 1
+					break
+				}
+			}
+			if position < 0 {
+				return ErrPlaylistItemNotFound
+			}
+		}
+
+		if beforeID != nil {
+			var nextID uint
+			if position < len(rest) {
+				nextID = rest[position].ID
+			}
+			if nextID != *beforeID {
+				return ErrPlaylistOrderConflict
+			}
+		}
+
+		var lo, hi string
+		if position > 0 {
+			lo = rest[position-1].SortKey
+		}
+		if position < len(rest) {
+			hi = rest[position].SortKey
+		}
+		newKey, err = sortkey.Between(lo, hi)
+		if err != nil {
+			return err
+		}
+		if len(newKey) > sortkey.RebalanceLength {
+			sequence := append(rest[:position:position], append([]orderedItem{{ID: playlistItemID}}, rest[position:]...)...)
+			if err := assignSortKeys(tx, sequence); err != nil {
+				return err
+			}
+			newKey = sequence[position].SortKey
+			return nil
+		}
+
+		return tx.Model(&models.PlaylistItem{}).
+			Where("id = ?", playlistItemID).
+			Update("sort_key", newKey).Error
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return newKey, nil
+}
+
+// UpdatePlaylistOrderBatch moves items of a room playlist to the given
+// positions in a transaction. Only the moved items get new sort keys, the
+// others keep their relative order.
+func UpdatePlaylistOrderBatch(roomID uint, updates []OrderIndexUpdate) error {
+	playlistOrderMu.Lock()
+	defer playlistOrderMu.Unlock()
+
+	return DB.Transaction(func(tx *gorm.DB) error {
+		items, err := loadOrderedItems(tx, roomID)
+		if err != nil {
+			return err
+		}
+
+		keyByID := make(map[uint]string, len(items))
+		for _, item := range items {
+			keyByID[item.ID] = item.SortKey
+		}
+
+		moved := make(map[uint]bool, len(updates))
+		for _, update := range updates {
+			key, ok := keyByID[update.PlaylistItemID]
+			if !ok || moved[update.PlaylistItemID] {
+				return ErrPlaylistItemNotFound
+			}
+			if update.SortKey != "" && update.SortKey != key {
+				return ErrPlaylistOrderConflict
+			}
+			moved[update.PlaylistItemID] = true
+		}
+
+		sequence := make([]orderedItem, 0, len(items))
+		for _, item := range items {
+			if !moved[item.ID] {
+				sequence = append(sequence, item)
+			}
+		}
+
+		targets := append([]OrderIndexUpdate(nil), updates...)
+		sort.SliceStable(targets, func(i, j int) bool {
+			return targets[i].OrderIndex < targets[j].OrderIndex
+		})
+		for _, target := range targets {
+			position := target.OrderIndex
+			if position > len(sequence) {
+				position = len(sequence)
+			}
+			sequence = append(sequence[:position], append([]orderedItem{{ID: target.PlaylistItemID}}, sequence[position:]...)...)
+		}
+
+		// Key the moved items left to right between their final neighbours
+		for i := range sequence {
+			if !moved[sequence[i].ID] {
+				continue
+			}
+			var lo, hi string
+			if i > 0 {
+				lo = sequence[i-1].SortKey
+			}
+			for _, next := range sequence[i+1:] {
+				if !moved[next.ID] {
+					hi = next.SortKey
+					break
+				}
+			}
+			key, err := sortkey.Between(lo, hi)
+			if err != nil {
+				return err
+			}
+			if len(key) > sortkey.RebalanceLength {
+				return assignSortKeys(tx, sequence)
+			}
+			sequence[i].SortKey = key
+
+			if err := tx.Model(&models.PlaylistItem{}).
+				Where("id = ?", sequence[i].ID).
+				Update("sort_key", key).Error; err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+// loadOrderedItems returns the ids and sort keys of a room playlist in
+// order. Keys which do not strictly increase, for example after restoring an
+// item next to one that took its key, are handed out anew first.
+func loadOrderedItems(tx *gorm.DB, roomID uint) ([]orderedItem, error) {
+	var items []orderedItem
+	if err := tx.Model(&models.PlaylistItem{}).
+		Select("id", "sort_key").
+		Where("room_id = ?", roomID).
+		Order("sort_key ASC, id ASC").
+		Scan(&items).Error; err != nil {
+		return nil, err
+	}
+
+	for i := range items {
+		if items[i].SortKey != "" && (i == 0 || items[i].SortKey > items[i-1].SortKey) {
+			continue
+		}
+		if err := assignSortKeys(tx, items); err != nil {
+			return nil, err
+		}
+		break
+	}
+
+	return items, nil
+}
+
+// assignSortKeys gives the items increasing sort keys in their current order.
+// Moves renumber the whole room with it once a key they generate grows past
+// sortkey.RebalanceLength.
+func assignSortKeys(tx *gorm.DB, items []orderedItem) error {
+	keys, err := sortkey.Sequence(len(items))
+	if err != nil {
+		return err
+	}
+	for i := range items {
+		items[i].SortKey = keys[i]
+		if err := tx.Model(&models.PlaylistItem{}).Unscoped().
+			Where("id = ?", items[i].ID).
+			Update("sort_key", keys[i]).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// lastSortKey returns the largest sort key of a room playlist, empty when
+// the playlist is empty
+func lastSortKey(tx *gorm.DB, roomID uint) (string, error) {
+	var lastKey *string
+	if err := tx.Model(&models.PlaylistItem{}).
+		Where("room_id = ?", roomID).
+		Select("MAX(sort_key)").
+		Scan(&lastKey).Error; err != nil {
+		return "", err
+	}
+	if lastKey == nil {
+		return "", nil
+	}
+	return *lastKey, nil
+}
+
+// playlistPositions maps the items of a room playlist to their position
+func playlistPositions(tx *gorm.DB, roomID uint) (map[uint]int, error) {
+	var ids []uint
+	if err := tx.Model(&models.PlaylistItem{}).
+		Where("room_id = ?", roomID).
+		Order("sort_key ASC, id ASC").
+		Pluck("id", &ids).Error; err != nil {
+		return nil, err
+	}
+
+	positions := make(map[uint]int, len(ids))
+	for i, id := range ids {
+		positions[id] = i
+	}
+	return positions, nil
+}
+
+// migratePlaylistOrder replaces the integer order_index column of older
+// databases with sort keys in the same order
+func migratePlaylistOrder() error {
+	if !DB.Migrator().HasColumn(&models.PlaylistItem{}, "order_index") {
+		return nil
+	}
+
+	var rows []struct {
+		ID     uint
+		RoomID uint
+	}
+	if err := DB.Table("playlist_items").
+		Select("id", "room_id").
+		Order("room_id ASC, order_index ASC, id ASC").
+		Scan(&rows).Error; err != nil {
+		return err
+	}
+
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		var room []orderedItem
+		for i, row := range rows {
+			room = append(room, orderedItem{ID: row.ID})
+			if i == len(rows)-1 || rows[i+1].RoomID != row.RoomID {
+				if err := assignSortKeys(tx, room); err != nil {
+					return err
+				}
+				room = nil
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	return DB.Migrator().DropColumn(&models.PlaylistItem{}, "order_index")
+}
@@ -0,0 +1,235 @@
+package database
+
+import (
+	"errors"
+	"sync-player-server/internal/models"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+var (
+	// ErrUndoTokenInvalid is returned when an undo token does not belong to a deletion of the room
+	ErrUndoTokenInvalid = errors.New("undo token is invalid")
+	// ErrUndoTokenExpired is returned when the undo window of a deletion has passed
+	ErrUndoTokenExpired = errors.New("undo token has expired")
+)
+
+// TrashedPlaylistItem is a deleted playlist item with the video sources it
+// had when it was deleted
+type TrashedPlaylistItem struct {
+	models.PlaylistItem
+	DeletedTime time.Time `json:"deletedTime"`
+}
+
+// trashTime returns the deletion time stamped on trashed rows. It is stored
+// in UTC with millisecond precision so that every database hands back the
+// exact value that was written and rows can be matched by it.
+func trashTime() time.Time {
+	return time.Now().UTC().Truncate(time.Millisecond)
+}
+
+// trashPlaylistItems soft-deletes playlist items with their video sources,
+// subtitle tracks and markers, stamping all of them with deletedTime
+func trashPlaylistItems(tx *gorm.DB, playlistItemIDs []uint, deletedTime time.Time) error {
+	for _, model := range []interface{}{&models.VideoSource{}, &models.SubtitleTrack{}, &models.Marker{}} {
+		if err := tx.Model(model).
+			Where("playlist_item_id IN ?", playlistItemIDs).
+			Update("deleted_at", deletedTime).Error; err != nil {
+			return err
+		}
+	}
+
+	if err := tx.Where("playlist_item_id IN ?", playlistItemIDs).Delete(&models.PlaylistVote{}).Error; err != nil {
+		return err
+	}
+
+	return tx.Model(&models.PlaylistItem{}).
+		Where("id IN ?", playlistItemIDs).
+		Update("deleted_at", deletedTime).Error
+}
+
+// GetPlaylistTrash retrieves the deleted items of a room, most recently
+// deleted first
+func GetPlaylistTrash(roomID uint) ([]TrashedPlaylistItem, error) {
+	var items []models.PlaylistItem
+	if err := DB.Unscoped().
+		Where("room_id = ? AND deleted_at IS NOT NULL", roomID).
+		Order("deleted_at DESC, sort_key ASC, id ASC").
+		Find(&items).Error; err != nil {
+		return nil, err
+	}
+
+	trashed := make([]TrashedPlaylistItem, 0, len(items))
+	if len(items) == 0 {
+		return trashed, nil
+	}
+
+	ids := make([]uint, 0, len(items))
+	for _, item := range items {
+		ids = append(ids, item.ID)
+	}
+
+	// Sources removed before the item was deleted stay in the trash
+	var sources []models.VideoSource
+	if err := DB.Unscoped().
+		Where("playlist_item_id IN ? AND deleted_at IS NOT NULL", ids).
+		Order("id ASC").
+		Find(&sources).Error; err != nil {
+		return nil, err
+	}
+
+	for _, item := range items {
+		for _, source := range sources {
+			if source.PlaylistItemID == item.ID && source.DeletedAt.Time.Equal(item.DeletedAt.Time) {
+				item.VideoSources = append(item.VideoSources, source)
+			}
+		}
+		trashed = append(trashed, TrashedPlaylistItem{
+			PlaylistItem: item,
+			DeletedTime:  item.DeletedAt.Time,
+		})
+	}
+
+	return trashed, nil
+}
+
+// RestorePlaylistItems brings deleted items of a room back with the video
+// sources, subtitle tracks and markers deleted along with them. Items keep
+// their place in the playlist. An item which was playing when it was deleted
+// is queued again unless the room still plays it. It returns the restored
+// items, ids which are not in the room's trash are skipped.
+func RestorePlaylistItems(roomID uint, playlistItemIDs []uint) ([]uint, error) {
+	playlistOrderMu.Lock()
+	defer playlistOrderMu.Unlock()
+
+	var restored []uint
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		restored, err = restorePlaylistItems(tx, roomID, DB.Where("id IN ?", playlistItemIDs))
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return restored, nil
+}
+
+// UndoPlaylistDeletion restores everything a delete or clear moved to the
+// trash while its undo token is valid. The token is used up on success.
+func UndoPlaylistDeletion(roomID uint, undoToken string) (*models.PlaylistDeletion, []uint, error) {
+	playlistOrderMu.Lock()
+	defer playlistOrderMu.Unlock()
+
+	var deletion models.PlaylistDeletion
+	if err := DB.Where("undo_token = ? AND room_id = ?", undoToken, roomID).First(&deletion).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil, ErrUndoTokenInvalid
+		}
+		return nil, nil, err
+	}
+	if time.Now().After(deletion.UndoExpiresTime) {
+		return nil, nil, ErrUndoTokenExpired
+	}
+
+	var restored []uint
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		restored, err = restorePlaylistItems(tx, roomID, DB.Where("deleted_at = ?", deletion.DeletedTime))
+		if err != nil {
+			return err
+		}
+		return tx.Delete(&deletion).Error
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return &deletion, restored, nil
+}
+
+func restorePlaylistItems(tx *gorm.DB, roomID uint, filter *gorm.DB) ([]uint, error) {
+	var items []models.PlaylistItem
+	if err := tx.Unscoped().
+		Where("room_id = ? AND deleted_at IS NOT NULL", roomID).
+		Where(filter).
+		Find(&items).Error; err != nil {
+		return nil, err
+	}
+
+	var status models.RoomPlayStatus
+	tx.Where("room_id = ?", roomID).Limit(1).Find(&status)
+
+	restored := make([]uint, 0, len(items))
+	for _, item := range items {
+		for _, model := range []interface{}{&models.VideoSource{}, &models.SubtitleTrack{}, &models.Marker{}} {
+			if err := tx.Unscoped().Model(model).
+				Where("playlist_item_id = ? AND deleted_at = ?", item.ID, item.DeletedAt.Time).
+				Update("deleted_at", nil).Error; err != nil {
+				return nil, err
+			}
+		}
+
+		// Votes were dropped on deletion
+		updates := map[string]interface{}{
+			"deleted_at": nil,
+			"upvotes":    0,
+		}
+		if item.PlayStatus == models.PlayStatusPlaying && item.ID != status.VideoID {
+			updates["play_status"] = models.PlayStatusNew
+		}
+		if err := tx.Unscoped().Model(&models.PlaylistItem{}).
+			Where("id = ?", item.ID).
+			Updates(updates).Error; err != nil {
+			return nil, err
+		}
+
+		restored = append(restored, item.ID)
+	}
+
+	return restored, nil
+}
+
+// PurgePlaylistTrash permanently deletes items from the trash of a room
+// with everything that belonged to them. Nil playlistItemIDs purges the
+// whole trash, a non-zero before only items deleted before that time.
+func PurgePlaylistTrash(roomID uint, playlistItemIDs []uint, before time.Time) (int, error) {
+	var purged int
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		query := tx.Unscoped().Model(&models.PlaylistItem{}).
+			Where("room_id = ? AND deleted_at IS NOT NULL", roomID)
+		if playlistItemIDs != nil {
+			query = query.Where("id IN ?", playlistItemIDs)
+		}
+		if !before.IsZero() {
+			query = query.Where("deleted_at < ?", before)
+		}
+
+		var ids []uint
+		if err := query.Pluck("id", &ids).Error; err != nil {
+			return err
+		}
+
+		if len(ids) > 0 {
+			for _, model := range []interface{}{&models.VideoSource{}, &models.SubtitleTrack{}, &models.Marker{}} {
+				if err := tx.Unscoped().Where("playlist_item_id IN ?", ids).Delete(model).Error; err != nil {
+					return err
+				}
+			}
+			if err := tx.Unscoped().Where("id IN ?", ids).Delete(&models.PlaylistItem{}).Error; err != nil {
+				return err
+			}
+		}
+		purged = len(ids)
+
+		// Deletions whose undo window has passed are of no further use
+		return tx.Where("room_id = ? AND undo_expires_time < ?", roomID, time.Now()).
+			Delete(&models.PlaylistDeletion{}).Error
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return purged, nil
+}
@@ -1,18 +1,29 @@
 package database
 
 import (
+	"sync-player-server/internal/config"
 	"sync-player-server/internal/models"
+	"sync-player-server/internal/utils"
 
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 // CreateRoom creates a new room
 func CreateRoom(name string, password *string, tx ...*gorm.DB) (*models.Room, error) {
 	db := getDB(tx...)
 
+	passwordHash, err := hashPassword(password)
+	if err != nil {
+		return nil, err
+	}
+
 	room := &models.Room{
-		Name:         name,
-		PasswordHash: password,
+		Name:          name,
+		PasswordHash:  passwordHash,
+		Visibility:    models.RoomVisibilityUnlisted,
+		DefaultRole:   models.MemberRoleMember,
+		ControlPolicy: models.ControlPolicyEveryone,
 	}
 
 	if err := db.Create(room).Error; err != nil {
@@ -23,9 +34,23 @@ func CreateRoom(name string, password *string, tx ...*gorm.DB) (*models.Room, er
 }
 
 // GetRoomByID retrieves a room by ID
-func GetRoomByID(id uint) (*models.Room, error) {
+func GetRoomByID(id uint, tx ...*gorm.DB) (*models.Room, error) {
+	db := getDB(tx...)
+
+	var room models.Room
+	if err := db.First(&room, id).Error; err != nil {
+		return nil, err
+	}
+	return &room, nil
+}
+
+// LockRoom retrieves a room and locks its row until tx ends, so that the
+// joins of a room check its member limit one at a time. It has to be the
+// first read of tx for the reads after it to see the members added by the
+// joins it waited for.
+func LockRoom(id uint, tx *gorm.DB) (*models.Room, error) {
 	var room models.Room
-	if err := DB.First(&room, id).Error; err != nil {
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&room, id).Error; err != nil {
 		return nil, err
 	}
 	return &room, nil
@@ -40,10 +65,76 @@ func GetRoomByName(name string) (*models.Room, error) {
 	return &room, nil
 }
 
-// VerifyRoomPassword verifies if the provided password matches the room's password
-func VerifyRoomPassword(room *models.Room, password string) bool {
+// VerifyRoomPassword verifies if the provided password matches the room's
+// password, replacing a plaintext or outdated stored value with a fresh hash
+// on success
+func VerifyRoomPassword(room *models.Room, password string, tx ...*gorm.DB) bool {
 	if room.PasswordHash == nil {
 		return true
 	}
-	return password == *room.PasswordHash
+	ok, needsRehash := utils.VerifyPassword(*room.PasswordHash, password)
+	if ok && needsRehash {
+		if err := UpdateRoomPassword(room.ID, &password, tx...); err != nil {
+			config.Logger.Errorf("Failed to rehash password of room %d: %v", room.ID, err)
+		}
+	}
+	return ok
+}
+
+// UpdateRoomPassword sets the password of a room, removing it when password
+// is nil
+func UpdateRoomPassword(roomID uint, password *string, tx ...*gorm.DB) error {
+	db := getDB(tx...)
+
+	passwordHash, err := hashPassword(password)
+	if err != nil {
+		return err
+	}
+	return db.Model(&models.Room{}).Where("id = ?", roomID).Update("password_hash", passwordHash).Error
+}
+
+// UpdateRoomSettings saves the settings of a room: its capacity, visibility,
+// default role, control policy and sync tolerance
+func UpdateRoomSettings(room *models.Room) error {
+	return DB.Model(&models.Room{}).
+		Where("id = ?", room.ID).
+		Select("max_members", "visibility", "default_role", "control_policy", "sync_tolerance_seconds").
+		Updates(room).Error
+}
+
+// GetPublicRooms retrieves the public rooms, most recently active first
+func GetPublicRooms(limit int) ([]models.Room, error) {
+	var rooms []models.Room
+	if err := DB.Where("visibility = ?", models.RoomVisibilityPublic).
+		Order("last_active_time DESC").
+		Limit(limit).
+		Find(&rooms).Error; err != nil {
+		return nil, err
+	}
+	return rooms, nil
+}
+
+// CountRoomMembers counts the members of rooms by room
+func CountRoomMembers(roomIDs []uint, tx ...*gorm.DB) (map[uint]int64, error) {
+	db := getDB(tx...)
+
+	var rows []struct {
+		RoomID uint
+		Count  int64
+	}
+	counts := make(map[uint]int64, len(roomIDs))
+	if len(roomIDs) == 0 {
+		return counts, nil
+	}
+	if err := db.Model(&models.RoomMember{}).
+		Select("room_id, COUNT(*) AS count").
+		Where("room_id IN ?", roomIDs).
+		Group("room_id").
+		Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+	for _, row := range rows {
+		counts[row.RoomID] = row.Count
+	}
+	return counts, nil
 }
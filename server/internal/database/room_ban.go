@@ -0,0 +1,70 @@
+package database
+
+import (
+	"sync-player-server/internal/models"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// BanMember bans a user from a room, replacing an earlier ban, and removes
+// them from it. It returns the sessions which were in the room.
+func BanMember(ban *models.RoomBan) ([]uint, error) {
+	var sessionIDs []uint
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("room_id = ? AND user_id = ?", ban.RoomID, ban.UserID).
+			Delete(&models.RoomBan{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Create(ban).Error; err != nil {
+			return err
+		}
+		var err error
+		sessionIDs, err = KickMember(ban.RoomID, ban.UserID, tx)
+		return err
+	})
+	return sessionIDs, err
+}
+
+// KickMember removes a user from a room and takes their sessions out of it,
+// so that their tokens for it stop working. It returns those sessions.
+func KickMember(roomID, userID uint, tx ...*gorm.DB) ([]uint, error) {
+	db := getDB(tx...)
+
+	if err := RemoveMemberFromRoom(roomID, userID, db); err != nil {
+		return nil, err
+	}
+	return LeaveSessionRoom(roomID, userID, db)
+}
+
+// UnbanMember lifts the ban of a user from a room and reports whether there
+// was one
+func UnbanMember(roomID, userID uint) (bool, error) {
+	result := DB.Where("room_id = ? AND user_id = ?", roomID, userID).Delete(&models.RoomBan{})
+	return result.RowsAffected > 0, result.Error
+}
+
+// GetActiveBan retrieves the ban of a user from a room which has not expired
+func GetActiveBan(roomID, userID uint, tx ...*gorm.DB) (*models.RoomBan, error) {
+	db := getDB(tx...)
+
+	var ban models.RoomBan
+	if err := db.Where("room_id = ? AND user_id = ? AND (expires_at IS NULL OR expires_at > ?)", roomID, userID, time.Now()).
+		First(&ban).Error; err != nil {
+		return nil, err
+	}
+	return &ban, nil
+}
+
+// GetActiveBans retrieves the bans of a room which have not expired with
+// their users, most recent first
+func GetActiveBans(roomID uint) ([]models.RoomBan, error) {
+	var bans []models.RoomBan
+	if err := DB.Where("room_id = ? AND (expires_at IS NULL OR expires_at > ?)", roomID, time.Now()).
+		Preload("User").
+		Order("created_time DESC").
+		Find(&bans).Error; err != nil {
+		return nil, err
+	}
+	return bans, nil
+}
@@ -0,0 +1,74 @@
+package database
+
+import (
+	"errors"
+	"sync-player-server/internal/models"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// ErrInviteUnavailable is returned when an invite was revoked, expired or
+// used up
+var ErrInviteUnavailable = errors.New("invite is no longer available")
+
+// CreateRoomInvite creates a new invite
+func CreateRoomInvite(invite *models.RoomInvite) error {
+	return DB.Create(invite).Error
+}
+
+// GetRoomInviteByToken retrieves the invite of a token hash
+func GetRoomInviteByToken(tokenHash string) (*models.RoomInvite, error) {
+	var invite models.RoomInvite
+	if err := DB.Where("token_hash = ?", tokenHash).First(&invite).Error; err != nil {
+		return nil, err
+	}
+	return &invite, nil
+}
+
+// GetRoomInvites retrieves the invites of a room with the users who redeemed
+// them, most recent first
+func GetRoomInvites(roomID uint) ([]models.RoomInvite, error) {
+	var invites []models.RoomInvite
+	if err := DB.Where("room_id = ?", roomID).
+		Preload("Redemptions", func(db *gorm.DB) *gorm.DB {
+			return db.Order("redeemed_time ASC")
+		}).
+		Preload("Redemptions.User").
+		Order("created_time DESC").
+		Find(&invites).Error; err != nil {
+		return nil, err
+	}
+	return invites, nil
+}
+
+// RevokeRoomInvite revokes an invite of a room and reports whether there
+// was one which was not revoked yet
+func RevokeRoomInvite(roomID, inviteID uint) (bool, error) {
+	result := DB.Model(&models.RoomInvite{}).
+		Where("id = ? AND room_id = ? AND revoked_at IS NULL", inviteID, roomID).
+		Update("revoked_at", time.Now())
+	return result.RowsAffected > 0, result.Error
+}
+
+// RedeemRoomInvite uses up one use of an invite for a user and records that
+// they redeemed it. It fails with ErrInviteUnavailable when the invite was
+// revoked, expired or used up meanwhile.
+func RedeemRoomInvite(inviteID, userID uint, tx ...*gorm.DB) error {
+	db := getDB(tx...)
+
+	result := db.Model(&models.RoomInvite{}).
+		Where("id = ? AND revoked_at IS NULL AND expires_at > ? AND (max_uses = 0 OR uses < max_uses)", inviteID, time.Now()).
+		UpdateColumn("uses", gorm.Expr("uses + 1"))
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrInviteUnavailable
+	}
+
+	return db.Create(&models.RoomInviteRedemption{
+		InviteID: inviteID,
+		UserID:   userID,
+	}).Error
+}
@@ -1,20 +1,22 @@
 package database
 
 import (
+	"sort"
 	"sync-player-server/internal/models"
 
 	"gorm.io/gorm"
 )
 
-// AddMemberToRoom adds a member to a room
-func AddMemberToRoom(roomID, userID uint, isAdmin, canGrantAdmin bool, tx ...*gorm.DB) (*models.RoomMember, error) {
+// AddMemberToRoom adds a member to a room with a role
+func AddMemberToRoom(roomID, userID uint, role models.MemberRole, canGrantAdmin bool, tx ...*gorm.DB) (*models.RoomMember, error) {
 	db := getDB(tx...)
 
 	member := &models.RoomMember{
 		RoomID:        roomID,
 		UserID:        userID,
-		IsAdmin:       isAdmin,
-		CanGrantAdmin: canGrantAdmin,
+		Role:          role,
+		IsAdmin:       role.IsAdmin(),
+		CanGrantAdmin: canGrantAdmin || role == models.MemberRoleOwner,
 	}
 
 	if err := db.Create(member).Error; err != nil {
@@ -32,14 +34,60 @@ func RemoveMemberFromRoom(roomID, userID uint, tx ...*gorm.DB) error {
 }
 
 // GetRoomMember retrieves a room member
-func GetRoomMember(roomID, userID uint) (*models.RoomMember, error) {
+func GetRoomMember(roomID, userID uint, tx ...*gorm.DB) (*models.RoomMember, error) {
+	db := getDB(tx...)
+
 	var member models.RoomMember
-	if err := DB.Where("room_id = ? AND user_id = ?", roomID, userID).First(&member).Error; err != nil {
+	if err := db.Where("room_id = ? AND user_id = ?", roomID, userID).First(&member).Error; err != nil {
 		return nil, err
 	}
 	return &member, nil
 }
 
+// GetRoomMembers retrieves the members of a room with their users, highest
+// roles first
+func GetRoomMembers(roomID uint) ([]models.RoomMember, error) {
+	var members []models.RoomMember
+	if err := DB.Where("room_id = ?", roomID).
+		Preload("User").
+		Order("id ASC").
+		Find(&members).Error; err != nil {
+		return nil, err
+	}
+	sort.SliceStable(members, func(i, j int) bool {
+		return members[i].Role.Rank() > members[j].Role.Rank()
+	})
+	return members, nil
+}
+
+// UpdateMemberRole sets the role of a member. Only admins keep the right to
+// grant the admin role, which the owner always has.
+func UpdateMemberRole(roomID, userID uint, role models.MemberRole, canGrantAdmin bool, tx ...*gorm.DB) error {
+	db := getDB(tx...)
+
+	if !role.IsAdmin() {
+		canGrantAdmin = false
+	}
+	return db.Model(&models.RoomMember{}).
+		Where("room_id = ? AND user_id = ?", roomID, userID).
+		Updates(map[string]interface{}{
+			"role":            role,
+			"is_admin":        role.IsAdmin(),
+			"can_grant_admin": canGrantAdmin || role == models.MemberRoleOwner,
+		}).Error
+}
+
+// TransferRoomOwnership makes a member the owner of a room, the previous
+// owner stays on as an admin who can grant the admin role
+func TransferRoomOwnership(roomID, fromUserID, toUserID uint) error {
+	return DB.Transaction(func(tx *gorm.DB) error {
+		if err := UpdateMemberRole(roomID, fromUserID, models.MemberRoleAdmin, true, tx); err != nil {
+			return err
+		}
+		return UpdateMemberRole(roomID, toUserID, models.MemberRoleOwner, true, tx)
+	})
+}
+
 // SetMemberOnline updates the online status of a member
 func SetMemberOnline(roomID, userID uint, online bool) error {
 	return DB.Model(&models.RoomMember{}).
@@ -49,10 +97,11 @@ func SetMemberOnline(roomID, userID uint, online bool) error {
 
 // OnlineUser represents an online user with their info
 type OnlineUser struct {
-	ID       uint   `json:"id"`
-	Username string `json:"username"`
-	Online   bool   `json:"online"`
-	IsAdmin  bool   `json:"isAdmin"`
+	ID       uint              `json:"id"`
+	Username string            `json:"username"`
+	Online   bool              `json:"online"`
+	IsAdmin  bool              `json:"isAdmin"`
+	Role     models.MemberRole `json:"role"`
 }
 
 // GetOnlineUsers retrieves all online users in a room
@@ -74,9 +123,18 @@ func GetOnlineUsers(roomID uint) ([]OnlineUser, error) {
 				Username: member.User.Username,
 				Online:   member.Online,
 				IsAdmin:  member.IsAdmin,
+				Role:     member.Role,
 			})
 		}
 	}
 
 	return users, nil
 }
+
+// migrateMemberRoles gives the admins older databases recorded before roles
+// existed the admin role
+func migrateMemberRoles() error {
+	return DB.Model(&models.RoomMember{}).
+		Where("is_admin = ? AND role = ?", true, models.MemberRoleMember).
+		UpdateColumn("role", models.MemberRoleAdmin).Error
+}
@@ -67,3 +67,12 @@ func DeleteRoomPlayStatus(roomID uint, tx ...*gorm.DB) error {
 
 	return db.Where("room_id = ?", roomID).Delete(&models.RoomPlayStatus{}).Error
 }
+
+// GetRoomPlayStatusesByVideoID retrieves the play status of every room currently playing a playlist item
+func GetRoomPlayStatusesByVideoID(videoID uint) ([]models.RoomPlayStatus, error) {
+	var statuses []models.RoomPlayStatus
+	if err := DB.Where("video_id = ?", videoID).Find(&statuses).Error; err != nil {
+		return nil, err
+	}
+	return statuses, nil
+}
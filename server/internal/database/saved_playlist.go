@@ -0,0 +1,115 @@
+package database
+
+import (
+	"sync-player-server/internal/models"
+
+	"gorm.io/gorm"
+)
+
+// SaveSavedPlaylist creates a saved playlist, or overwrites the items of an
+// existing one when its ID is set
+func SaveSavedPlaylist(playlist *models.SavedPlaylist, items []models.SavedPlaylistItem) error {
+	return DB.Transaction(func(tx *gorm.DB) error {
+		if playlist.ID == 0 {
+			if err := tx.Create(playlist).Error; err != nil {
+				return err
+			}
+		} else {
+			if err := tx.Model(playlist).Update("name", playlist.Name).Error; err != nil {
+				return err
+			}
+			if err := tx.Where("saved_playlist_id = ?", playlist.ID).Delete(&models.SavedPlaylistItem{}).Error; err != nil {
+				return err
+			}
+		}
+
+		for i := range items {
+			items[i].ID = 0
+			items[i].SavedPlaylistID = playlist.ID
+			items[i].OrderIndex = i
+		}
+		if len(items) > 0 {
+			if err := tx.Create(&items).Error; err != nil {
+				return err
+			}
+		}
+		playlist.Items = items
+		return nil
+	})
+}
+
+// GetSavedPlaylistByID retrieves a saved playlist with its items
+func GetSavedPlaylistByID(savedPlaylistID uint) (*models.SavedPlaylist, error) {
+	return getSavedPlaylist(DB.Where("id = ?", savedPlaylistID))
+}
+
+// GetSavedPlaylistByShareToken retrieves a shared saved playlist with its items
+func GetSavedPlaylistByShareToken(shareToken string) (*models.SavedPlaylist, error) {
+	return getSavedPlaylist(DB.Where("share_token = ?", shareToken))
+}
+
+func getSavedPlaylist(query *gorm.DB) (*models.SavedPlaylist, error) {
+	var playlist models.SavedPlaylist
+	err := query.Preload("Items", func(db *gorm.DB) *gorm.DB {
+		return db.Order("order_index ASC")
+	}).First(&playlist).Error
+	if err != nil {
+		return nil, err
+	}
+	playlist.ItemCount = len(playlist.Items)
+	return &playlist, nil
+}
+
+// GetSavedPlaylistsByUserID retrieves the saved playlists of a user without their items
+func GetSavedPlaylistsByUserID(userID uint) ([]models.SavedPlaylist, error) {
+	playlists := make([]models.SavedPlaylist, 0)
+	if err := DB.Where("user_id = ?", userID).Order("name ASC").Find(&playlists).Error; err != nil {
+		return nil, err
+	}
+	if len(playlists) == 0 {
+		return playlists, nil
+	}
+
+	ids := make([]uint, 0, len(playlists))
+	for _, playlist := range playlists {
+		ids = append(ids, playlist.ID)
+	}
+
+	var counts []struct {
+		SavedPlaylistID uint
+		Count           int
+	}
+	if err := DB.Model(&models.SavedPlaylistItem{}).
+		Select("saved_playlist_id, COUNT(*) AS count").
+		Where("saved_playlist_id IN ?", ids).
+		Group("saved_playlist_id").
+		Scan(&counts).Error; err != nil {
+		return nil, err
+	}
+	countByID := make(map[uint]int, len(counts))
+	for _, count := range counts {
+		countByID[count.SavedPlaylistID] = count.Count
+	}
+	for i := range playlists {
+		playlists[i].ItemCount = countByID[playlists[i].ID]
+	}
+
+	return playlists, nil
+}
+
+// UpdateSavedPlaylist updates the given columns of a saved playlist
+func UpdateSavedPlaylist(savedPlaylistID uint, data map[string]interface{}) error {
+	return DB.Model(&models.SavedPlaylist{}).Where("id = ?", savedPlaylistID).Updates(data).Error
+}
+
+// DeleteSavedPlaylist deletes a saved playlist and its items
+func DeleteSavedPlaylist(savedPlaylistID uint) error {
+	return DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("saved_playlist_id = ?", savedPlaylistID).Delete(&models.SavedPlaylistItem{}).Error; err != nil {
+			return err
+		}
+		// Free the share token so that a shared link stops working right away
+		return tx.Model(&models.SavedPlaylist{}).Where("id = ?", savedPlaylistID).
+			Updates(map[string]interface{}{"share_token": nil, "deleted_at": gorm.Expr("CURRENT_TIMESTAMP")}).Error
+	})
+}
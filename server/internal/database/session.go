@@ -0,0 +1,152 @@
+package database
+
+import (
+	"errors"
+	"sync-player-server/internal/models"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// ErrRefreshTokenRotated is returned when a refresh token was exchanged
+// concurrently, by another request with the same token
+var ErrRefreshTokenRotated = errors.New("refresh token already rotated")
+
+// CreateSession creates a new session
+func CreateSession(session *models.Session, tx ...*gorm.DB) error {
+	db := getDB(tx...)
+	return db.Create(session).Error
+}
+
+// GetActiveSession retrieves a session which is neither revoked nor expired
+func GetActiveSession(sessionID uint) (*models.Session, error) {
+	var session models.Session
+	if err := DB.Where("revoked_at IS NULL AND expires_at > ?", time.Now()).
+		First(&session, sessionID).Error; err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+// GetActiveSessionsByUserID retrieves the active sessions of a user, most
+// recently used first
+func GetActiveSessionsByUserID(userID uint) ([]models.Session, error) {
+	var sessions []models.Session
+	if err := DB.Where("user_id = ? AND revoked_at IS NULL AND expires_at > ?", userID, time.Now()).
+		Order("last_used_time DESC").
+		Find(&sessions).Error; err != nil {
+		return nil, err
+	}
+	return sessions, nil
+}
+
+// GetSessionByRefreshToken retrieves the session of a refresh token hash.
+// reused reports that the hash is of the token the current one replaced.
+func GetSessionByRefreshToken(tokenHash string) (session *models.Session, reused bool, err error) {
+	var found models.Session
+	err = DB.Where("refresh_token_hash = ?", tokenHash).First(&found).Error
+	if err == nil {
+		return &found, false, nil
+	}
+	if err != gorm.ErrRecordNotFound {
+		return nil, false, err
+	}
+	if err := DB.Where("previous_token_hash = ?", tokenHash).First(&found).Error; err != nil {
+		return nil, false, err
+	}
+	return &found, true, nil
+}
+
+// RotateSessionRefreshToken replaces the refresh token of a session, as long
+// as it still is oldHash, and extends the session until expiresAt
+func RotateSessionRefreshToken(sessionID uint, oldHash, newHash string, expiresAt time.Time) error {
+	result := DB.Model(&models.Session{}).
+		Where("id = ? AND refresh_token_hash = ? AND revoked_at IS NULL", sessionID, oldHash).
+		Updates(map[string]interface{}{
+			"refresh_token_hash":  newHash,
+			"previous_token_hash": oldHash,
+			"last_used_time":      time.Now(),
+			"expires_at":          expiresAt,
+		})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrRefreshTokenRotated
+	}
+	return nil
+}
+
+// SetSessionRoom sets the room the access tokens of a session open
+func SetSessionRoom(sessionID, roomID uint, tx ...*gorm.DB) error {
+	db := getDB(tx...)
+	return db.Model(&models.Session{}).Where("id = ?", sessionID).Update("room_id", roomID).Error
+}
+
+// RevokeSession revokes a session, its tokens stop working
+func RevokeSession(sessionID uint) error {
+	return DB.Model(&models.Session{}).
+		Where("id = ? AND revoked_at IS NULL", sessionID).
+		Update("revoked_at", time.Now()).Error
+}
+
+// RevokeUserSessions revokes the active sessions of a user but exceptID and
+// returns the IDs of the sessions it revoked
+func RevokeUserSessions(userID, exceptID uint) ([]uint, error) {
+	var sessionIDs []uint
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.Session{}).
+			Where("user_id = ? AND id <> ? AND revoked_at IS NULL", userID, exceptID).
+			Pluck("id", &sessionIDs).Error; err != nil {
+			return err
+		}
+		if len(sessionIDs) == 0 {
+			return nil
+		}
+		return tx.Model(&models.Session{}).
+			Where("id IN ?", sessionIDs).
+			Update("revoked_at", time.Now()).Error
+	})
+	return sessionIDs, err
+}
+
+// LeaveSessionRoom takes the sessions of a user out of a room, so that their
+// access tokens for it stop working, and returns the IDs of those sessions
+func LeaveSessionRoom(roomID, userID uint, tx ...*gorm.DB) ([]uint, error) {
+	db := getDB(tx...)
+
+	var sessionIDs []uint
+	if err := db.Model(&models.Session{}).
+		Where("room_id = ? AND user_id = ?", roomID, userID).
+		Pluck("id", &sessionIDs).Error; err != nil {
+		return nil, err
+	}
+	if len(sessionIDs) == 0 {
+		return nil, nil
+	}
+	if err := db.Model(&models.Session{}).
+		Where("id IN ?", sessionIDs).
+		Update("room_id", 0).Error; err != nil {
+		return nil, err
+	}
+	return sessionIDs, nil
+}
+
+// FilterActiveSessionIDs returns those of sessionIDs which are active
+func FilterActiveSessionIDs(sessionIDs []uint) ([]uint, error) {
+	var active []uint
+	if len(sessionIDs) == 0 {
+		return active, nil
+	}
+	err := DB.Model(&models.Session{}).
+		Where("id IN ? AND revoked_at IS NULL AND expires_at > ?", sessionIDs, time.Now()).
+		Pluck("id", &active).Error
+	return active, err
+}
+
+// DeleteStaleSessions deletes the sessions which expired or were revoked
+// before a time
+func DeleteStaleSessions(before time.Time) error {
+	return DB.Where("expires_at < ? OR revoked_at < ?", before, before).
+		Delete(&models.Session{}).Error
+}
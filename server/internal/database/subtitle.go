@@ -0,0 +1,37 @@
+package database
+
+import (
+	"sync-player-server/internal/models"
+)
+
+// CreateSubtitleTrack creates a subtitle track for a playlist item
+func CreateSubtitleTrack(track *models.SubtitleTrack) error {
+	return DB.Create(track).Error
+}
+
+// GetSubtitleTrackByID retrieves a subtitle track, including its content, with its playlist item
+func GetSubtitleTrackByID(subtitleTrackID uint) (*models.SubtitleTrack, error) {
+	var track models.SubtitleTrack
+	if err := DB.Preload("PlaylistItem").First(&track, subtitleTrackID).Error; err != nil {
+		return nil, err
+	}
+	return &track, nil
+}
+
+// GetSubtitleTracksByPlaylistItemID retrieves the subtitle tracks of a playlist item without their content
+func GetSubtitleTracksByPlaylistItemID(playlistItemID uint) ([]models.SubtitleTrack, error) {
+	var tracks []models.SubtitleTrack
+	err := DB.Omit("content").
+		Where("playlist_item_id = ?", playlistItemID).
+		Order("id ASC").
+		Find(&tracks).Error
+	if err != nil {
+		return nil, err
+	}
+	return tracks, nil
+}
+
+// DeleteSubtitleTrack deletes a subtitle track
+func DeleteSubtitleTrack(subtitleTrackID uint) error {
+	return DB.Delete(&models.SubtitleTrack{}, subtitleTrackID).Error
+}
@@ -0,0 +1,150 @@
+package database
+
+import (
+	"sync-player-server/internal/models"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// CreateTranscodeJob creates a new transcode job
+func CreateTranscodeJob(job *models.TranscodeJob) error {
+	return DB.Create(job).Error
+}
+
+// GetTranscodeJobByID retrieves a transcode job by ID
+func GetTranscodeJobByID(jobID uint) (*models.TranscodeJob, error) {
+	var job models.TranscodeJob
+	if err := DB.First(&job, jobID).Error; err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+// GetTranscodeJobByKey retrieves a transcode job by its key
+func GetTranscodeJobByKey(jobKey string) (*models.TranscodeJob, error) {
+	var job models.TranscodeJob
+	if err := DB.Where("job_key = ?", jobKey).First(&job).Error; err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+// GetTranscodeJobsByRoomID retrieves the transcode jobs of a room, newest
+// first, optionally only those of one playlist item
+func GetTranscodeJobsByRoomID(roomID uint, playlistItemID *uint) ([]models.TranscodeJob, error) {
+	var jobs []models.TranscodeJob
+	query := DB.Where("room_id = ?", roomID)
+	if playlistItemID != nil {
+		query = query.Where("playlist_item_id = ?", *playlistItemID)
+	}
+	if err := query.Order("id DESC").Find(&jobs).Error; err != nil {
+		return nil, err
+	}
+	return jobs, nil
+}
+
+// CountActiveTranscodeJobs counts the jobs of a video source which are
+// queued or running
+func CountActiveTranscodeJobs(sourceID uint) (int64, error) {
+	var count int64
+	err := DB.Model(&models.TranscodeJob{}).
+		Where("source_id = ? AND status IN ?", sourceID,
+			[]models.TranscodeStatus{models.TranscodeStatusQueued, models.TranscodeStatusRunning}).
+		Count(&count).Error
+	return count, err
+}
+
+// ClaimNextTranscodeJob marks the oldest queued job as running and returns
+// it, nil when no job is queued
+func ClaimNextTranscodeJob() (*models.TranscodeJob, error) {
+	for {
+		var job models.TranscodeJob
+		err := DB.Where("status = ?", models.TranscodeStatusQueued).
+			Order("id ASC").
+			First(&job).Error
+		if err == gorm.ErrRecordNotFound {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		now := time.Now()
+		result := DB.Model(&models.TranscodeJob{}).
+			Where("id = ? AND status = ?", job.ID, models.TranscodeStatusQueued).
+			Updates(map[string]interface{}{
+				"status":       models.TranscodeStatusRunning,
+				"started_time": &now,
+			})
+		if result.Error != nil {
+			return nil, result.Error
+		}
+		// Another worker or a cancellation got there first
+		if result.RowsAffected == 0 {
+			continue
+		}
+
+		job.Status = models.TranscodeStatusRunning
+		job.StartedTime = &now
+		return &job, nil
+	}
+}
+
+// RequeueRunningTranscodeJobs puts the jobs which were running when the
+// server stopped back into the queue
+func RequeueRunningTranscodeJobs() (int64, error) {
+	result := DB.Model(&models.TranscodeJob{}).
+		Where("status = ?", models.TranscodeStatusRunning).
+		Updates(map[string]interface{}{
+			"status":            models.TranscodeStatusQueued,
+			"current_rendition": "",
+		})
+	return result.RowsAffected, result.Error
+}
+
+// UpdateTranscodeProgress stores the progress of a running job
+func UpdateTranscodeProgress(jobID uint, progress float64, rendition string) error {
+	return DB.Model(&models.TranscodeJob{}).
+		Where("id = ?", jobID).
+		Updates(map[string]interface{}{
+			"progress":          progress,
+			"current_rendition": rendition,
+		}).Error
+}
+
+// UpdateTranscodeDoneRenditions stores the renditions of a job which are
+// attached to its playlist item
+func UpdateTranscodeDoneRenditions(jobID uint, renditions []string) error {
+	return DB.Model(&models.TranscodeJob{}).
+		Where("id = ?", jobID).
+		Select("done_renditions").
+		Updates(&models.TranscodeJob{DoneRenditions: renditions}).Error
+}
+
+// FinishTranscodeJob records how a job ended
+func FinishTranscodeJob(jobID uint, status models.TranscodeStatus, progress float64, errMsg string) error {
+	now := time.Now()
+	return DB.Model(&models.TranscodeJob{}).
+		Where("id = ?", jobID).
+		Updates(map[string]interface{}{
+			"status":            status,
+			"progress":          progress,
+			"current_rendition": "",
+			"error":             errMsg,
+			"finished_time":     &now,
+		}).Error
+}
+
+// CancelQueuedTranscodeJob cancels a job which has not started yet and
+// reports whether it was still queued
+func CancelQueuedTranscodeJob(jobID uint) (bool, error) {
+	now := time.Now()
+	result := DB.Model(&models.TranscodeJob{}).
+		Where("id = ? AND status = ?", jobID, models.TranscodeStatusQueued).
+		Updates(map[string]interface{}{
+			"status":        models.TranscodeStatusCanceled,
+			"finished_time": &now,
+		})
+	return result.RowsAffected > 0, result.Error
+}
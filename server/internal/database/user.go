@@ -1,7 +1,10 @@
 package database
 
 import (
+	"sync-player-server/internal/config"
 	"sync-player-server/internal/models"
+	"sync-player-server/internal/utils"
+	"time"
 
 	"gorm.io/gorm"
 )
@@ -10,9 +13,15 @@ import (
 func CreateUser(username string, password *string, tx ...*gorm.DB) (*models.User, error) {
 	db := getDB(tx...)
 
+	passwordHash, err := hashPassword(password)
+	if err != nil {
+		return nil, err
+	}
+
 	user := &models.User{
 		Username:     username,
-		PasswordHash: password,
+		PasswordHash: passwordHash,
+		IsGuest:      passwordHash == nil,
 	}
 
 	if err := db.Create(user).Error; err != nil {
@@ -32,14 +41,98 @@ func GetUserByUsername(username string) (*models.User, error) {
 }
 
 // GetUserByID retrieves a user by ID
-func GetUserByID(id uint) (*models.User, error) {
+func GetUserByID(id uint, tx ...*gorm.DB) (*models.User, error) {
+	db := getDB(tx...)
+
 	var user models.User
-	if err := DB.First(&user, id).Error; err != nil {
+	if err := db.First(&user, id).Error; err != nil {
 		return nil, err
 	}
 	return &user, nil
 }
 
+// VerifyUserPassword verifies a password against the user's password,
+// replacing a plaintext or outdated stored value with a fresh hash on success
+func VerifyUserPassword(user *models.User, password string, tx ...*gorm.DB) bool {
+	if user.PasswordHash == nil {
+		return true
+	}
+	ok, needsRehash := utils.VerifyPassword(*user.PasswordHash, password)
+	if ok && needsRehash {
+		if err := UpdateUserPassword(user.ID, &password, tx...); err != nil {
+			config.Logger.Errorf("Failed to rehash password of user %d: %v", user.ID, err)
+		}
+	}
+	return ok
+}
+
+// UpdateUserPassword sets the password of a user, removing it when password
+// is nil
+func UpdateUserPassword(userID uint, password *string, tx ...*gorm.DB) error {
+	db := getDB(tx...)
+
+	passwordHash, err := hashPassword(password)
+	if err != nil {
+		return err
+	}
+	return db.Model(&models.User{}).Where("id = ?", userID).Updates(map[string]interface{}{
+		"password_hash": passwordHash,
+		"is_guest":      passwordHash == nil,
+	}).Error
+}
+
+// RecordFailedLogin counts a wrong password for a user, locking the account
+// for lockout once maxAttempts are reached in a row
+func RecordFailedLogin(userID uint, maxAttempts int, lockout time.Duration) error {
+	return DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.User{}).Where("id = ?", userID).
+			UpdateColumn("failed_login_attempts", gorm.Expr("failed_login_attempts + 1")).Error; err != nil {
+			return err
+		}
+
+		var user models.User
+		if err := tx.Select("id", "failed_login_attempts").First(&user, userID).Error; err != nil {
+			return err
+		}
+		if user.FailedLoginAttempts < maxAttempts {
+			return nil
+		}
+
+		return tx.Model(&models.User{}).Where("id = ?", userID).UpdateColumns(map[string]interface{}{
+			"failed_login_attempts": 0,
+			"locked_until":          time.Now().Add(lockout),
+		}).Error
+	})
+}
+
+// ResetFailedLogins clears the failed login count and lock of a user
+func ResetFailedLogins(userID uint) error {
+	return DB.Model(&models.User{}).Where("id = ?", userID).UpdateColumns(map[string]interface{}{
+		"failed_login_attempts": 0,
+		"locked_until":          nil,
+	}).Error
+}
+
+// migrateGuestUsers marks the accounts older databases created without a
+// password as guests
+func migrateGuestUsers() error {
+	return DB.Model(&models.User{}).
+		Where("password_hash IS NULL AND is_guest = ?", false).
+		UpdateColumn("is_guest", true).Error
+}
+
+// hashPassword hashes an optional password for storage
+func hashPassword(password *string) (*string, error) {
+	if password == nil {
+		return nil, nil
+	}
+	hash, err := utils.HashPassword(*password)
+	if err != nil {
+		return nil, err
+	}
+	return &hash, nil
+}
+
 // getDB returns the database instance to use (transaction or default)
 func getDB(tx ...*gorm.DB) *gorm.DB {
 	if len(tx) > 0 && tx[0] != nil {
@@ -0,0 +1,81 @@
+package database
+
+import (
+	"sync-player-server/internal/models"
+)
+
+// GetVideoSourcesByPlaylistItemIDs retrieves the video sources of the given playlist items
+func GetVideoSourcesByPlaylistItemIDs(playlistItemIDs []uint) ([]models.VideoSource, error) {
+	var sources []models.VideoSource
+	if len(playlistItemIDs) == 0 {
+		return sources, nil
+	}
+
+	err := DB.Where("playlist_item_id IN ?", playlistItemIDs).
+		Order("id ASC").
+		Find(&sources).Error
+	if err != nil {
+		return nil, err
+	}
+	return sources, nil
+}
+
+// UpdateVideoSourceMediaInfo stores the probed media metadata of a video source
+func UpdateVideoSourceMediaInfo(videoSourceID uint, info models.MediaInfo) error {
+	return DB.Model(&models.VideoSource{}).
+		Where("id = ?", videoSourceID).
+		Select("duration", "container", "is_live", "width", "height", "video_codec", "audio_codec",
+			"variants", "audio_tracks", "chapters", "probe_status", "probe_error", "probed_time").
+		Updates(&models.VideoSource{MediaInfo: info}).Error
+}
+
+// GetVideoSourceByID retrieves a video source with its playlist item
+func GetVideoSourceByID(videoSourceID uint) (*models.VideoSource, error) {
+	var source models.VideoSource
+	if err := DB.Preload("PlaylistItem").First(&source, videoSourceID).Error; err != nil {
+		return nil, err
+	}
+	return &source, nil
+}
+
+// GetVideoSourcesByPlaylistItemID retrieves the video sources of a playlist item in insertion order
+func GetVideoSourcesByPlaylistItemID(playlistItemID uint) ([]models.VideoSource, error) {
+	return GetVideoSourcesByPlaylistItemIDs([]uint{playlistItemID})
+}
+
+// GetActiveVideoSources retrieves the video sources of all playlist items which are not finished,
+// leaving out uploads and transcoded renditions which the server serves itself
+func GetActiveVideoSources() ([]models.VideoSource, error) {
+	var sources []models.VideoSource
+	err := DB.Joins("JOIN playlist_items ON playlist_items.id = video_sources.playlist_item_id AND playlist_items.deleted_at IS NULL").
+		Where("playlist_items.play_status <> ?", models.PlayStatusFinished).
+		Where("video_sources.upload_id IS NULL AND video_sources.transcode_job_id IS NULL").
+		Preload("PlaylistItem").
+		Order("video_sources.id ASC").
+		Find(&sources).Error
+	if err != nil {
+		return nil, err
+	}
+	return sources, nil
+}
+
+// UpdateVideoSourceHealth stores the health check result of a video source
+func UpdateVideoSourceHealth(videoSourceID uint, health models.SourceHealth) error {
+	return DB.Model(&models.VideoSource{}).
+		Where("id = ?", videoSourceID).
+		Select("health_status", "health_latency_ms", "health_error", "health_failures", "health_checked_time").
+		Updates(&models.VideoSource{SourceHealth: health}).Error
+}
+
+// GetVideoSourcesByRoomID retrieves the video sources of all items in a room playlist
+func GetVideoSourcesByRoomID(roomID uint) ([]models.VideoSource, error) {
+	var sources []models.VideoSource
+	err := DB.Joins("JOIN playlist_items ON playlist_items.id = video_sources.playlist_item_id AND playlist_items.deleted_at IS NULL").
+		Where("playlist_items.room_id = ?", roomID).
+		Order("video_sources.id ASC").
+		Find(&sources).Error
+	if err != nil {
+		return nil, err
+	}
+	return sources, nil
+}
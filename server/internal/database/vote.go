@@ -0,0 +1,108 @@
+package database
+
+import (
+	"sync-player-server/internal/models"
+
+	"gorm.io/gorm"
+)
+
+// AddPlaylistVote records a member's vote on a playlist item and returns the
+// number of votes of that type. Voting twice has no effect.
+func AddPlaylistVote(playlistItemID, userID uint, voteType models.VoteType) (int64, error) {
+	var count int64
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		vote := models.PlaylistVote{
+			PlaylistItemID: playlistItemID,
+			UserID:         userID,
+			Type:           voteType,
+		}
+		if err := tx.Where(&vote).FirstOrCreate(&vote).Error; err != nil {
+			return err
+		}
+
+		var err error
+		count, err = recountPlaylistVotes(tx, playlistItemID, voteType)
+		return err
+	})
+	return count, err
+}
+
+// RemovePlaylistVote withdraws a member's vote on a playlist item and returns
+// the number of votes of that type left
+func RemovePlaylistVote(playlistItemID, userID uint, voteType models.VoteType) (int64, error) {
+	var count int64
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("playlist_item_id = ? AND user_id = ? AND type = ?", playlistItemID, userID, voteType).
+			Delete(&models.PlaylistVote{}).Error; err != nil {
+			return err
+		}
+
+		var err error
+		count, err = recountPlaylistVotes(tx, playlistItemID, voteType)
+		return err
+	})
+	return count, err
+}
+
+// recountPlaylistVotes counts the votes of a type, keeping the upvote counter
+// of the playlist item in step so that queues can be ordered by it
+func recountPlaylistVotes(tx *gorm.DB, playlistItemID uint, voteType models.VoteType) (int64, error) {
+	var count int64
+	if err := tx.Model(&models.PlaylistVote{}).
+		Where("playlist_item_id = ? AND type = ?", playlistItemID, voteType).
+		Count(&count).Error; err != nil {
+		return 0, err
+	}
+
+	if voteType == models.VoteTypeUp {
+		if err := tx.Model(&models.PlaylistItem{}).
+			Where("id = ?", playlistItemID).
+			Update("upvotes", count).Error; err != nil {
+			return 0, err
+		}
+	}
+
+	return count, nil
+}
+
+// CountPlaylistVotes returns the number of votes of a type on a playlist item
+func CountPlaylistVotes(playlistItemID uint, voteType models.VoteType) (int64, error) {
+	var count int64
+	err := DB.Model(&models.PlaylistVote{}).
+		Where("playlist_item_id = ? AND type = ?", playlistItemID, voteType).
+		Count(&count).Error
+	return count, err
+}
+
+// GetVotedPlaylistItemIDs returns the items of a room a member voted on
+func GetVotedPlaylistItemIDs(roomID, userID uint, voteType models.VoteType) ([]uint, error) {
+	playlistItemIDs := make([]uint, 0)
+	err := DB.Model(&models.PlaylistVote{}).
+		Joins("JOIN playlist_items ON playlist_items.id = playlist_votes.playlist_item_id AND playlist_items.deleted_at IS NULL").
+		Where("playlist_items.room_id = ? AND playlist_votes.user_id = ? AND playlist_votes.type = ?", roomID, userID, voteType).
+		Pluck("playlist_votes.playlist_item_id", &playlistItemIDs).Error
+	if err != nil {
+		return nil, err
+	}
+	return playlistItemIDs, nil
+}
+
+// ClearPlaylistVotes removes all votes of a type on a playlist item
+func ClearPlaylistVotes(playlistItemID uint, voteType models.VoteType, tx ...*gorm.DB) error {
+	db := getDB(tx...)
+
+	return db.Where("playlist_item_id = ? AND type = ?", playlistItemID, voteType).
+		Delete(&models.PlaylistVote{}).Error
+}
+
+// UpdateRoomQueueMode changes how the up next order of a room is decided
+func UpdateRoomQueueMode(roomID uint, queueMode models.QueueMode, skipVoteRatio float64, maxQueuedPerMember int) error {
+	return DB.Model(&models.Room{}).
+		Where("id = ?", roomID).
+		Select("queue_mode", "skip_vote_ratio", "max_queued_per_member").
+		Updates(&models.Room{
+			QueueMode:          queueMode,
+			SkipVoteRatio:      skipVoteRatio,
+			MaxQueuedPerMember: maxQueuedPerMember,
+		}).Error
+}
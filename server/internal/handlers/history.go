@@ -0,0 +1,189 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"sync-player-server/internal/config"
+	"sync-player-server/internal/database"
+	"sync-player-server/internal/middleware"
+	"sync-player-server/internal/models"
+	"sync-player-server/internal/sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	defaultHistoryPageSize = 20
+	maxHistoryPageSize     = 100
+)
+
+// HistoryQueryRoom returns a page of the watch history of the caller's room
+func HistoryQueryRoom(c *gin.Context) {
+	userInfo, ok := middleware.GetUserInfo(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+		return
+	}
+
+	page, pageSize := historyPage(c)
+	entries, total, err := database.GetRoomWatchHistory(userInfo.RoomID, (page-1)*pageSize, pageSize)
+	if err != nil {
+		config.Logger.Errorf("Failed to query watch history: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"items":    entries,
+		"total":    total,
+		"page":     page,
+		"pageSize": pageSize,
+	})
+}
+
+// HistoryQueryUser returns a page of the playbacks the caller was present
+// for, across all rooms
+func HistoryQueryUser(c *gin.Context) {
+	userInfo, ok := middleware.GetUserInfo(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+		return
+	}
+
+	page, pageSize := historyPage(c)
+	entries, total, err := database.GetUserWatchHistory(userInfo.UserID, (page-1)*pageSize, pageSize)
+	if err != nil {
+		config.Logger.Errorf("Failed to query watch history: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"items":    entries,
+		"total":    total,
+		"page":     page,
+		"pageSize": pageSize,
+	})
+}
+
+// HistoryRequeue adds a played item back to the caller's room playlist with
+// the sources it was played from
+func HistoryRequeue(c *gin.Context) {
+	var req struct {
+		HistoryID uint `json:"historyId" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+
+	userInfo, ok := middleware.GetUserInfo(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+		return
+	}
+
+	entry, err := database.GetWatchHistoryByID(req.HistoryID)
+	if err != nil || !canAccessHistory(entry, userInfo) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "History entry not found"})
+		return
+	}
+	if len(entry.Sources) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "History entry has no video sources"})
+		return
+	}
+
+	if !checkQueueLimit(c, userInfo.RoomID, userInfo.UserID, 1, false) {
+		return
+	}
+
+	sources := make([]database.VideoSourceInput, 0, len(entry.Sources))
+	for _, source := range entry.Sources {
+		sources = append(sources, database.VideoSourceInput{URL: source.URL, Label: source.Label})
+	}
+
+	playlistItemID, err := database.AddItemToPlaylist(userInfo.RoomID, userInfo.UserID, entry.Title, sources)
+	if err != nil {
+		config.Logger.Errorf("Failed to re-queue history entry: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	probePlaylistItems(userInfo.RoomID, []uint{playlistItemID})
+
+	syncManager := sync.GetSyncManager()
+	if syncManager != nil {
+		syncManager.Broadcast(userInfo.RoomID, sync.SyncMessage{
+			Type: "updatePlaylist",
+		}, []uint{userInfo.UserID})
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":        "Item added to playlist",
+		"playlistItemId": playlistItemID,
+	})
+}
+
+// canAccessHistory reports whether an entry was played in the caller's room
+// or the caller was present for it
+func canAccessHistory(entry *models.WatchHistory, userInfo *middleware.UserInfo) bool {
+	if entry.RoomID == userInfo.RoomID {
+		return true
+	}
+	for _, member := range entry.Members {
+		if member.UserID == userInfo.UserID {
+			return true
+		}
+	}
+	return false
+}
+
+func historyPage(c *gin.Context) (int, int) {
+	page, err := strconv.Atoi(c.DefaultQuery("page", "1"))
+	if err != nil || page < 1 {
+		page = 1
+	}
+	pageSize, err := strconv.Atoi(c.DefaultQuery("pageSize", strconv.Itoa(defaultHistoryPageSize)))
+	if err != nil || pageSize < 1 {
+		pageSize = defaultHistoryPageSize
+	}
+	if pageSize > maxHistoryPageSize {
+		pageSize = maxHistoryPageSize
+	}
+	return page, pageSize
+}
+
+// recordPlaybackChange closes the history entry of what the room played
+// before and opens one for the item it plays now, zero when it stopped.
+// previous is the play status before the change and may be nil.
+func recordPlaybackChange(roomID uint, previous *models.RoomPlayStatus, playlistItemID uint) {
+	var onlineUserIDs []uint
+	syncManager := sync.GetSyncManager()
+	if syncManager != nil {
+		onlineUserIDs = syncManager.GetUserIDsInRoom(roomID)
+	}
+
+	if previous != nil && previous.VideoID != 0 {
+		watched := previous.Time
+		if !previous.Paused {
+			watched += float64(time.Now().UnixMilli()-previous.Timestamp) / 1000.0
+		}
+		if err := database.FinishWatchHistory(roomID, watched, onlineUserIDs); err != nil {
+			config.Logger.Errorf("Failed to finish watch history of room %d: %v", roomID, err)
+		}
+	}
+
+	if playlistItemID == 0 {
+		return
+	}
+
+	items, err := database.QueryPlaylistItems(roomID, &playlistItemID, nil)
+	if err != nil || len(items) == 0 {
+		return
+	}
+	if _, err := database.StartWatchHistory(roomID, &items[0], onlineUserIDs); err != nil {
+		config.Logger.Errorf("Failed to start watch history of room %d: %v", roomID, err)
+	}
+}
@@ -0,0 +1,235 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sync-player-server/internal/config"
+	"sync-player-server/internal/database"
+	"sync-player-server/internal/middleware"
+	"sync-player-server/internal/models"
+	"sync-player-server/internal/utils"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// InviteCreate handles an admin creating an invite to their room, by default
+// for the default role of the room. The token is only returned here, the
+// invite stores a hash of it.
+func InviteCreate(c *gin.Context) {
+	var req struct {
+		Role             models.MemberRole `json:"role"`
+		MaxUses          int               `json:"maxUses"`
+		ExpiresInMinutes int               `json:"expiresInMinutes"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+
+	actor, ok := middleware.GetRoomMember(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+		return
+	}
+
+	if req.Role == "" {
+		room, err := database.GetRoomByID(actor.RoomID)
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Room not found"})
+			return
+		}
+		req.Role = room.DefaultRole
+	}
+	switch {
+	case !req.Role.Valid() || req.Role == models.MemberRoleOwner:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Role must be admin, moderator, member or viewer"})
+		return
+	case req.Role == models.MemberRoleAdmin && !actor.CanGrantAdmin:
+		c.JSON(http.StatusForbidden, gin.H{"error": "Inviting admins requires the right to grant the admin role"})
+		return
+	case req.Role != models.MemberRoleAdmin && req.Role.Rank() >= actor.Role.Rank():
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only roles below your own can be assigned"})
+		return
+	}
+
+	if req.MaxUses < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Max uses must not be negative"})
+		return
+	}
+
+	maxTTL := time.Duration(config.Env.InviteMaxTTLDays) * 24 * time.Hour
+	ttl := time.Duration(config.Env.InviteDefaultTTLHours) * time.Hour
+	if req.ExpiresInMinutes != 0 {
+		ttl = time.Duration(req.ExpiresInMinutes) * time.Minute
+	}
+	if ttl <= 0 || ttl > maxTTL {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Invites expire within %d days", config.Env.InviteMaxTTLDays)})
+		return
+	}
+
+	token, err := utils.GenerateToken(32)
+	if err != nil {
+		config.Logger.Errorf("Failed to generate invite token: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	invite := &models.RoomInvite{
+		RoomID:    actor.RoomID,
+		TokenHash: utils.HashToken(token),
+		CreatedBy: actor.UserID,
+		Role:      req.Role,
+		MaxUses:   req.MaxUses,
+		ExpiresAt: time.Now().Add(ttl),
+	}
+	if err := database.CreateRoomInvite(invite); err != nil {
+		config.Logger.Errorf("Failed to create invite: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"invite": invite,
+		"token":  token,
+	})
+}
+
+// InviteList handles listing the invites of the caller's room with who
+// redeemed them
+func InviteList(c *gin.Context) {
+	userInfo, ok := middleware.GetUserInfo(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+		return
+	}
+
+	invites, err := database.GetRoomInvites(userInfo.RoomID)
+	if err != nil {
+		config.Logger.Errorf("Failed to query invites: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	c.JSON(http.StatusOK, invites)
+}
+
+// InviteRevoke handles revoking an invite of the caller's room, members who
+// joined with it stay in the room
+func InviteRevoke(c *gin.Context) {
+	var req struct {
+		InviteID uint `json:"inviteId" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+
+	userInfo, ok := middleware.GetUserInfo(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+		return
+	}
+
+	found, err := database.RevokeRoomInvite(userInfo.RoomID, req.InviteID)
+	if err != nil {
+		config.Logger.Errorf("Failed to revoke invite: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+	if !found {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Invite not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Invite revoked"})
+}
+
+// InviteJoin handles a logged in user joining a room with an invite, which
+// stands in for the room password. New members get the role of the invite
+// and use it up, members who already joined only get a token for the room.
+func InviteJoin(c *gin.Context) {
+	var req struct {
+		Token string `json:"token" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+
+	claims, ok := middleware.GetJWTClaims(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+		return
+	}
+
+	invite, err := database.GetRoomInviteByToken(utils.HashToken(req.Token))
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Invite not found"})
+			return
+		}
+		config.Logger.Errorf("Failed to query invite: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+	if invite.RevokedAt != nil || !time.Now().Before(invite.ExpiresAt) {
+		c.JSON(http.StatusGone, gin.H{"error": "Invite has expired or was revoked"})
+		return
+	}
+
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		// Concurrent joins wait here for each other so that they cannot take
+		// the room past its member limit together
+		room, err := database.LockRoom(invite.RoomID, tx)
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Room not found"})
+			return err
+		}
+
+		user, err := database.GetUserByID(claims.UserID, tx)
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+			return err
+		}
+
+		if isBanned(c, invite.RoomID, user.ID, tx) {
+			return gorm.ErrInvalidData
+		}
+
+		member, err := database.GetRoomMember(invite.RoomID, user.ID, tx)
+		if err != nil {
+			if isRoomFull(c, room, tx) {
+				return gorm.ErrInvalidData
+			}
+			if err := database.RedeemRoomInvite(invite.ID, user.ID, tx); err != nil {
+				if errors.Is(err, database.ErrInviteUnavailable) {
+					c.JSON(http.StatusGone, gin.H{"error": "Invite is used up"})
+					return err
+				}
+				config.Logger.Errorf("Failed to redeem invite: %v", err)
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+				return err
+			}
+			member, err = database.AddMemberToRoom(invite.RoomID, user.ID, invite.Role, false, tx)
+			if err != nil {
+				config.Logger.Errorf("Failed to add member to room: %v", err)
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+				return err
+			}
+		}
+
+		return respondWithRoomSession(c, user, member, claims, tx)
+	})
+
+	if err != nil {
+		return
+	}
+
+	closePreviousRoomConnections(claims, invite.RoomID)
+}
@@ -0,0 +1,70 @@
+package handlers
+
+import (
+	gosync "sync"
+	"sync-player-server/internal/config"
+	"time"
+)
+
+// loginThrottle counts failed logins per client address so that one client
+// cannot guess through many accounts, each below its own lockout. The count
+// of an address starts over a lockout period after its first failure.
+type loginThrottle struct {
+	mu       gosync.Mutex
+	failures map[string]*loginFailures
+}
+
+type loginFailures struct {
+	count int
+	since time.Time
+}
+
+// maxThrottledAddresses bounds the addresses kept before expired ones are
+// swept out
+const maxThrottledAddresses = 10000
+
+var failedLogins = &loginThrottle{failures: make(map[string]*loginFailures)}
+
+// retryAfter returns how long an address has to wait before logging in
+// again, zero when it may log in now
+func (t *loginThrottle) retryAfter(address string) time.Duration {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	entry, ok := t.failures[address]
+	if !ok || entry.count < config.Env.LoginIPMaxFailures {
+		return 0
+	}
+	remaining := time.Until(entry.since.Add(loginLockout()))
+	if remaining <= 0 {
+		delete(t.failures, address)
+		return 0
+	}
+	return remaining
+}
+
+// fail records a failed login from an address
+func (t *loginThrottle) fail(address string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := time.Now()
+	entry, ok := t.failures[address]
+	if ok && now.Before(entry.since.Add(loginLockout())) {
+		entry.count++
+		return
+	}
+
+	if len(t.failures) >= maxThrottledAddresses {
+		for key, other := range t.failures {
+			if !now.Before(other.since.Add(loginLockout())) {
+				delete(t.failures, key)
+			}
+		}
+	}
+	t.failures[address] = &loginFailures{count: 1, since: now}
+}
+
+func loginLockout() time.Duration {
+	return time.Duration(config.Env.LoginLockoutMinutes) * time.Minute
+}
@@ -0,0 +1,402 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"sync-player-server/internal/config"
+	"sync-player-server/internal/database"
+	"sync-player-server/internal/middleware"
+	"sync-player-server/internal/models"
+	"sync-player-server/internal/subtitle"
+	"sync-player-server/internal/sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	maxChapterFileBytes = 512 * 1024
+	maxImportedChapters = 500
+)
+
+// MarkerAdd adds a chapter, bookmark or skip-intro marker to a playlist item
+func MarkerAdd(c *gin.Context) {
+	var req struct {
+		PlaylistItemID uint              `json:"playlistItemId" binding:"required"`
+		Type           models.MarkerType `json:"type"`
+		Time           float64           `json:"time"`
+		EndTime        float64           `json:"endTime"`
+		Label          string            `json:"label"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+
+	userInfo, ok := middleware.GetUserInfo(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+		return
+	}
+
+	if req.Type == "" {
+		req.Type = models.MarkerTypeBookmark
+	}
+
+	marker := &models.Marker{
+		PlaylistItemID: req.PlaylistItemID,
+		UserID:         userInfo.UserID,
+		Type:           req.Type,
+		Time:           req.Time,
+		EndTime:        req.EndTime,
+		Label:          strings.TrimSpace(req.Label),
+	}
+	if err := validateMarker(marker); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if !playlistItemInRoom(req.PlaylistItemID, userInfo.RoomID) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Playlist item not found"})
+		return
+	}
+
+	if err := database.CreateMarker(marker); err != nil {
+		config.Logger.Errorf("Failed to create marker: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	broadcastMarkersUpdate(userInfo, req.PlaylistItemID)
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":  "Marker added",
+		"markerId": marker.ID,
+	})
+}
+
+// MarkerQuery lists the markers of a playlist item
+func MarkerQuery(c *gin.Context) {
+	userInfo, ok := middleware.GetUserInfo(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+		return
+	}
+
+	var playlistItemID uint
+	if _, err := fmt.Sscanf(c.Query("playlistItemId"), "%d", &playlistItemID); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid playlist item ID"})
+		return
+	}
+
+	var markerType *models.MarkerType
+	if typeStr := c.Query("type"); typeStr != "" {
+		t := models.MarkerType(typeStr)
+		markerType = &t
+	}
+
+	if !playlistItemInRoom(playlistItemID, userInfo.RoomID) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Playlist item not found"})
+		return
+	}
+
+	markers, err := database.GetMarkersByPlaylistItemID(playlistItemID, markerType)
+	if err != nil {
+		config.Logger.Errorf("Failed to query markers: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	c.JSON(http.StatusOK, markers)
+}
+
+// MarkerUpdate updates the type, time range or label of a marker
+func MarkerUpdate(c *gin.Context) {
+	var req struct {
+		MarkerID uint               `json:"markerId" binding:"required"`
+		Type     *models.MarkerType `json:"type"`
+		Time     *float64           `json:"time"`
+		EndTime  *float64           `json:"endTime"`
+		Label    *string            `json:"label"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+
+	userInfo, ok := middleware.GetUserInfo(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+		return
+	}
+
+	marker, ok := getRoomMarker(c, req.MarkerID, userInfo.RoomID)
+	if !ok {
+		return
+	}
+
+	updates := make(map[string]interface{})
+	if req.Type != nil {
+		marker.Type = *req.Type
+		updates["type"] = marker.Type
+	}
+	if req.Time != nil {
+		marker.Time = *req.Time
+		updates["time"] = marker.Time
+	}
+	if req.EndTime != nil {
+		marker.EndTime = *req.EndTime
+		updates["end_time"] = marker.EndTime
+	}
+	if req.Label != nil {
+		marker.Label = strings.TrimSpace(*req.Label)
+		updates["label"] = marker.Label
+	}
+
+	if err := validateMarker(marker); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if len(updates) > 0 {
+		if err := database.UpdateMarker(marker.ID, updates); err != nil {
+			config.Logger.Errorf("Failed to update marker: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+			return
+		}
+		broadcastMarkersUpdate(userInfo, marker.PlaylistItemID)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Marker updated"})
+}
+
+// MarkerDelete deletes a marker
+func MarkerDelete(c *gin.Context) {
+	var req struct {
+		MarkerID uint `json:"markerId" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+
+	userInfo, ok := middleware.GetUserInfo(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+		return
+	}
+
+	marker, ok := getRoomMarker(c, req.MarkerID, userInfo.RoomID)
+	if !ok {
+		return
+	}
+
+	if err := database.DeleteMarker(marker.ID); err != nil {
+		config.Logger.Errorf("Failed to delete marker: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	broadcastMarkersUpdate(userInfo, marker.PlaylistItemID)
+
+	c.JSON(http.StatusOK, gin.H{"message": "Marker deleted"})
+}
+
+// MarkerJump seeks the whole room to a marker. Skip-intro markers seek to the
+// end of the intro, all other markers to their start.
+func MarkerJump(c *gin.Context) {
+	var req struct {
+		MarkerID uint `json:"markerId" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+
+	userInfo, ok := middleware.GetUserInfo(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+		return
+	}
+
+	marker, ok := getRoomMarker(c, req.MarkerID, userInfo.RoomID)
+	if !ok {
+		return
+	}
+
+	playTime := marker.Time
+	if marker.Type == models.MarkerTypeSkipIntro {
+		playTime = marker.EndTime
+	}
+	timestamp := time.Now().UnixMilli()
+
+	config.Logger.Infof("marker jump: roomId=%d, userId=%d, markerId=%d, time=%f, videoId=%d",
+		userInfo.RoomID, userInfo.UserID, marker.ID, playTime, marker.PlaylistItemID)
+
+	// The caller has not seeked yet, so it receives the update as well
+	updateRoomPlayTime(userInfo, playTime, timestamp, marker.PlaylistItemID, nil)
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":   "Play status updated",
+		"time":      playTime,
+		"timestamp": timestamp,
+		"videoId":   marker.PlaylistItemID,
+	})
+}
+
+// MarkerImportChapters creates chapter markers from the chapters found while
+// probing the item's video sources or from an uploaded WebVTT chapters file
+func MarkerImportChapters(c *gin.Context) {
+	var req struct {
+		PlaylistItemID uint   `json:"playlistItemId" binding:"required"`
+		From           string `json:"from"`
+		Content        string `json:"content"`
+		Replace        bool   `json:"replace"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+
+	userInfo, ok := middleware.GetUserInfo(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+		return
+	}
+
+	if !playlistItemInRoom(req.PlaylistItemID, userInfo.RoomID) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Playlist item not found"})
+		return
+	}
+
+	var chapters []models.MediaChapter
+	switch req.From {
+	case "", "media":
+		sources, err := database.GetVideoSourcesByPlaylistItemID(req.PlaylistItemID)
+		if err != nil {
+			config.Logger.Errorf("Failed to query video sources: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+			return
+		}
+		for _, source := range sources {
+			if len(source.Chapters) > 0 {
+				chapters = source.Chapters
+				break
+			}
+		}
+		if len(chapters) == 0 {
+			c.JSON(http.StatusNotFound, gin.H{"error": "No chapters found in the probed media"})
+			return
+		}
+	case "webvtt":
+		if len(req.Content) > maxChapterFileBytes {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "Chapter file is too large"})
+			return
+		}
+		parsed, err := subtitle.ParseChapters([]byte(req.Content))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		for _, chapter := range parsed {
+			chapters = append(chapters, models.MediaChapter{
+				Start: chapter.Start,
+				End:   chapter.End,
+				Title: chapter.Title,
+			})
+		}
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "From must be media or webvtt"})
+		return
+	}
+
+	if len(chapters) > maxImportedChapters {
+		chapters = chapters[:maxImportedChapters]
+	}
+
+	markers := make([]models.Marker, 0, len(chapters))
+	for i, chapter := range chapters {
+		label := truncateString(strings.TrimSpace(chapter.Title), 255)
+		if label == "" {
+			label = fmt.Sprintf("Chapter %d", i+1)
+		}
+		endTime := chapter.End
+		if endTime <= chapter.Start {
+			endTime = 0
+		}
+		markers = append(markers, models.Marker{
+			PlaylistItemID: req.PlaylistItemID,
+			UserID:         userInfo.UserID,
+			Type:           models.MarkerTypeChapter,
+			Time:           chapter.Start,
+			EndTime:        endTime,
+			Label:          label,
+		})
+	}
+
+	if err := database.ReplaceChapterMarkers(req.PlaylistItemID, markers, req.Replace); err != nil {
+		config.Logger.Errorf("Failed to import chapters: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	broadcastMarkersUpdate(userInfo, req.PlaylistItemID)
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":  "Chapters imported",
+		"imported": len(markers),
+	})
+}
+
+// getRoomMarker loads a marker and makes sure it belongs to the given room,
+// writing a not found response otherwise
+func getRoomMarker(c *gin.Context, markerID, roomID uint) (*models.Marker, bool) {
+	marker, err := database.GetMarkerByID(markerID)
+	if err != nil || marker.PlaylistItem == nil || marker.PlaylistItem.RoomID != roomID {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Marker not found"})
+		return nil, false
+	}
+	return marker, true
+}
+
+func validateMarker(marker *models.Marker) error {
+	switch marker.Type {
+	case models.MarkerTypeChapter, models.MarkerTypeBookmark, models.MarkerTypeSkipIntro:
+	default:
+		return fmt.Errorf("type must be chapter, bookmark or skip-intro")
+	}
+
+	if marker.Time < 0 {
+		return fmt.Errorf("time must not be negative")
+	}
+	if marker.EndTime != 0 && marker.EndTime <= marker.Time {
+		return fmt.Errorf("end time must be after the start time")
+	}
+	if marker.Type == models.MarkerTypeSkipIntro && marker.EndTime == 0 {
+		return fmt.Errorf("skip-intro markers need an end time")
+	}
+	if len([]rune(marker.Label)) > 255 {
+		return fmt.Errorf("label is too long")
+	}
+	return nil
+}
+
+func broadcastMarkersUpdate(userInfo *middleware.UserInfo, playlistItemID uint) {
+	syncManager := sync.GetSyncManager()
+	if syncManager != nil {
+		syncManager.Broadcast(userInfo.RoomID, sync.SyncMessage{
+			Type: "updateMarkers",
+			Payload: map[string]interface{}{
+				"roomId":         userInfo.RoomID,
+				"userId":         userInfo.UserID,
+				"playlistItemId": playlistItemID,
+			},
+		}, []uint{userInfo.UserID})
+	}
+}
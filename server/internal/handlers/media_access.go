@@ -0,0 +1,68 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"sync-player-server/internal/config"
+	"sync-player-server/internal/mediaurl"
+	"sync-player-server/internal/middleware"
+	"sync-player-server/internal/models"
+	"sync-player-server/internal/proxy"
+
+	"github.com/gin-gonic/gin"
+)
+
+// authorizeMedia checks the access token of a media request against scope,
+// writing the error response when it does not open it. Tokens bound to a
+// user only work with a room token of that user in the token's room, since
+// the user and room in the media token can be read by whoever holds the URL.
+func authorizeMedia(c *gin.Context, scope, token string) (*mediaurl.Claims, bool) {
+	claims, err := mediaurl.GetSigner().Verify(token, scope)
+	if err != nil {
+		if errors.Is(err, mediaurl.ErrExpiredToken) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Media URL expired"})
+		} else {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Invalid media URL"})
+		}
+		return nil, false
+	}
+
+	if claims.UserID != 0 {
+		userInfo, ok := middleware.GetUserInfo(c)
+		if !ok {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+			return nil, false
+		}
+		if userInfo.UserID != claims.UserID || userInfo.RoomID != claims.RoomID {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Invalid media URL"})
+			return nil, false
+		}
+	}
+
+	return claims, true
+}
+
+// signPlaylistSources mints access tokens into the URLs of the sources the
+// server hosts and fills in the proxy URL of the others
+func signPlaylistSources(userInfo *middleware.UserInfo, items []models.PlaylistItem) {
+	signer := mediaurl.GetSigner()
+	var userID uint
+	if config.Env.MediaURLBindUser {
+		userID = userInfo.UserID
+	}
+	proxied := proxy.GetProxy() != nil
+
+	for i := range items {
+		for j := range items[i].VideoSources {
+			signer.SignSource(&items[i].VideoSources[j], userInfo.RoomID, userID, proxied)
+		}
+	}
+}
+
+// signedSource returns a copy of a source with the URLs of the room, which
+// messages to the whole room carry since they are not bound to one user
+func signedSource(source *models.VideoSource, roomID uint) models.VideoSource {
+	signed := *source
+	mediaurl.GetSigner().SignSource(&signed, roomID, 0, proxy.GetProxy() != nil)
+	return signed
+}
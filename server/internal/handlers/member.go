@@ -0,0 +1,395 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+	"sync-player-server/internal/config"
+	"sync-player-server/internal/database"
+	"sync-player-server/internal/middleware"
+	"sync-player-server/internal/models"
+	"sync-player-server/internal/sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// MemberList handles listing the members of the caller's room with their roles
+func MemberList(c *gin.Context) {
+	userInfo, ok := middleware.GetUserInfo(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+		return
+	}
+
+	members, err := database.GetRoomMembers(userInfo.RoomID)
+	if err != nil {
+		config.Logger.Errorf("Failed to query room members: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	c.JSON(http.StatusOK, members)
+}
+
+// MemberPermissions handles querying the role of the caller in their room and
+// what it allows
+func MemberPermissions(c *gin.Context) {
+	member, ok := middleware.GetRoomMember(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"role":          member.Role,
+		"isAdmin":       member.IsAdmin,
+		"canGrantAdmin": member.CanGrantAdmin,
+		"permissions":   member.Role.Permissions(),
+	})
+}
+
+// MemberGrant handles changing the role of another member. Granting the owner
+// role hands the room over, and only the owner decides who may grant the
+// admin role.
+func MemberGrant(c *gin.Context) {
+	var req struct {
+		UserID        uint              `json:"userId" binding:"required"`
+		Role          models.MemberRole `json:"role" binding:"required"`
+		CanGrantAdmin *bool             `json:"canGrantAdmin"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+
+	if !req.Role.Valid() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Role must be owner, admin, moderator, member or viewer"})
+		return
+	}
+
+	changeMemberRole(c, req.UserID, req.Role, req.CanGrantAdmin)
+}
+
+// MemberRevoke handles taking the role of another member back to member
+func MemberRevoke(c *gin.Context) {
+	var req struct {
+		UserID uint `json:"userId" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+
+	changeMemberRole(c, req.UserID, models.MemberRoleMember, nil)
+}
+
+// changeMemberRole changes the role of a member of the caller's room, as far
+// as the role of the caller allows, and tells the room about it
+func changeMemberRole(c *gin.Context, userID uint, role models.MemberRole, canGrantAdmin *bool) {
+	actor, ok := middleware.GetRoomMember(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+		return
+	}
+
+	if userID == actor.UserID {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "You cannot change your own role"})
+		return
+	}
+
+	target, err := database.GetRoomMember(actor.RoomID, userID)
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Member not found"})
+			return
+		}
+		config.Logger.Errorf("Failed to query room member: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	// Admins are granted and revoked by who has the right to, the other roles
+	// by who ranks above both the current and the new role
+	isOwner := actor.Role == models.MemberRoleOwner
+	adminChange := role == models.MemberRoleAdmin || target.Role == models.MemberRoleAdmin
+	switch {
+	case target.Role == models.MemberRoleOwner:
+		c.JSON(http.StatusForbidden, gin.H{"error": "The owner's role cannot be changed"})
+		return
+	case role == models.MemberRoleOwner && !isOwner:
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only the owner can transfer ownership"})
+		return
+	case canGrantAdmin != nil && !isOwner:
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only the owner decides who can grant the admin role"})
+		return
+	case target.CanGrantAdmin && !isOwner:
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only the owner can change admins who can grant the admin role"})
+		return
+	case adminChange && !actor.CanGrantAdmin:
+		c.JSON(http.StatusForbidden, gin.H{"error": "Granting or revoking the admin role requires the right to grant it"})
+		return
+	case !adminChange && role != models.MemberRoleOwner &&
+		(role.Rank() >= actor.Role.Rank() || target.Role.Rank() >= actor.Role.Rank()):
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only roles below your own can be assigned"})
+		return
+	}
+
+	grant := target.CanGrantAdmin
+	if canGrantAdmin != nil {
+		grant = *canGrantAdmin
+	}
+
+	if role == models.MemberRoleOwner {
+		err = database.TransferRoomOwnership(actor.RoomID, actor.UserID, target.UserID)
+	} else {
+		err = database.UpdateMemberRole(actor.RoomID, target.UserID, role, grant)
+	}
+	if err != nil {
+		config.Logger.Errorf("Failed to update member role: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	updated, err := database.GetRoomMember(actor.RoomID, target.UserID)
+	if err != nil {
+		config.Logger.Errorf("Failed to query room member: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	broadcastRoleChange(actor, target.Role, updated)
+	if role == models.MemberRoleOwner {
+		if previous, err := database.GetRoomMember(actor.RoomID, actor.UserID); err == nil {
+			broadcastRoleChange(actor, actor.Role, previous)
+		}
+	}
+
+	c.JSON(http.StatusOK, updated)
+}
+
+// broadcastRoleChange tells the room, the member included, that the role of
+// a member changed
+func broadcastRoleChange(actor *models.RoomMember, previousRole models.MemberRole, member *models.RoomMember) {
+	syncManager := sync.GetSyncManager()
+	if syncManager == nil {
+		return
+	}
+	syncManager.Broadcast(member.RoomID, sync.SyncMessage{
+		Type: "memberRoleChanged",
+		Payload: map[string]interface{}{
+			"roomId":        member.RoomID,
+			"userId":        member.UserID,
+			"role":          member.Role,
+			"previousRole":  previousRole,
+			"isAdmin":       member.IsAdmin,
+			"canGrantAdmin": member.CanGrantAdmin,
+			"permissions":   member.Role.Permissions(),
+			"changedBy":     actor.UserID,
+		},
+	}, nil)
+}
+
+// memberCan reports whether a user is a member of a room whose role grants
+// a permission
+func memberCan(roomID, userID uint, permission models.Permission) bool {
+	member, err := database.GetRoomMember(roomID, userID)
+	return err == nil && member.Role.Can(permission)
+}
+
+// maxBanReasonLength matches the reason column of room bans
+const maxBanReasonLength = 255
+
+// MemberKick handles removing a member ranked below the caller from the room.
+// Their connections are closed and their tokens stop opening the room, but
+// they may join again.
+func MemberKick(c *gin.Context) {
+	var req struct {
+		UserID uint   `json:"userId" binding:"required"`
+		Reason string `json:"reason"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+
+	actor, target, ok := getRemovableMember(c, req.UserID)
+	if !ok {
+		return
+	}
+
+	reason := truncateString(strings.TrimSpace(req.Reason), maxBanReasonLength)
+	if _, err := database.KickMember(target.RoomID, target.UserID); err != nil {
+		config.Logger.Errorf("Failed to kick member: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	removeMemberConnections(actor, target, "kick", reason)
+
+	c.JSON(http.StatusOK, gin.H{"message": "Member kicked"})
+}
+
+// MemberBan handles removing a member ranked below the caller from the room
+// and keeping them out of it, for durationMinutes or, without it, until
+// they are unbanned
+func MemberBan(c *gin.Context) {
+	var req struct {
+		UserID          uint   `json:"userId" binding:"required"`
+		Reason          string `json:"reason"`
+		DurationMinutes int    `json:"durationMinutes"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+
+	if req.DurationMinutes < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Duration must not be negative"})
+		return
+	}
+
+	actor, target, ok := getRemovableMember(c, req.UserID)
+	if !ok {
+		return
+	}
+
+	ban := &models.RoomBan{
+		RoomID:   target.RoomID,
+		UserID:   target.UserID,
+		BannedBy: actor.UserID,
+		Reason:   truncateString(strings.TrimSpace(req.Reason), maxBanReasonLength),
+	}
+	if req.DurationMinutes > 0 {
+		expiresAt := time.Now().Add(time.Duration(req.DurationMinutes) * time.Minute)
+		ban.ExpiresAt = &expiresAt
+	}
+
+	if _, err := database.BanMember(ban); err != nil {
+		config.Logger.Errorf("Failed to ban member: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	removeMemberConnections(actor, target, "ban", ban.Reason)
+
+	c.JSON(http.StatusOK, ban)
+}
+
+// MemberUnban handles lifting the ban of a user from the caller's room
+func MemberUnban(c *gin.Context) {
+	var req struct {
+		UserID uint `json:"userId" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+
+	userInfo, ok := middleware.GetUserInfo(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+		return
+	}
+
+	found, err := database.UnbanMember(userInfo.RoomID, req.UserID)
+	if err != nil {
+		config.Logger.Errorf("Failed to unban member: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+	if !found {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Ban not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Ban lifted"})
+}
+
+// MemberBans handles listing the bans of the caller's room which have not
+// expired
+func MemberBans(c *gin.Context) {
+	userInfo, ok := middleware.GetUserInfo(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+		return
+	}
+
+	bans, err := database.GetActiveBans(userInfo.RoomID)
+	if err != nil {
+		config.Logger.Errorf("Failed to query room bans: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	c.JSON(http.StatusOK, bans)
+}
+
+// getRemovableMember retrieves a member of the caller's room whom the caller
+// outranks, and so may kick or ban
+func getRemovableMember(c *gin.Context, userID uint) (actor, target *models.RoomMember, ok bool) {
+	actor, ok = middleware.GetRoomMember(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+		return nil, nil, false
+	}
+
+	if userID == actor.UserID {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "You cannot remove yourself, leave the room instead"})
+		return nil, nil, false
+	}
+
+	target, err := database.GetRoomMember(actor.RoomID, userID)
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Member not found"})
+			return nil, nil, false
+		}
+		config.Logger.Errorf("Failed to query room member: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return nil, nil, false
+	}
+
+	if target.Role.Rank() >= actor.Role.Rank() {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only members ranked below you can be removed"})
+		return nil, nil, false
+	}
+	return actor, target, true
+}
+
+// removeMemberConnections closes the connections of a member who was kicked
+// or banned, telling them why, and tells the rest of the room
+func removeMemberConnections(actor, target *models.RoomMember, action, reason string) {
+	message := "Kicked from the room"
+	if action == "ban" {
+		message = "Banned from the room"
+	}
+	if reason != "" {
+		message += ": " + reason
+	}
+
+	syncManager := sync.GetSyncManager()
+	if syncManager == nil {
+		return
+	}
+	syncManager.CloseConnections(sync.ConnectionFilter{
+		RoomID: target.RoomID,
+		UserID: target.UserID,
+	}, message)
+
+	syncManager.Broadcast(target.RoomID, sync.SyncMessage{
+		Type: "memberRemoved",
+		Payload: map[string]interface{}{
+			"roomId":    target.RoomID,
+			"userId":    target.UserID,
+			"action":    action,
+			"reason":    reason,
+			"removedBy": actor.UserID,
+		},
+	}, nil)
+}
@@ -1,10 +1,12 @@
 package handlers
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
 	"sync-player-server/internal/config"
 	"sync-player-server/internal/database"
+	"sync-player-server/internal/health"
 	"sync-player-server/internal/middleware"
 	"sync-player-server/internal/models"
 	"sync-player-server/internal/sync"
@@ -31,13 +33,24 @@ func PlaylistAdd(c *gin.Context) {
 		return
 	}
 
-	playlistItemID, err := database.AddItemToPlaylist(userInfo.RoomID, req.Title, req.Sources)
+	if err := validatePlaylistItem(&req.Title, req.Sources); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if !checkQueueLimit(c, userInfo.RoomID, userInfo.UserID, 1, false) {
+		return
+	}
+
+	playlistItemID, err := database.AddItemToPlaylist(userInfo.RoomID, userInfo.UserID, req.Title, req.Sources)
 	if err != nil {
 		config.Logger.Errorf("Failed to add playlist item: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
 		return
 	}
 
+	probePlaylistItems(userInfo.RoomID, []uint{playlistItemID})
+
 	syncManager := sync.GetSyncManager()
 	if syncManager != nil {
 		syncManager.Broadcast(userInfo.RoomID, sync.SyncMessage{
@@ -81,6 +94,27 @@ func PlaylistQuery(c *gin.Context) {
 		return
 	}
 
+	signPlaylistSources(userInfo, items)
+
+	// Rooms in vote and round-robin mode decide the order of their queue
+	if room, err := database.GetRoomByID(userInfo.RoomID); err == nil {
+		arrangePlaylist(room, items)
+	}
+
+	// A member's own queue
+	if addedByStr := c.Query("addedBy"); addedByStr != "" {
+		var addedBy uint
+		if _, err := fmt.Sscanf(addedByStr, "%d", &addedBy); err == nil {
+			memberItems := make([]models.PlaylistItem, 0)
+			for _, item := range items {
+				if item.AddedBy == addedBy {
+					memberItems = append(memberItems, item)
+				}
+			}
+			items = memberItems
+		}
+	}
+
 	// If no playStatus filter is specified, filter out finished items on the server side
 	if playStatus == nil {
 		filteredItems := make([]models.PlaylistItem, 0)
@@ -96,7 +130,7 @@ func PlaylistQuery(c *gin.Context) {
 	c.JSON(http.StatusOK, items)
 }
 
-// PlaylistDelete deletes a playlist item
+// PlaylistDelete moves a playlist item to the trash
 func PlaylistDelete(c *gin.Context) {
 	var req struct {
 		PlaylistItemID uint `json:"playlistItemId" binding:"required"`
@@ -113,7 +147,28 @@ func PlaylistDelete(c *gin.Context) {
 		return
 	}
 
-	if err := database.DeletePlaylistItem(req.PlaylistItemID); err != nil {
+	items, err := database.QueryPlaylistItems(userInfo.RoomID, &req.PlaylistItemID, nil)
+	if err != nil || len(items) == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Playlist item not found"})
+		return
+	}
+	if !canEditPlaylistItem(userInfo, &items[0]) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only the member who added the item or a moderator can delete it"})
+		return
+	}
+
+	deletion, err := newPlaylistDeletion(userInfo)
+	if err != nil {
+		config.Logger.Errorf("Failed to generate undo token: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	if err := database.DeletePlaylistItem(deletion, req.PlaylistItemID); err != nil {
+		if errors.Is(err, database.ErrPlaylistItemNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Playlist item not found"})
+			return
+		}
 		config.Logger.Errorf("Failed to delete playlist item: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"message": "Internal server error"})
 		return
@@ -126,10 +181,14 @@ func PlaylistDelete(c *gin.Context) {
 		}, []uint{userInfo.UserID})
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "Item deleted from playlist"})
+	c.JSON(http.StatusOK, gin.H{
+		"message":         "Item deleted from playlist",
+		"undoToken":       deletion.UndoToken,
+		"undoExpiresTime": deletion.UndoExpiresTime,
+	})
 }
 
-// PlaylistClear clears all playlist items
+// PlaylistClear moves all playlist items to the trash
 func PlaylistClear(c *gin.Context) {
 	userInfo, ok := middleware.GetUserInfo(c)
 	if !ok {
@@ -137,12 +196,25 @@ func PlaylistClear(c *gin.Context) {
 		return
 	}
 
-	if err := database.ClearPlaylist(userInfo.RoomID); err != nil {
+	deletion, err := newPlaylistDeletion(userInfo)
+	if err != nil {
+		config.Logger.Errorf("Failed to generate undo token: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	if err := database.ClearPlaylist(deletion); err != nil {
 		config.Logger.Errorf("Failed to clear playlist: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"message": "Internal server error"})
 		return
 	}
 
+	// Clearing an empty playlist leaves nothing to undo
+	if deletion.ItemCount == 0 {
+		c.JSON(http.StatusOK, gin.H{"message": "Playlist cleared"})
+		return
+	}
+
 	syncManager := sync.GetSyncManager()
 	if syncManager != nil {
 		syncManager.Broadcast(userInfo.RoomID, sync.SyncMessage{
@@ -150,10 +222,14 @@ func PlaylistClear(c *gin.Context) {
 		}, []uint{userInfo.UserID})
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "Playlist cleared"})
+	c.JSON(http.StatusOK, gin.H{
+		"message":         "Playlist cleared",
+		"undoToken":       deletion.UndoToken,
+		"undoExpiresTime": deletion.UndoExpiresTime,
+	})
 }
 
-// PlaylistUpdateOrder updates playlist order
+// PlaylistUpdateOrder moves playlist items to the given positions
 func PlaylistUpdateOrder(c *gin.Context) {
 	var req struct {
 		OrderIndexList []database.OrderIndexUpdate `json:"orderIndexList" binding:"required,min=1,dive"`
@@ -170,9 +246,16 @@ func PlaylistUpdateOrder(c *gin.Context) {
 		return
 	}
 
-	if err := database.UpdatePlaylistOrderBatch(req.OrderIndexList); err != nil {
-		config.Logger.Errorf("Failed to update playlist order: %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+	playlistItemIDs := make([]uint, 0, len(req.OrderIndexList))
+	for _, update := range req.OrderIndexList {
+		playlistItemIDs = append(playlistItemIDs, update.PlaylistItemID)
+	}
+	if !checkReorderAllowed(c, userInfo, playlistItemIDs) {
+		return
+	}
+
+	if err := database.UpdatePlaylistOrderBatch(userInfo.RoomID, req.OrderIndexList); err != nil {
+		writeReorderError(c, err)
 		return
 	}
 
@@ -186,10 +269,14 @@ func PlaylistUpdateOrder(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"message": "Order updated"})
 }
 
-// PlaylistSwitch switches to a playlist item
-func PlaylistSwitch(c *gin.Context) {
+// PlaylistMove places a playlist item right after another one, or first
+// when afterId is zero. Clients pass the item they saw after afterId as
+// beforeId, zero meaning none, to be told when the playlist changed meanwhile.
+func PlaylistMove(c *gin.Context) {
 	var req struct {
-		PlaylistItemID uint `json:"playlistItemId" binding:"required"`
+		PlaylistItemID uint  `json:"playlistItemId" binding:"required"`
+		AfterID        uint  `json:"afterId"`
+		BeforeID       *uint `json:"beforeId"`
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -203,39 +290,98 @@ func PlaylistSwitch(c *gin.Context) {
 		return
 	}
 
-	// Mark all currently playing items as finished
-	playingStatus := models.PlayStatusPlaying
-	playingItems, err := database.QueryPlaylistItems(userInfo.RoomID, nil, &playingStatus)
+	if req.AfterID == req.PlaylistItemID || (req.BeforeID != nil && *req.BeforeID == req.PlaylistItemID) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "An item cannot be placed next to itself"})
+		return
+	}
+
+	if !checkReorderAllowed(c, userInfo, []uint{req.PlaylistItemID}) {
+		return
+	}
+
+	sortKey, err := database.MovePlaylistItem(userInfo.RoomID, req.PlaylistItemID, req.AfterID, req.BeforeID)
 	if err != nil {
-		config.Logger.Errorf("Failed to query playing items: %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		writeReorderError(c, err)
 		return
 	}
 
-	for _, item := range playingItems {
-		if err := database.UpdatePlayStatus(item.ID, models.PlayStatusFinished); err != nil {
-			config.Logger.Errorf("Failed to update play status: %v", err)
+	syncManager := sync.GetSyncManager()
+	if syncManager != nil {
+		syncManager.Broadcast(userInfo.RoomID, sync.SyncMessage{
+			Type: "updatePlaylist",
+		}, []uint{userInfo.UserID})
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":        "Item moved",
+		"playlistItemId": req.PlaylistItemID,
+		"sortKey":        sortKey,
+	})
+}
+
+// checkReorderAllowed reports whether the queue mode of the caller's room
+// lets the caller reorder the given items, writing an error response otherwise
+func checkReorderAllowed(c *gin.Context, userInfo *middleware.UserInfo, playlistItemIDs []uint) bool {
+	room, err := database.GetRoomByID(userInfo.RoomID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Room not found"})
+		return false
+	}
+
+	switch room.QueueMode {
+	case models.QueueModeVote:
+		c.JSON(http.StatusConflict, gin.H{"error": "Playlist order is decided by votes"})
+		return false
+	case models.QueueModeRoundRobin:
+		// Members only order their own queue, the turns are fixed
+		for _, playlistItemID := range playlistItemIDs {
+			items, err := database.QueryPlaylistItems(userInfo.RoomID, &playlistItemID, nil)
+			if err != nil || len(items) == 0 || items[0].AddedBy != userInfo.UserID {
+				c.JSON(http.StatusForbidden, gin.H{"error": "Only your own items can be reordered"})
+				return false
+			}
 		}
 	}
+	return true
+}
 
-	// Set the requested item to playing
-	if err := database.UpdatePlayStatus(req.PlaylistItemID, models.PlayStatusPlaying); err != nil {
-		config.Logger.Errorf("Failed to update play status: %v", err)
+func writeReorderError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, database.ErrPlaylistItemNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Playlist item not found"})
+	case errors.Is(err, database.ErrPlaylistOrderConflict):
+		c.JSON(http.StatusConflict, gin.H{"error": "Playlist order has changed, reload the playlist and try again"})
+	default:
+		config.Logger.Errorf("Failed to update playlist order: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+	}
+}
+
+// PlaylistSwitch switches to a playlist item
+func PlaylistSwitch(c *gin.Context) {
+	var req struct {
+		PlaylistItemID uint `json:"playlistItemId" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
 		return
 	}
 
-	// Update or create room play status
-	_, err = database.GetRoomPlayStatus(userInfo.RoomID)
-	if err != nil {
-		database.CreateRoomPlayStatus(userInfo.RoomID, false, 0, time.Now().UnixMilli(), req.PlaylistItemID)
-	} else {
-		database.UpdateRoomPlayStatus(userInfo.RoomID, map[string]any{
-			"paused":    false,
-			"time":      0.0,
-			"timestamp": time.Now().UnixMilli(),
-			"video_id":  req.PlaylistItemID,
-		})
+	userInfo, ok := middleware.GetUserInfo(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+		return
+	}
+
+	if err := switchPlaylistItem(userInfo.RoomID, req.PlaylistItemID); err != nil {
+		if errors.Is(err, database.ErrPlaylistItemNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Playlist item not found"})
+			return
+		}
+		config.Logger.Errorf("Failed to switch playlist item: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
 	}
 
 	// Always broadcast playlist update to sync all clients
@@ -248,3 +394,64 @@ func PlaylistSwitch(c *gin.Context) {
 
 	c.JSON(http.StatusOK, gin.H{"message": "Playlist item switched"})
 }
+
+// switchPlaylistItem finishes the items a room is playing and starts playing
+// the given item of the room from the beginning. It fails with
+// database.ErrPlaylistItemNotFound when the item is not in the room.
+func switchPlaylistItem(roomID, playlistItemID uint) error {
+	playingStatus := models.PlayStatusPlaying
+	playingItems, err := database.QueryPlaylistItems(roomID, nil, &playingStatus)
+	if err != nil {
+		return err
+	}
+
+	// Set the requested item to playing
+	if err := database.UpdatePlayStatus(roomID, playlistItemID, models.PlayStatusPlaying); err != nil {
+		return err
+	}
+
+	// Mark the items which were playing before as finished
+	for _, item := range playingItems {
+		if item.ID == playlistItemID {
+			continue
+		}
+		if err := database.UpdatePlayStatus(roomID, item.ID, models.PlayStatusFinished); err != nil {
+			config.Logger.Errorf("Failed to update play status: %v", err)
+		}
+	}
+
+	// Skip votes from an earlier run of the item no longer apply
+	if err := database.ClearPlaylistVotes(playlistItemID, models.VoteTypeSkip); err != nil {
+		config.Logger.Errorf("Failed to clear skip votes: %v", err)
+	}
+
+	// Start with the first source which is not known to be unreachable
+	var sourceID uint
+	if sources, err := database.GetVideoSourcesByPlaylistItemID(playlistItemID); err == nil {
+		if preferred := health.PreferredSource(sources); preferred != nil {
+			sourceID = preferred.ID
+		}
+	}
+
+	// Update or create room play status
+	previous, err := database.GetRoomPlayStatus(roomID)
+	recordPlaybackChange(roomID, previous, playlistItemID)
+	if err != nil {
+		database.CreateRoomPlayStatus(roomID, false, 0, time.Now().UnixMilli(), playlistItemID)
+		database.UpdateRoomPlayStatus(roomID, map[string]any{
+			"source_id": sourceID,
+		})
+	} else {
+		database.UpdateRoomPlayStatus(roomID, map[string]any{
+			"paused":            false,
+			"time":              0.0,
+			"timestamp":         time.Now().UnixMilli(),
+			"video_id":          playlistItemID,
+			"source_id":         sourceID,
+			"subtitle_track_id": 0,
+			"subtitle_offset":   0.0,
+		})
+	}
+
+	return nil
+}
@@ -0,0 +1,186 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"sync-player-server/internal/config"
+	"sync-player-server/internal/database"
+	"sync-player-server/internal/middleware"
+	"sync-player-server/internal/sync"
+	"sync-player-server/internal/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+const maxBulkAddItems = 100
+
+// Statuses of an item in the bulk add report
+const (
+	bulkAddStatusAdded     = "added"
+	bulkAddStatusDuplicate = "duplicate"
+	bulkAddStatusInvalid   = "invalid"
+)
+
+// bulkAddResult reports what happened to one item of a bulk add, in the
+// order the items were sent
+type bulkAddResult struct {
+	Index          int    `json:"index"`
+	Status         string `json:"status"`
+	PlaylistItemID uint   `json:"playlistItemId,omitempty"`
+	DuplicateOf    uint   `json:"duplicateOf,omitempty"`
+	DuplicateIndex *int   `json:"duplicateIndex,omitempty"`
+	URL            string `json:"url,omitempty"`
+	Error          string `json:"error,omitempty"`
+}
+
+// PlaylistBulkAdd appends several items to the playlist at once. Items with
+// an invalid title or source are skipped, as are items with a source already
+// in the room playlist or earlier in the request unless allowDuplicates is
+// set. The response reports the outcome of every item.
+func PlaylistBulkAdd(c *gin.Context) {
+	var req struct {
+		Items []struct {
+			Title   string                      `json:"title"`
+			Sources []database.VideoSourceInput `json:"sources"`
+		} `json:"items" binding:"required,min=1"`
+		AllowDuplicates bool `json:"allowDuplicates"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+
+	userInfo, ok := middleware.GetUserInfo(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+		return
+	}
+
+	if len(req.Items) > maxBulkAddItems {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("At most %d items can be added at once", maxBulkAddItems)})
+		return
+	}
+
+	existing, err := database.GetVideoSourcesByRoomID(userInfo.RoomID)
+	if err != nil {
+		config.Logger.Errorf("Failed to query room video sources: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	// Normalized URLs of the playlist mapped to the item holding them, and of
+	// the items sent so far mapped to their index
+	inPlaylist := make(map[string]uint, len(existing))
+	for _, source := range existing {
+		inPlaylist[utils.NormalizeMediaURL(source.URL)] = source.PlaylistItemID
+	}
+	inRequest := make(map[string]int)
+
+	results := make([]bulkAddResult, len(req.Items))
+	items := make([]database.PlaylistItemInput, 0, len(req.Items))
+	positions := make([]int, 0, len(req.Items))
+	for i, entry := range req.Items {
+		results[i] = bulkAddResult{Index: i}
+
+		title := entry.Title
+		if err := validatePlaylistItem(&title, entry.Sources); err != nil {
+			results[i].Status = bulkAddStatusInvalid
+			results[i].Error = err.Error()
+			continue
+		}
+
+		if !req.AllowDuplicates && findBulkAddDuplicate(&results[i], entry.Sources, inPlaylist, inRequest) {
+			continue
+		}
+		for _, source := range entry.Sources {
+			key := utils.NormalizeMediaURL(source.URL)
+			if _, ok := inRequest[key]; !ok {
+				inRequest[key] = i
+			}
+		}
+
+		items = append(items, database.PlaylistItemInput{Title: title, Sources: entry.Sources})
+		positions = append(positions, i)
+	}
+
+	var playlistItemIDs []uint
+	if len(items) > 0 {
+		if !checkQueueLimit(c, userInfo.RoomID, userInfo.UserID, len(items), false) {
+			return
+		}
+
+		playlistItemIDs, err = database.ImportPlaylistItems(userInfo.RoomID, userInfo.UserID, items, false)
+		if err != nil {
+			config.Logger.Errorf("Failed to bulk add playlist items: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+			return
+		}
+
+		for i, playlistItemID := range playlistItemIDs {
+			results[positions[i]].Status = bulkAddStatusAdded
+			results[positions[i]].PlaylistItemID = playlistItemID
+		}
+
+		probePlaylistItems(userInfo.RoomID, playlistItemIDs)
+
+		syncManager := sync.GetSyncManager()
+		if syncManager != nil {
+			syncManager.Broadcast(userInfo.RoomID, sync.SyncMessage{
+				Type: "updatePlaylist",
+			}, []uint{userInfo.UserID})
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": fmt.Sprintf("%d of %d items added to playlist", len(playlistItemIDs), len(req.Items)),
+		"added":   len(playlistItemIDs),
+		"results": results,
+	})
+}
+
+// findBulkAddDuplicate marks result as a duplicate when one of the sources
+// is in the playlist or in an earlier item of the request
+func findBulkAddDuplicate(result *bulkAddResult, sources []database.VideoSourceInput, inPlaylist map[string]uint, inRequest map[string]int) bool {
+	for _, source := range sources {
+		key := utils.NormalizeMediaURL(source.URL)
+		if playlistItemID, ok := inPlaylist[key]; ok {
+			result.DuplicateOf = playlistItemID
+		} else if index, ok := inRequest[key]; ok {
+			result.DuplicateIndex = &index
+		} else {
+			continue
+		}
+		result.Status = bulkAddStatusDuplicate
+		result.URL = source.URL
+		return true
+	}
+	return false
+}
+
+// validatePlaylistItem trims and checks the title and sources of an item to
+// add
+func validatePlaylistItem(title *string, sources []database.VideoSourceInput) error {
+	*title = strings.TrimSpace(*title)
+	if *title == "" || len([]rune(*title)) > maxPlaylistTitleLength {
+		return fmt.Errorf("Title must be 1 to %d characters", maxPlaylistTitleLength)
+	}
+	if len(sources) == 0 {
+		return fmt.Errorf("At least one video source is required")
+	}
+	if len(sources) > maxSourceChangesPerEdit {
+		return fmt.Errorf("At most %d video sources are allowed", maxSourceChangesPerEdit)
+	}
+	for i := range sources {
+		if err := validateVideoSource(&sources[i].URL, &sources[i].Label); err != nil {
+			return err
+		}
+		headers, err := normalizeSourceHeaders(sources[i].Headers)
+		if err != nil {
+			return err
+		}
+		sources[i].Headers = headers
+	}
+	return nil
+}
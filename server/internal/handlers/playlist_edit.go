@@ -0,0 +1,300 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	gosync "sync"
+	"sync-player-server/internal/config"
+	"sync-player-server/internal/database"
+	"sync-player-server/internal/health"
+	"sync-player-server/internal/middleware"
+	"sync-player-server/internal/models"
+	"sync-player-server/internal/sync"
+	"sync-player-server/internal/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	maxPlaylistTitleLength  = 255
+	maxSourceLabelLength    = 100
+	maxSourceChangesPerEdit = 50
+	maxSourceHeaderLength   = 4096
+)
+
+// proxySourceHeaders are the request headers a source may ask the media
+// proxy to send
+var proxySourceHeaders = []string{"Referer", "Origin", "Cookie", "User-Agent", "Authorization"}
+
+// PlaylistUpdate edits a playlist item in place, keeping its id, position
+// and play status. Only the fields sent are changed: the title, and sources
+// to add, to change the URL or label of, or to remove by id.
+func PlaylistUpdate(c *gin.Context) {
+	var req struct {
+		PlaylistItemID  uint                         `json:"playlistItemId" binding:"required"`
+		Title           *string                      `json:"title"`
+		AddSources      []database.VideoSourceInput  `json:"addSources"`
+		UpdateSources   []database.VideoSourceUpdate `json:"updateSources" binding:"dive"`
+		RemoveSourceIDs []uint                       `json:"removeSourceIds"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+
+	userInfo, ok := middleware.GetUserInfo(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+		return
+	}
+
+	if req.Title == nil && len(req.AddSources) == 0 && len(req.UpdateSources) == 0 && len(req.RemoveSourceIDs) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Nothing to update"})
+		return
+	}
+	if len(req.AddSources)+len(req.UpdateSources)+len(req.RemoveSourceIDs) > maxSourceChangesPerEdit {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("At most %d source changes are allowed at once", maxSourceChangesPerEdit)})
+		return
+	}
+
+	update := database.PlaylistItemUpdate{
+		AddSources:    req.AddSources,
+		UpdateSources: req.UpdateSources,
+		RemoveSources: req.RemoveSourceIDs,
+	}
+	if req.Title != nil {
+		title := strings.TrimSpace(*req.Title)
+		if title == "" || len([]rune(title)) > maxPlaylistTitleLength {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Title must be 1 to %d characters", maxPlaylistTitleLength)})
+			return
+		}
+		update.Title = &title
+	}
+	for i := range update.AddSources {
+		source := &update.AddSources[i]
+		err := validateVideoSource(&source.URL, &source.Label)
+		if err == nil {
+			source.Headers, err = normalizeSourceHeaders(source.Headers)
+		}
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	for i := range update.UpdateSources {
+		source := &update.UpdateSources[i]
+		err := validateVideoSource(source.URL, source.Label)
+		if err == nil {
+			source.Headers, err = normalizeSourceHeaders(source.Headers)
+		}
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	items, err := database.QueryPlaylistItems(userInfo.RoomID, &req.PlaylistItemID, nil)
+	if err != nil || len(items) == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Playlist item not found"})
+		return
+	}
+	item := items[0]
+
+	if !canEditPlaylistItem(userInfo, &item) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only the member who added the item or a moderator can edit it"})
+		return
+	}
+
+	changedSourceIDs, err := database.UpdatePlaylistItem(userInfo.RoomID, req.PlaylistItemID, update)
+	if err != nil {
+		switch {
+		case errors.Is(err, database.ErrPlaylistItemNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": "Playlist item not found"})
+		case errors.Is(err, database.ErrVideoSourceNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": "Video source not found"})
+		case errors.Is(err, database.ErrNoVideoSources):
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Playlist item needs at least one video source"})
+		default:
+			config.Logger.Errorf("Failed to update playlist item: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		}
+		return
+	}
+
+	if len(changedSourceIDs) > 0 {
+		probePlaylistItems(userInfo.RoomID, []uint{req.PlaylistItemID})
+	}
+
+	syncManager := sync.GetSyncManager()
+	if syncManager != nil {
+		syncManager.Broadcast(userInfo.RoomID, sync.SyncMessage{
+			Type: "updatePlaylist",
+		}, []uint{userInfo.UserID})
+	}
+
+	syncEditedSource(userInfo.RoomID, &item, update)
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":        "Playlist item updated",
+		"playlistItemId": req.PlaylistItemID,
+	})
+}
+
+// canEditPlaylistItem reports whether the caller added the item or their
+// role manages the playlist
+func canEditPlaylistItem(userInfo *middleware.UserInfo, item *models.PlaylistItem) bool {
+	if item.AddedBy != 0 && item.AddedBy == userInfo.UserID {
+		return true
+	}
+	return memberCan(userInfo.RoomID, userInfo.UserID, models.PermissionManagePlaylist)
+}
+
+var (
+	mediaURLPolicy     *utils.MediaURLPolicy
+	mediaURLPolicyOnce gosync.Once
+)
+
+// validateMediaURL checks a video or subtitle source URL against the
+// configured schemes and hosts
+func validateMediaURL(rawURL string) error {
+	mediaURLPolicyOnce.Do(func() {
+		mediaURLPolicy = utils.NewMediaURLPolicy(
+			config.Env.MediaURLSchemes,
+			config.Env.MediaURLAllowedHosts,
+			config.Env.MediaURLDeniedHosts,
+			config.Env.MediaURLMaxLength,
+		)
+	})
+	return mediaURLPolicy.Check(rawURL)
+}
+
+// validateVideoSource trims and checks the URL and label of a source, nil
+// fields are not checked
+func validateVideoSource(rawURL, label *string) error {
+	if rawURL != nil {
+		*rawURL = strings.TrimSpace(*rawURL)
+		if err := validateMediaURL(*rawURL); err != nil {
+			return err
+		}
+	}
+	if label != nil {
+		*label = strings.TrimSpace(*label)
+		if len([]rune(*label)) > maxSourceLabelLength {
+			return fmt.Errorf("Label must be at most %d characters", maxSourceLabelLength)
+		}
+	}
+	return nil
+}
+
+// normalizeSourceHeaders checks the proxy headers of a source and returns
+// them with canonical names. Nil stays nil, an empty map clears the headers
+// of an edited source.
+func normalizeSourceHeaders(headers map[string]string) (map[string]string, error) {
+	if headers == nil {
+		return nil, nil
+	}
+
+	normalized := make(map[string]string, len(headers))
+	for name, value := range headers {
+		canonical := ""
+		for _, allowed := range proxySourceHeaders {
+			if strings.EqualFold(name, allowed) {
+				canonical = allowed
+			}
+		}
+		if canonical == "" {
+			return nil, fmt.Errorf("Header %s is not allowed, use one of %s", name, strings.Join(proxySourceHeaders, ", "))
+		}
+
+		value = strings.TrimSpace(value)
+		if value == "" {
+			continue
+		}
+		if len(value) > maxSourceHeaderLength || strings.ContainsAny(value, "\r\n") {
+			return nil, fmt.Errorf("Header %s has an invalid value", canonical)
+		}
+		normalized[canonical] = value
+	}
+	return normalized, nil
+}
+
+// syncEditedSource moves a room which plays the edited item off a removed
+// source and reloads a source whose URL changed. item is the item as it was
+// before the edit.
+func syncEditedSource(roomID uint, item *models.PlaylistItem, update database.PlaylistItemUpdate) {
+	status, err := database.GetRoomPlayStatus(roomID)
+	if err != nil || status.VideoID != item.ID || len(item.VideoSources) == 0 {
+		return
+	}
+
+	activeID := status.SourceID
+	if activeID == 0 {
+		// Rooms which never selected a source play the first one
+		activeID = item.VideoSources[0].ID
+	}
+
+	removed := false
+	for _, id := range update.RemoveSources {
+		if id == activeID {
+			removed = true
+		}
+	}
+	changed := false
+	for _, source := range update.UpdateSources {
+		if source.ID == activeID && source.URL != nil {
+			changed = true
+		}
+	}
+	if !removed && !changed {
+		return
+	}
+
+	sources, err := database.GetVideoSourcesByPlaylistItemID(item.ID)
+	if err != nil {
+		config.Logger.Errorf("Failed to query video sources of playlist item %d: %v", item.ID, err)
+		return
+	}
+
+	var next *models.VideoSource
+	if removed {
+		next = health.PreferredSource(sources)
+	} else {
+		for i := range sources {
+			if sources[i].ID == activeID {
+				next = &sources[i]
+			}
+		}
+	}
+	if next == nil {
+		return
+	}
+
+	if next.ID != status.SourceID {
+		if err := database.UpdateRoomPlayStatus(roomID, map[string]interface{}{
+			"source_id": next.ID,
+		}); err != nil {
+			config.Logger.Errorf("Failed to switch room %d to video source %d: %v", roomID, next.ID, err)
+			return
+		}
+	}
+
+	syncManager := sync.GetSyncManager()
+	if syncManager != nil {
+		signed := signedSource(next, roomID)
+		syncManager.Broadcast(roomID, sync.SyncMessage{
+			Type: "switchSource",
+			Payload: map[string]interface{}{
+				"roomId":   roomID,
+				"videoId":  item.ID,
+				"sourceId": next.ID,
+				"url":      signed.URL,
+				"proxyUrl": signed.ProxyURL,
+				"label":    next.Label,
+				"reason":   "edited",
+			},
+		}, nil)
+	}
+}
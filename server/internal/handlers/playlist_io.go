@@ -0,0 +1,213 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sync-player-server/internal/config"
+	"sync-player-server/internal/database"
+	"sync-player-server/internal/middleware"
+	"sync-player-server/internal/models"
+	"sync-player-server/internal/playlistio"
+	"sync-player-server/internal/sync"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	maxImportContentBytes = 5 * 1024 * 1024
+	maxImportEntries      = 500
+	// maxImportBodyBytes leaves room for the rest of the JSON envelope and
+	// the escaping of the content, mostly its line breaks
+	maxImportBodyBytes = maxImportContentBytes + 1024*1024
+)
+
+// PlaylistImport imports playlist items from an M3U, XSPF or JSON document
+func PlaylistImport(c *gin.Context) {
+	var req struct {
+		Format  string `json:"format"`
+		Mode    string `json:"mode"`
+		Content string `json:"content" binding:"required"`
+	}
+
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxImportBodyBytes)
+	if err := c.ShouldBindJSON(&req); err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "Playlist is too large"})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+
+	userInfo, ok := middleware.GetUserInfo(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+		return
+	}
+
+	if len(req.Content) > maxImportContentBytes {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "Playlist is too large"})
+		return
+	}
+
+	var replace bool
+	switch req.Mode {
+	case "", "append":
+		replace = false
+	case "replace":
+		replace = true
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Mode must be append or replace"})
+		return
+	}
+	if replace && !memberCan(userInfo.RoomID, userInfo.UserID, models.PermissionManagePlaylist) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only moderators can replace the playlist"})
+		return
+	}
+
+	content := []byte(req.Content)
+
+	var format playlistio.Format
+	var err error
+	if req.Format != "" {
+		format, err = playlistio.ParseFormat(req.Format)
+	} else {
+		format, err = playlistio.DetectFormat(content)
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	entries, entryErrors, err := playlistio.Parse(format, content)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if len(entries) > maxImportEntries {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Playlist has more than %d entries", maxImportEntries)})
+		return
+	}
+
+	items := make([]database.PlaylistItemInput, 0, len(entries))
+	for _, entry := range entries {
+		sources := make([]database.VideoSourceInput, 0, len(entry.Sources))
+		for _, source := range entry.Sources {
+			sources = append(sources, database.VideoSourceInput{
+				URL:   source.URL,
+				Label: source.Label,
+			})
+		}
+		title := entry.Title
+		if err := validatePlaylistItem(&title, sources); err != nil {
+			entryErrors = append(entryErrors, playlistio.EntryError{
+				Index: entry.Index,
+				Line:  entry.Line,
+				Title: entry.Title,
+				Error: err.Error(),
+			})
+			continue
+		}
+		items = append(items, database.PlaylistItemInput{
+			Title:   title,
+			Sources: sources,
+		})
+	}
+
+	if len(items) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":  "Playlist contains no valid entries",
+			"errors": entryErrors,
+		})
+		return
+	}
+
+	if !checkQueueLimit(c, userInfo.RoomID, userInfo.UserID, len(items), replace) {
+		return
+	}
+
+	playlistItemIDs, err := database.ImportPlaylistItems(userInfo.RoomID, userInfo.UserID, items, replace)
+	if err != nil {
+		config.Logger.Errorf("Failed to import playlist: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	probePlaylistItems(userInfo.RoomID, playlistItemIDs)
+
+	syncManager := sync.GetSyncManager()
+	if syncManager != nil {
+		syncManager.Broadcast(userInfo.RoomID, sync.SyncMessage{
+			Type: "updatePlaylist",
+		}, []uint{userInfo.UserID})
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":         "Playlist imported",
+		"format":          format,
+		"imported":        len(playlistItemIDs),
+		"playlistItemIds": playlistItemIDs,
+		"errors":          entryErrors,
+	})
+}
+
+// PlaylistExport exports the room playlist as an M3U, XSPF or JSON document
+func PlaylistExport(c *gin.Context) {
+	userInfo, ok := middleware.GetUserInfo(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+		return
+	}
+
+	formatName := c.DefaultQuery("format", string(playlistio.FormatJSON))
+	format, err := playlistio.ParseFormat(formatName)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	items, err := database.QueryPlaylistItems(userInfo.RoomID, nil, nil)
+	if err != nil {
+		config.Logger.Errorf("Failed to query playlist items: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	includeFinished := c.Query("includeFinished") == "true"
+
+	entries := make([]playlistio.Entry, 0, len(items))
+	for _, item := range items {
+		if item.PlayStatus == models.PlayStatusFinished && !includeFinished {
+			continue
+		}
+
+		entry := playlistio.Entry{Title: item.Title}
+		for _, source := range item.VideoSources {
+			if entry.Duration == 0 {
+				entry.Duration = source.Duration
+			}
+			entry.Sources = append(entry.Sources, playlistio.Source{
+				URL:   source.URL,
+				Label: source.Label,
+			})
+		}
+		if len(entry.Sources) == 0 {
+			continue
+		}
+		entries = append(entries, entry)
+	}
+
+	data, err := playlistio.Write(format, entries)
+	if err != nil {
+		config.Logger.Errorf("Failed to export playlist: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	filename := fmt.Sprintf("playlist-%d%s", userInfo.RoomID, playlistio.FileExtension(format))
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	c.Data(http.StatusOK, playlistio.ContentType(format), data)
+}
@@ -0,0 +1,154 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"sync-player-server/internal/config"
+	"sync-player-server/internal/database"
+	"sync-player-server/internal/middleware"
+	"sync-player-server/internal/models"
+	"sync-player-server/internal/resolve"
+	"sync-player-server/internal/sync"
+	"sync-player-server/internal/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// PlaylistResolve finds the media of a page link without adding it, so that
+// members can preview what a link resolves to
+func PlaylistResolve(c *gin.Context) {
+	var req struct {
+		URL string `json:"url" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+
+	if _, ok := middleware.GetUserInfo(c); !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+		return
+	}
+
+	result, ok := resolveLink(c, req.URL)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
+// PlaylistAddLink resolves a page link and appends an item playing the media
+// found on it. The title defaults to the title of the page.
+func PlaylistAddLink(c *gin.Context) {
+	var req struct {
+		URL   string `json:"url" binding:"required"`
+		Title string `json:"title"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+
+	userInfo, ok := middleware.GetUserInfo(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+		return
+	}
+
+	result, ok := resolveLink(c, req.URL)
+	if !ok {
+		return
+	}
+
+	title := strings.TrimSpace(req.Title)
+	if title == "" {
+		title = result.Title
+	}
+	if title == "" {
+		title = strings.TrimSpace(req.URL)
+	}
+	title = truncateString(title, maxPlaylistTitleLength)
+
+	sources := make([]database.VideoSourceInput, 0, len(result.Sources))
+	for _, source := range result.Sources {
+		sources = append(sources, database.VideoSourceInput{
+			URL:      source.URL,
+			Label:    source.Label,
+			PageURL:  strings.TrimSpace(req.URL),
+			Resolver: result.Resolver,
+			MediaInfo: models.MediaInfo{
+				Duration: source.Duration,
+				Width:    source.Width,
+				Height:   source.Height,
+			},
+		})
+	}
+	if err := validatePlaylistItem(&title, sources); err != nil {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Media found on the link cannot be added: " + err.Error()})
+		return
+	}
+
+	if !checkQueueLimit(c, userInfo.RoomID, userInfo.UserID, 1, false) {
+		return
+	}
+
+	playlistItemID, err := database.AddItemToPlaylist(userInfo.RoomID, userInfo.UserID, title, sources)
+	if err != nil {
+		config.Logger.Errorf("Failed to add playlist item: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	probePlaylistItems(userInfo.RoomID, []uint{playlistItemID})
+
+	syncManager := sync.GetSyncManager()
+	if syncManager != nil {
+		syncManager.Broadcast(userInfo.RoomID, sync.SyncMessage{
+			Type: "updatePlaylist",
+		}, []uint{userInfo.UserID})
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":        "Item added to playlist",
+		"playlistItemId": playlistItemID,
+		"resolver":       result.Resolver,
+		"sources":        len(sources),
+	})
+}
+
+// resolveLink checks a pasted link against the media URL policy and runs it
+// through the resolvers, writing the error response when that fails
+func resolveLink(c *gin.Context, rawURL string) (*resolve.Result, bool) {
+	registry := resolve.GetRegistry()
+	if registry == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Link resolving is disabled"})
+		return nil, false
+	}
+
+	rawURL = strings.TrimSpace(rawURL)
+	if err := validateMediaURL(rawURL); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return nil, false
+	}
+
+	result, err := registry.Resolve(context.Background(), rawURL)
+	if err != nil {
+		switch {
+		case errors.Is(err, resolve.ErrNoMedia):
+			c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "No playable media found on the link"})
+		case errors.Is(err, utils.ErrBlockedAddress):
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Link points at an address which is not allowed"})
+		default:
+			config.Logger.Warnf("Failed to resolve link %s: %v", rawURL, err)
+			c.JSON(http.StatusBadGateway, gin.H{"error": "Failed to resolve link"})
+		}
+		return nil, false
+	}
+
+	return result, true
+}
@@ -0,0 +1,187 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"sync-player-server/internal/config"
+	"sync-player-server/internal/database"
+	"sync-player-server/internal/middleware"
+	"sync-player-server/internal/models"
+	"sync-player-server/internal/sync"
+	"sync-player-server/internal/utils"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// PlaylistTrashQuery returns the deleted items of the caller's room which
+// can still be restored
+func PlaylistTrashQuery(c *gin.Context) {
+	userInfo, ok := middleware.GetUserInfo(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+		return
+	}
+
+	// Items past the retention period are purged when the trash is looked at
+	retention := time.Duration(config.Env.PlaylistTrashRetentionHours) * time.Hour
+	if _, err := database.PurgePlaylistTrash(userInfo.RoomID, nil, time.Now().Add(-retention)); err != nil {
+		config.Logger.Errorf("Failed to purge expired trash: %v", err)
+	}
+
+	items, err := database.GetPlaylistTrash(userInfo.RoomID)
+	if err != nil {
+		config.Logger.Errorf("Failed to query playlist trash: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"items":          items,
+		"retentionHours": config.Env.PlaylistTrashRetentionHours,
+	})
+}
+
+// PlaylistRestore restores items from the trash of the caller's room
+func PlaylistRestore(c *gin.Context) {
+	var req struct {
+		PlaylistItemIDs []uint `json:"playlistItemIds" binding:"required,min=1"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+
+	userInfo, ok := middleware.GetUserInfo(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+		return
+	}
+
+	restored, err := database.RestorePlaylistItems(userInfo.RoomID, req.PlaylistItemIDs)
+	if err != nil {
+		config.Logger.Errorf("Failed to restore playlist items: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+	if len(restored) == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Playlist items not found in trash"})
+		return
+	}
+
+	broadcastRestore(userInfo)
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":         "Items restored",
+		"playlistItemIds": restored,
+	})
+}
+
+// PlaylistUndo undoes a delete or clear of the caller's room with the undo
+// token it returned
+func PlaylistUndo(c *gin.Context) {
+	var req struct {
+		UndoToken string `json:"undoToken" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+
+	userInfo, ok := middleware.GetUserInfo(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+		return
+	}
+
+	deletion, restored, err := database.UndoPlaylistDeletion(userInfo.RoomID, req.UndoToken)
+	if err != nil {
+		switch {
+		case errors.Is(err, database.ErrUndoTokenInvalid):
+			c.JSON(http.StatusNotFound, gin.H{"error": "Undo token not found"})
+		case errors.Is(err, database.ErrUndoTokenExpired):
+			c.JSON(http.StatusGone, gin.H{"error": "Undo token has expired, restore the items from the trash"})
+		default:
+			config.Logger.Errorf("Failed to undo playlist deletion: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		}
+		return
+	}
+
+	broadcastRestore(userInfo)
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":         "Deletion undone",
+		"cleared":         deletion.Cleared,
+		"playlistItemIds": restored,
+	})
+}
+
+// PlaylistPurge permanently deletes items, or with all set everything, from
+// the trash of the caller's room
+func PlaylistPurge(c *gin.Context) {
+	var req struct {
+		PlaylistItemIDs []uint `json:"playlistItemIds"`
+		All             bool   `json:"all"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+
+	userInfo, ok := middleware.GetUserInfo(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+		return
+	}
+
+	if len(req.PlaylistItemIDs) == 0 && !req.All {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Playlist item IDs or all is required"})
+		return
+	}
+
+	var playlistItemIDs []uint
+	if !req.All {
+		playlistItemIDs = req.PlaylistItemIDs
+	}
+
+	purged, err := database.PurgePlaylistTrash(userInfo.RoomID, playlistItemIDs, time.Time{})
+	if err != nil {
+		config.Logger.Errorf("Failed to purge playlist trash: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Trash purged",
+		"purged":  purged,
+	})
+}
+
+// newPlaylistDeletion prepares the record of a delete or clear in the
+// caller's room with a fresh undo token
+func newPlaylistDeletion(userInfo *middleware.UserInfo) (*models.PlaylistDeletion, error) {
+	undoToken, err := utils.GenerateToken(24)
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.PlaylistDeletion{
+		RoomID:          userInfo.RoomID,
+		UserID:          userInfo.UserID,
+		UndoToken:       undoToken,
+		UndoExpiresTime: time.Now().Add(time.Duration(config.Env.PlaylistUndoSeconds) * time.Second),
+	}, nil
+}
+
+func broadcastRestore(userInfo *middleware.UserInfo) {
+	syncManager := sync.GetSyncManager()
+	if syncManager != nil {
+		syncManager.Broadcast(userInfo.RoomID, sync.SyncMessage{
+			Type: "updatePlaylist",
+		}, []uint{userInfo.UserID})
+	}
+}
@@ -0,0 +1,121 @@
+package handlers
+
+import (
+	"context"
+	gosync "sync"
+	"sync-player-server/internal/config"
+	"sync-player-server/internal/database"
+	"sync-player-server/internal/models"
+	"sync-player-server/internal/probe"
+	"sync-player-server/internal/sync"
+	"time"
+)
+
+// probePlaylistItems probes the video sources of the given playlist items in
+// the background and tells the room to reload the playlist once done
+func probePlaylistItems(roomID uint, playlistItemIDs []uint) {
+	prober := probe.GetProber()
+	if prober == nil || len(playlistItemIDs) == 0 {
+		return
+	}
+
+	go func() {
+		sources, err := database.GetVideoSourcesByPlaylistItemIDs(playlistItemIDs)
+		if err != nil {
+			config.Logger.Errorf("Failed to query video sources for probing: %v", err)
+			return
+		}
+
+		var wg gosync.WaitGroup
+		for _, source := range sources {
+			// Uploads and renditions are served by this server and not fetched
+			// over the network
+			if source.UploadID != nil || source.TranscodeJobID != nil {
+				continue
+			}
+			wg.Add(1)
+			go func(source models.VideoSource) {
+				defer wg.Done()
+				probeVideoSource(prober, source)
+			}(source)
+		}
+		wg.Wait()
+
+		syncManager := sync.GetSyncManager()
+		if syncManager != nil && len(sources) > 0 {
+			syncManager.Broadcast(roomID, sync.SyncMessage{
+				Type: "updatePlaylist",
+			}, nil)
+		}
+	}()
+}
+
+func probeVideoSource(prober *probe.Prober, source models.VideoSource) {
+	now := time.Now()
+	// A failed probe keeps what is already known, e.g. from a link resolver
+	info := source.MediaInfo
+	info.ProbeStatus = models.ProbeStatusFailed
+	info.ProbedTime = &now
+
+	result, err := prober.Probe(context.Background(), source.URL)
+	if err != nil {
+		config.Logger.Warnf("Failed to probe video source %d: %v", source.ID, err)
+		info.ProbeError = truncateString(err.Error(), 255)
+	} else {
+		info = mediaInfoFromProbe(result)
+		info.ProbedTime = &now
+	}
+
+	if err := database.UpdateVideoSourceMediaInfo(source.ID, info); err != nil {
+		config.Logger.Errorf("Failed to save media info of video source %d: %v", source.ID, err)
+	}
+}
+
+func mediaInfoFromProbe(result *probe.Result) models.MediaInfo {
+	info := models.MediaInfo{
+		Duration:    result.Duration,
+		Container:   result.Container,
+		IsLive:      result.Live,
+		Width:       result.Width,
+		Height:      result.Height,
+		VideoCodec:  truncateString(result.VideoCodec, 50),
+		AudioCodec:  truncateString(result.AudioCodec, 50),
+		ProbeStatus: models.ProbeStatusDone,
+	}
+
+	for _, variant := range result.Variants {
+		info.Variants = append(info.Variants, models.MediaVariant{
+			URL:       variant.URL,
+			Bandwidth: variant.Bandwidth,
+			Width:     variant.Width,
+			Height:    variant.Height,
+			Codecs:    variant.Codecs,
+			FrameRate: variant.FrameRate,
+		})
+	}
+	for _, track := range result.AudioTracks {
+		info.AudioTracks = append(info.AudioTracks, models.MediaAudioTrack{
+			Language: track.Language,
+			Name:     track.Name,
+			Codec:    track.Codec,
+			Default:  track.Default,
+		})
+	}
+	for _, chapter := range result.Chapters {
+		info.Chapters = append(info.Chapters, models.MediaChapter{
+			Start: chapter.Start,
+			End:   chapter.End,
+			Title: chapter.Title,
+		})
+	}
+
+	return info
+}
+
+func truncateString(value string, maxLength int) string {
+	runes := []rune(value)
+	if len(runes) <= maxLength {
+		return value
+	}
+	return string(runes[:maxLength])
+}
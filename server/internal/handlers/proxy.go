@@ -0,0 +1,106 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync-player-server/internal/database"
+	"sync-player-server/internal/mediaurl"
+	"sync-player-server/internal/models"
+	"sync-player-server/internal/proxy"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ProxyEntry redirects to the proxy path of a video source, passing on the
+// access token. Players load the signed proxy URL from the playlist in place
+// of the source URL.
+func ProxyEntry(c *gin.Context) {
+	mediaProxy, _, source, _, token, ok := getProxiedSource(c)
+	if !ok {
+		return
+	}
+
+	target, err := url.Parse(source.URL)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid video source URL"})
+		return
+	}
+
+	c.Redirect(http.StatusFound, mediaurl.AppendQuery(mediaProxy.Path(source.ID, target), accessQuery(token)))
+}
+
+// ProxyStream streams a video source, or a segment or rendition its manifest
+// refers to, through the server
+func ProxyStream(c *gin.Context) {
+	mediaProxy, claims, source, rawQuery, token, ok := getProxiedSource(c)
+	if !ok {
+		return
+	}
+
+	proxyToken := c.Param("token")
+	escapedPath := c.Request.URL.EscapedPath()
+	marker := "/" + proxyToken + "/"
+	index := strings.Index(escapedPath, marker)
+	if index < 0 {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Invalid proxy path"})
+		return
+	}
+
+	target, err := mediaProxy.Target(source.ID, proxyToken, escapedPath[index+len(marker):], rawQuery)
+	if err != nil {
+		if errors.Is(err, proxy.ErrInvalidToken) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Invalid proxy path"})
+		} else {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	sourceURL, err := url.Parse(source.URL)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid video source URL"})
+		return
+	}
+
+	mediaProxy.Serve(c.Writer, c.Request, claims.RoomID, source.ID, sourceURL, target, source.ProxyHeaders, accessQuery(token))
+}
+
+// getProxiedSource looks up the video source of a proxy request, which has
+// to be in the playlist of the room its access token was signed for,
+// writing the error response when it is not. The token comes last in the
+// query, it returns the query without it along with the token.
+func getProxiedSource(c *gin.Context) (*proxy.Proxy, *mediaurl.Claims, *models.VideoSource, string, string, bool) {
+	mediaProxy := proxy.GetProxy()
+	if mediaProxy == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Media proxy is disabled"})
+		return nil, nil, nil, "", "", false
+	}
+
+	var sourceID uint
+	if _, err := fmt.Sscanf(c.Param("sourceId"), "%d", &sourceID); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid video source ID"})
+		return nil, nil, nil, "", "", false
+	}
+
+	rawQuery, token := mediaurl.SplitQuery(c.Request.URL.RawQuery)
+	claims, ok := authorizeMedia(c, fmt.Sprintf("%s%d", mediaurl.ProxyPath, sourceID), token)
+	if !ok {
+		return nil, nil, nil, "", "", false
+	}
+
+	source, err := database.GetVideoSourceByID(sourceID)
+	if err != nil || source.PlaylistItem == nil || source.PlaylistItem.RoomID != claims.RoomID {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Video source not found"})
+		return nil, nil, nil, "", "", false
+	}
+
+	return mediaProxy, claims, source, rawQuery, token, true
+}
+
+// accessQuery encodes an access token as a query pair
+func accessQuery(token string) string {
+	return mediaurl.Param + "=" + url.QueryEscape(token)
+}
@@ -0,0 +1,230 @@
+package handlers
+
+import (
+	"net/http"
+	"sort"
+	"sync-player-server/internal/config"
+	"sync-player-server/internal/database"
+	"sync-player-server/internal/middleware"
+	"sync-player-server/internal/models"
+	"sync-player-server/internal/sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// PlaylistSetQueueMode changes how the up next order of a room is decided:
+// manually, by upvotes or round-robin between the members who added items
+func PlaylistSetQueueMode(c *gin.Context) {
+	var req struct {
+		QueueMode          models.QueueMode `json:"queueMode" binding:"required"`
+		SkipVoteRatio      *float64         `json:"skipVoteRatio"`
+		MaxQueuedPerMember *int             `json:"maxQueuedPerMember"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+
+	userInfo, ok := middleware.GetUserInfo(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+		return
+	}
+
+	switch req.QueueMode {
+	case models.QueueModeManual, models.QueueModeVote, models.QueueModeRoundRobin:
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Queue mode must be manual, vote or round-robin"})
+		return
+	}
+
+	room, err := database.GetRoomByID(userInfo.RoomID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Room not found"})
+		return
+	}
+
+	// Zero falls back to the server default
+	skipVoteRatio := room.SkipVoteRatio
+	if req.SkipVoteRatio != nil {
+		if *req.SkipVoteRatio < 0 || *req.SkipVoteRatio > 1 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Skip vote ratio must be between 0 and 1"})
+			return
+		}
+		skipVoteRatio = *req.SkipVoteRatio
+	}
+
+	// Zero means members can queue any number of items
+	maxQueuedPerMember := room.MaxQueuedPerMember
+	if req.MaxQueuedPerMember != nil {
+		if *req.MaxQueuedPerMember < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Max queued items per member must not be negative"})
+			return
+		}
+		maxQueuedPerMember = *req.MaxQueuedPerMember
+	}
+
+	if err := database.UpdateRoomQueueMode(userInfo.RoomID, req.QueueMode, skipVoteRatio, maxQueuedPerMember); err != nil {
+		config.Logger.Errorf("Failed to update queue mode: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	syncManager := sync.GetSyncManager()
+	if syncManager != nil {
+		syncManager.Broadcast(userInfo.RoomID, sync.SyncMessage{
+			Type: "updateQueueMode",
+			Payload: map[string]interface{}{
+				"roomId":             userInfo.RoomID,
+				"userId":             userInfo.UserID,
+				"queueMode":          req.QueueMode,
+				"skipVoteRatio":      skipVoteRatio,
+				"maxQueuedPerMember": maxQueuedPerMember,
+			},
+		}, []uint{userInfo.UserID})
+		syncManager.Broadcast(userInfo.RoomID, sync.SyncMessage{
+			Type: "updatePlaylist",
+		}, []uint{userInfo.UserID})
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Queue mode updated"})
+}
+
+// checkQueueLimit reports whether a member may queue count more items in a
+// room, writing a conflict response otherwise. When the playlist is replaced
+// the member's queued items are dropped and do not count.
+func checkQueueLimit(c *gin.Context, roomID, userID uint, count int, replace bool) bool {
+	room, err := database.GetRoomByID(roomID)
+	if err != nil || room.MaxQueuedPerMember <= 0 {
+		return true
+	}
+
+	var queued int64
+	if !replace {
+		queued, err = database.CountQueuedItemsByMember(roomID, userID)
+		if err != nil {
+			config.Logger.Errorf("Failed to count queued items: %v", err)
+			return true
+		}
+	}
+
+	if int(queued)+count > room.MaxQueuedPerMember {
+		c.JSON(http.StatusConflict, gin.H{
+			"error":              "Queue limit reached",
+			"queued":             queued,
+			"maxQueuedPerMember": room.MaxQueuedPerMember,
+		})
+		return false
+	}
+	return true
+}
+
+// nextQueuedItem returns the item a room plays next according to its queue
+// mode, zero when nothing is queued
+func nextQueuedItem(room *models.Room) (uint, error) {
+	items, err := database.QueryPlaylistItems(room.ID, nil, nil)
+	if err != nil {
+		return 0, err
+	}
+
+	arrangePlaylist(room, items)
+	for _, item := range items {
+		if item.PlayStatus == models.PlayStatusNew {
+			return item.ID, nil
+		}
+	}
+	return 0, nil
+}
+
+// arrangePlaylist orders a room playlist by its queue mode. Items which are
+// playing or finished keep their position at the front, queued items follow
+// in the order they will be played. Manual queues are left untouched.
+func arrangePlaylist(room *models.Room, items []models.PlaylistItem) {
+	if room.QueueMode != models.QueueModeVote && room.QueueMode != models.QueueModeRoundRobin {
+		return
+	}
+
+	queued := make([]models.PlaylistItem, 0, len(items))
+	ordered := make([]models.PlaylistItem, 0, len(items))
+	var currentMember uint
+	for _, item := range items {
+		if item.PlayStatus == models.PlayStatusNew {
+			queued = append(queued, item)
+		} else {
+			ordered = append(ordered, item)
+		}
+		if item.PlayStatus == models.PlayStatusPlaying {
+			currentMember = item.AddedBy
+		}
+	}
+
+	if room.QueueMode == models.QueueModeVote {
+		sortByVotes(queued)
+	} else {
+		queued = interleaveMembers(queued, currentMember)
+	}
+	copy(items, append(ordered, queued...))
+}
+
+// sortByVotes orders queued items by upvotes, breaking ties by the time
+// they were added
+func sortByVotes(items []models.PlaylistItem) {
+	sort.SliceStable(items, func(i, j int) bool {
+		if items[i].Upvotes != items[j].Upvotes {
+			return items[i].Upvotes > items[j].Upvotes
+		}
+		if !items[i].CreatedTime.Equal(items[j].CreatedTime) {
+			return items[i].CreatedTime.Before(items[j].CreatedTime)
+		}
+		return items[i].ID < items[j].ID
+	})
+}
+
+// interleaveMembers takes one item from each member's queue in turn. Each
+// member's queue keeps its own order, members take turns in the order they
+// first queued an item, starting after the member whose item is playing.
+func interleaveMembers(items []models.PlaylistItem, currentMember uint) []models.PlaylistItem {
+	queues := make(map[uint][]models.PlaylistItem)
+	var members []uint
+	for _, item := range items {
+		if _, ok := queues[item.AddedBy]; !ok {
+			members = append(members, item.AddedBy)
+		}
+		queues[item.AddedBy] = append(queues[item.AddedBy], item)
+	}
+
+	sort.SliceStable(members, func(i, j int) bool {
+		return firstQueuedTime(queues[members[i]]).Before(firstQueuedTime(queues[members[j]]))
+	})
+
+	for i, member := range members {
+		if member == currentMember {
+			rotated := make([]uint, 0, len(members))
+			rotated = append(rotated, members[i+1:]...)
+			members = append(rotated, members[:i+1]...)
+			break
+		}
+	}
+
+	result := make([]models.PlaylistItem, 0, len(items))
+	for round := 0; len(result) < len(items); round++ {
+		for _, member := range members {
+			if round < len(queues[member]) {
+				result = append(result, queues[member][round])
+			}
+		}
+	}
+	return result
+}
+
+func firstQueuedTime(items []models.PlaylistItem) time.Time {
+	first := items[0].CreatedTime
+	for _, item := range items[1:] {
+		if item.CreatedTime.Before(first) {
+			first = item.CreatedTime
+		}
+	}
+	return first
+}
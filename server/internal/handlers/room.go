@@ -6,13 +6,16 @@ import (
 	"sync-player-server/internal/config"
 	"sync-player-server/internal/database"
 	"sync-player-server/internal/middleware"
+	"sync-player-server/internal/models"
+	"sync-player-server/internal/sync"
 	"sync-player-server/internal/utils"
 
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
 )
 
-// RoomCreate handles room creation
+// RoomCreate handles room creation, the caller becomes the owner of the room.
+// Creating a room whose name is taken returns the existing room.
 func RoomCreate(c *gin.Context) {
 	var req struct {
 		Name     string `json:"name" binding:"required"`
@@ -24,6 +27,17 @@ func RoomCreate(c *gin.Context) {
 		return
 	}
 
+	if len(req.Password) > maxPasswordLength {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Password is too long"})
+		return
+	}
+
+	claims, ok := middleware.GetJWTClaims(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+		return
+	}
+
 	existingRoom, err := database.GetRoomByName(req.Name)
 	if err == nil && existingRoom != nil {
 		c.JSON(http.StatusOK, gin.H{
@@ -39,7 +53,16 @@ func RoomCreate(c *gin.Context) {
 		password = &req.Password
 	}
 
-	room, err := database.CreateRoom(req.Name, password)
+	var room *models.Room
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		room, err = database.CreateRoom(req.Name, password, tx)
+		if err != nil {
+			return err
+		}
+		_, err = database.AddMemberToRoom(room.ID, claims.UserID, models.MemberRoleOwner, true, tx)
+		return err
+	})
 	if err != nil {
 		config.Logger.Errorf("Failed to create room: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
@@ -72,6 +95,7 @@ func RoomQuery(c *gin.Context) {
 		return
 	}
 
+	room.HasPassword = room.PasswordHash != nil
 	c.JSON(http.StatusOK, room)
 }
 
@@ -79,7 +103,7 @@ func RoomQuery(c *gin.Context) {
 func RoomJoin(c *gin.Context) {
 	var req struct {
 		RoomID   uint   `json:"roomId" binding:"required"`
-		UserID   uint   `json:"userId" binding:"required"`
+		UserID   uint   `json:"userId"`
 		Password string `json:"password"`
 	}
 
@@ -88,69 +112,173 @@ func RoomJoin(c *gin.Context) {
 		return
 	}
 
+	// The token of logging in tells who joins, only guests may join by id
+	claims, authenticated := middleware.GetJWTClaims(c)
+	if authenticated {
+		if req.UserID != 0 && req.UserID != claims.UserID {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Token does not belong to this user"})
+			return
+		}
+		req.UserID = claims.UserID
+	} else if req.UserID == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+
 	err := database.DB.Transaction(func(tx *gorm.DB) error {
-		user, err := database.GetUserByID(req.UserID)
+		// Concurrent joins wait here for each other so that they cannot take
+		// the room past its member limit together
+		room, err := database.LockRoom(req.RoomID, tx)
 		if err != nil {
-			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+			c.JSON(http.StatusNotFound, gin.H{"error": "Room not found"})
 			return err
 		}
 
-		room, err := database.GetRoomByID(req.RoomID)
+		user, err := database.GetUserByID(req.UserID, tx)
 		if err != nil {
-			c.JSON(http.StatusNotFound, gin.H{"error": "Room not found"})
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
 			return err
 		}
 
-		if !database.VerifyRoomPassword(room, req.Password) {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid password"})
+		if !authenticated && !user.IsGuest {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Login required to join as this user"})
 			return gorm.ErrInvalidData
 		}
 
-		existingMember, _ := database.GetRoomMember(req.RoomID, req.UserID)
-		if existingMember != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "User is already in the room"})
-			return gorm.ErrDuplicatedKey
+		if isBanned(c, req.RoomID, req.UserID, tx) {
+			return gorm.ErrInvalidData
+		}
+
+		if !database.VerifyRoomPassword(room, req.Password, tx) {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid password"})
+			return gorm.ErrInvalidData
 		}
 
-		newMember, err := database.AddMemberToRoom(req.RoomID, req.UserID, false, false, tx)
+		// Members join again from other devices, new members are let in as
+		// far as the settings of the room allow
+		member, err := database.GetRoomMember(req.RoomID, req.UserID, tx)
 		if err != nil {
-			config.Logger.Errorf("Failed to add member to room: %v", err)
+			if room.Visibility == models.RoomVisibilityPrivate {
+				c.JSON(http.StatusForbidden, gin.H{"error": "This room is private, join it with an invite"})
+				return gorm.ErrInvalidData
+			}
+			if isRoomFull(c, room, tx) {
+				return gorm.ErrInvalidData
+			}
+			member, err = database.AddMemberToRoom(req.RoomID, req.UserID, room.DefaultRole, false, tx)
+			if err != nil {
+				config.Logger.Errorf("Failed to add member to room: %v", err)
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+				return err
+			}
+		}
+
+		return respondWithRoomSession(c, user, member, claims, tx)
+	})
+
+	if err != nil {
+		return
+	}
+
+	closePreviousRoomConnections(claims, req.RoomID)
+}
+
+// respondWithRoomSession responds to a user joining the room of member with
+// a token for it. A logged in session, whose claims are given, moves into the
+// room, guests joining by id get a session of their own.
+func respondWithRoomSession(c *gin.Context, user *models.User, member *models.RoomMember, claims *utils.JWTClaims, tx *gorm.DB) error {
+	var response gin.H
+	if claims != nil {
+		if err := database.SetSessionRoom(claims.SessionID, member.RoomID, tx); err != nil {
+			config.Logger.Errorf("Failed to move session into room: %v", err)
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
 			return err
 		}
-
-		// Generate JWT token
-		token, err := utils.GenerateJWT(user.ID, user.Username, req.RoomID, newMember.IsAdmin)
+		token, err := utils.GenerateJWT(user.ID, user.Username, member.RoomID, string(member.Role), claims.SessionID)
 		if err != nil {
 			config.Logger.Errorf("Failed to generate JWT token: %v", err)
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate authentication token"})
 			return err
 		}
+		response = gin.H{
+			"token":     token,
+			"sessionId": claims.SessionID,
+			"expiresIn": int(utils.AccessTokenTTL().Seconds()),
+		}
+	} else {
+		var err error
+		response, err = startSession(c, user, "", member.RoomID, member.Role, tx)
+		if err != nil {
+			config.Logger.Errorf("Failed to start session: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate authentication token"})
+			return err
+		}
+	}
 
-		// Also set cookie for backward compatibility
-		middleware.SetUserInfoCookie(c, req.RoomID, user.ID)
-
-		c.JSON(http.StatusOK, gin.H{
-			"token":         token,
-			"roomId":        newMember.RoomID,
-			"userId":        newMember.UserID,
-			"isAdmin":       newMember.IsAdmin,
-			"canGrantAdmin": newMember.CanGrantAdmin,
-		})
+	response["roomId"] = member.RoomID
+	response["userId"] = member.UserID
+	response["role"] = member.Role
+	response["isAdmin"] = member.IsAdmin
+	response["canGrantAdmin"] = member.CanGrantAdmin
+	c.JSON(http.StatusOK, response)
+	return nil
+}
 
-		return nil
+// isBanned reports whether a user is banned from a room, and if so tells
+// them until when
+func isBanned(c *gin.Context, roomID, userID uint, tx *gorm.DB) bool {
+	ban, err := database.GetActiveBan(roomID, userID, tx)
+	if err != nil {
+		return false
+	}
+	c.JSON(http.StatusForbidden, gin.H{
+		"error":       "You are banned from this room",
+		"reason":      ban.Reason,
+		"bannedUntil": ban.ExpiresAt,
 	})
+	return true
+}
 
+// isRoomFull reports whether a room has as many members as it allows, and if
+// so tells the user joining it
+func isRoomFull(c *gin.Context, room *models.Room, tx *gorm.DB) bool {
+	if room.MaxMembers == 0 {
+		return false
+	}
+	counts, err := database.CountRoomMembers([]uint{room.ID}, tx)
 	if err != nil {
+		config.Logger.Errorf("Failed to count room members: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return true
+	}
+	if counts[room.ID] < int64(room.MaxMembers) {
+		return false
+	}
+	c.JSON(http.StatusForbidden, gin.H{
+		"error":      "Room is full",
+		"maxMembers": room.MaxMembers,
+	})
+	return true
+}
+
+// closePreviousRoomConnections closes the connections a logged in session
+// had in the room it was in before joining roomID
+func closePreviousRoomConnections(claims *utils.JWTClaims, roomID uint) {
+	if claims == nil || claims.RoomID == 0 || claims.RoomID == roomID {
 		return
 	}
+	sync.GetSyncManager().CloseConnections(sync.ConnectionFilter{
+		RoomID:    claims.RoomID,
+		SessionID: claims.SessionID,
+	}, "Joined another room")
 }
 
-// RoomLeave handles user leaving a room
-func RoomLeave(c *gin.Context) {
+// RoomChangePassword handles a member whose role manages the room settings
+// setting or, with an empty new password, removing the password of their
+// room. Members who already joined stay in the room.
+func RoomChangePassword(c *gin.Context) {
 	var req struct {
-		RoomID uint `json:"roomId" binding:"required"`
-		UserID uint `json:"userId" binding:"required"`
+		NewPassword string `json:"newPassword"`
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -158,18 +286,64 @@ func RoomLeave(c *gin.Context) {
 		return
 	}
 
-	_, err := database.GetRoomMember(req.RoomID, req.UserID)
-	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "User is not in the room"})
+	if len(req.NewPassword) > maxPasswordLength {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Password is too long"})
+		return
+	}
+
+	userInfo, ok := middleware.GetUserInfo(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+		return
+	}
+
+	var password *string
+	if req.NewPassword != "" {
+		password = &req.NewPassword
+	}
+
+	if err := database.UpdateRoomPassword(userInfo.RoomID, password); err != nil {
+		config.Logger.Errorf("Failed to update room password: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	message := "Password updated"
+	if password == nil {
+		message = "Password removed"
+	}
+	c.JSON(http.StatusOK, gin.H{"message": message})
+}
+
+// RoomLeave handles the caller leaving their room. The owner hands the room
+// over to another member first.
+func RoomLeave(c *gin.Context) {
+	member, ok := middleware.GetRoomMember(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
 		return
 	}
 
-	if err := database.RemoveMemberFromRoom(req.RoomID, req.UserID); err != nil {
+	if member.Role == models.MemberRoleOwner {
+		c.JSON(http.StatusConflict, gin.H{"error": "Transfer ownership of the room before leaving it"})
+		return
+	}
+
+	if err := database.RemoveMemberFromRoom(member.RoomID, member.UserID); err != nil {
 		config.Logger.Errorf("Failed to remove member from room: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
 		return
 	}
 
+	// The tokens of the member for the room stop opening it
+	if _, err := database.LeaveSessionRoom(member.RoomID, member.UserID); err != nil {
+		config.Logger.Errorf("Failed to take sessions out of room: %v", err)
+	}
+	sync.GetSyncManager().CloseConnections(sync.ConnectionFilter{
+		RoomID: member.RoomID,
+		UserID: member.UserID,
+	}, "Left the room")
+
 	c.JSON(http.StatusOK, gin.H{"message": "Successfully left the room"})
 }
 
@@ -0,0 +1,186 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"sync-player-server/internal/config"
+	"sync-player-server/internal/database"
+	"sync-player-server/internal/middleware"
+	"sync-player-server/internal/models"
+	"sync-player-server/internal/sync"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxPublicRooms is how many public rooms the room list shows
+const maxPublicRooms = 100
+
+// RoomSettings handles querying the settings of the caller's room
+func RoomSettings(c *gin.Context) {
+	userInfo, ok := middleware.GetUserInfo(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+		return
+	}
+
+	room, err := database.GetRoomByID(userInfo.RoomID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Room not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, roomSettings(room))
+}
+
+// RoomUpdateSettings handles an admin changing the settings of their room.
+// Settings left out keep their value. Lowering the capacity keeps the
+// members who already joined.
+func RoomUpdateSettings(c *gin.Context) {
+	var req struct {
+		MaxMembers           *int                   `json:"maxMembers"`
+		Visibility           *models.RoomVisibility `json:"visibility"`
+		DefaultRole          *models.MemberRole     `json:"defaultRole"`
+		ControlPolicy        *models.ControlPolicy  `json:"controlPolicy"`
+		SyncToleranceSeconds *float64               `json:"syncToleranceSeconds"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+
+	userInfo, ok := middleware.GetUserInfo(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+		return
+	}
+
+	room, err := database.GetRoomByID(userInfo.RoomID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Room not found"})
+		return
+	}
+
+	// Zero means members can join without limit
+	if req.MaxMembers != nil {
+		if *req.MaxMembers < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Max members must not be negative"})
+			return
+		}
+		room.MaxMembers = *req.MaxMembers
+	}
+
+	if req.Visibility != nil {
+		switch *req.Visibility {
+		case models.RoomVisibilityPublic, models.RoomVisibilityUnlisted, models.RoomVisibilityPrivate:
+		default:
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Visibility must be public, unlisted or private"})
+			return
+		}
+		room.Visibility = *req.Visibility
+	}
+
+	// Admins are made by granting the role, not by joining
+	if req.DefaultRole != nil {
+		switch *req.DefaultRole {
+		case models.MemberRoleModerator, models.MemberRoleMember, models.MemberRoleViewer:
+		default:
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Default role must be moderator, member or viewer"})
+			return
+		}
+		room.DefaultRole = *req.DefaultRole
+	}
+
+	if req.ControlPolicy != nil {
+		switch *req.ControlPolicy {
+		case models.ControlPolicyEveryone, models.ControlPolicyModerators, models.ControlPolicyAdmins:
+		default:
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Control policy must be everyone, moderators or admins"})
+			return
+		}
+		room.ControlPolicy = *req.ControlPolicy
+	}
+
+	// Zero falls back to the server default
+	if req.SyncToleranceSeconds != nil {
+		if *req.SyncToleranceSeconds < 0 || *req.SyncToleranceSeconds > config.MaxSyncToleranceSeconds {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Sync tolerance must be between 0 and %d seconds", config.MaxSyncToleranceSeconds)})
+			return
+		}
+		room.SyncToleranceSeconds = *req.SyncToleranceSeconds
+	}
+
+	if err := database.UpdateRoomSettings(room); err != nil {
+		config.Logger.Errorf("Failed to update room settings: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	syncManager := sync.GetSyncManager()
+	if syncManager != nil {
+		payload := roomSettings(room)
+		payload["roomId"] = room.ID
+		payload["updatedBy"] = userInfo.UserID
+		syncManager.Broadcast(room.ID, sync.SyncMessage{
+			Type:    "updateRoomSettings",
+			Payload: payload,
+		}, nil)
+	}
+
+	c.JSON(http.StatusOK, roomSettings(room))
+}
+
+// RoomList handles listing the public rooms with how many members they have
+func RoomList(c *gin.Context) {
+	rooms, err := database.GetPublicRooms(maxPublicRooms)
+	if err != nil {
+		config.Logger.Errorf("Failed to query public rooms: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	roomIDs := make([]uint, 0, len(rooms))
+	for _, room := range rooms {
+		roomIDs = append(roomIDs, room.ID)
+	}
+	counts, err := database.CountRoomMembers(roomIDs)
+	if err != nil {
+		config.Logger.Errorf("Failed to count room members: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	result := make([]gin.H, 0, len(rooms))
+	for _, room := range rooms {
+		result = append(result, gin.H{
+			"id":             room.ID,
+			"name":           room.Name,
+			"hasPassword":    room.PasswordHash != nil,
+			"maxMembers":     room.MaxMembers,
+			"memberCount":    counts[room.ID],
+			"lastActiveTime": room.LastActiveTime,
+		})
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
+// roomSettings returns the settings of a room as players go by them
+func roomSettings(room *models.Room) gin.H {
+	return gin.H{
+		"maxMembers":           room.MaxMembers,
+		"visibility":           room.Visibility,
+		"defaultRole":          room.DefaultRole,
+		"controlPolicy":        room.ControlPolicy,
+		"syncToleranceSeconds": effectiveSyncTolerance(room),
+	}
+}
+
+// effectiveSyncTolerance returns the sync tolerance of a room, falling back
+// to the server default
+func effectiveSyncTolerance(room *models.Room) float64 {
+	if room.SyncToleranceSeconds > 0 {
+		return room.SyncToleranceSeconds
+	}
+	return config.Env.SyncToleranceSeconds
+}
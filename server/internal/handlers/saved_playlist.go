@@ -0,0 +1,408 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"sync-player-server/internal/config"
+	"sync-player-server/internal/database"
+	"sync-player-server/internal/middleware"
+	"sync-player-server/internal/models"
+	"sync-player-server/internal/sync"
+	"sync-player-server/internal/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+const maxSavedPlaylistNameLength = 100
+
+// SavedPlaylistSave saves the playlist of the caller's room as a saved
+// playlist of the caller, overwriting one of the caller's saved playlists
+// when savedPlaylistId is given
+func SavedPlaylistSave(c *gin.Context) {
+	var req struct {
+		Name            string `json:"name" binding:"required"`
+		SavedPlaylistID uint   `json:"savedPlaylistId"`
+		IncludeFinished bool   `json:"includeFinished"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+
+	userInfo, ok := middleware.GetUserInfo(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+		return
+	}
+
+	name, ok := validateSavedPlaylistName(c, req.Name)
+	if !ok {
+		return
+	}
+
+	playlist := &models.SavedPlaylist{UserID: userInfo.UserID, Name: name}
+	if req.SavedPlaylistID != 0 {
+		existing, ok := getOwnSavedPlaylist(c, req.SavedPlaylistID, userInfo.UserID)
+		if !ok {
+			return
+		}
+		playlist = existing
+		playlist.Name = name
+	}
+
+	room, err := database.GetRoomByID(userInfo.RoomID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Room not found"})
+		return
+	}
+
+	playlistItems, err := database.QueryPlaylistItems(userInfo.RoomID, nil, nil)
+	if err != nil {
+		config.Logger.Errorf("Failed to query playlist: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+	// Save items in the order the room would play them
+	arrangePlaylist(room, playlistItems)
+
+	items := make([]models.SavedPlaylistItem, 0, len(playlistItems))
+	for _, playlistItem := range playlistItems {
+		if playlistItem.PlayStatus == models.PlayStatusFinished && !req.IncludeFinished {
+			continue
+		}
+		sources := make([]models.SavedSource, 0, len(playlistItem.VideoSources))
+		for _, source := range playlistItem.VideoSources {
+			sources = append(sources, models.SavedSource{URL: source.URL, Label: source.Label})
+		}
+		items = append(items, models.SavedPlaylistItem{
+			Title:   playlistItem.Title,
+			Sources: sources,
+		})
+	}
+
+	if len(items) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Playlist is empty"})
+		return
+	}
+
+	if err := database.SaveSavedPlaylist(playlist, items); err != nil {
+		config.Logger.Errorf("Failed to save playlist: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":         "Playlist saved",
+		"savedPlaylistId": playlist.ID,
+		"itemCount":       len(items),
+	})
+}
+
+// SavedPlaylistList returns the saved playlists of the caller without their items
+func SavedPlaylistList(c *gin.Context) {
+	userInfo, ok := middleware.GetUserInfo(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+		return
+	}
+
+	playlists, err := database.GetSavedPlaylistsByUserID(userInfo.UserID)
+	if err != nil {
+		config.Logger.Errorf("Failed to query saved playlists: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	c.JSON(http.StatusOK, playlists)
+}
+
+// SavedPlaylistQuery returns a saved playlist of the caller with its items
+func SavedPlaylistQuery(c *gin.Context) {
+	userInfo, ok := middleware.GetUserInfo(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+		return
+	}
+
+	var savedPlaylistID uint
+	if _, err := fmt.Sscanf(c.Query("savedPlaylistId"), "%d", &savedPlaylistID); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid saved playlist ID"})
+		return
+	}
+
+	playlist, ok := getOwnSavedPlaylist(c, savedPlaylistID, userInfo.UserID)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, playlist)
+}
+
+// SavedPlaylistShared returns a shared saved playlist by its share token. It
+// needs no authentication, the token itself grants read-only access.
+func SavedPlaylistShared(c *gin.Context) {
+	token := c.Query("token")
+	if token == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Share token is required"})
+		return
+	}
+
+	playlist, err := database.GetSavedPlaylistByShareToken(token)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Saved playlist not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"name":      playlist.Name,
+		"itemCount": playlist.ItemCount,
+		"items":     playlist.Items,
+	})
+}
+
+// SavedPlaylistLoad loads a saved playlist of the caller, or a shared one by
+// its share token, into a room the caller is a member of. The room defaults
+// to the caller's current room.
+func SavedPlaylistLoad(c *gin.Context) {
+	var req struct {
+		SavedPlaylistID uint   `json:"savedPlaylistId"`
+		ShareToken      string `json:"shareToken"`
+		RoomID          uint   `json:"roomId"`
+		Mode            string `json:"mode"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+
+	userInfo, ok := middleware.GetUserInfo(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+		return
+	}
+
+	var replace bool
+	switch req.Mode {
+	case "", "append":
+		replace = false
+	case "replace":
+		replace = true
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Mode must be append or replace"})
+		return
+	}
+
+	var playlist *models.SavedPlaylist
+	switch {
+	case req.SavedPlaylistID != 0:
+		playlist, ok = getOwnSavedPlaylist(c, req.SavedPlaylistID, userInfo.UserID)
+		if !ok {
+			return
+		}
+	case req.ShareToken != "":
+		var err error
+		playlist, err = database.GetSavedPlaylistByShareToken(req.ShareToken)
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Saved playlist not found"})
+			return
+		}
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Saved playlist ID or share token is required"})
+		return
+	}
+
+	// The playlist may be loaded into another room of the caller, whose
+	// role there has to allow it
+	roomID := userInfo.RoomID
+	if req.RoomID != 0 {
+		roomID = req.RoomID
+	}
+	if !memberCan(roomID, userInfo.UserID, models.PermissionEditPlaylist) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Your role does not allow editing the playlist of the room"})
+		return
+	}
+	if replace && !memberCan(roomID, userInfo.UserID, models.PermissionManagePlaylist) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only moderators can replace the playlist"})
+		return
+	}
+
+	if len(playlist.Items) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Saved playlist is empty"})
+		return
+	}
+
+	items := make([]database.PlaylistItemInput, 0, len(playlist.Items))
+	for _, item := range playlist.Items {
+		sources := make([]database.VideoSourceInput, 0, len(item.Sources))
+		for _, source := range item.Sources {
+			sources = append(sources, database.VideoSourceInput{
+				URL:   source.URL,
+				Label: source.Label,
+			})
+		}
+		items = append(items, database.PlaylistItemInput{
+			Title:   item.Title,
+			Sources: sources,
+		})
+	}
+
+	if !checkQueueLimit(c, roomID, userInfo.UserID, len(items), replace) {
+		return
+	}
+
+	playlistItemIDs, err := database.ImportPlaylistItems(roomID, userInfo.UserID, items, replace)
+	if err != nil {
+		config.Logger.Errorf("Failed to load saved playlist: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	probePlaylistItems(roomID, playlistItemIDs)
+
+	syncManager := sync.GetSyncManager()
+	if syncManager != nil {
+		syncManager.Broadcast(roomID, sync.SyncMessage{
+			Type: "updatePlaylist",
+		}, []uint{userInfo.UserID})
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":         "Saved playlist loaded",
+		"roomId":          roomID,
+		"loaded":          len(playlistItemIDs),
+		"playlistItemIds": playlistItemIDs,
+	})
+}
+
+// SavedPlaylistRename renames a saved playlist of the caller
+func SavedPlaylistRename(c *gin.Context) {
+	var req struct {
+		SavedPlaylistID uint   `json:"savedPlaylistId" binding:"required"`
+		Name            string `json:"name" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+
+	userInfo, ok := middleware.GetUserInfo(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+		return
+	}
+
+	name, ok := validateSavedPlaylistName(c, req.Name)
+	if !ok {
+		return
+	}
+
+	if _, ok := getOwnSavedPlaylist(c, req.SavedPlaylistID, userInfo.UserID); !ok {
+		return
+	}
+
+	if err := database.UpdateSavedPlaylist(req.SavedPlaylistID, map[string]interface{}{"name": name}); err != nil {
+		config.Logger.Errorf("Failed to rename saved playlist: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Saved playlist renamed"})
+}
+
+// SavedPlaylistShare enables or disables read-only sharing of a saved
+// playlist of the caller. Enabling it again issues a new share token and
+// invalidates the previous link.
+func SavedPlaylistShare(c *gin.Context) {
+	var req struct {
+		SavedPlaylistID uint  `json:"savedPlaylistId" binding:"required"`
+		Enabled         *bool `json:"enabled" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+
+	userInfo, ok := middleware.GetUserInfo(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+		return
+	}
+
+	if _, ok := getOwnSavedPlaylist(c, req.SavedPlaylistID, userInfo.UserID); !ok {
+		return
+	}
+
+	var shareToken *string
+	if *req.Enabled {
+		token, err := utils.GenerateToken(24)
+		if err != nil {
+			config.Logger.Errorf("Failed to generate share token: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+			return
+		}
+		shareToken = &token
+	}
+
+	if err := database.UpdateSavedPlaylist(req.SavedPlaylistID, map[string]interface{}{"share_token": shareToken}); err != nil {
+		config.Logger.Errorf("Failed to update share token: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":    "Sharing updated",
+		"shareToken": shareToken,
+	})
+}
+
+// SavedPlaylistDelete deletes a saved playlist of the caller
+func SavedPlaylistDelete(c *gin.Context) {
+	userInfo, ok := middleware.GetUserInfo(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+		return
+	}
+
+	var savedPlaylistID uint
+	if _, err := fmt.Sscanf(c.Query("savedPlaylistId"), "%d", &savedPlaylistID); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid saved playlist ID"})
+		return
+	}
+
+	if _, ok := getOwnSavedPlaylist(c, savedPlaylistID, userInfo.UserID); !ok {
+		return
+	}
+
+	if err := database.DeleteSavedPlaylist(savedPlaylistID); err != nil {
+		config.Logger.Errorf("Failed to delete saved playlist: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Saved playlist deleted"})
+}
+
+// getOwnSavedPlaylist loads a saved playlist owned by the user, writing a not
+// found response otherwise so that other users' playlists are not revealed
+func getOwnSavedPlaylist(c *gin.Context, savedPlaylistID, userID uint) (*models.SavedPlaylist, bool) {
+	playlist, err := database.GetSavedPlaylistByID(savedPlaylistID)
+	if err != nil || playlist.UserID != userID {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Saved playlist not found"})
+		return nil, false
+	}
+	return playlist, true
+}
+
+func validateSavedPlaylistName(c *gin.Context, name string) (string, bool) {
+	name = strings.TrimSpace(name)
+	if name == "" || len([]rune(name)) > maxSavedPlaylistNameLength {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Name must be 1 to %d characters", maxSavedPlaylistNameLength)})
+		return "", false
+	}
+	return name, true
+}
@@ -0,0 +1,283 @@
+package handlers
+
+import (
+	"net/http"
+	"sync-player-server/internal/config"
+	"sync-player-server/internal/database"
+	"sync-player-server/internal/middleware"
+	"sync-player-server/internal/models"
+	"sync-player-server/internal/sync"
+	"sync-player-server/internal/utils"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// maxDeviceLength matches the device column of sessions
+const maxDeviceLength = 255
+
+// SessionRefresh handles exchanging a refresh token for a new access token
+// and a new refresh token. Presenting a refresh token which was already
+// exchanged revokes the session, since one of its holders stole it.
+func SessionRefresh(c *gin.Context) {
+	var req struct {
+		RefreshToken string `json:"refreshToken" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+
+	tokenHash := utils.HashToken(req.RefreshToken)
+	session, reused, err := database.GetSessionByRefreshToken(tokenHash)
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid refresh token"})
+			return
+		}
+		config.Logger.Errorf("Failed to query session: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	if reused {
+		config.Logger.Warnf("Refresh token of session %d was reused, revoking the session", session.ID)
+		revokeSessions(session.ID)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid refresh token"})
+		return
+	}
+	if session.RevokedAt != nil || !time.Now().Before(session.ExpiresAt) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Session expired or revoked"})
+		return
+	}
+
+	user, err := database.GetUserByID(session.UserID)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid refresh token"})
+		return
+	}
+
+	refreshToken, err := utils.GenerateToken(32)
+	if err != nil {
+		config.Logger.Errorf("Failed to generate refresh token: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+	if err := database.RotateSessionRefreshToken(session.ID, tokenHash, utils.HashToken(refreshToken), refreshExpiry()); err != nil {
+		if err == database.ErrRefreshTokenRotated {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid refresh token"})
+			return
+		}
+		config.Logger.Errorf("Failed to rotate refresh token: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	// A session whose member left the room meanwhile goes back to opening
+	// no room
+	role := ""
+	if session.RoomID != 0 {
+		member, err := database.GetRoomMember(session.RoomID, session.UserID)
+		if err != nil {
+			if _, err := database.LeaveSessionRoom(session.RoomID, session.UserID); err != nil {
+				config.Logger.Errorf("Failed to take session out of room: %v", err)
+			}
+			session.RoomID = 0
+		} else {
+			role = string(member.Role)
+		}
+	}
+
+	token, err := utils.GenerateJWT(user.ID, user.Username, session.RoomID, role, session.ID)
+	if err != nil {
+		config.Logger.Errorf("Failed to generate JWT token: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate authentication token"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"token":        token,
+		"refreshToken": refreshToken,
+		"sessionId":    session.ID,
+		"expiresIn":    int(utils.AccessTokenTTL().Seconds()),
+		"roomId":       session.RoomID,
+	})
+}
+
+// SessionList handles listing the active sessions of the caller, one per
+// device they logged in on
+func SessionList(c *gin.Context) {
+	claims, ok := middleware.GetJWTClaims(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+		return
+	}
+
+	sessions, err := database.GetActiveSessionsByUserID(claims.UserID)
+	if err != nil {
+		config.Logger.Errorf("Failed to query sessions: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	type sessionInfo struct {
+		models.Session
+		Current bool `json:"current"`
+	}
+	result := make([]sessionInfo, 0, len(sessions))
+	for _, session := range sessions {
+		result = append(result, sessionInfo{Session: session, Current: session.ID == claims.SessionID})
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
+// SessionRevoke handles the caller revoking one of their sessions, which
+// logs that device out
+func SessionRevoke(c *gin.Context) {
+	var req struct {
+		SessionID uint `json:"sessionId" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+
+	claims, ok := middleware.GetJWTClaims(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+		return
+	}
+
+	session, err := database.GetActiveSession(req.SessionID)
+	if err != nil || session.UserID != claims.UserID {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Session not found"})
+		return
+	}
+
+	if err := database.RevokeSession(session.ID); err != nil {
+		config.Logger.Errorf("Failed to revoke session: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+	closeSessionConnections([]uint{session.ID}, "Session revoked")
+
+	c.JSON(http.StatusOK, gin.H{"message": "Session revoked"})
+}
+
+// SessionRevokeOthers handles the caller revoking every session but the one
+// of the request
+func SessionRevokeOthers(c *gin.Context) {
+	claims, ok := middleware.GetJWTClaims(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+		return
+	}
+
+	sessionIDs, err := database.RevokeUserSessions(claims.UserID, claims.SessionID)
+	if err != nil {
+		config.Logger.Errorf("Failed to revoke sessions: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+	closeSessionConnections(sessionIDs, "Session revoked")
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Sessions revoked",
+		"count":   len(sessionIDs),
+	})
+}
+
+// SessionLogout handles the caller ending the session of the request
+func SessionLogout(c *gin.Context) {
+	claims, ok := middleware.GetJWTClaims(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+		return
+	}
+
+	if err := database.RevokeSession(claims.SessionID); err != nil {
+		config.Logger.Errorf("Failed to revoke session: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+	closeSessionConnections([]uint{claims.SessionID}, "Logged out")
+
+	c.JSON(http.StatusOK, gin.H{"message": "Logged out"})
+}
+
+// startSession creates a session for a user on the device of the request,
+// already in a room when roomID is set, and returns its tokens
+func startSession(c *gin.Context, user *models.User, device string, roomID uint, role models.MemberRole, tx ...*gorm.DB) (gin.H, error) {
+	refreshToken, err := utils.GenerateToken(32)
+	if err != nil {
+		return nil, err
+	}
+
+	if device == "" {
+		device = c.Request.UserAgent()
+	}
+	device = truncateString(device, maxDeviceLength)
+
+	session := &models.Session{
+		UserID:           user.ID,
+		RoomID:           roomID,
+		RefreshTokenHash: utils.HashToken(refreshToken),
+		Device:           device,
+		IPAddress:        c.ClientIP(),
+		LastUsedTime:     time.Now(),
+		ExpiresAt:        refreshExpiry(),
+	}
+	if err := database.CreateSession(session, tx...); err != nil {
+		return nil, err
+	}
+
+	token, err := utils.GenerateJWT(user.ID, user.Username, roomID, string(role), session.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	return gin.H{
+		"token":        token,
+		"refreshToken": refreshToken,
+		"sessionId":    session.ID,
+		"expiresIn":    int(utils.AccessTokenTTL().Seconds()),
+	}, nil
+}
+
+// revokeSessions revokes sessions and closes their live connections
+func revokeSessions(sessionIDs ...uint) {
+	for _, sessionID := range sessionIDs {
+		if err := database.RevokeSession(sessionID); err != nil {
+			config.Logger.Errorf("Failed to revoke session %d: %v", sessionID, err)
+		}
+	}
+	closeSessionConnections(sessionIDs, "Session revoked")
+}
+
+// closeSessionConnections closes the live sync connections of sessions
+func closeSessionConnections(sessionIDs []uint, reason string) {
+	manager := sync.GetSyncManager()
+	if manager == nil {
+		return
+	}
+	for _, sessionID := range sessionIDs {
+		manager.CloseConnections(sync.ConnectionFilter{SessionID: sessionID}, reason)
+	}
+}
+
+// cleanStaleSessions drops the sessions which expired or were revoked more
+// than a refresh token lifetime ago
+func cleanStaleSessions() {
+	before := time.Now().Add(-time.Duration(config.Env.JWTRefreshTTLDays) * 24 * time.Hour)
+	if err := database.DeleteStaleSessions(before); err != nil {
+		config.Logger.Errorf("Failed to delete stale sessions: %v", err)
+	}
+}
+
+func refreshExpiry() time.Time {
+	return time.Now().Add(time.Duration(config.Env.JWTRefreshTTLDays) * 24 * time.Hour)
+}
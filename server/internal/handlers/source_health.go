@@ -0,0 +1,61 @@
+package handlers
+
+import (
+	"net/http"
+	"sync-player-server/internal/config"
+	"sync-player-server/internal/database"
+	"sync-player-server/internal/health"
+	"sync-player-server/internal/middleware"
+	"sync-player-server/internal/sync"
+
+	"github.com/gin-gonic/gin"
+)
+
+// PlaylistReportSourceError records a playback error a client ran into
+func PlaylistReportSourceError(c *gin.Context) {
+	var req struct {
+		SourceID uint   `json:"sourceId" binding:"required"`
+		Error    string `json:"error"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+
+	userInfo, ok := middleware.GetUserInfo(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+		return
+	}
+
+	source, err := database.GetVideoSourceByID(req.SourceID)
+	if err != nil || source.PlaylistItem == nil || source.PlaylistItem.RoomID != userInfo.RoomID {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Video source not found"})
+		return
+	}
+
+	checker := health.GetChecker()
+	if checker == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Source health tracking is not available"})
+		return
+	}
+
+	onlineMembers := 0
+	syncManager := sync.GetSyncManager()
+	if syncManager != nil {
+		onlineMembers = len(syncManager.GetUserIDsInRoom(userInfo.RoomID))
+	}
+
+	unhealthy, err := checker.ReportPlaybackError(userInfo.UserID, source, req.Error, onlineMembers)
+	if err != nil {
+		config.Logger.Errorf("Failed to record playback error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":   "Playback error reported",
+		"unhealthy": unhealthy,
+	})
+}
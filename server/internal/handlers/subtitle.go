@@ -0,0 +1,280 @@
+package handlers
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync-player-server/internal/config"
+	"sync-player-server/internal/database"
+	"sync-player-server/internal/middleware"
+	"sync-player-server/internal/models"
+	"sync-player-server/internal/subtitle"
+	"sync-player-server/internal/sync"
+
+	"github.com/gin-gonic/gin"
+)
+
+const maxSubtitleUploadBytes = 2 * 1024 * 1024
+
+// languagePattern loosely matches BCP 47 language tags such as "en" or "zh-Hans"
+var languagePattern = regexp.MustCompile(`^[A-Za-z]{2,3}(-[A-Za-z0-9]{2,8})*$`)
+
+// SubtitleAdd attaches an external WebVTT subtitle track to a playlist item
+func SubtitleAdd(c *gin.Context) {
+	var req struct {
+		PlaylistItemID uint   `json:"playlistItemId" binding:"required"`
+		Language       string `json:"language"`
+		Label          string `json:"label"`
+		URL            string `json:"url" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+
+	userInfo, ok := middleware.GetUserInfo(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+		return
+	}
+
+	if err := validateMediaURL(req.URL); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	track := &models.SubtitleTrack{
+		PlaylistItemID: req.PlaylistItemID,
+		URL:            req.URL,
+		Format:         string(subtitle.FormatWebVTT),
+	}
+	createSubtitleTrack(c, userInfo, track, req.Language, req.Label)
+}
+
+// SubtitleUpload uploads an SRT, ASS or WebVTT file as a subtitle track of a
+// playlist item. The file is converted to WebVTT and stored in the database.
+func SubtitleUpload(c *gin.Context) {
+	userInfo, ok := middleware.GetUserInfo(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+		return
+	}
+
+	var playlistItemID uint
+	if _, err := fmt.Sscanf(c.PostForm("playlistItemId"), "%d", &playlistItemID); err != nil || playlistItemID == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid playlist item ID"})
+		return
+	}
+
+	fileHeader, err := c.FormFile("file")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Subtitle file is required"})
+		return
+	}
+	if fileHeader.Size > maxSubtitleUploadBytes {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "Subtitle file is too large"})
+		return
+	}
+
+	file, err := fileHeader.Open()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read subtitle file"})
+		return
+	}
+	defer file.Close()
+
+	content, err := io.ReadAll(io.LimitReader(file, maxSubtitleUploadBytes+1))
+	if err != nil || len(content) > maxSubtitleUploadBytes {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read subtitle file"})
+		return
+	}
+
+	format, err := subtitle.DetectFormat(fileHeader.Filename, content)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	vtt, err := subtitle.ToWebVTT(format, content)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	label := c.PostForm("label")
+	if label == "" {
+		label = strings.TrimSuffix(fileHeader.Filename, "."+string(format))
+	}
+
+	track := &models.SubtitleTrack{
+		PlaylistItemID: playlistItemID,
+		Content:        vtt,
+		Format:         string(format),
+		Uploaded:       true,
+	}
+	createSubtitleTrack(c, userInfo, track, c.PostForm("language"), label)
+}
+
+// createSubtitleTrack validates the metadata shared by external and uploaded
+// tracks, stores the track and notifies the room
+func createSubtitleTrack(c *gin.Context, userInfo *middleware.UserInfo, track *models.SubtitleTrack, language, label string) {
+	language = strings.TrimSpace(language)
+	if language != "" && (len(language) > 35 || !languagePattern.MatchString(language)) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid language tag"})
+		return
+	}
+
+	label = truncateString(strings.TrimSpace(label), 100)
+	if label == "" {
+		label = language
+	}
+
+	if !playlistItemInRoom(track.PlaylistItemID, userInfo.RoomID) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Playlist item not found"})
+		return
+	}
+
+	track.Language = language
+	track.Label = label
+	if err := database.CreateSubtitleTrack(track); err != nil {
+		config.Logger.Errorf("Failed to create subtitle track: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	syncManager := sync.GetSyncManager()
+	if syncManager != nil {
+		syncManager.Broadcast(userInfo.RoomID, sync.SyncMessage{
+			Type: "updatePlaylist",
+		}, []uint{userInfo.UserID})
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":         "Subtitle track added",
+		"subtitleTrackId": track.ID,
+	})
+}
+
+// SubtitleQuery lists the subtitle tracks of a playlist item
+func SubtitleQuery(c *gin.Context) {
+	userInfo, ok := middleware.GetUserInfo(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+		return
+	}
+
+	var playlistItemID uint
+	if _, err := fmt.Sscanf(c.Query("playlistItemId"), "%d", &playlistItemID); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid playlist item ID"})
+		return
+	}
+
+	if !playlistItemInRoom(playlistItemID, userInfo.RoomID) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Playlist item not found"})
+		return
+	}
+
+	tracks, err := database.GetSubtitleTracksByPlaylistItemID(playlistItemID)
+	if err != nil {
+		config.Logger.Errorf("Failed to query subtitle tracks: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	c.JSON(http.StatusOK, tracks)
+}
+
+// SubtitleContent serves the WebVTT content of an uploaded subtitle track
+func SubtitleContent(c *gin.Context) {
+	userInfo, ok := middleware.GetUserInfo(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+		return
+	}
+
+	var subtitleTrackID uint
+	if _, err := fmt.Sscanf(c.Query("subtitleTrackId"), "%d", &subtitleTrackID); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid subtitle track ID"})
+		return
+	}
+
+	track, err := database.GetSubtitleTrackByID(subtitleTrackID)
+	if err != nil || track.PlaylistItem == nil || track.PlaylistItem.RoomID != userInfo.RoomID {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Subtitle track not found"})
+		return
+	}
+
+	if !track.Uploaded {
+		c.Redirect(http.StatusFound, track.URL)
+		return
+	}
+
+	c.Data(http.StatusOK, "text/vtt; charset=utf-8", []byte(track.Content))
+}
+
+// SubtitleDelete deletes a subtitle track
+func SubtitleDelete(c *gin.Context) {
+	var req struct {
+		SubtitleTrackID uint `json:"subtitleTrackId" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+
+	userInfo, ok := middleware.GetUserInfo(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+		return
+	}
+
+	track, err := database.GetSubtitleTrackByID(req.SubtitleTrackID)
+	if err != nil || track.PlaylistItem == nil || track.PlaylistItem.RoomID != userInfo.RoomID {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Subtitle track not found"})
+		return
+	}
+
+	if err := database.DeleteSubtitleTrack(track.ID); err != nil {
+		config.Logger.Errorf("Failed to delete subtitle track: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	syncManager := sync.GetSyncManager()
+
+	// Turn subtitles off for the room when the selected track is gone
+	if status, err := database.GetRoomPlayStatus(userInfo.RoomID); err == nil && status.SubtitleTrackID == track.ID {
+		database.UpdateRoomPlayStatus(userInfo.RoomID, map[string]interface{}{
+			"subtitle_track_id": 0,
+		})
+		if syncManager != nil {
+			syncManager.Broadcast(userInfo.RoomID, sync.SyncMessage{
+				Type: "updateSubtitle",
+				Payload: map[string]interface{}{
+					"roomId":          userInfo.RoomID,
+					"userId":          userInfo.UserID,
+					"subtitleTrackId": 0,
+					"offset":          status.SubtitleOffset,
+				},
+			}, nil)
+		}
+	}
+
+	if syncManager != nil {
+		syncManager.Broadcast(userInfo.RoomID, sync.SyncMessage{
+			Type: "updatePlaylist",
+		}, []uint{userInfo.UserID})
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Subtitle track deleted"})
+}
+
+// playlistItemInRoom reports whether a playlist item exists in the given room
+func playlistItemInRoom(playlistItemID, roomID uint) bool {
+	items, err := database.QueryPlaylistItems(roomID, &playlistItemID, nil)
+	return err == nil && len(items) > 0
+}
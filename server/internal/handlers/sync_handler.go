@@ -33,16 +33,34 @@ func SyncUpdateTime(c *gin.Context) {
 	config.Logger.Infof("sync updateTime: roomId=%d, userId=%d, time=%f, timestamp=%d, videoId=%d",
 		userInfo.RoomID, userInfo.UserID, req.Time, req.Timestamp, req.VideoID)
 
-	_, err := database.GetRoomPlayStatus(userInfo.RoomID)
+	updateRoomPlayTime(userInfo, req.Time, req.Timestamp, req.VideoID, []uint{userInfo.UserID})
+
+	c.JSON(http.StatusOK, gin.H{"message": "Play status updated"})
+}
+
+// updateRoomPlayTime stores a new playback position of the room and
+// broadcasts it to the members which are not excluded
+func updateRoomPlayTime(userInfo *middleware.UserInfo, playTime float64, timestamp int64, videoID uint, excludeUserIDs []uint) {
+	currentStatus, err := database.GetRoomPlayStatus(userInfo.RoomID)
+	if err != nil || currentStatus.VideoID != videoID {
+		recordPlaybackChange(userInfo.RoomID, currentStatus, videoID)
+	}
 	if err != nil {
-		database.CreateRoomPlayStatus(userInfo.RoomID, false, req.Time, req.Timestamp, req.VideoID)
+		database.CreateRoomPlayStatus(userInfo.RoomID, false, playTime, timestamp, videoID)
 	} else {
-		database.UpdateRoomPlayStatus(userInfo.RoomID, map[string]interface{}{
+		updates := map[string]interface{}{
 			"paused":    false,
-			"time":      req.Time,
-			"timestamp": req.Timestamp,
-			"video_id":  req.VideoID,
-		})
+			"time":      playTime,
+			"timestamp": timestamp,
+			"video_id":  videoID,
+		}
+		// The selected source and subtitle track belong to the previous video
+		if currentStatus.VideoID != videoID {
+			updates["source_id"] = 0
+			updates["subtitle_track_id"] = 0
+			updates["subtitle_offset"] = 0.0
+		}
+		database.UpdateRoomPlayStatus(userInfo.RoomID, updates)
 	}
 
 	syncManager := sync.GetSyncManager()
@@ -53,14 +71,12 @@ func SyncUpdateTime(c *gin.Context) {
 				"roomId":    userInfo.RoomID,
 				"userId":    userInfo.UserID,
 				"paused":    false,
-				"time":      req.Time,
-				"timestamp": req.Timestamp,
-				"videoId":   req.VideoID,
+				"time":      playTime,
+				"timestamp": timestamp,
+				"videoId":   videoID,
 			},
-		}, []uint{userInfo.UserID})
+		}, excludeUserIDs)
 	}
-
-	c.JSON(http.StatusOK, gin.H{"message": "Play status updated"})
 }
 
 // SyncQuery queries the playback status
@@ -136,6 +152,60 @@ func SyncUpdatePause(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"message": "Play status updated"})
 }
 
+// SyncUpdateSubtitle updates the subtitle track and offset shared by the room
+func SyncUpdateSubtitle(c *gin.Context) {
+	var req struct {
+		SubtitleTrackID uint    `json:"subtitleTrackId"`
+		Offset          float64 `json:"offset"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+
+	userInfo, ok := middleware.GetUserInfo(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+		return
+	}
+
+	config.Logger.Infof("sync updateSubtitle: roomId=%d, userId=%d, subtitleTrackId=%d, offset=%f",
+		userInfo.RoomID, userInfo.UserID, req.SubtitleTrackID, req.Offset)
+
+	// Zero turns subtitles off, any other track has to belong to the room
+	if req.SubtitleTrackID != 0 {
+		track, err := database.GetSubtitleTrackByID(req.SubtitleTrackID)
+		if err != nil || track.PlaylistItem == nil || track.PlaylistItem.RoomID != userInfo.RoomID {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Subtitle track not found"})
+			return
+		}
+	}
+
+	if _, err := database.GetRoomPlayStatus(userInfo.RoomID); err != nil {
+		database.CreateRoomPlayStatus(userInfo.RoomID, true, 0, time.Now().UnixMilli(), 0)
+	}
+	database.UpdateRoomPlayStatus(userInfo.RoomID, map[string]interface{}{
+		"subtitle_track_id": req.SubtitleTrackID,
+		"subtitle_offset":   req.Offset,
+	})
+
+	syncManager := sync.GetSyncManager()
+	if syncManager != nil {
+		syncManager.Broadcast(userInfo.RoomID, sync.SyncMessage{
+			Type: "updateSubtitle",
+			Payload: map[string]interface{}{
+				"roomId":          userInfo.RoomID,
+				"userId":          userInfo.UserID,
+				"subtitleTrackId": req.SubtitleTrackID,
+				"offset":          req.Offset,
+			},
+		}, []uint{userInfo.UserID})
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Subtitle status updated"})
+}
+
 // SyncProtocol returns the sync protocol
 func SyncProtocol(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"protocol": config.Env.SyncProtocol})
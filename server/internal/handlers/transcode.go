@@ -0,0 +1,275 @@
+package handlers
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync-player-server/internal/config"
+	"sync-player-server/internal/database"
+	"sync-player-server/internal/mediaurl"
+	"sync-player-server/internal/middleware"
+	"sync-player-server/internal/models"
+	"sync-player-server/internal/transcode"
+	"sync-player-server/internal/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// TranscodeCreate queues a job which packages a video source of the
+// caller's room as HLS renditions browsers can play. Renditions taller than
+// the source are left out.
+func TranscodeCreate(c *gin.Context) {
+	var req struct {
+		PlaylistItemID uint     `json:"playlistItemId" binding:"required"`
+		SourceID       uint     `json:"sourceId" binding:"required"`
+		Renditions     []string `json:"renditions"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+
+	queue := transcode.GetQueue()
+	if queue == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Transcoding is disabled"})
+		return
+	}
+
+	userInfo, ok := middleware.GetUserInfo(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+		return
+	}
+
+	source, err := database.GetVideoSourceByID(req.SourceID)
+	if err != nil || source.PlaylistItem == nil ||
+		source.PlaylistItemID != req.PlaylistItemID || source.PlaylistItem.RoomID != userInfo.RoomID {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Video source not found"})
+		return
+	}
+	if !canEditPlaylistItem(userInfo, source.PlaylistItem) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only the member who added the item or a moderator can edit it"})
+		return
+	}
+	if source.TranscodeJobID != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Video source is already a transcoded rendition"})
+		return
+	}
+
+	names := req.Renditions
+	if len(names) == 0 {
+		names = queue.DefaultRenditions()
+	}
+	renditions, err := transcode.SelectRenditions(names, source.Height)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	active, err := database.CountActiveTranscodeJobs(source.ID)
+	if err != nil {
+		config.Logger.Errorf("Failed to count transcode jobs: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+	if active > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "Video source is already being transcoded"})
+		return
+	}
+
+	jobKey, err := utils.GenerateToken(24)
+	if err != nil {
+		config.Logger.Errorf("Failed to generate transcode job key: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	job := &models.TranscodeJob{
+		JobKey:         jobKey,
+		RoomID:         userInfo.RoomID,
+		UserID:         userInfo.UserID,
+		PlaylistItemID: source.PlaylistItemID,
+		SourceID:       source.ID,
+		Renditions:     renditions,
+		Status:         models.TranscodeStatusQueued,
+		DoneRenditions: []string{},
+		BaseURL:        mediaPublicURL(c),
+	}
+	if err := database.CreateTranscodeJob(job); err != nil {
+		config.Logger.Errorf("Failed to create transcode job: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+	queue.Notify()
+
+	c.JSON(http.StatusOK, job)
+}
+
+// TranscodeQuery lists the transcode jobs of the caller's room, optionally
+// only those of one playlist item
+func TranscodeQuery(c *gin.Context) {
+	userInfo, ok := middleware.GetUserInfo(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+		return
+	}
+
+	var playlistItemID *uint
+	if idStr := c.Query("playlistItemId"); idStr != "" {
+		var id uint
+		if _, err := fmt.Sscanf(idStr, "%d", &id); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid playlist item ID"})
+			return
+		}
+		playlistItemID = &id
+	}
+
+	jobs, err := database.GetTranscodeJobsByRoomID(userInfo.RoomID, playlistItemID)
+	if err != nil {
+		config.Logger.Errorf("Failed to get transcode jobs: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	c.JSON(http.StatusOK, jobs)
+}
+
+// TranscodeCancel cancels a queued or running transcode job. Renditions it
+// already finished stay in the playlist.
+func TranscodeCancel(c *gin.Context) {
+	var req struct {
+		JobID uint `json:"jobId" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+
+	queue := transcode.GetQueue()
+	if queue == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Transcoding is disabled"})
+		return
+	}
+
+	userInfo, ok := middleware.GetUserInfo(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+		return
+	}
+
+	job, err := database.GetTranscodeJobByID(req.JobID)
+	if err != nil || job.RoomID != userInfo.RoomID {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Transcode job not found"})
+		return
+	}
+	if job.UserID != userInfo.UserID && !memberCan(userInfo.RoomID, userInfo.UserID, models.PermissionManagePlaylist) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only the member who started the job or a moderator can cancel it"})
+		return
+	}
+
+	if err := queue.Cancel(job.ID); err != nil {
+		if errors.Is(err, transcode.ErrJobNotActive) {
+			c.JSON(http.StatusConflict, gin.H{"error": "Transcode job already ended"})
+			return
+		}
+		config.Logger.Errorf("Failed to cancel transcode job: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Transcode job canceled"})
+}
+
+// TranscodeMedia serves the playlists and segments of transcoded renditions
+// to those holding a signed URL for the job. Playlists pass the access token
+// on to their segments.
+func TranscodeMedia(c *gin.Context) {
+	queue := transcode.GetQueue()
+	if queue == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Transcoding is disabled"})
+		return
+	}
+
+	token := c.Query(mediaurl.Param)
+	claims, ok := authorizeMedia(c, mediaurl.TranscodePath+c.Param("key"), token)
+	if !ok {
+		return
+	}
+
+	job, err := database.GetTranscodeJobByKey(c.Param("key"))
+	if err != nil || job.RoomID != claims.RoomID {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Media not found"})
+		return
+	}
+
+	name := c.Param("file")
+	rendition, _, _ := strings.Cut(strings.TrimPrefix(name, "/"), "/")
+	done := false
+	for _, doneRendition := range job.DoneRenditions {
+		done = done || doneRendition == rendition
+	}
+	filePath, err := queue.OutputPath(job.JobKey, name)
+	if err != nil || !done {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Media not found"})
+		return
+	}
+
+	file, err := os.Open(filePath)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Media not found"})
+		return
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil || info.IsDir() {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Media not found"})
+		return
+	}
+
+	header := c.Writer.Header()
+	header.Set("X-Content-Type-Options", "nosniff")
+	header.Set("Content-Security-Policy", "default-src 'none'; sandbox")
+	header.Set("Cache-Control", "private, max-age=86400")
+
+	switch filepath.Ext(filePath) {
+	case ".m3u8":
+		playlist, err := io.ReadAll(file)
+		if err != nil {
+			config.Logger.Errorf("Failed to read transcoded playlist: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+			return
+		}
+		// The token changes with every playlist fetch
+		header.Set("Cache-Control", "no-store")
+		header.Set("Content-Type", "application/vnd.apple.mpegurl")
+		playlist = signPlaylistSegments(playlist, accessQuery(token))
+		http.ServeContent(c.Writer, c.Request, info.Name(), info.ModTime(), bytes.NewReader(playlist))
+		return
+	case ".ts":
+		header.Set("Content-Type", "video/mp2t")
+	default:
+		header.Set("Content-Type", "application/octet-stream")
+	}
+
+	http.ServeContent(c.Writer, c.Request, info.Name(), info.ModTime(), file)
+}
+
+// signPlaylistSegments adds the encoded query pair access to the segment
+// lines of an HLS playlist, which name files next to it
+func signPlaylistSegments(playlist []byte, access string) []byte {
+	lines := strings.Split(string(playlist), "\n")
+	for i, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		if trimmed != "" && !strings.HasPrefix(trimmed, "#") {
+			lines[i] = mediaurl.AppendQuery(trimmed, access)
+		}
+	}
+	return []byte(strings.Join(lines, "\n"))
+}
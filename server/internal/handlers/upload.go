@@ -0,0 +1,634 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	gosync "sync"
+	"sync-player-server/internal/config"
+	"sync-player-server/internal/database"
+	"sync-player-server/internal/mediaurl"
+	"sync-player-server/internal/middleware"
+	"sync-player-server/internal/models"
+	"sync-player-server/internal/probe"
+	"sync-player-server/internal/storage"
+	"sync-player-server/internal/sync"
+	"sync-player-server/internal/utils"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// Uploads speak the core, creation and termination parts of the tus 1.0
+// resumable upload protocol, so that tus clients can use them as they are
+const (
+	tusVersion    = "1.0.0"
+	tusExtensions = "creation,termination"
+	tusChunkType  = "application/offset+octet-stream"
+)
+
+// uploadLocks holds the keys of the uploads a PATCH is writing to
+var (
+	uploadLocksMu gosync.Mutex
+	uploadLocks   = make(map[string]bool)
+)
+
+func lockUpload(uploadKey string) bool {
+	uploadLocksMu.Lock()
+	defer uploadLocksMu.Unlock()
+	if uploadLocks[uploadKey] {
+		return false
+	}
+	uploadLocks[uploadKey] = true
+	return true
+}
+
+func unlockUpload(uploadKey string) {
+	uploadLocksMu.Lock()
+	defer uploadLocksMu.Unlock()
+	delete(uploadLocks, uploadKey)
+}
+
+// UploadOptions tells tus clients which protocol version and extensions the
+// server supports
+func UploadOptions(c *gin.Context) {
+	c.Header("Tus-Resumable", tusVersion)
+	c.Header("Tus-Version", tusVersion)
+	c.Header("Tus-Extension", tusExtensions)
+	c.Header("Tus-Max-Size", strconv.FormatInt(maxUploadSize(), 10))
+	c.Status(http.StatusNoContent)
+}
+
+// UploadCreate starts an upload of a media file to the caller's room. The
+// size comes in the Upload-Length header and the file name, type and title
+// in Upload-Metadata. The file is attached to the playlist once its last
+// byte arrives, as a new item or as a further source of playlistItemId.
+func UploadCreate(c *gin.Context) {
+	c.Header("Tus-Resumable", tusVersion)
+
+	store := storage.GetStorage()
+	if store == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Uploads are disabled"})
+		return
+	}
+
+	userInfo, ok := middleware.GetUserInfo(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+		return
+	}
+
+	size, err := strconv.ParseInt(c.GetHeader("Upload-Length"), 10, 64)
+	if err != nil || size <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Upload-Length must be a positive number of bytes"})
+		return
+	}
+	if size > maxUploadSize() {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{
+			"error":   "File is too large",
+			"maxSize": maxUploadSize(),
+		})
+		return
+	}
+
+	metadata, err := parseUploadMetadata(c.GetHeader("Upload-Metadata"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid Upload-Metadata"})
+		return
+	}
+
+	mimeType := strings.ToLower(strings.TrimSpace(metadata["filetype"]))
+	if mimeType != "" && !isMediaMimeType(mimeType) {
+		c.JSON(http.StatusUnsupportedMediaType, gin.H{"error": "Only video and audio files can be uploaded"})
+		return
+	}
+
+	fileName := truncateString(path.Base(strings.ReplaceAll(strings.TrimSpace(metadata["filename"]), "\\", "/")), 255)
+	if fileName == "." || fileName == "/" {
+		fileName = ""
+	}
+	title := strings.TrimSpace(metadata["title"])
+	if title == "" {
+		title = strings.TrimSuffix(fileName, path.Ext(fileName))
+	}
+	if title == "" {
+		title = "Upload"
+	}
+	title = truncateString(title, maxPlaylistTitleLength)
+
+	var playlistItemID uint
+	if value := strings.TrimSpace(metadata["playlistItemId"]); value != "" {
+		id, err := strconv.ParseUint(value, 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid playlist item ID"})
+			return
+		}
+		playlistItemID = uint(id)
+
+		items, err := database.QueryPlaylistItems(userInfo.RoomID, &playlistItemID, nil)
+		if err != nil {
+			config.Logger.Errorf("Failed to query playlist item: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+			return
+		}
+		if len(items) == 0 {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Playlist item not found"})
+			return
+		}
+		if !canEditPlaylistItem(userInfo, &items[0]) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Only the member who added the item or a moderator can edit it"})
+			return
+		}
+	} else if !checkQueueLimit(c, userInfo.RoomID, userInfo.UserID, 1, false) {
+		return
+	}
+
+	cleanStaleUploads(store)
+
+	if !checkUploadQuota(c, userInfo, size) {
+		return
+	}
+
+	uploadKey, err := utils.GenerateToken(24)
+	if err != nil {
+		config.Logger.Errorf("Failed to generate upload key: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	upload := &models.MediaUpload{
+		UploadKey:      uploadKey,
+		UserID:         userInfo.UserID,
+		RoomID:         userInfo.RoomID,
+		FileName:       fileName,
+		Title:          title,
+		MimeType:       mimeType,
+		Size:           size,
+		Status:         models.UploadStatusUploading,
+		PlaylistItemID: playlistItemID,
+	}
+	if _, err := store.Append(uploadKey, 0, strings.NewReader("")); err != nil {
+		config.Logger.Errorf("Failed to create upload file: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+	if err := database.CreateMediaUpload(upload); err != nil {
+		config.Logger.Errorf("Failed to create media upload: %v", err)
+		if err := store.Delete(uploadKey); err != nil {
+			config.Logger.Warnf("Failed to delete upload file %s: %v", uploadKey, err)
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	c.Header("Location", "/api/upload/"+uploadKey)
+	c.Header("Upload-Offset", "0")
+	c.JSON(http.StatusCreated, upload)
+}
+
+// UploadHead reports how many bytes of an upload arrived, so that an
+// interrupted upload can resume from there
+func UploadHead(c *gin.Context) {
+	c.Header("Tus-Resumable", tusVersion)
+	c.Header("Cache-Control", "no-store")
+
+	upload, ok := getOwnUpload(c)
+	if !ok {
+		return
+	}
+
+	c.Header("Upload-Offset", strconv.FormatInt(upload.Offset, 10))
+	c.Header("Upload-Length", strconv.FormatInt(upload.Size, 10))
+	c.Status(http.StatusOK)
+}
+
+// UploadPatch appends a chunk to an upload at the offset given in the
+// Upload-Offset header, which has to match the bytes stored so far
+func UploadPatch(c *gin.Context) {
+	c.Header("Tus-Resumable", tusVersion)
+
+	upload, ok := getOwnUpload(c)
+	if !ok {
+		return
+	}
+
+	if c.ContentType() != tusChunkType {
+		c.JSON(http.StatusUnsupportedMediaType, gin.H{"error": "Content-Type must be " + tusChunkType})
+		return
+	}
+
+	offset, err := strconv.ParseInt(c.GetHeader("Upload-Offset"), 10, 64)
+	if err != nil || offset < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Upload-Offset must be a number of bytes"})
+		return
+	}
+
+	if !lockUpload(upload.UploadKey) {
+		c.JSON(http.StatusLocked, gin.H{"error": "Upload is busy"})
+		return
+	}
+	defer unlockUpload(upload.UploadKey)
+
+	// Read again under the lock, a PATCH which just finished moved it on
+	upload, err = database.GetMediaUploadByKey(upload.UploadKey)
+	if err != nil {
+		config.Logger.Errorf("Failed to get media upload: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+	if offset != upload.Offset {
+		c.Header("Upload-Offset", strconv.FormatInt(upload.Offset, 10))
+		c.JSON(http.StatusConflict, gin.H{
+			"error":  "Upload-Offset does not match the stored bytes",
+			"offset": upload.Offset,
+		})
+		return
+	}
+	if upload.Status == models.UploadStatusComplete {
+		c.Header("Upload-Offset", strconv.FormatInt(upload.Offset, 10))
+		c.Status(http.StatusNoContent)
+		return
+	}
+
+	store := storage.GetStorage()
+	written, writeErr := store.Append(upload.UploadKey, offset, io.LimitReader(c.Request.Body, upload.Size-offset))
+	if written > 0 {
+		if err := database.AdvanceMediaUpload(upload.ID, offset, offset+written); err != nil {
+			config.Logger.Errorf("Failed to update upload offset: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+			return
+		}
+		upload.Offset += written
+	}
+	if writeErr != nil {
+		// The client went away mid-chunk, what arrived is kept for resuming
+		config.Logger.Warnf("Upload %s interrupted at %d bytes: %v", upload.UploadKey, upload.Offset, writeErr)
+		c.Header("Upload-Offset", strconv.FormatInt(upload.Offset, 10))
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Upload interrupted"})
+		return
+	}
+
+	if upload.Offset == upload.Size {
+		if err := finishUpload(c, upload); err != nil {
+			config.Logger.Errorf("Failed to attach upload %s: %v", upload.UploadKey, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+			return
+		}
+	}
+
+	c.Header("Upload-Offset", strconv.FormatInt(upload.Offset, 10))
+	c.Status(http.StatusNoContent)
+}
+
+// UploadDelete cancels an upload or deletes an uploaded file which no
+// playlist item plays anymore
+func UploadDelete(c *gin.Context) {
+	c.Header("Tus-Resumable", tusVersion)
+
+	upload, ok := getOwnUpload(c)
+	if !ok {
+		return
+	}
+
+	if !lockUpload(upload.UploadKey) {
+		c.JSON(http.StatusLocked, gin.H{"error": "Upload is busy"})
+		return
+	}
+	defer unlockUpload(upload.UploadKey)
+
+	count, err := database.CountMediaUploadSources(upload.ID)
+	if err != nil {
+		config.Logger.Errorf("Failed to count upload sources: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+	if count > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "Upload is still in the playlist"})
+		return
+	}
+
+	if err := database.DeleteMediaUpload(upload.ID); err != nil {
+		config.Logger.Errorf("Failed to delete media upload: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+	if err := storage.GetStorage().Delete(upload.UploadKey); err != nil {
+		config.Logger.Warnf("Failed to delete upload file %s: %v", upload.UploadKey, err)
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// UploadList returns the caller's uploads with the space they take up
+// against the user and room quotas
+func UploadList(c *gin.Context) {
+	if storage.GetStorage() == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Uploads are disabled"})
+		return
+	}
+
+	userInfo, ok := middleware.GetUserInfo(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+		return
+	}
+
+	uploads, err := database.GetMediaUploadsByUserID(userInfo.UserID)
+	if err != nil {
+		config.Logger.Errorf("Failed to get media uploads: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	userBytes, roomBytes, err := database.GetMediaUploadUsage(userInfo.UserID, userInfo.RoomID)
+	if err != nil {
+		config.Logger.Errorf("Failed to get upload usage: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"uploads":        uploads,
+		"usedBytes":      userBytes,
+		"quotaBytes":     int64(config.Env.UploadUserQuotaMB) << 20,
+		"roomUsedBytes":  roomBytes,
+		"roomQuotaBytes": int64(config.Env.UploadRoomQuotaMB) << 20,
+		"maxFileSize":    maxUploadSize(),
+	})
+}
+
+// MediaServe serves an uploaded file to those holding a signed URL for it,
+// answering Range and If-Range requests so that players can seek
+func MediaServe(c *gin.Context) {
+	store := storage.GetStorage()
+	if store == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Uploads are disabled"})
+		return
+	}
+
+	claims, ok := authorizeMedia(c, mediaurl.UploadPath+c.Param("key"), c.Query(mediaurl.Param))
+	if !ok {
+		return
+	}
+
+	upload, err := database.GetMediaUploadByKey(c.Param("key"))
+	if err != nil || upload.RoomID != claims.RoomID || upload.Status != models.UploadStatusComplete {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Media not found"})
+		return
+	}
+
+	file, err := store.Open(upload.UploadKey)
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Media not found"})
+		} else {
+			config.Logger.Errorf("Failed to open upload %s: %v", upload.UploadKey, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		}
+		return
+	}
+	defer file.Close()
+
+	modTime := upload.LastActiveTime
+	if upload.CompletedTime != nil {
+		modTime = *upload.CompletedTime
+	}
+
+	// The file is served from the site's own origin, so it must never be
+	// taken for a page
+	header := c.Writer.Header()
+	header.Set("Content-Type", upload.MimeType)
+	header.Set("X-Content-Type-Options", "nosniff")
+	header.Set("Content-Security-Policy", "default-src 'none'; sandbox")
+	header.Set("Content-Disposition", "inline")
+	header.Set("Cache-Control", "private, max-age=86400")
+	// Uploads never change once complete, so their key is a strong validator
+	header.Set("ETag", `"`+upload.UploadKey+`"`)
+
+	http.ServeContent(c.Writer, c.Request, upload.FileName, modTime, file)
+}
+
+// getOwnUpload looks up the upload named in the path, which has to belong to
+// the caller in their current room, writing the error response when it does
+// not
+func getOwnUpload(c *gin.Context) (*models.MediaUpload, bool) {
+	if storage.GetStorage() == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Uploads are disabled"})
+		return nil, false
+	}
+
+	userInfo, ok := middleware.GetUserInfo(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+		return nil, false
+	}
+
+	upload, err := database.GetMediaUploadByKey(c.Param("key"))
+	if err != nil {
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			config.Logger.Errorf("Failed to get media upload: %v", err)
+		}
+		c.JSON(http.StatusNotFound, gin.H{"error": "Upload not found"})
+		return nil, false
+	}
+	if upload.UserID != userInfo.UserID || upload.RoomID != userInfo.RoomID {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Upload not found"})
+		return nil, false
+	}
+
+	return upload, true
+}
+
+// finishUpload settles the type of a completely uploaded file and attaches it
+// to the playlist of its room
+func finishUpload(c *gin.Context, upload *models.MediaUpload) error {
+	mimeType, err := sniffUploadType(upload)
+	if err != nil {
+		return err
+	}
+	upload.MimeType = mimeType
+
+	fileName := upload.FileName
+	if fileName == "" {
+		fileName = "media"
+	}
+	source := database.VideoSourceInput{
+		URL:      mediaPublicURL(c) + mediaurl.UploadPath + upload.UploadKey + "/" + url.PathEscape(fileName),
+		Label:    "Upload",
+		UploadID: &upload.ID,
+		MediaInfo: models.MediaInfo{
+			Container: containerForMimeType(mimeType),
+		},
+	}
+
+	attached := false
+	if upload.PlaylistItemID != 0 {
+		_, err := database.UpdatePlaylistItem(upload.RoomID, upload.PlaylistItemID, database.PlaylistItemUpdate{
+			AddSources: []database.VideoSourceInput{source},
+		})
+		switch {
+		case err == nil:
+			attached = true
+		case errors.Is(err, database.ErrPlaylistItemNotFound):
+			// The item went away while the file was uploading
+		default:
+			return err
+		}
+	}
+	if !attached {
+		playlistItemID, err := database.AddItemToPlaylist(upload.RoomID, upload.UserID, upload.Title, []database.VideoSourceInput{source})
+		if err != nil {
+			return err
+		}
+		upload.PlaylistItemID = playlistItemID
+	}
+
+	if err := database.CompleteMediaUpload(upload.ID, mimeType); err != nil {
+		return err
+	}
+	upload.Status = models.UploadStatusComplete
+
+	syncManager := sync.GetSyncManager()
+	if syncManager != nil {
+		syncManager.Broadcast(upload.RoomID, sync.SyncMessage{
+			Type: "updatePlaylist",
+		}, nil)
+	}
+	return nil
+}
+
+// sniffUploadType returns the declared type of an upload, or the type its
+// first bytes reveal when none was declared. Files which turn out to be
+// anything but video or audio are served as opaque bytes.
+func sniffUploadType(upload *models.MediaUpload) (string, error) {
+	if upload.MimeType != "" {
+		return upload.MimeType, nil
+	}
+
+	file, err := storage.GetStorage().Open(upload.UploadKey)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	head := make([]byte, 512)
+	n, err := io.ReadFull(file, head)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) {
+		return "", err
+	}
+
+	mimeType, _, _ := strings.Cut(http.DetectContentType(head[:n]), ";")
+	if !isMediaMimeType(mimeType) {
+		return "application/octet-stream", nil
+	}
+	return mimeType, nil
+}
+
+// checkUploadQuota reports whether size more bytes fit into the upload
+// quotas of the caller and their room, writing the error response otherwise
+func checkUploadQuota(c *gin.Context, userInfo *middleware.UserInfo, size int64) bool {
+	userBytes, roomBytes, err := database.GetMediaUploadUsage(userInfo.UserID, userInfo.RoomID)
+	if err != nil {
+		config.Logger.Errorf("Failed to get upload usage: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return false
+	}
+
+	userQuota := int64(config.Env.UploadUserQuotaMB) << 20
+	if userQuota > 0 && userBytes+size > userQuota {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{
+			"error":      "Upload quota exceeded",
+			"usedBytes":  userBytes,
+			"quotaBytes": userQuota,
+		})
+		return false
+	}
+
+	roomQuota := int64(config.Env.UploadRoomQuotaMB) << 20
+	if roomQuota > 0 && roomBytes+size > roomQuota {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{
+			"error":      "Room upload quota exceeded",
+			"usedBytes":  roomBytes,
+			"quotaBytes": roomQuota,
+		})
+		return false
+	}
+
+	return true
+}
+
+// cleanStaleUploads drops the uploads left unfinished for longer than the
+// configured expiry, freeing the quota they reserve
+func cleanStaleUploads(store storage.Storage) {
+	before := time.Now().Add(-time.Duration(config.Env.UploadExpiryHours) * time.Hour)
+	keys, err := database.DeleteStaleMediaUploads(before)
+	if err != nil {
+		config.Logger.Errorf("Failed to delete stale uploads: %v", err)
+		return
+	}
+	for _, key := range keys {
+		if err := store.Delete(key); err != nil {
+			config.Logger.Warnf("Failed to delete upload file %s: %v", key, err)
+		}
+	}
+}
+
+// parseUploadMetadata decodes a tus Upload-Metadata header, a comma separated
+// list of keys each followed by its base64 encoded value
+func parseUploadMetadata(header string) (map[string]string, error) {
+	metadata := make(map[string]string)
+	for _, pair := range strings.Split(header, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		key, encoded, _ := strings.Cut(pair, " ")
+		value, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+		if err != nil {
+			return nil, fmt.Errorf("metadata %s: %w", key, err)
+		}
+		metadata[key] = string(value)
+	}
+	return metadata, nil
+}
+
+// mediaPublicURL returns the base URL uploaded media is served under
+func mediaPublicURL(c *gin.Context) string {
+	if config.Env.MediaPublicURL != "" {
+		return config.Env.MediaPublicURL
+	}
+	scheme := "http"
+	if c.Request.TLS != nil || strings.EqualFold(c.GetHeader("X-Forwarded-Proto"), "https") {
+		scheme = "https"
+	}
+	return scheme + "://" + c.Request.Host
+}
+
+func maxUploadSize() int64 {
+	return int64(config.Env.UploadMaxFileMB) << 20
+}
+
+func isMediaMimeType(mimeType string) bool {
+	return strings.HasPrefix(mimeType, "video/") || strings.HasPrefix(mimeType, "audio/")
+}
+
+// containerForMimeType maps the type of an uploaded file to the container
+// the prober would report for it
+func containerForMimeType(mimeType string) string {
+	switch mimeType {
+	case "video/mp4", "audio/mp4":
+		return probe.ContainerMP4
+	case "video/webm", "audio/webm":
+		return probe.ContainerWebM
+	case "video/x-matroska", "audio/x-matroska":
+		return probe.ContainerMKV
+	}
+	return ""
+}
@@ -1,19 +1,40 @@
 package handlers
 
 import (
+	"fmt"
+	"math"
 	"net/http"
+	gosync "sync"
 	"sync-player-server/internal/config"
 	"sync-player-server/internal/database"
+	"sync-player-server/internal/middleware"
+	"sync-player-server/internal/models"
+	"sync-player-server/internal/utils"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
 )
 
-// UserLogin handles user login/registration
-func UserLogin(c *gin.Context) {
+// maxPasswordLength bounds the passwords of users and rooms
+const maxPasswordLength = 256
+
+// maxUsernameLength matches the username column
+const maxUsernameLength = 50
+
+var (
+	dummyPasswordHash     string
+	dummyPasswordHashOnce gosync.Once
+)
+
+// UserRegister handles creating an account. Without a password the account
+// is a guest, which logs in by name only.
+func UserRegister(c *gin.Context) {
 	var req struct {
 		Username string `json:"username" binding:"required"`
 		Password string `json:"password"`
+		// Device names the session, the User-Agent is used without it
+		Device string `json:"device"`
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -21,13 +42,23 @@ func UserLogin(c *gin.Context) {
 		return
 	}
 
-	existingUser, err := database.GetUserByUsername(req.Username)
-	if err == nil && existingUser != nil {
-		c.JSON(http.StatusOK, gin.H{
-			"id":          existingUser.ID,
-			"username":    existingUser.Username,
-			"createdTime": existingUser.CreatedTime,
-		})
+	if len(req.Username) > maxUsernameLength {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Username is too long"})
+		return
+	}
+	if len(req.Password) > maxPasswordLength {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Password is too long"})
+		return
+	}
+
+	_, err := database.GetUserByUsername(req.Username)
+	if err == nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "Username is already taken"})
+		return
+	}
+	if err != gorm.ErrRecordNotFound {
+		config.Logger.Errorf("Failed to query user: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
 		return
 	}
 
@@ -43,11 +74,71 @@ func UserLogin(c *gin.Context) {
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{
-		"id":          user.ID,
-		"username":    user.Username,
-		"createdTime": user.CreatedTime,
-	})
+	respondWithSession(c, user, req.Device)
+}
+
+// UserLogin handles logging in to an account. Accounts with a password are
+// locked for a while after too many wrong ones in a row, and addresses with
+// too many failed logins are throttled. Logins without a password guess
+// nothing and are not counted, players log in guests that way before
+// registering them.
+func UserLogin(c *gin.Context) {
+	var req struct {
+		Username string `json:"username" binding:"required"`
+		Password string `json:"password"`
+		// Device names the session, the User-Agent is used without it
+		Device string `json:"device"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+
+	address := c.ClientIP()
+	if wait := failedLogins.retryAfter(address); wait > 0 {
+		setRetryAfter(c, wait)
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": "Too many failed logins, try again later"})
+		return
+	}
+
+	if len(req.Password) > maxPasswordLength {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Password is too long"})
+		return
+	}
+
+	user, err := database.GetUserByUsername(req.Username)
+	if err != nil {
+		if err != gorm.ErrRecordNotFound {
+			config.Logger.Errorf("Failed to query user: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+			return
+		}
+		// Take as long as checking a password so that the response time
+		// does not tell which usernames exist
+		utils.VerifyPassword(getDummyPasswordHash(), req.Password)
+		if req.Password != "" {
+			failedLogins.fail(address)
+		}
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid username or password"})
+		return
+	}
+
+	if user.IsGuest {
+		// A password for a guest is most likely meant for another account
+		if req.Password != "" {
+			failedLogins.fail(address)
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid username or password"})
+			return
+		}
+	} else if req.Password == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid username or password"})
+		return
+	} else if !checkUserPassword(c, user, req.Password, "Invalid username or password") {
+		return
+	}
+
+	respondWithSession(c, user, req.Device)
 }
 
 // UserQuery handles user query by username
@@ -71,3 +162,132 @@ func UserQuery(c *gin.Context) {
 
 	c.JSON(http.StatusOK, user)
 }
+
+// UserChangePassword handles the caller changing their own password, which
+// logs out their other sessions. A guest setting a password turns into a
+// regular account.
+func UserChangePassword(c *gin.Context) {
+	var req struct {
+		CurrentPassword string `json:"currentPassword"`
+		NewPassword     string `json:"newPassword" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+
+	if len(req.NewPassword) > maxPasswordLength {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Password is too long"})
+		return
+	}
+
+	claims, ok := middleware.GetJWTClaims(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+		return
+	}
+
+	address := c.ClientIP()
+	if wait := failedLogins.retryAfter(address); wait > 0 {
+		setRetryAfter(c, wait)
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": "Too many failed logins, try again later"})
+		return
+	}
+
+	user, err := database.GetUserByID(claims.UserID)
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+			return
+		}
+		config.Logger.Errorf("Failed to query user: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	if !user.IsGuest && !checkUserPassword(c, user, req.CurrentPassword, "Invalid password") {
+		return
+	}
+
+	if err := database.UpdateUserPassword(user.ID, &req.NewPassword); err != nil {
+		config.Logger.Errorf("Failed to update user password: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	// Log out the other devices, which may be whoever learned the old password
+	sessionIDs, err := database.RevokeUserSessions(user.ID, claims.SessionID)
+	if err != nil {
+		config.Logger.Errorf("Failed to revoke sessions: %v", err)
+	}
+	closeSessionConnections(sessionIDs, "Password changed")
+
+	c.JSON(http.StatusOK, gin.H{"message": "Password updated"})
+}
+
+// checkUserPassword verifies the password of an account which has one,
+// counting wrong ones towards its lockout and the caller's throttling. It
+// writes the error response when the password is not accepted.
+func checkUserPassword(c *gin.Context, user *models.User, password, invalidMessage string) bool {
+	if user.LockedUntil != nil && time.Now().Before(*user.LockedUntil) {
+		setRetryAfter(c, time.Until(*user.LockedUntil))
+		c.JSON(http.StatusLocked, gin.H{"error": "Account is locked after too many failed logins, try again later"})
+		return false
+	}
+
+	if !database.VerifyUserPassword(user, password) {
+		failedLogins.fail(c.ClientIP())
+		if err := database.RecordFailedLogin(user.ID, config.Env.LoginMaxFailedAttempts, loginLockout()); err != nil {
+			config.Logger.Errorf("Failed to record failed login: %v", err)
+		}
+		c.JSON(http.StatusUnauthorized, gin.H{"error": invalidMessage})
+		return false
+	}
+
+	if user.FailedLoginAttempts > 0 || user.LockedUntil != nil {
+		if err := database.ResetFailedLogins(user.ID); err != nil {
+			config.Logger.Errorf("Failed to reset failed logins: %v", err)
+		}
+	}
+	return true
+}
+
+// respondWithSession writes an account along with the tokens of a new
+// session for it. Its access token proves who the user is when joining
+// rooms but opens none.
+func respondWithSession(c *gin.Context, user *models.User, device string) {
+	cleanStaleSessions()
+
+	tokens, err := startSession(c, user, device, 0, "")
+	if err != nil {
+		config.Logger.Errorf("Failed to start session: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate authentication token"})
+		return
+	}
+
+	tokens["id"] = user.ID
+	tokens["username"] = user.Username
+	tokens["isGuest"] = user.IsGuest
+	tokens["createdTime"] = user.CreatedTime
+	c.JSON(http.StatusOK, tokens)
+}
+
+// setRetryAfter tells the client how long to wait, in whole seconds
+func setRetryAfter(c *gin.Context, wait time.Duration) {
+	c.Header("Retry-After", fmt.Sprintf("%d", int64(math.Ceil(wait.Seconds()))))
+}
+
+// getDummyPasswordHash returns a hash to verify passwords of unknown users
+// against
+func getDummyPasswordHash() string {
+	dummyPasswordHashOnce.Do(func() {
+		hash, err := utils.HashPassword("")
+		if err != nil {
+			config.Logger.Errorf("Failed to hash dummy password: %v", err)
+			return
+		}
+		dummyPasswordHash = hash
+	})
+	return dummyPasswordHash
+}
@@ -0,0 +1,296 @@
+package handlers
+
+import (
+	"math"
+	"net/http"
+	gosync "sync"
+	"sync-player-server/internal/config"
+	"sync-player-server/internal/database"
+	"sync-player-server/internal/middleware"
+	"sync-player-server/internal/models"
+	"sync-player-server/internal/sync"
+
+	"github.com/gin-gonic/gin"
+)
+
+// skipMu serializes skip votes so that a room advances only once when the
+// last votes needed arrive at the same time
+var skipMu gosync.Mutex
+
+// PlaylistUpvote upvotes a queued playlist item
+func PlaylistUpvote(c *gin.Context) {
+	updateUpvote(c, true)
+}
+
+// PlaylistRemoveUpvote withdraws an upvote of a queued playlist item
+func PlaylistRemoveUpvote(c *gin.Context) {
+	updateUpvote(c, false)
+}
+
+func updateUpvote(c *gin.Context, add bool) {
+	var req struct {
+		PlaylistItemID uint `json:"playlistItemId" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+
+	userInfo, ok := middleware.GetUserInfo(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+		return
+	}
+
+	items, err := database.QueryPlaylistItems(userInfo.RoomID, &req.PlaylistItemID, nil)
+	if err != nil || len(items) == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Playlist item not found"})
+		return
+	}
+	if items[0].PlayStatus != models.PlayStatusNew {
+		c.JSON(http.StatusConflict, gin.H{"error": "Only queued items can be upvoted"})
+		return
+	}
+
+	var upvotes int64
+	if add {
+		upvotes, err = database.AddPlaylistVote(req.PlaylistItemID, userInfo.UserID, models.VoteTypeUp)
+	} else {
+		upvotes, err = database.RemovePlaylistVote(req.PlaylistItemID, userInfo.UserID, models.VoteTypeUp)
+	}
+	if err != nil {
+		config.Logger.Errorf("Failed to update upvote: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	syncManager := sync.GetSyncManager()
+	if syncManager != nil {
+		syncManager.Broadcast(userInfo.RoomID, sync.SyncMessage{
+			Type: "updateVotes",
+			Payload: map[string]interface{}{
+				"roomId":         userInfo.RoomID,
+				"userId":         userInfo.UserID,
+				"playlistItemId": req.PlaylistItemID,
+				"upvotes":        upvotes,
+			},
+		}, []uint{userInfo.UserID})
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":        "Vote updated",
+		"playlistItemId": req.PlaylistItemID,
+		"upvotes":        upvotes,
+	})
+}
+
+// PlaylistVoteSkip votes to skip the item the room is playing. Once the
+// room's share of online members has voted, the room advances to the next
+// queued item.
+func PlaylistVoteSkip(c *gin.Context) {
+	updateSkipVote(c, true)
+}
+
+// PlaylistRemoveSkipVote withdraws a vote to skip the item the room is playing
+func PlaylistRemoveSkipVote(c *gin.Context) {
+	updateSkipVote(c, false)
+}
+
+func updateSkipVote(c *gin.Context, add bool) {
+	var req struct {
+		PlaylistItemID uint `json:"playlistItemId" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+
+	userInfo, ok := middleware.GetUserInfo(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+		return
+	}
+
+	room, err := database.GetRoomByID(userInfo.RoomID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Room not found"})
+		return
+	}
+
+	skipMu.Lock()
+	defer skipMu.Unlock()
+
+	// Votes for an item which is no longer playing arrive late and are ignored
+	status, err := database.GetRoomPlayStatus(userInfo.RoomID)
+	if err != nil || status.VideoID != req.PlaylistItemID {
+		c.JSON(http.StatusConflict, gin.H{"error": "Playlist item is not playing"})
+		return
+	}
+
+	var skipVotes int64
+	if add {
+		skipVotes, err = database.AddPlaylistVote(req.PlaylistItemID, userInfo.UserID, models.VoteTypeSkip)
+	} else {
+		skipVotes, err = database.RemovePlaylistVote(req.PlaylistItemID, userInfo.UserID, models.VoteTypeSkip)
+	}
+	if err != nil {
+		config.Logger.Errorf("Failed to update skip vote: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	needed := skipVotesNeeded(room)
+	skipped := skipVotes >= needed
+
+	syncManager := sync.GetSyncManager()
+	if syncManager != nil {
+		syncManager.Broadcast(userInfo.RoomID, sync.SyncMessage{
+			Type: "updateVotes",
+			Payload: map[string]interface{}{
+				"roomId":          userInfo.RoomID,
+				"userId":          userInfo.UserID,
+				"playlistItemId":  req.PlaylistItemID,
+				"skipVotes":       skipVotes,
+				"skipVotesNeeded": needed,
+				"skipped":         skipped,
+			},
+		}, []uint{userInfo.UserID})
+	}
+
+	var nextItemID uint
+	if skipped {
+		config.Logger.Infof("Room %d voted to skip playlist item %d (%d of %d votes)",
+			userInfo.RoomID, req.PlaylistItemID, skipVotes, needed)
+
+		nextItemID, err = advancePlaylist(room, req.PlaylistItemID)
+		if err != nil {
+			config.Logger.Errorf("Failed to skip playlist item: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+			return
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":         "Vote updated",
+		"playlistItemId":  req.PlaylistItemID,
+		"skipVotes":       skipVotes,
+		"skipVotesNeeded": needed,
+		"skipped":         skipped,
+		"nextItemId":      nextItemID,
+	})
+}
+
+// PlaylistQueryVotes returns the vote tallies of a room and the items the
+// caller upvoted
+func PlaylistQueryVotes(c *gin.Context) {
+	userInfo, ok := middleware.GetUserInfo(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+		return
+	}
+
+	room, err := database.GetRoomByID(userInfo.RoomID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Room not found"})
+		return
+	}
+
+	upvoted, err := database.GetVotedPlaylistItemIDs(userInfo.RoomID, userInfo.UserID, models.VoteTypeUp)
+	if err != nil {
+		config.Logger.Errorf("Failed to query votes: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	var currentItemID uint
+	var skipVotes int64
+	skipVoted := false
+	if status, err := database.GetRoomPlayStatus(userInfo.RoomID); err == nil && status.VideoID != 0 {
+		currentItemID = status.VideoID
+		skipVotes, _ = database.CountPlaylistVotes(currentItemID, models.VoteTypeSkip)
+
+		skipVotedIDs, _ := database.GetVotedPlaylistItemIDs(userInfo.RoomID, userInfo.UserID, models.VoteTypeSkip)
+		for _, id := range skipVotedIDs {
+			if id == currentItemID {
+				skipVoted = true
+			}
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"queueMode":       room.QueueMode,
+		"skipVoteRatio":   effectiveSkipVoteRatio(room),
+		"currentItemId":   currentItemID,
+		"skipVotes":       skipVotes,
+		"skipVotesNeeded": skipVotesNeeded(room),
+		"skipVoted":       skipVoted,
+		"upvoted":         upvoted,
+	})
+}
+
+// advancePlaylist finishes the skipped item and switches the room to the
+// next queued item. It returns the next item, zero when the queue is empty.
+func advancePlaylist(room *models.Room, skippedItemID uint) (uint, error) {
+	nextItemID, err := nextQueuedItem(room)
+	if err != nil {
+		return 0, err
+	}
+
+	if nextItemID != 0 {
+		if err := switchPlaylistItem(room.ID, nextItemID); err != nil {
+			return 0, err
+		}
+	} else {
+		if err := database.UpdatePlayStatus(room.ID, skippedItemID, models.PlayStatusFinished); err != nil {
+			return 0, err
+		}
+		if previous, err := database.GetRoomPlayStatus(room.ID); err == nil {
+			recordPlaybackChange(room.ID, previous, 0)
+		}
+		database.UpdateRoomPlayStatus(room.ID, map[string]interface{}{
+			"paused": true,
+		})
+	}
+
+	if err := database.ClearPlaylistVotes(skippedItemID, models.VoteTypeSkip); err != nil {
+		config.Logger.Errorf("Failed to clear skip votes: %v", err)
+	}
+
+	syncManager := sync.GetSyncManager()
+	if syncManager != nil {
+		syncManager.Broadcast(room.ID, sync.SyncMessage{
+			Type: "updatePlaylist",
+		}, nil)
+	}
+
+	return nextItemID, nil
+}
+
+func effectiveSkipVoteRatio(room *models.Room) float64 {
+	if room.SkipVoteRatio > 0 {
+		return room.SkipVoteRatio
+	}
+	return config.Env.SkipVoteRatio
+}
+
+// skipVotesNeeded returns how many skip votes advance the room given the
+// members currently connected to it
+func skipVotesNeeded(room *models.Room) int64 {
+	onlineMembers := 0
+	syncManager := sync.GetSyncManager()
+	if syncManager != nil {
+		onlineMembers = len(syncManager.GetUserIDsInRoom(room.ID))
+	}
+	// The voter is in the room even when not connected to the sync channel
+	if onlineMembers < 1 {
+		onlineMembers = 1
+	}
+
+	needed := int64(math.Ceil(effectiveSkipVoteRatio(room)*float64(onlineMembers) - 1e-9))
+	if needed < 1 {
+		needed = 1
+	}
+	return needed
+}
@@ -0,0 +1,298 @@
+package health
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	gosync "sync"
+	"sync-player-server/internal/config"
+	"sync-player-server/internal/database"
+	"sync-player-server/internal/models"
+	"sync-player-server/internal/sync"
+	"sync-player-server/internal/utils"
+	"time"
+)
+
+// Options configures a Checker
+type Options struct {
+	// Interval between two rounds of checks, zero disables periodic checks
+	Interval time.Duration
+	// Timeout for checking a single source
+	Timeout time.Duration
+	// FailureThreshold is the number of consecutive failed checks before a
+	// source is considered unhealthy
+	FailureThreshold int
+	// ReportThreshold is the number of distinct members which have to report
+	// a playback error before a source is considered unhealthy
+	ReportThreshold int
+	// ReportWindow is how long client reports are remembered
+	ReportWindow time.Duration
+	// AllowPrivateNetworks disables the SSRF address check
+	AllowPrivateNetworks bool
+	// MaxConcurrent limits the number of checks running at the same time
+	MaxConcurrent int
+}
+
+// Checker periodically checks the reachability of video sources and fails
+// rooms over to another source when the one they play becomes unhealthy
+type Checker struct {
+	opts   Options
+	client *http.Client
+	stop   chan struct{}
+	wg     gosync.WaitGroup
+
+	mu      gosync.Mutex
+	reports map[uint]map[uint]time.Time
+}
+
+var globalChecker *Checker
+
+// NewChecker creates a new health checker
+func NewChecker(opts Options) *Checker {
+	if opts.Timeout <= 0 {
+		opts.Timeout = 10 * time.Second
+	}
+	if opts.FailureThreshold <= 0 {
+		opts.FailureThreshold = 1
+	}
+	if opts.ReportThreshold <= 0 {
+		opts.ReportThreshold = 1
+	}
+	if opts.ReportWindow <= 0 {
+		opts.ReportWindow = 2 * time.Minute
+	}
+	if opts.MaxConcurrent <= 0 {
+		opts.MaxConcurrent = 8
+	}
+
+	return &Checker{
+		opts:    opts,
+		client:  utils.NewSafeHTTPClient(opts.Timeout, opts.AllowPrivateNetworks),
+		stop:    make(chan struct{}),
+		reports: make(map[uint]map[uint]time.Time),
+	}
+}
+
+// InitChecker initializes the global health checker
+func InitChecker(opts Options) *Checker {
+	globalChecker = NewChecker(opts)
+	return globalChecker
+}
+
+// GetChecker returns the global health checker
+func GetChecker() *Checker {
+	return globalChecker
+}
+
+// Start starts the periodic checks
+func (c *Checker) Start() {
+	if c.opts.Interval <= 0 {
+		config.Logger.Info("Source health checks disabled")
+		return
+	}
+
+	c.wg.Add(1)
+	go func() {
+		defer c.wg.Done()
+
+		ticker := time.NewTicker(c.opts.Interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-c.stop:
+				return
+			case <-ticker.C:
+				c.CheckAll()
+			}
+		}
+	}()
+
+	config.Logger.Infof("Source health checks running every %s", c.opts.Interval)
+}
+
+// Stop stops the periodic checks and waits for a running round to finish
+func (c *Checker) Stop() {
+	select {
+	case <-c.stop:
+	default:
+		close(c.stop)
+	}
+	c.wg.Wait()
+}
+
+// CheckAll checks every source of the playlist items which are not finished
+func (c *Checker) CheckAll() {
+	sources, err := database.GetActiveVideoSources()
+	if err != nil {
+		config.Logger.Errorf("Failed to query video sources for health checks: %v", err)
+		return
+	}
+
+	sem := make(chan struct{}, c.opts.MaxConcurrent)
+	var wg gosync.WaitGroup
+	for _, source := range sources {
+		sem <- struct{}{}
+		wg.Add(1)
+		go func(source models.VideoSource) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			c.checkSource(source)
+		}(source)
+	}
+	wg.Wait()
+}
+
+func (c *Checker) checkSource(source models.VideoSource) {
+	ctx, cancel := context.WithTimeout(context.Background(), c.opts.Timeout)
+	defer cancel()
+
+	latency, err := c.ping(ctx, source.URL)
+
+	now := time.Now()
+	health := source.SourceHealth
+	health.HealthCheckedTime = &now
+	if err == nil {
+		health.HealthStatus = models.HealthStatusHealthy
+		health.HealthLatencyMs = latency.Milliseconds()
+		health.HealthError = ""
+		health.HealthFailures = 0
+	} else {
+		health.HealthFailures++
+		health.HealthError = truncate(err.Error(), 255)
+		if health.HealthFailures >= c.opts.FailureThreshold {
+			health.HealthStatus = models.HealthStatusUnhealthy
+		}
+	}
+
+	c.saveHealth(source, health, "health check failed")
+}
+
+// ping requests a source and returns the time until the response headers
+// arrived. When HEAD is rejected, which some servers and signed CDN URLs do,
+// a single byte is requested with GET instead.
+func (c *Checker) ping(ctx context.Context, rawURL string) (time.Duration, error) {
+	start := time.Now()
+	status, err := c.request(ctx, http.MethodHead, rawURL)
+	if err == nil && status >= 400 {
+		start = time.Now()
+		status, err = c.request(ctx, http.MethodGet, rawURL)
+	}
+	latency := time.Since(start)
+
+	if err != nil {
+		return 0, err
+	}
+	if status >= 400 {
+		return 0, fmt.Errorf("unexpected status %d", status)
+	}
+	return latency, nil
+}
+
+func (c *Checker) request(ctx context.Context, method, rawURL string) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, method, rawURL, nil)
+	if err != nil {
+		return 0, err
+	}
+	if method == http.MethodGet {
+		req.Header.Set("Range", "bytes=0-0")
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 1024))
+
+	return resp.StatusCode, nil
+}
+
+// ReportPlaybackError records a playback error reported by a room member.
+// Once enough distinct members report errors for the same source within the
+// report window, the source is marked unhealthy and the room fails over.
+// It returns whether the source was marked unhealthy.
+func (c *Checker) ReportPlaybackError(userID uint, source *models.VideoSource, message string, onlineMembers int) (bool, error) {
+	now := time.Now()
+
+	c.mu.Lock()
+	reporters := c.reports[source.ID]
+	if reporters == nil {
+		reporters = make(map[uint]time.Time)
+		c.reports[source.ID] = reporters
+	}
+	reporters[userID] = now
+	for reporterID, reportedAt := range reporters {
+		if now.Sub(reportedAt) > c.opts.ReportWindow {
+			delete(reporters, reporterID)
+		}
+	}
+
+	// The reporter is in the room even when not connected to the sync channel
+	if onlineMembers < 1 {
+		onlineMembers = 1
+	}
+	threshold := c.opts.ReportThreshold
+	if onlineMembers < threshold {
+		threshold = onlineMembers
+	}
+	reached := len(reporters) >= threshold
+	count := len(reporters)
+	if reached {
+		delete(c.reports, source.ID)
+	}
+	c.mu.Unlock()
+
+	if !reached {
+		return false, nil
+	}
+
+	health := source.SourceHealth
+	health.HealthStatus = models.HealthStatusUnhealthy
+	health.HealthFailures = c.opts.FailureThreshold
+	health.HealthCheckedTime = &now
+	health.HealthError = truncate(fmt.Sprintf("playback failed for %d members: %s", count, message), 255)
+
+	return true, c.saveHealth(*source, health, "playback errors reported by members")
+}
+
+// saveHealth stores a new health state and reacts to status changes
+func (c *Checker) saveHealth(source models.VideoSource, health models.SourceHealth, reason string) error {
+	if err := database.UpdateVideoSourceHealth(source.ID, health); err != nil {
+		config.Logger.Errorf("Failed to save health of video source %d: %v", source.ID, err)
+		return err
+	}
+
+	if health.HealthStatus == source.HealthStatus {
+		return nil
+	}
+
+	config.Logger.Infof("Video source %d is now %s", source.ID, health.HealthStatus)
+
+	if source.PlaylistItem != nil {
+		syncManager := sync.GetSyncManager()
+		if syncManager != nil {
+			syncManager.Broadcast(source.PlaylistItem.RoomID, sync.SyncMessage{
+				Type: "updatePlaylist",
+			}, nil)
+		}
+	}
+
+	if health.HealthStatus == models.HealthStatusUnhealthy {
+		source.SourceHealth = health
+		Failover(&source, reason)
+	}
+
+	return nil
+}
+
+func truncate(value string, maxLength int) string {
+	runes := []rune(value)
+	if len(runes) <= maxLength {
+		return value
+	}
+	return string(runes[:maxLength])
+}
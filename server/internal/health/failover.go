@@ -0,0 +1,114 @@
+package health
+
+import (
+	"sync-player-server/internal/config"
+	"sync-player-server/internal/database"
+	"sync-player-server/internal/mediaurl"
+	"sync-player-server/internal/models"
+	"sync-player-server/internal/proxy"
+	"sync-player-server/internal/sync"
+)
+
+// PreferredSource returns the source a room should start playing: the first
+// source which is not known to be unhealthy, or the first source if all are
+func PreferredSource(sources []models.VideoSource) *models.VideoSource {
+	if len(sources) == 0 {
+		return nil
+	}
+	for i := range sources {
+		if sources[i].HealthStatus != models.HealthStatusUnhealthy {
+			return &sources[i]
+		}
+	}
+	return &sources[0]
+}
+
+// nextHealthySource returns the first source after currentID, wrapping
+// around, which is not unhealthy
+func nextHealthySource(sources []models.VideoSource, currentID uint) *models.VideoSource {
+	start := 0
+	for i, source := range sources {
+		if source.ID == currentID {
+			start = i + 1
+			break
+		}
+	}
+
+	for offset := 0; offset < len(sources); offset++ {
+		candidate := &sources[(start+offset)%len(sources)]
+		if candidate.ID == currentID || candidate.HealthStatus == models.HealthStatusUnhealthy {
+			continue
+		}
+		return candidate
+	}
+	return nil
+}
+
+// Failover switches every room which currently plays the given source to the
+// next healthy source of the same playlist item and tells its members
+func Failover(source *models.VideoSource, reason string) {
+	statuses, err := database.GetRoomPlayStatusesByVideoID(source.PlaylistItemID)
+	if err != nil {
+		config.Logger.Errorf("Failed to query rooms playing video source %d: %v", source.ID, err)
+		return
+	}
+	if len(statuses) == 0 {
+		return
+	}
+
+	sources, err := database.GetVideoSourcesByPlaylistItemID(source.PlaylistItemID)
+	if err != nil {
+		config.Logger.Errorf("Failed to query video sources of playlist item %d: %v", source.PlaylistItemID, err)
+		return
+	}
+	if len(sources) == 0 {
+		return
+	}
+
+	for _, status := range statuses {
+		activeID := status.SourceID
+		if activeID == 0 {
+			// Rooms which never selected a source play the first one
+			activeID = sources[0].ID
+		}
+		if activeID != source.ID {
+			continue
+		}
+
+		next := nextHealthySource(sources, source.ID)
+		if next == nil {
+			config.Logger.Warnf("No healthy source left for playlist item %d in room %d", source.PlaylistItemID, status.RoomID)
+			continue
+		}
+
+		if err := database.UpdateRoomPlayStatus(status.RoomID, map[string]interface{}{
+			"source_id": next.ID,
+		}); err != nil {
+			config.Logger.Errorf("Failed to switch room %d to video source %d: %v", status.RoomID, next.ID, err)
+			continue
+		}
+
+		config.Logger.Infof("Room %d failed over from video source %d to %d: %s", status.RoomID, source.ID, next.ID, reason)
+
+		syncManager := sync.GetSyncManager()
+		if syncManager != nil {
+			// The message goes to the whole room, so its URLs are signed for
+			// the room rather than for one member
+			signed := *next
+			mediaurl.GetSigner().SignSource(&signed, status.RoomID, 0, proxy.GetProxy() != nil)
+			syncManager.Broadcast(status.RoomID, sync.SyncMessage{
+				Type: "switchSource",
+				Payload: map[string]interface{}{
+					"roomId":         status.RoomID,
+					"videoId":        source.PlaylistItemID,
+					"sourceId":       next.ID,
+					"url":            signed.URL,
+					"proxyUrl":       signed.ProxyURL,
+					"label":          next.Label,
+					"failedSourceId": source.ID,
+					"reason":         reason,
+				},
+			}, nil)
+		}
+	}
+}
@@ -0,0 +1,164 @@
+package mediaurl
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Param is the query parameter carrying the access token of a media URL
+const Param = "access"
+
+var (
+	// ErrInvalidToken is returned for missing, malformed or forged tokens
+	ErrInvalidToken = errors.New("invalid media access token")
+	// ErrExpiredToken is returned for tokens past their expiry
+	ErrExpiredToken = errors.New("media access token expired")
+)
+
+// Claims are what an access token grants: the media of a room, to one user
+// when UserID is set, until Expires
+type Claims struct {
+	RoomID  uint
+	UserID  uint
+	Expires time.Time
+}
+
+// Options configures a Signer
+type Options struct {
+	// Keys verify tokens, the first one also signs them. Rotating in a new
+	// key first keeps the URLs signed with the old one working until they
+	// expire.
+	Keys [][]byte
+	// TTL is how long a signed URL stays valid
+	TTL time.Duration
+}
+
+// Signer mints and verifies access tokens for the media the server hosts or
+// proxies. A token is bound to a scope, the path prefix of the media it
+// opens, so that it cannot be moved to other media.
+type Signer struct {
+	keys [][]byte
+	ttl  time.Duration
+}
+
+var globalSigner *Signer
+
+// NewSigner creates a new signer
+func NewSigner(opts Options) (*Signer, error) {
+	if len(opts.Keys) == 0 {
+		return nil, errors.New("media URL signer needs a key")
+	}
+	if opts.TTL <= 0 {
+		opts.TTL = 6 * time.Hour
+	}
+	return &Signer{keys: opts.Keys, ttl: opts.TTL}, nil
+}
+
+// InitSigner initializes the global signer
+func InitSigner(opts Options) error {
+	signer, err := NewSigner(opts)
+	if err != nil {
+		return err
+	}
+	globalSigner = signer
+	return nil
+}
+
+// GetSigner returns the global signer
+func GetSigner() *Signer {
+	return globalSigner
+}
+
+// Sign returns a token opening the media under scope for the members of a
+// room, or for a single user of it when userID is not zero
+func (s *Signer) Sign(scope string, roomID, userID uint) string {
+	expires := time.Now().Add(s.ttl).Unix()
+	return fmt.Sprintf("%d.%d.%d.%s", roomID, userID, expires, s.mac(s.keys[0], scope, roomID, userID, expires))
+}
+
+// SignURL adds a token for scope to a media URL
+func (s *Signer) SignURL(rawURL, scope string, roomID, userID uint) string {
+	return AppendQuery(rawURL, Param+"="+s.Sign(scope, roomID, userID))
+}
+
+// Verify checks that a token was signed for scope and has not expired
+func (s *Signer) Verify(token, scope string) (*Claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 4 {
+		return nil, ErrInvalidToken
+	}
+	roomID, err1 := strconv.ParseUint(parts[0], 10, 64)
+	userID, err2 := strconv.ParseUint(parts[1], 10, 64)
+	expires, err3 := strconv.ParseInt(parts[2], 10, 64)
+	if err1 != nil || err2 != nil || err3 != nil {
+		return nil, ErrInvalidToken
+	}
+
+	valid := false
+	for _, key := range s.keys {
+		expected := s.mac(key, scope, uint(roomID), uint(userID), expires)
+		if hmac.Equal([]byte(parts[3]), []byte(expected)) {
+			valid = true
+			break
+		}
+	}
+	if !valid {
+		return nil, ErrInvalidToken
+	}
+	if time.Now().Unix() >= expires {
+		return nil, ErrExpiredToken
+	}
+
+	return &Claims{
+		RoomID:  uint(roomID),
+		UserID:  uint(userID),
+		Expires: time.Unix(expires, 0),
+	}, nil
+}
+
+func (s *Signer) mac(key []byte, scope string, roomID, userID uint, expires int64) string {
+	mac := hmac.New(sha256.New, key)
+	fmt.Fprintf(mac, "%s\n%d\n%d\n%d", scope, roomID, userID, expires)
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil)[:16])
+}
+
+// AppendQuery adds an encoded query pair to a URL or path, after any query
+// it already has
+func AppendQuery(rawURL, pair string) string {
+	if pair == "" {
+		return rawURL
+	}
+	fragment := ""
+	if index := strings.IndexByte(rawURL, '#'); index >= 0 {
+		rawURL, fragment = rawURL[:index], rawURL[index:]
+	}
+	if strings.Contains(rawURL, "?") {
+		return rawURL + "&" + pair + fragment
+	}
+	return rawURL + "?" + pair + fragment
+}
+
+// SplitQuery takes the access token off the end of a raw query, where
+// AppendQuery put it, and returns the query the media was requested with
+func SplitQuery(rawQuery string) (string, string) {
+	index := strings.LastIndexByte(rawQuery, '&')
+	last := rawQuery[index+1:]
+	if !strings.HasPrefix(last, Param+"=") {
+		return rawQuery, ""
+	}
+	token, err := url.QueryUnescape(strings.TrimPrefix(last, Param+"="))
+	if err != nil {
+		return rawQuery, ""
+	}
+	if index < 0 {
+		return "", token
+	}
+	return rawQuery[:index], token
+}
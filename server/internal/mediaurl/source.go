@@ -0,0 +1,52 @@
+package mediaurl
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+	"sync-player-server/internal/models"
+)
+
+// Path prefixes of the media the server hosts or proxies. An access token
+// is signed for the prefix of one upload, transcode job or proxied source.
+const (
+	UploadPath    = "/api/media/"
+	TranscodePath = "/api/transcode/media/"
+	ProxyPath     = "/api/proxy/"
+)
+
+// SignSource mints access tokens into the URL of a source the server hosts,
+// or fills in the proxy URL of another source when proxied is set
+func (s *Signer) SignSource(source *models.VideoSource, roomID, userID uint, proxied bool) {
+	if source.UploadID != nil || source.TranscodeJobID != nil {
+		if scope, ok := HostedScope(source.URL); ok {
+			source.URL = s.SignURL(source.URL, scope, roomID, userID)
+		}
+		return
+	}
+	if proxied {
+		scope := fmt.Sprintf("%s%d", ProxyPath, source.ID)
+		source.ProxyURL = s.SignURL(scope, scope, roomID, userID)
+	}
+}
+
+// HostedScope returns the scope of a URL of an upload or transcoded
+// rendition, the path prefix up to its key
+func HostedScope(rawURL string) (string, bool) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", false
+	}
+	for _, prefix := range []string{TranscodePath, UploadPath} {
+		index := strings.Index(u.Path, prefix)
+		if index < 0 {
+			continue
+		}
+		key, _, _ := strings.Cut(u.Path[index+len(prefix):], "/")
+		if key == "" {
+			return "", false
+		}
+		return prefix + key, true
+	}
+	return "", false
+}
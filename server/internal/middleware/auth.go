@@ -1,13 +1,17 @@
 package middleware
 
 import (
+	"errors"
 	"net/http"
 	"strings"
+	"sync-player-server/internal/database"
 	"sync-player-server/internal/utils"
 
 	"github.com/gin-gonic/gin"
 )
 
+var errSessionMismatch = errors.New("token does not belong to its session")
+
 // JWTAuth middleware validates JWT token from Authorization header
 func JWTAuth() gin.HandlerFunc {
 	return func(c *gin.Context) {
@@ -30,24 +34,14 @@ func JWTAuth() gin.HandlerFunc {
 		tokenString := parts[1]
 
 		// Validate token
-		claims, err := utils.ValidateJWT(tokenString)
+		claims, inRoom, err := validateAccessToken(tokenString)
 		if err != nil {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired token"})
 			c.Abort()
 			return
 		}
 
-		// Set claims in context for use in handlers
-		c.Set("userInfo", UserInfo{
-			RoomID: claims.RoomID,
-			UserID: claims.UserID,
-		})
-		c.Set("userId", claims.UserID)
-		c.Set("roomId", claims.RoomID)
-		c.Set("username", claims.Username)
-		c.Set("role", claims.Role)
-		c.Set("jwtClaims", claims)
-
+		setClaims(c, claims, inRoom)
 		c.Next()
 	}
 }
@@ -72,23 +66,60 @@ func OptionalJWTAuth() gin.HandlerFunc {
 		tokenString := parts[1]
 
 		// Validate token
-		claims, err := utils.ValidateJWT(tokenString)
+		claims, inRoom, err := validateAccessToken(tokenString)
 		if err != nil {
 			c.Next()
 			return
 		}
 
-		// Set claims in context for use in handlers
+		setClaims(c, claims, inRoom)
+		c.Next()
+	}
+}
+
+// validateAccessToken validates an access token and checks that its session
+// is active. inRoom reports whether the session is still in the room of the
+// token, which it leaves for example when the user leaves the room.
+func validateAccessToken(tokenString string) (claims *utils.JWTClaims, inRoom bool, err error) {
+	claims, err = utils.ValidateJWT(tokenString)
+	if err != nil {
+		return nil, false, err
+	}
+
+	session, err := database.GetActiveSession(claims.SessionID)
+	if err != nil {
+		return nil, false, err
+	}
+	if session.UserID != claims.UserID {
+		return nil, false, errSessionMismatch
+	}
+
+	return claims, claims.RoomID != 0 && session.RoomID == claims.RoomID, nil
+}
+
+// setClaims sets the claims of a valid token in context for use in handlers.
+// Tokens which are not or no longer for a room do not open room routes.
+func setClaims(c *gin.Context, claims *utils.JWTClaims, inRoom bool) {
+	if inRoom {
 		c.Set("userInfo", UserInfo{
 			RoomID: claims.RoomID,
 			UserID: claims.UserID,
 		})
-		c.Set("userId", claims.UserID)
 		c.Set("roomId", claims.RoomID)
-		c.Set("username", claims.Username)
-		c.Set("role", claims.Role)
-		c.Set("jwtClaims", claims)
+	}
+	c.Set("userId", claims.UserID)
+	c.Set("username", claims.Username)
+	c.Set("role", claims.Role)
+	c.Set("jwtClaims", claims)
+}
 
-		c.Next()
+// GetJWTClaims retrieves the claims of a valid JWT from context
+func GetJWTClaims(c *gin.Context) (*utils.JWTClaims, bool) {
+	value, exists := c.Get("jwtClaims")
+	if !exists {
+		return nil, false
 	}
+
+	claims, ok := value.(*utils.JWTClaims)
+	return claims, ok
 }
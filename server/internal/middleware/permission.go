@@ -0,0 +1,72 @@
+package middleware
+
+import (
+	"net/http"
+	"sync-player-server/internal/database"
+	"sync-player-server/internal/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RequirePermission middleware requires the user to be a member of their
+// room whose role grants a permission, and sets the member in context
+func RequirePermission(permission models.Permission) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userInfo, ok := GetUserInfo(c)
+		if !ok {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+			c.Abort()
+			return
+		}
+
+		member, err := database.GetRoomMember(userInfo.RoomID, userInfo.UserID)
+		if err != nil {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Not a member of the room"})
+			c.Abort()
+			return
+		}
+		if !member.Role.Can(permission) {
+			c.JSON(http.StatusForbidden, gin.H{
+				"error":      "Your role does not allow this",
+				"role":       member.Role,
+				"permission": permission,
+			})
+			c.Abort()
+			return
+		}
+
+		// The control policy of the room can keep playback to higher roles
+		if permission == models.PermissionControlPlayback {
+			room, err := database.GetRoomByID(member.RoomID)
+			if err != nil {
+				c.JSON(http.StatusNotFound, gin.H{"error": "Room not found"})
+				c.Abort()
+				return
+			}
+			if !room.ControlPolicy.Allows(member.Role) {
+				c.JSON(http.StatusForbidden, gin.H{
+					"error":         "The room does not allow your role to control playback",
+					"role":          member.Role,
+					"controlPolicy": room.ControlPolicy,
+				})
+				c.Abort()
+				return
+			}
+		}
+
+		c.Set("roomMember", member)
+		c.Next()
+	}
+}
+
+// GetRoomMember retrieves the member of the caller's room which
+// RequirePermission set in context
+func GetRoomMember(c *gin.Context) (*models.RoomMember, bool) {
+	value, exists := c.Get("roomMember")
+	if !exists {
+		return nil, false
+	}
+
+	member, ok := value.(*models.RoomMember)
+	return member, ok
+}
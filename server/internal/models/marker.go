@@ -0,0 +1,40 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// MarkerType represents the kind of a playlist item marker
+type MarkerType string
+
+const (
+	MarkerTypeChapter   MarkerType = "chapter"
+	MarkerTypeBookmark  MarkerType = "bookmark"
+	MarkerTypeSkipIntro MarkerType = "skip-intro"
+)
+
+// Marker represents a timestamped chapter, bookmark or skip-intro range on a
+// playlist item shared with the whole room
+type Marker struct {
+	ID             uint           `gorm:"primaryKey;autoIncrement" json:"id"`
+	PlaylistItemID uint           `gorm:"not null;index" json:"playlistItemId"`
+	UserID         uint           `gorm:"not null;index" json:"userId"`
+	Type           MarkerType     `gorm:"type:varchar(20);not null;default:'bookmark'" json:"type"`
+	Time           float64        `gorm:"not null;default:0" json:"time"`
+	EndTime        float64        `gorm:"default:0" json:"endTime,omitempty"`
+	Label          string         `gorm:"type:varchar(255)" json:"label"`
+	CreatedTime    time.Time      `gorm:"not null;autoCreateTime:milli" json:"createdTime"`
+	LastActiveTime time.Time      `gorm:"not null;autoUpdateTime:milli" json:"lastActiveTime"`
+	DeletedAt      gorm.DeletedAt `gorm:"index" json:"-"`
+
+	// Associations
+	PlaylistItem *PlaylistItem `gorm:"foreignKey:PlaylistItemID" json:"playlistItem,omitempty"`
+	User         *User         `gorm:"foreignKey:UserID" json:"user,omitempty"`
+}
+
+// TableName specifies the table name for Marker model
+func (Marker) TableName() string {
+	return "markers"
+}
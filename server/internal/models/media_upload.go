@@ -0,0 +1,43 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// UploadStatus represents the state of a media upload
+type UploadStatus string
+
+const (
+	UploadStatusUploading UploadStatus = "uploading"
+	UploadStatusComplete  UploadStatus = "complete"
+)
+
+// MediaUpload is a media file a member uploads to a room in chunks. Its
+// UploadKey names it in upload and media URLs and in the storage. Once all
+// bytes arrived it is attached to the room playlist as a video source.
+type MediaUpload struct {
+	ID        uint         `gorm:"primaryKey;autoIncrement" json:"id"`
+	UploadKey string       `gorm:"type:varchar(64);not null;uniqueIndex" json:"uploadKey"`
+	UserID    uint         `gorm:"not null;index" json:"userId"`
+	RoomID    uint         `gorm:"not null;index" json:"roomId"`
+	FileName  string       `gorm:"type:varchar(255)" json:"fileName"`
+	Title     string       `gorm:"type:varchar(255)" json:"title"`
+	MimeType  string       `gorm:"type:varchar(100)" json:"mimeType"`
+	Size      int64        `gorm:"not null" json:"size"`
+	Offset    int64        `gorm:"not null;default:0" json:"offset"`
+	Status    UploadStatus `gorm:"type:varchar(20);not null;default:'uploading'" json:"status"`
+	// PlaylistItemID is the item the upload is added to as a further
+	// source, zero adds a new item
+	PlaylistItemID uint           `gorm:"default:0" json:"playlistItemId,omitempty"`
+	CreatedTime    time.Time      `gorm:"not null;autoCreateTime:milli" json:"createdTime"`
+	LastActiveTime time.Time      `gorm:"not null;autoUpdateTime:milli" json:"lastActiveTime"`
+	CompletedTime  *time.Time     `json:"completedTime,omitempty"`
+	DeletedAt      gorm.DeletedAt `gorm:"index" json:"-"`
+}
+
+// TableName specifies the table name for MediaUpload model
+func (MediaUpload) TableName() string {
+	return "media_uploads"
+}
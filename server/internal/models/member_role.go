@@ -0,0 +1,96 @@
+package models
+
+// MemberRole represents what a member may do in a room
+type MemberRole string
+
+const (
+	// MemberRoleOwner is the member who created the room, there is one per room
+	MemberRoleOwner     MemberRole = "owner"
+	MemberRoleAdmin     MemberRole = "admin"
+	MemberRoleModerator MemberRole = "moderator"
+	MemberRoleMember    MemberRole = "member"
+	// MemberRoleViewer only watches, it cannot control playback or the playlist
+	MemberRoleViewer MemberRole = "viewer"
+)
+
+// Permission represents an action in a room which depends on the role
+type Permission string
+
+const (
+	PermissionView            Permission = "view"
+	PermissionControlPlayback Permission = "controlPlayback"
+	// PermissionEditPlaylist covers adding items and changing or deleting
+	// one's own
+	PermissionEditPlaylist Permission = "editPlaylist"
+	// PermissionManagePlaylist covers changing or deleting the items of other
+	// members and clearing the playlist
+	PermissionManagePlaylist Permission = "managePlaylist"
+	PermissionManageMembers  Permission = "manageMembers"
+	PermissionAssignRoles    Permission = "assignRoles"
+	PermissionManageSettings Permission = "manageSettings"
+)
+
+// rolePermissions is the permission matrix of the roles
+var rolePermissions = map[MemberRole][]Permission{
+	MemberRoleOwner: {
+		PermissionView, PermissionControlPlayback, PermissionEditPlaylist, PermissionManagePlaylist,
+		PermissionManageMembers, PermissionAssignRoles, PermissionManageSettings,
+	},
+	MemberRoleAdmin: {
+		PermissionView, PermissionControlPlayback, PermissionEditPlaylist, PermissionManagePlaylist,
+		PermissionManageMembers, PermissionAssignRoles, PermissionManageSettings,
+	},
+	MemberRoleModerator: {
+		PermissionView, PermissionControlPlayback, PermissionEditPlaylist, PermissionManagePlaylist,
+		PermissionManageMembers,
+	},
+	MemberRoleMember: {
+		PermissionView, PermissionControlPlayback, PermissionEditPlaylist,
+	},
+	MemberRoleViewer: {
+		PermissionView,
+	},
+}
+
+// roleRanks orders the roles, members only manage members ranked below them
+var roleRanks = map[MemberRole]int{
+	MemberRoleOwner:     5,
+	MemberRoleAdmin:     4,
+	MemberRoleModerator: 3,
+	MemberRoleMember:    2,
+	MemberRoleViewer:    1,
+}
+
+// Valid reports whether the role is one of the known roles
+func (r MemberRole) Valid() bool {
+	_, ok := roleRanks[r]
+	return ok
+}
+
+// Rank returns the position of the role, higher roles rank higher and
+// unknown roles rank lowest
+func (r MemberRole) Rank() int {
+	return roleRanks[r]
+}
+
+// IsAdmin reports whether the role administers the room
+func (r MemberRole) IsAdmin() bool {
+	return r == MemberRoleOwner || r == MemberRoleAdmin
+}
+
+// Can reports whether the role grants a permission
+func (r MemberRole) Can(permission Permission) bool {
+	for _, granted := range rolePermissions[r] {
+		if granted == permission {
+			return true
+		}
+	}
+	return false
+}
+
+// Permissions returns the permissions the role grants
+func (r MemberRole) Permissions() []Permission {
+	permissions := make([]Permission, len(rolePermissions[r]))
+	copy(permissions, rolePermissions[r])
+	return permissions
+}
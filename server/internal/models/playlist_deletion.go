@@ -0,0 +1,22 @@
+package models
+
+import "time"
+
+// PlaylistDeletion records a delete or clear of playlist items. All rows it
+// soft-deleted share its DeletedTime, which lets the deletion be undone as a
+// whole with its undo token while the token is valid.
+type PlaylistDeletion struct {
+	ID              uint      `gorm:"primaryKey;autoIncrement" json:"id"`
+	RoomID          uint      `gorm:"not null;index" json:"roomId"`
+	UserID          uint      `gorm:"not null" json:"userId"`
+	Cleared         bool      `gorm:"not null;default:false" json:"cleared"`
+	ItemCount       int       `gorm:"not null;default:0" json:"itemCount"`
+	DeletedTime     time.Time `gorm:"not null" json:"deletedTime"`
+	UndoToken       string    `gorm:"type:varchar(64);not null;uniqueIndex" json:"-"`
+	UndoExpiresTime time.Time `gorm:"not null" json:"undoExpiresTime"`
+}
+
+// TableName specifies the table name for PlaylistDeletion model
+func (PlaylistDeletion) TableName() string {
+	return "playlist_deletions"
+}
@@ -19,15 +19,20 @@ const (
 type PlaylistItem struct {
 	ID          uint           `gorm:"primaryKey;autoIncrement" json:"id"`
 	RoomID      uint           `gorm:"not null;index" json:"roomId"`
+	AddedBy     uint           `gorm:"default:0;index" json:"addedBy"`
 	Title       string         `gorm:"type:varchar(255);not null" json:"title"`
-	OrderIndex  int            `gorm:"not null" json:"orderIndex"`
+	SortKey     string         `gorm:"type:varchar(64);not null;default:'';index" json:"sortKey"`
+	OrderIndex  int            `gorm:"-" json:"orderIndex"` // Position in the room playlist, derived from SortKey
 	PlayStatus  PlayStatus     `gorm:"type:varchar(20);not null;default:'new'" json:"playStatus"`
+	Upvotes     int            `gorm:"not null;default:0" json:"upvotes"`
 	CreatedTime time.Time      `gorm:"not null;autoCreateTime:milli" json:"createdTime"`
 	DeletedAt   gorm.DeletedAt `gorm:"index" json:"-"`
 
 	// Associations
-	Room         *Room          `gorm:"foreignKey:RoomID" json:"room,omitempty"`
-	VideoSources []VideoSource  `gorm:"foreignKey:PlaylistItemID" json:"videoSources,omitempty"`
+	Room           *Room           `gorm:"foreignKey:RoomID" json:"room,omitempty"`
+	VideoSources   []VideoSource   `gorm:"foreignKey:PlaylistItemID" json:"videoSources,omitempty"`
+	SubtitleTracks []SubtitleTrack `gorm:"foreignKey:PlaylistItemID" json:"subtitleTracks,omitempty"`
+	Markers        []Marker        `gorm:"foreignKey:PlaylistItemID" json:"markers,omitempty"`
 }
 
 // TableName specifies the table name for PlaylistItem model
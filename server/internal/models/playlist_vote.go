@@ -0,0 +1,29 @@
+package models
+
+import (
+	"time"
+)
+
+// VoteType represents what a playlist vote is for
+type VoteType string
+
+const (
+	VoteTypeUp   VoteType = "up"
+	VoteTypeSkip VoteType = "skip"
+)
+
+// PlaylistVote represents a member's upvote of a queued playlist item or
+// vote to skip the item currently playing. Votes are removed outright, so a
+// member has at most one vote of each type per item.
+type PlaylistVote struct {
+	ID             uint      `gorm:"primaryKey;autoIncrement" json:"id"`
+	PlaylistItemID uint      `gorm:"not null;uniqueIndex:idx_playlist_vote" json:"playlistItemId"`
+	UserID         uint      `gorm:"not null;uniqueIndex:idx_playlist_vote" json:"userId"`
+	Type           VoteType  `gorm:"type:varchar(10);not null;uniqueIndex:idx_playlist_vote" json:"type"`
+	CreatedTime    time.Time `gorm:"not null;autoCreateTime:milli" json:"createdTime"`
+}
+
+// TableName specifies the table name for PlaylistVote model
+func (PlaylistVote) TableName() string {
+	return "playlist_votes"
+}
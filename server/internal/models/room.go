@@ -6,14 +6,73 @@ import (
 	"gorm.io/gorm"
 )
 
+// QueueMode represents how the up next order of a room's playlist is decided
+type QueueMode string
+
+const (
+	QueueModeManual QueueMode = "manual"
+	QueueModeVote   QueueMode = "vote"
+	// QueueModeRoundRobin interleaves the queues of the members who added items
+	QueueModeRoundRobin QueueMode = "round-robin"
+)
+
+// RoomVisibility represents who can find and join a room
+type RoomVisibility string
+
+const (
+	// RoomVisibilityPublic rooms are listed for everyone to join
+	RoomVisibilityPublic RoomVisibility = "public"
+	// RoomVisibilityUnlisted rooms are joined by name but not listed
+	RoomVisibilityUnlisted RoomVisibility = "unlisted"
+	// RoomVisibilityPrivate rooms are only joined with an invite
+	RoomVisibilityPrivate RoomVisibility = "private"
+)
+
+// ControlPolicy represents which members of a room control playback, on top
+// of their role allowing it
+type ControlPolicy string
+
+const (
+	ControlPolicyEveryone   ControlPolicy = "everyone"
+	ControlPolicyModerators ControlPolicy = "moderators"
+	ControlPolicyAdmins     ControlPolicy = "admins"
+)
+
+// Allows reports whether members of a role control playback under the policy
+func (p ControlPolicy) Allows(role MemberRole) bool {
+	switch p {
+	case ControlPolicyModerators:
+		return role.Rank() >= MemberRoleModerator.Rank()
+	case ControlPolicyAdmins:
+		return role.IsAdmin()
+	default:
+		return true
+	}
+}
+
 // Room represents a sync room
 type Room struct {
-	ID             uint           `gorm:"primaryKey;autoIncrement" json:"id"`
-	Name           string         `gorm:"type:varchar(100);not null" json:"name"`
-	PasswordHash   *string        `gorm:"type:varchar(255)" json:"passwordHash,omitempty"`
-	CreatedTime    time.Time      `gorm:"not null;autoCreateTime:milli" json:"createdTime"`
-	LastActiveTime time.Time      `gorm:"not null;autoUpdateTime:milli" json:"lastActiveTime"`
-	DeletedAt      gorm.DeletedAt `gorm:"index" json:"-"`
+	ID           uint    `gorm:"primaryKey;autoIncrement" json:"id"`
+	Name         string  `gorm:"type:varchar(100);not null" json:"name"`
+	PasswordHash *string `gorm:"type:varchar(255)" json:"-"`
+	// HasPassword tells clients whether joining asks for a password
+	HasPassword   bool      `gorm:"-" json:"hasPassword"`
+	QueueMode     QueueMode `gorm:"type:varchar(20);not null;default:'manual'" json:"queueMode"`
+	SkipVoteRatio float64   `gorm:"default:0" json:"skipVoteRatio"`
+	// MaxQueuedPerMember limits the queued items per member, zero means no limit
+	MaxQueuedPerMember int `gorm:"default:0" json:"maxQueuedPerMember"`
+	// MaxMembers limits how many members can join, zero means no limit
+	MaxMembers int            `gorm:"not null;default:0" json:"maxMembers"`
+	Visibility RoomVisibility `gorm:"type:varchar(20);not null;default:'unlisted';index" json:"visibility"`
+	// DefaultRole is the role of members who join without an invite
+	DefaultRole   MemberRole    `gorm:"type:varchar(20);not null;default:'member'" json:"defaultRole"`
+	ControlPolicy ControlPolicy `gorm:"type:varchar(20);not null;default:'everyone'" json:"controlPolicy"`
+	// SyncToleranceSeconds is how far players may drift from the room before
+	// they seek, zero falls back to the server default
+	SyncToleranceSeconds float64        `gorm:"default:0" json:"syncToleranceSeconds"`
+	CreatedTime          time.Time      `gorm:"not null;autoCreateTime:milli" json:"createdTime"`
+	LastActiveTime       time.Time      `gorm:"not null;autoUpdateTime:milli" json:"lastActiveTime"`
+	DeletedAt            gorm.DeletedAt `gorm:"index" json:"-"`
 }
 
 // TableName specifies the table name for Room model
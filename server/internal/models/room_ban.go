@@ -0,0 +1,25 @@
+package models
+
+import (
+	"time"
+)
+
+// RoomBan keeps a user out of a room, until ExpiresAt when it is set. A user
+// has at most one ban per room, banning again replaces it.
+type RoomBan struct {
+	ID          uint       `gorm:"primaryKey;autoIncrement" json:"id"`
+	RoomID      uint       `gorm:"not null;uniqueIndex:idx_room_ban" json:"roomId"`
+	UserID      uint       `gorm:"not null;uniqueIndex:idx_room_ban" json:"userId"`
+	BannedBy    uint       `gorm:"not null" json:"bannedBy"`
+	Reason      string     `gorm:"type:varchar(255)" json:"reason"`
+	CreatedTime time.Time  `gorm:"not null;autoCreateTime:milli" json:"createdTime"`
+	ExpiresAt   *time.Time `gorm:"index" json:"expiresAt"`
+
+	// Associations
+	User *User `gorm:"foreignKey:UserID" json:"user,omitempty"`
+}
+
+// TableName specifies the table name for RoomBan model
+func (RoomBan) TableName() string {
+	return "room_bans"
+}
@@ -0,0 +1,46 @@
+package models
+
+import (
+	"time"
+)
+
+// RoomInvite is a link which lets users join a room without its password,
+// with the role the invite gives. Only a hash of its token is stored.
+type RoomInvite struct {
+	ID        uint       `gorm:"primaryKey;autoIncrement" json:"id"`
+	RoomID    uint       `gorm:"not null;index" json:"roomId"`
+	TokenHash string     `gorm:"type:varchar(64);not null;uniqueIndex" json:"-"`
+	CreatedBy uint       `gorm:"not null" json:"createdBy"`
+	Role      MemberRole `gorm:"type:varchar(20);not null;default:'member'" json:"role"`
+	// MaxUses limits how many users can join with the invite, zero means no
+	// limit
+	MaxUses     int        `gorm:"not null;default:0" json:"maxUses"`
+	Uses        int        `gorm:"not null;default:0" json:"uses"`
+	CreatedTime time.Time  `gorm:"not null;autoCreateTime:milli" json:"createdTime"`
+	ExpiresAt   time.Time  `gorm:"not null;index" json:"expiresAt"`
+	RevokedAt   *time.Time `json:"revokedAt,omitempty"`
+
+	// Associations
+	Redemptions []RoomInviteRedemption `gorm:"foreignKey:InviteID" json:"redemptions,omitempty"`
+}
+
+// TableName specifies the table name for RoomInvite model
+func (RoomInvite) TableName() string {
+	return "room_invites"
+}
+
+// RoomInviteRedemption records a user who joined a room with an invite
+type RoomInviteRedemption struct {
+	ID           uint      `gorm:"primaryKey;autoIncrement" json:"id"`
+	InviteID     uint      `gorm:"not null;index" json:"inviteId"`
+	UserID       uint      `gorm:"not null;index" json:"userId"`
+	RedeemedTime time.Time `gorm:"not null;autoCreateTime:milli" json:"redeemedTime"`
+
+	// Associations
+	User *User `gorm:"foreignKey:UserID" json:"user,omitempty"`
+}
+
+// TableName specifies the table name for RoomInviteRedemption model
+func (RoomInviteRedemption) TableName() string {
+	return "room_invite_redemptions"
+}
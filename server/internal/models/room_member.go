@@ -6,13 +6,17 @@ import (
 
 // RoomMember represents the relationship between users and rooms
 type RoomMember struct {
-	ID             uint           `gorm:"primaryKey;autoIncrement" json:"id"`
-	RoomID         uint           `gorm:"not null;index" json:"roomId"`
-	UserID         uint           `gorm:"not null;index" json:"userId"`
-	IsAdmin        bool           `gorm:"default:false" json:"isAdmin"`
-	CanGrantAdmin  bool           `gorm:"default:false" json:"canGrantAdmin"`
-	Online         bool           `gorm:"default:false" json:"online"`
-	DeletedAt      gorm.DeletedAt `gorm:"index" json:"-"`
+	ID     uint       `gorm:"primaryKey;autoIncrement" json:"id"`
+	RoomID uint       `gorm:"not null;index" json:"roomId"`
+	UserID uint       `gorm:"not null;index" json:"userId"`
+	Role   MemberRole `gorm:"type:varchar(20);not null;default:'member'" json:"role"`
+	// IsAdmin mirrors whether Role is owner or admin
+	IsAdmin bool `gorm:"default:false" json:"isAdmin"`
+	// CanGrantAdmin allows an admin to grant and revoke the admin role, the
+	// owner always can
+	CanGrantAdmin bool           `gorm:"default:false" json:"canGrantAdmin"`
+	Online        bool           `gorm:"default:false" json:"online"`
+	DeletedAt     gorm.DeletedAt `gorm:"index" json:"-"`
 
 	// Associations
 	User *User `gorm:"foreignKey:UserID" json:"user,omitempty"`
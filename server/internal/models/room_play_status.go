@@ -12,8 +12,14 @@ type RoomPlayStatus struct {
 	Time      float64        `gorm:"default:0" json:"time"`
 	Timestamp int64          `gorm:"default:0" json:"timestamp"`
 	VideoID   uint           `gorm:"default:0" json:"videoId"`
+	SourceID  uint           `gorm:"default:0" json:"sourceId"`
 	DeletedAt gorm.DeletedAt `gorm:"index" json:"-"`
 
+	// Subtitle track shown to the room, zero when subtitles are off, and the
+	// offset in seconds applied to its cues
+	SubtitleTrackID uint    `gorm:"default:0" json:"subtitleTrackId"`
+	SubtitleOffset  float64 `gorm:"default:0" json:"subtitleOffset"`
+
 	// Associations
 	Room *Room `gorm:"foreignKey:RoomID" json:"room,omitempty"`
 }
@@ -0,0 +1,49 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// SavedSource is a video source of a saved playlist item
+type SavedSource struct {
+	URL   string `json:"url"`
+	Label string `json:"label"`
+}
+
+// SavedPlaylist represents a playlist owned by a user which lives
+// independently of rooms and can be loaded into any room of its owner
+type SavedPlaylist struct {
+	ID     uint   `gorm:"primaryKey;autoIncrement" json:"id"`
+	UserID uint   `gorm:"not null;index" json:"userId"`
+	Name   string `gorm:"type:varchar(100);not null" json:"name"`
+	// ShareToken grants read-only access to anyone who knows it, nil when not shared
+	ShareToken     *string        `gorm:"type:varchar(64);uniqueIndex" json:"shareToken,omitempty"`
+	ItemCount      int            `gorm:"-" json:"itemCount"`
+	CreatedTime    time.Time      `gorm:"not null;autoCreateTime:milli" json:"createdTime"`
+	LastActiveTime time.Time      `gorm:"not null;autoUpdateTime:milli" json:"lastActiveTime"`
+	DeletedAt      gorm.DeletedAt `gorm:"index" json:"-"`
+
+	// Associations
+	Items []SavedPlaylistItem `gorm:"foreignKey:SavedPlaylistID" json:"items,omitempty"`
+}
+
+// TableName specifies the table name for SavedPlaylist model
+func (SavedPlaylist) TableName() string {
+	return "saved_playlists"
+}
+
+// SavedPlaylistItem represents an item of a saved playlist
+type SavedPlaylistItem struct {
+	ID              uint          `gorm:"primaryKey;autoIncrement" json:"id"`
+	SavedPlaylistID uint          `gorm:"not null;index" json:"savedPlaylistId"`
+	Title           string        `gorm:"type:varchar(255);not null" json:"title"`
+	OrderIndex      int           `gorm:"not null" json:"orderIndex"`
+	Sources         []SavedSource `gorm:"type:text;serializer:json" json:"sources"`
+}
+
+// TableName specifies the table name for SavedPlaylistItem model
+func (SavedPlaylistItem) TableName() string {
+	return "saved_playlist_items"
+}
@@ -0,0 +1,31 @@
+package models
+
+import (
+	"time"
+)
+
+// Session is a device a user logged in on. Its refresh token is exchanged
+// for short-lived access tokens and replaced with each exchange; only hashes
+// of the tokens are stored.
+type Session struct {
+	ID     uint `gorm:"primaryKey;autoIncrement" json:"id"`
+	UserID uint `gorm:"not null;index" json:"userId"`
+	// RoomID is the room the access tokens of the session open, zero before
+	// joining one
+	RoomID           uint   `gorm:"not null;default:0;index" json:"roomId"`
+	RefreshTokenHash string `gorm:"type:varchar(64);not null;uniqueIndex" json:"-"`
+	// PreviousTokenHash is the refresh token the current one replaced. It
+	// being used again means the token was stolen, which revokes the session.
+	PreviousTokenHash *string    `gorm:"type:varchar(64);index" json:"-"`
+	Device            string     `gorm:"type:varchar(255)" json:"device"`
+	IPAddress         string     `gorm:"type:varchar(64)" json:"ipAddress"`
+	CreatedTime       time.Time  `gorm:"not null;autoCreateTime:milli" json:"createdTime"`
+	LastUsedTime      time.Time  `gorm:"not null" json:"lastUsedTime"`
+	ExpiresAt         time.Time  `gorm:"not null;index" json:"expiresAt"`
+	RevokedAt         *time.Time `gorm:"index" json:"revokedAt,omitempty"`
+}
+
+// TableName specifies the table name for Session model
+func (Session) TableName() string {
+	return "sessions"
+}
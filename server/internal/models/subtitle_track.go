@@ -0,0 +1,32 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// SubtitleTrack represents a subtitle track for a playlist item. A track
+// either points to an external WebVTT file or holds uploaded content which
+// was converted to WebVTT.
+type SubtitleTrack struct {
+	ID             uint           `gorm:"primaryKey;autoIncrement" json:"id"`
+	PlaylistItemID uint           `gorm:"not null;index" json:"playlistItemId"`
+	Language       string         `gorm:"type:varchar(35)" json:"language"`
+	Label          string         `gorm:"type:varchar(100)" json:"label"`
+	URL            string         `gorm:"type:text" json:"url,omitempty"`
+	Content        string         `gorm:"type:text" json:"-"`
+	Format         string         `gorm:"type:varchar(10)" json:"format,omitempty"`
+	Uploaded       bool           `gorm:"default:false" json:"uploaded"`
+	CreatedTime    time.Time      `gorm:"not null;autoCreateTime:milli" json:"createdTime"`
+	LastActiveTime time.Time      `gorm:"not null;autoUpdateTime:milli" json:"lastActiveTime"`
+	DeletedAt      gorm.DeletedAt `gorm:"index" json:"-"`
+
+	// Associations
+	PlaylistItem *PlaylistItem `gorm:"foreignKey:PlaylistItemID" json:"playlistItem,omitempty"`
+}
+
+// TableName specifies the table name for SubtitleTrack model
+func (SubtitleTrack) TableName() string {
+	return "subtitle_tracks"
+}
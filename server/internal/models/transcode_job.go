@@ -0,0 +1,52 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// TranscodeStatus represents the state of a transcode job
+type TranscodeStatus string
+
+const (
+	TranscodeStatusQueued    TranscodeStatus = "queued"
+	TranscodeStatusRunning   TranscodeStatus = "running"
+	TranscodeStatusCompleted TranscodeStatus = "completed"
+	TranscodeStatusFailed    TranscodeStatus = "failed"
+	TranscodeStatusCanceled  TranscodeStatus = "canceled"
+)
+
+// TranscodeJob converts a video source browsers cannot play into HLS
+// renditions. Each finished rendition is added to the playlist item of the
+// source as a further source. JobKey names the output in media URLs.
+type TranscodeJob struct {
+	ID             uint            `gorm:"primaryKey;autoIncrement" json:"id"`
+	JobKey         string          `gorm:"type:varchar(64);not null;uniqueIndex" json:"jobKey"`
+	RoomID         uint            `gorm:"not null;index" json:"roomId"`
+	UserID         uint            `gorm:"not null" json:"userId"`
+	PlaylistItemID uint            `gorm:"not null;index" json:"playlistItemId"`
+	SourceID       uint            `gorm:"not null;index" json:"sourceId"`
+	Renditions     []string        `gorm:"type:text;serializer:json" json:"renditions"`
+	Status         TranscodeStatus `gorm:"type:varchar(20);not null;default:'queued';index" json:"status"`
+	// Progress over all renditions from 0 to 1
+	Progress float64 `gorm:"default:0" json:"progress"`
+	// Rendition being packaged while the job runs
+	CurrentRendition string `gorm:"type:varchar(20)" json:"currentRendition,omitempty"`
+	// Renditions already attached to the playlist item
+	DoneRenditions []string `gorm:"type:text;serializer:json" json:"doneRenditions"`
+	Error          string   `gorm:"type:varchar(255)" json:"error,omitempty"`
+	// BaseURL the renditions are served under, taken from the request which
+	// created the job
+	BaseURL        string         `gorm:"type:varchar(255)" json:"-"`
+	CreatedTime    time.Time      `gorm:"not null;autoCreateTime:milli" json:"createdTime"`
+	StartedTime    *time.Time     `json:"startedTime,omitempty"`
+	FinishedTime   *time.Time     `json:"finishedTime,omitempty"`
+	LastActiveTime time.Time      `gorm:"not null;autoUpdateTime:milli" json:"lastActiveTime"`
+	DeletedAt      gorm.DeletedAt `gorm:"index" json:"-"`
+}
+
+// TableName specifies the table name for TranscodeJob model
+func (TranscodeJob) TableName() string {
+	return "transcode_jobs"
+}
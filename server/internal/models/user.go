@@ -8,12 +8,18 @@ import (
 
 // User represents a user in the system
 type User struct {
-	ID             uint           `gorm:"primaryKey;autoIncrement" json:"id"`
-	Username       string         `gorm:"type:varchar(50);uniqueIndex;not null" json:"username"`
-	PasswordHash   *string        `gorm:"type:varchar(255)" json:"passwordHash,omitempty"`
-	CreatedTime    time.Time      `gorm:"not null;autoCreateTime:milli" json:"createdTime"`
-	LastActiveTime time.Time      `gorm:"not null;autoUpdateTime:milli" json:"lastActiveTime"`
-	DeletedAt      gorm.DeletedAt `gorm:"index" json:"-"`
+	ID           uint    `gorm:"primaryKey;autoIncrement" json:"id"`
+	Username     string  `gorm:"type:varchar(50);uniqueIndex;not null" json:"username"`
+	PasswordHash *string `gorm:"type:varchar(255)" json:"-"`
+	// IsGuest marks accounts without a password, which log in by name only
+	IsGuest bool `gorm:"not null;default:false" json:"isGuest"`
+	// FailedLoginAttempts counts the wrong passwords since the last login,
+	// reaching the limit locks the account until LockedUntil
+	FailedLoginAttempts int            `gorm:"not null;default:0" json:"-"`
+	LockedUntil         *time.Time     `json:"-"`
+	CreatedTime         time.Time      `gorm:"not null;autoCreateTime:milli" json:"createdTime"`
+	LastActiveTime      time.Time      `gorm:"not null;autoUpdateTime:milli" json:"lastActiveTime"`
+	DeletedAt           gorm.DeletedAt `gorm:"index" json:"-"`
 }
 
 // TableName specifies the table name for User model
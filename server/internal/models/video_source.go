@@ -6,16 +6,108 @@ import (
 	"gorm.io/gorm"
 )
 
+// ProbeStatus represents the state of media probing for a video source
+type ProbeStatus string
+
+const (
+	ProbeStatusDone   ProbeStatus = "done"
+	ProbeStatusFailed ProbeStatus = "failed"
+)
+
+// HealthStatus represents the reachability of a video source
+type HealthStatus string
+
+const (
+	HealthStatusUnknown   HealthStatus = "unknown"
+	HealthStatusHealthy   HealthStatus = "healthy"
+	HealthStatusUnhealthy HealthStatus = "unhealthy"
+)
+
+// MediaVariant describes one rendition of an adaptive stream
+type MediaVariant struct {
+	URL       string  `json:"url,omitempty"`
+	Bandwidth int     `json:"bandwidth,omitempty"`
+	Width     int     `json:"width,omitempty"`
+	Height    int     `json:"height,omitempty"`
+	Codecs    string  `json:"codecs,omitempty"`
+	FrameRate float64 `json:"frameRate,omitempty"`
+}
+
+// MediaAudioTrack describes an audio track of a video source
+type MediaAudioTrack struct {
+	Language string `json:"language,omitempty"`
+	Name     string `json:"name,omitempty"`
+	Codec    string `json:"codec,omitempty"`
+	Default  bool   `json:"default,omitempty"`
+}
+
+// MediaChapter describes a chapter embedded in a video source
+type MediaChapter struct {
+	Start float64 `json:"start"`
+	End   float64 `json:"end,omitempty"`
+	Title string  `json:"title,omitempty"`
+}
+
+// MediaInfo holds the stream metadata discovered by probing a video source
+type MediaInfo struct {
+	Duration    float64           `gorm:"default:0" json:"duration"`
+	Container   string            `gorm:"type:varchar(20)" json:"container,omitempty"`
+	IsLive      bool              `gorm:"default:false" json:"isLive"`
+	Width       int               `gorm:"default:0" json:"width,omitempty"`
+	Height      int               `gorm:"default:0" json:"height,omitempty"`
+	VideoCodec  string            `gorm:"type:varchar(50)" json:"videoCodec,omitempty"`
+	AudioCodec  string            `gorm:"type:varchar(50)" json:"audioCodec,omitempty"`
+	Variants    []MediaVariant    `gorm:"type:text;serializer:json" json:"variants,omitempty"`
+	AudioTracks []MediaAudioTrack `gorm:"type:text;serializer:json" json:"audioTracks,omitempty"`
+	Chapters    []MediaChapter    `gorm:"type:text;serializer:json" json:"chapters,omitempty"`
+	ProbeStatus ProbeStatus       `gorm:"type:varchar(20)" json:"probeStatus,omitempty"`
+	ProbeError  string            `gorm:"type:varchar(255)" json:"probeError,omitempty"`
+	ProbedTime  *time.Time        `json:"probedTime,omitempty"`
+}
+
+// SourceHealth holds the result of the latest health check of a video source
+type SourceHealth struct {
+	HealthStatus      HealthStatus `gorm:"type:varchar(20);default:'unknown'" json:"healthStatus"`
+	HealthLatencyMs   int64        `gorm:"default:0" json:"healthLatencyMs,omitempty"`
+	HealthError       string       `gorm:"type:varchar(255)" json:"healthError,omitempty"`
+	HealthFailures    int          `gorm:"default:0" json:"-"`
+	HealthCheckedTime *time.Time   `json:"healthCheckedTime,omitempty"`
+}
+
+// MaxVideoSourceURLLength is the longest source URL accepted. The text
+// column holds it on every database, a varchar would truncate it.
+const MaxVideoSourceURLLength = 8192
+
 // VideoSource represents a video source URL for a playlist item
 type VideoSource struct {
 	ID             uint           `gorm:"primaryKey;autoIncrement" json:"id"`
 	PlaylistItemID uint           `gorm:"not null;index" json:"playlistItemId"`
-	URL            string         `gorm:"type:varchar(255);not null" json:"url"`
+	URL            string         `gorm:"type:text;not null" json:"url"`
 	Label          string         `gorm:"type:varchar(100)" json:"label"`
+	PageURL        string         `gorm:"type:text" json:"pageUrl,omitempty"`
+	Resolver       string         `gorm:"type:varchar(50)" json:"resolver,omitempty"`
 	CreatedTime    time.Time      `gorm:"not null;autoCreateTime:milli" json:"createdTime"`
 	LastActiveTime time.Time      `gorm:"not null;autoUpdateTime:milli" json:"lastActiveTime"`
 	DeletedAt      gorm.DeletedAt `gorm:"index" json:"-"`
 
+	// Stream metadata filled in by the prober
+	MediaInfo `gorm:"embedded"`
+
+	// Reachability recorded by the health checker and client reports
+	SourceHealth `gorm:"embedded"`
+
+	// Extra request headers such as Referer or Cookie sent by the media proxy
+	ProxyHeaders map[string]string `gorm:"type:text;serializer:json" json:"-"`
+	// Signed URL playing the source through the media proxy, minted when
+	// the playlist is fetched
+	ProxyURL string `gorm:"-" json:"proxyUrl,omitempty"`
+
+	// Upload the source serves, nil for sources hosted elsewhere
+	UploadID *uint `gorm:"index" json:"uploadId,omitempty"`
+
+	// Transcode job which packaged the source, nil for sources it did not
+	TranscodeJobID *uint `gorm:"index" json:"transcodeJobId,omitempty"`
+
 	// Associations
 	PlaylistItem *PlaylistItem `gorm:"foreignKey:PlaylistItemID" json:"playlistItem,omitempty"`
 }
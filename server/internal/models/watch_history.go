@@ -0,0 +1,49 @@
+package models
+
+import (
+	"time"
+)
+
+// HistorySource is a copy of a video source taken when an item started
+// playing, so that history entries outlive the playlist item
+type HistorySource struct {
+	URL   string `json:"url"`
+	Label string `json:"label"`
+}
+
+// WatchHistory records one playback of a playlist item in a room
+type WatchHistory struct {
+	ID             uint            `gorm:"primaryKey;autoIncrement" json:"id"`
+	RoomID         uint            `gorm:"not null;index" json:"roomId"`
+	PlaylistItemID uint            `gorm:"not null;index" json:"playlistItemId"`
+	Title          string          `gorm:"type:varchar(255);not null" json:"title"`
+	Sources        []HistorySource `gorm:"type:text;serializer:json" json:"sources"`
+	Duration       float64         `gorm:"default:0" json:"duration"`
+	// WatchedSeconds is the playback position the room reached
+	WatchedSeconds float64    `gorm:"default:0" json:"watchedSeconds"`
+	StartedTime    time.Time  `gorm:"not null;index" json:"startedTime"`
+	EndedTime      *time.Time `json:"endedTime,omitempty"`
+
+	// Associations
+	Members []WatchHistoryMember `gorm:"foreignKey:WatchHistoryID" json:"members,omitempty"`
+}
+
+// TableName specifies the table name for WatchHistory model
+func (WatchHistory) TableName() string {
+	return "watch_history"
+}
+
+// WatchHistoryMember records a member who was present during a playback
+type WatchHistoryMember struct {
+	ID             uint `gorm:"primaryKey;autoIncrement" json:"-"`
+	WatchHistoryID uint `gorm:"not null;uniqueIndex:idx_watch_history_member" json:"-"`
+	UserID         uint `gorm:"not null;uniqueIndex:idx_watch_history_member;index" json:"userId"`
+
+	// Associations
+	User *User `gorm:"foreignKey:UserID" json:"user,omitempty"`
+}
+
+// TableName specifies the table name for WatchHistoryMember model
+func (WatchHistoryMember) TableName() string {
+	return "watch_history_members"
+}
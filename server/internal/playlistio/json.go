@@ -0,0 +1,81 @@
+package playlistio
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+)
+
+// jsonVersion is the version of the native JSON playlist format
+const jsonVersion = 1
+
+type jsonPlaylist struct {
+	Version int               `json:"version"`
+	Items   []json.RawMessage `json:"items"`
+}
+
+func parseJSON(content []byte) ([]Entry, []EntryError, error) {
+	content = bytes.TrimSpace(bytes.TrimPrefix(content, []byte("\ufeff")))
+
+	var rawItems []json.RawMessage
+	if bytes.HasPrefix(content, []byte("[")) {
+		if err := json.Unmarshal(content, &rawItems); err != nil {
+			return nil, nil, fmt.Errorf("invalid JSON playlist: %w", err)
+		}
+	} else {
+		var playlist jsonPlaylist
+		if err := json.Unmarshal(content, &playlist); err != nil {
+			return nil, nil, fmt.Errorf("invalid JSON playlist: %w", err)
+		}
+		if playlist.Version > jsonVersion {
+			return nil, nil, fmt.Errorf("unsupported JSON playlist version: %d", playlist.Version)
+		}
+		rawItems = playlist.Items
+	}
+
+	entries := make([]Entry, 0, len(rawItems))
+	entryErrors := make([]EntryError, 0)
+
+	for index, rawItem := range rawItems {
+		var entry Entry
+		if err := json.Unmarshal(rawItem, &entry); err != nil {
+			entryErrors = append(entryErrors, EntryError{
+				Index: index,
+				Error: "invalid entry: " + err.Error(),
+			})
+			continue
+		}
+
+		if err := Normalize(&entry); err != nil {
+			entryErrors = append(entryErrors, EntryError{
+				Index: index,
+				Title: entry.Title,
+				Error: err.Error(),
+			})
+			continue
+		}
+		entry.Index = index
+		entries = append(entries, entry)
+	}
+
+	return entries, entryErrors, nil
+}
+
+func writeJSON(entries []Entry) ([]byte, error) {
+	playlist := struct {
+		Version int     `json:"version"`
+		Items   []Entry `json:"items"`
+	}{
+		Version: jsonVersion,
+		Items:   entries,
+	}
+	if playlist.Items == nil {
+		playlist.Items = []Entry{}
+	}
+
+	data, err := json.MarshalIndent(playlist, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode JSON playlist: %w", err)
+	}
+	return append(data, '\n'), nil
+}
@@ -0,0 +1,186 @@
+package playlistio
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Extended M3U has no notion of alternative sources, so the extra sources of
+// an entry and the label of its primary URL are stored in custom directives.
+// Other players treat them as comments and only see the primary URL.
+const (
+	m3uHeader      = "#EXTM3U"
+	m3uInfo        = "#EXTINF:"
+	m3uLabel       = "#EXTSP-LABEL:"
+	m3uAlternative = "#EXTSP-ALT:"
+)
+
+// hlsTags are tags which only appear in HLS manifests, not in playlists
+var hlsTags = []string{
+	"#EXT-X-TARGETDURATION",
+	"#EXT-X-STREAM-INF",
+	"#EXT-X-MEDIA-SEQUENCE",
+	"#EXT-X-KEY",
+	"#EXT-X-MAP",
+}
+
+func parseM3U(content []byte) ([]Entry, []EntryError, error) {
+	content = bytes.TrimPrefix(content, []byte("\ufeff"))
+	if !utf8.Valid(content) {
+		content = latin1ToUTF8(content)
+	}
+
+	entries := make([]Entry, 0)
+	entryErrors := make([]EntryError, 0)
+
+	var pending Entry
+	pendingLine := 0
+	index := 0
+
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		if strings.HasPrefix(line, "#") {
+			for _, tag := range hlsTags {
+				if strings.HasPrefix(line, tag) {
+					return nil, nil, fmt.Errorf("line %d: content is an HLS stream manifest, not a playlist", lineNumber)
+				}
+			}
+
+			switch {
+			case strings.HasPrefix(line, m3uInfo):
+				pending.Duration, pending.Title = parseExtInf(strings.TrimPrefix(line, m3uInfo))
+				pendingLine = lineNumber
+			case strings.HasPrefix(line, m3uLabel):
+				if len(pending.Sources) == 0 {
+					pending.Sources = append(pending.Sources, Source{})
+				}
+				pending.Sources[0].Label = strings.TrimSpace(strings.TrimPrefix(line, m3uLabel))
+			case strings.HasPrefix(line, m3uAlternative):
+				value := strings.TrimSpace(strings.TrimPrefix(line, m3uAlternative))
+				sourceURL, label, _ := strings.Cut(value, " ")
+				if len(pending.Sources) == 0 {
+					pending.Sources = append(pending.Sources, Source{})
+				}
+				pending.Sources = append(pending.Sources, Source{URL: sourceURL, Label: strings.TrimSpace(label)})
+			}
+			continue
+		}
+
+		// A non-comment line is the primary URL and terminates the entry
+		if len(pending.Sources) == 0 {
+			pending.Sources = append(pending.Sources, Source{})
+		}
+		pending.Sources[0].URL = line
+		if pendingLine == 0 {
+			pendingLine = lineNumber
+		}
+
+		if err := Normalize(&pending); err != nil {
+			entryErrors = append(entryErrors, EntryError{
+				Index: index,
+				Line:  pendingLine,
+				Title: pending.Title,
+				Error: err.Error(),
+			})
+		} else {
+			pending.Index = index
+			pending.Line = pendingLine
+			entries = append(entries, pending)
+		}
+
+		index++
+		pending = Entry{}
+		pendingLine = 0
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, nil, fmt.Errorf("failed to read playlist: %w", err)
+	}
+
+	return entries, entryErrors, nil
+}
+
+// parseExtInf parses the value of an #EXTINF directive. The title follows the
+// first comma which is not inside a quoted attribute value.
+func parseExtInf(value string) (float64, string) {
+	inQuotes := false
+	for i, r := range value {
+		switch r {
+		case '"':
+			inQuotes = !inQuotes
+		case ',':
+			if inQuotes {
+				continue
+			}
+			return parseExtInfDuration(value[:i]), strings.TrimSpace(value[i+1:])
+		}
+	}
+	return parseExtInfDuration(value), ""
+}
+
+func parseExtInfDuration(value string) float64 {
+	fields := strings.Fields(value)
+	if len(fields) == 0 {
+		return 0
+	}
+	duration, err := strconv.ParseFloat(fields[0], 64)
+	if err != nil || duration < 0 {
+		return 0
+	}
+	return duration
+}
+
+func writeM3U(entries []Entry) []byte {
+	var buf bytes.Buffer
+	buf.WriteString(m3uHeader + "\n")
+
+	for _, entry := range entries {
+		if len(entry.Sources) == 0 {
+			continue
+		}
+
+		duration := "-1"
+		if entry.Duration > 0 {
+			duration = strconv.FormatFloat(entry.Duration, 'f', 0, 64)
+		}
+		fmt.Fprintf(&buf, "%s%s,%s\n", m3uInfo, duration, singleLine(entry.Title))
+
+		primary := entry.Sources[0]
+		if primary.Label != "" {
+			fmt.Fprintf(&buf, "%s%s\n", m3uLabel, singleLine(primary.Label))
+		}
+		for _, source := range entry.Sources[1:] {
+			line := m3uAlternative + singleLine(source.URL)
+			if source.Label != "" {
+				line += " " + singleLine(source.Label)
+			}
+			buf.WriteString(line + "\n")
+		}
+		buf.WriteString(singleLine(primary.URL) + "\n")
+	}
+
+	return buf.Bytes()
+}
+
+func singleLine(value string) string {
+	return strings.TrimSpace(strings.NewReplacer("\r", " ", "\n", " ").Replace(value))
+}
+
+func latin1ToUTF8(content []byte) []byte {
+	runes := make([]rune, len(content))
+	for i, b := range content {
+		runes[i] = rune(b)
+	}
+	return []byte(string(runes))
+}
@@ -0,0 +1,203 @@
+package playlistio
+
+import (
+	"fmt"
+	"net/url"
+	"path"
+	"strings"
+	"sync-player-server/internal/models"
+	"unicode/utf8"
+)
+
+// Format represents a playlist file format
+type Format string
+
+const (
+	FormatM3U  Format = "m3u"
+	FormatM3U8 Format = "m3u8"
+	FormatXSPF Format = "xspf"
+	FormatJSON Format = "json"
+)
+
+const (
+	maxTitleLength = 255
+	maxLabelLength = 100
+	maxURLLength   = models.MaxVideoSourceURLLength
+)
+
+// Source represents a single playable URL of an entry
+type Source struct {
+	URL   string `json:"url"`
+	Label string `json:"label,omitempty"`
+}
+
+// Entry represents a format independent playlist entry
+type Entry struct {
+	Title    string   `json:"title"`
+	Duration float64  `json:"duration,omitempty"`
+	Sources  []Source `json:"sources"`
+
+	// Index and Line locate a parsed entry in the imported content, the
+	// same way an EntryError does
+	Index int `json:"-"`
+	Line  int `json:"-"`
+}
+
+// EntryError describes why a single entry of an imported playlist was rejected
+type EntryError struct {
+	Index int    `json:"index"`
+	Line  int    `json:"line,omitempty"`
+	Title string `json:"title,omitempty"`
+	Error string `json:"error"`
+}
+
+// ParseFormat converts a user supplied format name into a Format
+func ParseFormat(name string) (Format, error) {
+	switch Format(strings.ToLower(strings.TrimSpace(name))) {
+	case FormatM3U:
+		return FormatM3U, nil
+	case FormatM3U8:
+		return FormatM3U8, nil
+	case FormatXSPF:
+		return FormatXSPF, nil
+	case FormatJSON:
+		return FormatJSON, nil
+	default:
+		return "", fmt.Errorf("unsupported playlist format: %s", name)
+	}
+}
+
+// DetectFormat guesses the format of playlist content
+func DetectFormat(content []byte) (Format, error) {
+	trimmed := strings.TrimSpace(strings.TrimPrefix(string(content), "\ufeff"))
+	switch {
+	case trimmed == "":
+		return "", fmt.Errorf("playlist is empty")
+	case strings.HasPrefix(trimmed, "{") || strings.HasPrefix(trimmed, "["):
+		return FormatJSON, nil
+	case strings.HasPrefix(trimmed, "<"):
+		return FormatXSPF, nil
+	case utf8.ValidString(trimmed):
+		return FormatM3U8, nil
+	default:
+		return FormatM3U, nil
+	}
+}
+
+// Parse parses playlist content in the given format. Entries which cannot be
+// read are reported in the returned error list instead of aborting the parse.
+func Parse(format Format, content []byte) ([]Entry, []EntryError, error) {
+	switch format {
+	case FormatM3U, FormatM3U8:
+		return parseM3U(content)
+	case FormatXSPF:
+		return parseXSPF(content)
+	case FormatJSON:
+		return parseJSON(content)
+	default:
+		return nil, nil, fmt.Errorf("unsupported playlist format: %s", format)
+	}
+}
+
+// Write serializes entries in the given format
+func Write(format Format, entries []Entry) ([]byte, error) {
+	switch format {
+	case FormatM3U, FormatM3U8:
+		return writeM3U(entries), nil
+	case FormatXSPF:
+		return writeXSPF(entries)
+	case FormatJSON:
+		return writeJSON(entries)
+	default:
+		return nil, fmt.Errorf("unsupported playlist format: %s", format)
+	}
+}
+
+// ContentType returns the MIME type used when serving a playlist format
+func ContentType(format Format) string {
+	switch format {
+	case FormatM3U:
+		return "audio/x-mpegurl"
+	case FormatM3U8:
+		return "application/vnd.apple.mpegurl"
+	case FormatXSPF:
+		return "application/xspf+xml"
+	default:
+		return "application/json"
+	}
+}
+
+// FileExtension returns the file extension used for a playlist format
+func FileExtension(format Format) string {
+	return "." + string(format)
+}
+
+// Normalize cleans up an entry and validates it, filling in a title derived
+// from the first source when none is given
+func Normalize(entry *Entry) error {
+	entry.Title = strings.TrimSpace(entry.Title)
+
+	sources := make([]Source, 0, len(entry.Sources))
+	for _, source := range entry.Sources {
+		source.URL = strings.TrimSpace(source.URL)
+		source.Label = strings.TrimSpace(source.Label)
+		if source.URL == "" {
+			continue
+		}
+		if err := validateSourceURL(source.URL); err != nil {
+			return err
+		}
+		if utf8.RuneCountInString(source.Label) > maxLabelLength {
+			return fmt.Errorf("source label exceeds %d characters", maxLabelLength)
+		}
+		sources = append(sources, source)
+	}
+	if len(sources) == 0 {
+		return fmt.Errorf("entry has no sources")
+	}
+	entry.Sources = sources
+
+	if entry.Title == "" {
+		entry.Title = titleFromURL(sources[0].URL)
+	}
+	if utf8.RuneCountInString(entry.Title) > maxTitleLength {
+		return fmt.Errorf("title exceeds %d characters", maxTitleLength)
+	}
+
+	return nil
+}
+
+func validateSourceURL(rawURL string) error {
+	if len(rawURL) > maxURLLength {
+		return fmt.Errorf("source url exceeds %d characters", maxURLLength)
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return fmt.Errorf("invalid source url %q", rawURL)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("unsupported url scheme in %q", rawURL)
+	}
+	if u.Host == "" {
+		return fmt.Errorf("source url %q has no host", rawURL)
+	}
+	return nil
+}
+
+func titleFromURL(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return rawURL
+	}
+	name := path.Base(u.Path)
+	if name == "" || name == "." || name == "/" {
+		return u.Host
+	}
+	if unescaped, err := url.PathUnescape(name); err == nil {
+		name = unescaped
+	}
+	if ext := path.Ext(name); ext != "" && ext != name {
+		name = strings.TrimSuffix(name, ext)
+	}
+	return name
+}
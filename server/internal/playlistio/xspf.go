@@ -0,0 +1,117 @@
+package playlistio
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"math"
+)
+
+const (
+	xspfNamespace = "http://xspf.org/ns/0/"
+
+	// xspfApplication identifies the extension element holding labelled sources
+	xspfApplication = "https://github.com/happy-game/sync-player"
+)
+
+type xspfPlaylist struct {
+	XMLName   xml.Name      `xml:"playlist"`
+	Xmlns     string        `xml:"xmlns,attr,omitempty"`
+	Version   string        `xml:"version,attr"`
+	TrackList xspfTrackList `xml:"trackList"`
+}
+
+type xspfTrackList struct {
+	Tracks []xspfTrack `xml:"track"`
+}
+
+type xspfTrack struct {
+	Locations  []string        `xml:"location"`
+	Title      string          `xml:"title,omitempty"`
+	Duration   int64           `xml:"duration,omitempty"`
+	Extensions []xspfExtension `xml:"extension"`
+}
+
+type xspfExtension struct {
+	Application string       `xml:"application,attr"`
+	Sources     []xspfSource `xml:"source"`
+}
+
+type xspfSource struct {
+	Label string `xml:"label,attr,omitempty"`
+	URL   string `xml:",chardata"`
+}
+
+func parseXSPF(content []byte) ([]Entry, []EntryError, error) {
+	var playlist xspfPlaylist
+	if err := xml.NewDecoder(bytes.NewReader(content)).Decode(&playlist); err != nil {
+		return nil, nil, fmt.Errorf("invalid XSPF document: %w", err)
+	}
+
+	entries := make([]Entry, 0, len(playlist.TrackList.Tracks))
+	entryErrors := make([]EntryError, 0)
+
+	for index, track := range playlist.TrackList.Tracks {
+		entry := Entry{
+			Title:    track.Title,
+			Duration: float64(track.Duration) / 1000,
+		}
+
+		for _, extension := range track.Extensions {
+			if extension.Application != xspfApplication {
+				continue
+			}
+			for _, source := range extension.Sources {
+				entry.Sources = append(entry.Sources, Source{URL: source.URL, Label: source.Label})
+			}
+		}
+		if len(entry.Sources) == 0 {
+			for _, location := range track.Locations {
+				entry.Sources = append(entry.Sources, Source{URL: location})
+			}
+		}
+
+		if err := Normalize(&entry); err != nil {
+			entryErrors = append(entryErrors, EntryError{
+				Index: index,
+				Title: entry.Title,
+				Error: err.Error(),
+			})
+			continue
+		}
+		entry.Index = index
+		entries = append(entries, entry)
+	}
+
+	return entries, entryErrors, nil
+}
+
+func writeXSPF(entries []Entry) ([]byte, error) {
+	playlist := xspfPlaylist{
+		Xmlns:   xspfNamespace,
+		Version: "1",
+	}
+
+	for _, entry := range entries {
+		track := xspfTrack{
+			Title:    entry.Title,
+			Duration: int64(math.Round(entry.Duration * 1000)),
+		}
+
+		extension := xspfExtension{Application: xspfApplication}
+		for _, source := range entry.Sources {
+			track.Locations = append(track.Locations, source.URL)
+			extension.Sources = append(extension.Sources, xspfSource{URL: source.URL, Label: source.Label})
+		}
+		track.Extensions = []xspfExtension{extension}
+
+		playlist.TrackList.Tracks = append(playlist.TrackList.Tracks, track)
+	}
+
+	data, err := xml.MarshalIndent(playlist, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode XSPF document: %w", err)
+	}
+
+	return append([]byte(xml.Header), append(data, '\n')...), nil
+}
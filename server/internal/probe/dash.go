@@ -0,0 +1,176 @@
+package probe
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+type mpd struct {
+	Type                      string      `xml:"type,attr"`
+	MediaPresentationDuration string      `xml:"mediaPresentationDuration,attr"`
+	Periods                   []mpdPeriod `xml:"Period"`
+}
+
+type mpdPeriod struct {
+	Duration       string             `xml:"duration,attr"`
+	AdaptationSets []mpdAdaptationSet `xml:"AdaptationSet"`
+}
+
+type mpdAdaptationSet struct {
+	ContentType     string              `xml:"contentType,attr"`
+	MimeType        string              `xml:"mimeType,attr"`
+	Codecs          string              `xml:"codecs,attr"`
+	Lang            string              `xml:"lang,attr"`
+	Label           string              `xml:"Label"`
+	Roles           []mpdDescriptor     `xml:"Role"`
+	Representations []mpdRepresentation `xml:"Representation"`
+}
+
+type mpdDescriptor struct {
+	Value string `xml:"value,attr"`
+}
+
+type mpdRepresentation struct {
+	MimeType  string `xml:"mimeType,attr"`
+	Codecs    string `xml:"codecs,attr"`
+	Bandwidth int    `xml:"bandwidth,attr"`
+	Width     int    `xml:"width,attr"`
+	Height    int    `xml:"height,attr"`
+	FrameRate string `xml:"frameRate,attr"`
+}
+
+func probeDASH(body []byte) (*Result, error) {
+	var manifest mpd
+	if err := xml.NewDecoder(bytes.NewReader(body)).Decode(&manifest); err != nil {
+		return nil, fmt.Errorf("invalid MPD: %w", err)
+	}
+
+	result := &Result{
+		Container: ContainerDASH,
+		Live:      manifest.Type == "dynamic",
+	}
+
+	if duration, err := parseISODuration(manifest.MediaPresentationDuration); err == nil {
+		result.Duration = duration
+	} else {
+		for _, period := range manifest.Periods {
+			if duration, err := parseISODuration(period.Duration); err == nil {
+				result.Duration += duration
+			}
+		}
+	}
+
+	if len(manifest.Periods) == 0 {
+		return result, nil
+	}
+
+	bestIndex := -1
+	for _, set := range manifest.Periods[0].AdaptationSets {
+		switch adaptationSetType(set) {
+		case "video":
+			for _, representation := range set.Representations {
+				codecs := representation.Codecs
+				if codecs == "" {
+					codecs = set.Codecs
+				}
+				variant := Variant{
+					Bandwidth: representation.Bandwidth,
+					Width:     representation.Width,
+					Height:    representation.Height,
+					Codecs:    codecs,
+					FrameRate: parseFrameRate(representation.FrameRate),
+				}
+				result.Variants = append(result.Variants, variant)
+				if bestIndex < 0 || variant.Bandwidth > result.Variants[bestIndex].Bandwidth {
+					bestIndex = len(result.Variants) - 1
+				}
+			}
+		case "audio":
+			codec := set.Codecs
+			if codec == "" && len(set.Representations) > 0 {
+				codec = set.Representations[0].Codecs
+			}
+			track := AudioTrack{
+				Language: set.Lang,
+				Name:     set.Label,
+				Codec:    codec,
+			}
+			for _, role := range set.Roles {
+				if role.Value == "main" {
+					track.Default = true
+				}
+			}
+			result.AudioTracks = append(result.AudioTracks, track)
+			if result.AudioCodec == "" {
+				result.AudioCodec = codec
+			}
+		}
+	}
+
+	if bestIndex >= 0 {
+		best := result.Variants[bestIndex]
+		result.Width = best.Width
+		result.Height = best.Height
+		result.VideoCodec = best.Codecs
+	}
+
+	return result, nil
+}
+
+func adaptationSetType(set mpdAdaptationSet) string {
+	if set.ContentType != "" {
+		return set.ContentType
+	}
+	mimeType := set.MimeType
+	if mimeType == "" && len(set.Representations) > 0 {
+		mimeType = set.Representations[0].MimeType
+	}
+	kind, _, _ := strings.Cut(mimeType, "/")
+	return kind
+}
+
+// parseFrameRate parses a DASH frame rate such as "25" or "30000/1001"
+func parseFrameRate(value string) float64 {
+	numerator, denominator, ok := strings.Cut(value, "/")
+	n, err := strconv.ParseFloat(numerator, 64)
+	if err != nil {
+		return 0
+	}
+	if !ok {
+		return n
+	}
+	d, err := strconv.ParseFloat(denominator, 64)
+	if err != nil || d == 0 {
+		return 0
+	}
+	return n / d
+}
+
+var isoDurationPattern = regexp.MustCompile(`^P(?:(\d+(?:\.\d+)?)D)?(?:T(?:(\d+(?:\.\d+)?)H)?(?:(\d+(?:\.\d+)?)M)?(?:(\d+(?:\.\d+)?)S)?)?$`)
+
+// parseISODuration parses an xs:duration such as PT1H2M3.5S into seconds.
+// Year and month components are not supported since their length varies.
+func parseISODuration(value string) (float64, error) {
+	matches := isoDurationPattern.FindStringSubmatch(strings.TrimSpace(value))
+	if matches == nil || value == "P" || value == "PT" {
+		return 0, fmt.Errorf("invalid duration: %q", value)
+	}
+
+	multipliers := []float64{86400, 3600, 60, 1}
+	var seconds float64
+	for i, multiplier := range multipliers {
+		if matches[i+1] == "" {
+			continue
+		}
+		part, err := strconv.ParseFloat(matches[i+1], 64)
+		if err != nil {
+			return 0, err
+		}
+		seconds += part * multiplier
+	}
+	return seconds, nil
+}
@@ -0,0 +1,196 @@
+package probe
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// probeHLS reads an HLS master or media playlist. For master playlists the
+// first variant's media playlist is fetched to determine the duration.
+func (p *Prober) probeHLS(ctx context.Context, base *url.URL, body []byte) (*Result, error) {
+	playlist := parseHLS(base, body)
+	result := &Result{
+		Container:   ContainerHLS,
+		Variants:    playlist.variants,
+		AudioTracks: playlist.audioTracks,
+	}
+
+	if !playlist.isMaster {
+		result.Duration = playlist.duration
+		result.Live = !playlist.ended
+		return result, nil
+	}
+
+	if len(result.Variants) == 0 {
+		return nil, fmt.Errorf("master playlist has no variants")
+	}
+
+	best := result.Variants[0]
+	for _, variant := range result.Variants[1:] {
+		if variant.Bandwidth > best.Bandwidth {
+			best = variant
+		}
+	}
+	result.Width = best.Width
+	result.Height = best.Height
+	result.VideoCodec, result.AudioCodec = splitCodecs(best.Codecs)
+
+	mediaURL, err := url.Parse(result.Variants[0].URL)
+	if err != nil {
+		return result, nil
+	}
+	media, err := p.fetchText(ctx, mediaURL)
+	if err != nil {
+		// The variant list is still useful without a duration
+		return result, nil
+	}
+	mediaPlaylist := parseHLS(media.url, media.body)
+	result.Duration = mediaPlaylist.duration
+	result.Live = !mediaPlaylist.ended
+
+	return result, nil
+}
+
+type hlsPlaylist struct {
+	isMaster    bool
+	ended       bool
+	duration    float64
+	variants    []Variant
+	audioTracks []AudioTrack
+}
+
+func parseHLS(base *url.URL, body []byte) *hlsPlaylist {
+	playlist := &hlsPlaylist{}
+
+	var pendingVariant *Variant
+	scanner := bufio.NewScanner(bytes.NewReader(body))
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		switch {
+		case strings.HasPrefix(line, "#EXT-X-STREAM-INF:"):
+			playlist.isMaster = true
+			attrs := parseAttributeList(strings.TrimPrefix(line, "#EXT-X-STREAM-INF:"))
+			variant := Variant{Codecs: attrs["CODECS"]}
+			variant.Bandwidth, _ = strconv.Atoi(attrs["BANDWIDTH"])
+			variant.FrameRate, _ = strconv.ParseFloat(attrs["FRAME-RATE"], 64)
+			if width, height, ok := strings.Cut(attrs["RESOLUTION"], "x"); ok {
+				variant.Width, _ = strconv.Atoi(width)
+				variant.Height, _ = strconv.Atoi(height)
+			}
+			pendingVariant = &variant
+		case strings.HasPrefix(line, "#EXT-X-MEDIA:"):
+			attrs := parseAttributeList(strings.TrimPrefix(line, "#EXT-X-MEDIA:"))
+			if attrs["TYPE"] != "AUDIO" {
+				continue
+			}
+			playlist.isMaster = true
+			playlist.audioTracks = append(playlist.audioTracks, AudioTrack{
+				Language: attrs["LANGUAGE"],
+				Name:     attrs["NAME"],
+				Default:  attrs["DEFAULT"] == "YES",
+			})
+		case strings.HasPrefix(line, "#EXTINF:"):
+			value := strings.TrimPrefix(line, "#EXTINF:")
+			value, _, _ = strings.Cut(value, ",")
+			if duration, err := strconv.ParseFloat(strings.TrimSpace(value), 64); err == nil && duration > 0 {
+				playlist.duration += duration
+			}
+		case strings.HasPrefix(line, "#EXT-X-ENDLIST"):
+			playlist.ended = true
+		case strings.HasPrefix(line, "#EXT-X-PLAYLIST-TYPE:VOD"):
+			playlist.ended = true
+		case strings.HasPrefix(line, "#"):
+			continue
+		default:
+			if pendingVariant != nil {
+				pendingVariant.URL = resolveReference(base, line)
+				playlist.variants = append(playlist.variants, *pendingVariant)
+				pendingVariant = nil
+			}
+		}
+	}
+
+	return playlist
+}
+
+// parseAttributeList parses an HLS attribute list such as
+// BANDWIDTH=1280000,CODECS="avc1.4d401f,mp4a.40.2"
+func parseAttributeList(value string) map[string]string {
+	attrs := make(map[string]string)
+
+	for len(value) > 0 {
+		key, rest, ok := strings.Cut(value, "=")
+		if !ok {
+			break
+		}
+		key = strings.TrimSpace(key)
+
+		var attrValue string
+		if strings.HasPrefix(rest, "\"") {
+			end := strings.Index(rest[1:], "\"")
+			if end < 0 {
+				attrValue = rest[1:]
+				rest = ""
+			} else {
+				attrValue = rest[1 : end+1]
+				rest = rest[end+2:]
+			}
+			_, rest, _ = strings.Cut(rest, ",")
+		} else {
+			attrValue, rest, _ = strings.Cut(rest, ",")
+		}
+
+		attrs[key] = strings.TrimSpace(attrValue)
+		value = rest
+	}
+
+	return attrs
+}
+
+// splitCodecs splits an RFC 6381 codecs string into video and audio codecs
+func splitCodecs(codecs string) (string, string) {
+	var video, audio string
+	for _, codec := range strings.Split(codecs, ",") {
+		codec = strings.TrimSpace(codec)
+		switch {
+		case codec == "":
+			continue
+		case isAudioCodec(codec):
+			if audio == "" {
+				audio = codec
+			}
+		default:
+			if video == "" {
+				video = codec
+			}
+		}
+	}
+	return video, audio
+}
+
+func isAudioCodec(codec string) bool {
+	for _, prefix := range []string{"mp4a", "ac-3", "ec-3", "opus", "flac", "vorbis", "mp3", "dtsc", "alac"} {
+		if strings.HasPrefix(strings.ToLower(codec), prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func resolveReference(base *url.URL, reference string) string {
+	ref, err := url.Parse(reference)
+	if err != nil {
+		return reference
+	}
+	return base.ResolveReference(ref).String()
+}
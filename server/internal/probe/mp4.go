@@ -0,0 +1,321 @@
+package probe
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"strings"
+)
+
+// mp4TopLevelBoxes are box types which may start an ISO BMFF file
+var mp4TopLevelBoxes = map[string]bool{
+	"ftyp": true, "styp": true, "moov": true, "mdat": true,
+	"free": true, "skip": true, "wide": true, "pnot": true, "uuid": true,
+}
+
+func isMP4BoxType(boxType string) bool {
+	return mp4TopLevelBoxes[boxType]
+}
+
+type mp4Box struct {
+	boxType    string
+	offset     int64
+	headerSize int64
+	size       int64
+}
+
+// readBoxHeader reads a box header at the start of data. size is -1 when the
+// box extends to the end of the file.
+func readBoxHeader(data []byte, offset int64) (*mp4Box, bool) {
+	if len(data) < 8 {
+		return nil, false
+	}
+
+	box := &mp4Box{
+		boxType:    string(data[4:8]),
+		offset:     offset,
+		headerSize: 8,
+		size:       int64(binary.BigEndian.Uint32(data[0:4])),
+	}
+
+	switch box.size {
+	case 0:
+		box.size = -1
+	case 1:
+		if len(data) < 16 {
+			return nil, false
+		}
+		box.size = int64(binary.BigEndian.Uint64(data[8:16]))
+		box.headerSize = 16
+	}
+
+	if box.size >= 0 && box.size < box.headerSize {
+		return nil, false
+	}
+	return box, true
+}
+
+// probeMP4 walks the top-level boxes until the moov box is found. Boxes which
+// are not part of the initial read (usually a large mdat) are skipped with
+// further range requests so that files with a trailing moov also work.
+func (p *Prober) probeMP4(ctx context.Context, head *response) (*Result, error) {
+	data := head.body
+	dataOffset := head.offset
+	offset := head.offset
+
+	for hop := 0; hop < maxBoxHops; hop++ {
+		if head.totalSize >= 0 && offset >= head.totalSize {
+			break
+		}
+
+		relative := offset - dataOffset
+		if relative < 0 || relative+16 > int64(len(data)) {
+			chunk, err := p.fetchRange(ctx, head.url, offset, headBytes)
+			if err != nil {
+				return nil, err
+			}
+			data, dataOffset, relative = chunk.body, chunk.offset, offset-chunk.offset
+			if relative < 0 || relative >= int64(len(data)) {
+				break
+			}
+		}
+
+		box, ok := readBoxHeader(data[relative:], offset)
+		if !ok {
+			break
+		}
+
+		if box.boxType == "moov" {
+			if box.size < 0 || box.size > maxMoovBytes {
+				return nil, fmt.Errorf("moov box too large")
+			}
+			if relative+box.size > int64(len(data)) {
+				chunk, err := p.fetchRange(ctx, head.url, offset, box.size)
+				if err != nil {
+					return nil, err
+				}
+				if int64(len(chunk.body)) < box.size || chunk.offset != offset {
+					return nil, fmt.Errorf("truncated moov box")
+				}
+				data, dataOffset, relative = chunk.body, chunk.offset, 0
+			}
+			return parseMoov(data[relative+box.headerSize : relative+box.size])
+		}
+
+		if box.size < 0 {
+			break
+		}
+		offset += box.size
+	}
+
+	return nil, fmt.Errorf("moov box not found")
+}
+
+// childBoxes returns the boxes contained in the payload of a container box
+func childBoxes(payload []byte) map[string][][]byte {
+	children := make(map[string][][]byte)
+	for len(payload) >= 8 {
+		box, ok := readBoxHeader(payload, 0)
+		if !ok {
+			break
+		}
+		size := box.size
+		if size < 0 || size > int64(len(payload)) {
+			size = int64(len(payload))
+		}
+		children[box.boxType] = append(children[box.boxType], payload[box.headerSize:size])
+		payload = payload[size:]
+	}
+	return children
+}
+
+func firstChild(children map[string][][]byte, boxType string) []byte {
+	if boxes := children[boxType]; len(boxes) > 0 {
+		return boxes[0]
+	}
+	return nil
+}
+
+func parseMoov(payload []byte) (*Result, error) {
+	children := childBoxes(payload)
+	result := &Result{Container: ContainerMP4}
+
+	var timescale uint32
+	if mvhd := firstChild(children, "mvhd"); mvhd != nil {
+		var duration uint64
+		var ok bool
+		timescale, duration, ok = parseTimescaleDuration(mvhd)
+		if ok && timescale > 0 {
+			result.Duration = float64(duration) / float64(timescale)
+		}
+	}
+
+	// Fragmented files keep the total duration in the movie extends header
+	if mvex := firstChild(children, "mvex"); mvex != nil && result.Duration == 0 && timescale > 0 {
+		if mehd := firstChild(childBoxes(mvex), "mehd"); len(mehd) >= 8 {
+			var fragmentDuration uint64
+			if mehd[0] == 1 && len(mehd) >= 12 {
+				fragmentDuration = binary.BigEndian.Uint64(mehd[4:12])
+			} else {
+				fragmentDuration = uint64(binary.BigEndian.Uint32(mehd[4:8]))
+			}
+			result.Duration = float64(fragmentDuration) / float64(timescale)
+		}
+	}
+
+	for _, trak := range children["trak"] {
+		parseTrak(trak, result)
+	}
+
+	if udta := firstChild(children, "udta"); udta != nil {
+		if chpl := firstChild(childBoxes(udta), "chpl"); chpl != nil {
+			result.Chapters = parseChpl(chpl, result.Duration)
+		}
+	}
+
+	return result, nil
+}
+
+// parseChpl reads the Nero chapter list written by most MP4 muxers. Chapter
+// start times are in units of 100 nanoseconds, a chapter ends where the next
+// one starts.
+func parseChpl(payload []byte, duration float64) []Chapter {
+	if len(payload) < 5 {
+		return nil
+	}
+	offset := 4
+	if payload[0] == 1 {
+		offset += 4
+	}
+	if len(payload) <= offset {
+		return nil
+	}
+	count := int(payload[offset])
+	offset++
+
+	var chapters []Chapter
+	for i := 0; i < count && offset+9 <= len(payload); i++ {
+		start := float64(binary.BigEndian.Uint64(payload[offset:offset+8])) / 1e7
+		titleLength := int(payload[offset+8])
+		offset += 9
+		if offset+titleLength > len(payload) {
+			break
+		}
+		chapters = append(chapters, Chapter{
+			Start: start,
+			Title: string(payload[offset : offset+titleLength]),
+		})
+		offset += titleLength
+	}
+
+	for i := range chapters {
+		if i+1 < len(chapters) {
+			chapters[i].End = chapters[i+1].Start
+		} else if duration > chapters[i].Start {
+			chapters[i].End = duration
+		}
+	}
+	return chapters
+}
+
+// parseTimescaleDuration reads the timescale and duration of an mvhd or mdhd box
+func parseTimescaleDuration(payload []byte) (uint32, uint64, bool) {
+	if len(payload) < 4 {
+		return 0, 0, false
+	}
+	if payload[0] == 1 {
+		if len(payload) < 32 {
+			return 0, 0, false
+		}
+		return binary.BigEndian.Uint32(payload[20:24]), binary.BigEndian.Uint64(payload[24:32]), true
+	}
+	if len(payload) < 20 {
+		return 0, 0, false
+	}
+	return binary.BigEndian.Uint32(payload[12:16]), uint64(binary.BigEndian.Uint32(payload[16:20])), true
+}
+
+func parseTrak(payload []byte, result *Result) {
+	children := childBoxes(payload)
+	mdia := firstChild(children, "mdia")
+	if mdia == nil {
+		return
+	}
+	mdiaChildren := childBoxes(mdia)
+
+	var handler string
+	if hdlr := firstChild(mdiaChildren, "hdlr"); len(hdlr) >= 12 {
+		handler = string(hdlr[8:12])
+	}
+
+	var codec string
+	if minf := firstChild(mdiaChildren, "minf"); minf != nil {
+		if stbl := firstChild(childBoxes(minf), "stbl"); stbl != nil {
+			if stsd := firstChild(childBoxes(stbl), "stsd"); len(stsd) >= 16 {
+				codec = strings.TrimSpace(string(stsd[12:16]))
+			}
+		}
+	}
+
+	switch handler {
+	case "vide":
+		if result.VideoCodec == "" {
+			result.VideoCodec = codec
+		}
+		if tkhd := firstChild(children, "tkhd"); tkhd != nil && result.Width == 0 {
+			result.Width, result.Height = parseTrackDimensions(tkhd)
+		}
+	case "soun":
+		if result.AudioCodec == "" {
+			result.AudioCodec = codec
+		}
+		track := AudioTrack{
+			Codec:   codec,
+			Default: len(result.AudioTracks) == 0,
+		}
+		if mdhd := firstChild(mdiaChildren, "mdhd"); mdhd != nil {
+			track.Language = parseMdhdLanguage(mdhd)
+		}
+		result.AudioTracks = append(result.AudioTracks, track)
+	}
+}
+
+// parseTrackDimensions reads the 16.16 fixed point width and height of a tkhd box
+func parseTrackDimensions(tkhd []byte) (int, int) {
+	offset := 76
+	if len(tkhd) > 0 && tkhd[0] == 1 {
+		offset = 88
+	}
+	if len(tkhd) < offset+8 {
+		return 0, 0
+	}
+	width := binary.BigEndian.Uint32(tkhd[offset : offset+4])
+	height := binary.BigEndian.Uint32(tkhd[offset+4 : offset+8])
+	return int(width >> 16), int(height >> 16)
+}
+
+// parseMdhdLanguage decodes the packed ISO 639-2/T language code of an mdhd box
+func parseMdhdLanguage(mdhd []byte) string {
+	offset := 20
+	if len(mdhd) > 0 && mdhd[0] == 1 {
+		offset = 32
+	}
+	if len(mdhd) < offset+2 {
+		return ""
+	}
+	packed := binary.BigEndian.Uint16(mdhd[offset : offset+2])
+	language := []byte{
+		byte((packed>>10)&0x1F) + 0x60,
+		byte((packed>>5)&0x1F) + 0x60,
+		byte(packed&0x1F) + 0x60,
+	}
+	for _, c := range language {
+		if c < 'a' || c > 'z' {
+			return ""
+		}
+	}
+	if string(language) == "und" {
+		return ""
+	}
+	return string(language)
+}
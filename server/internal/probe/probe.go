@@ -0,0 +1,328 @@
+package probe
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"sync-player-server/internal/utils"
+	"time"
+)
+
+// Container types reported by the prober
+const (
+	ContainerHLS  = "hls"
+	ContainerDASH = "dash"
+	ContainerMP4  = "mp4"
+	ContainerWebM = "webm"
+	ContainerMKV  = "matroska"
+)
+
+const (
+	headBytes        = 256 * 1024
+	maxManifestBytes = 4 * 1024 * 1024
+	maxMoovBytes     = 16 * 1024 * 1024
+	maxBoxHops       = 16
+)
+
+// ErrUnsupported is returned when the media type cannot be probed
+var ErrUnsupported = errors.New("unsupported media type")
+
+// ErrRangeNotSupported is returned when media has to be read past its start
+// from a server which ignores range requests
+var ErrRangeNotSupported = errors.New("upstream does not support range requests")
+
+// Variant describes one rendition of an adaptive stream
+type Variant struct {
+	URL       string  `json:"url,omitempty"`
+	Bandwidth int     `json:"bandwidth,omitempty"`
+	Width     int     `json:"width,omitempty"`
+	Height    int     `json:"height,omitempty"`
+	Codecs    string  `json:"codecs,omitempty"`
+	FrameRate float64 `json:"frameRate,omitempty"`
+}
+
+// AudioTrack describes an audio track or alternative audio rendition
+type AudioTrack struct {
+	Language string `json:"language,omitempty"`
+	Name     string `json:"name,omitempty"`
+	Codec    string `json:"codec,omitempty"`
+	Default  bool   `json:"default,omitempty"`
+}
+
+// Chapter describes a chapter embedded in a media file, times are in seconds
+type Chapter struct {
+	Start float64 `json:"start"`
+	End   float64 `json:"end,omitempty"`
+	Title string  `json:"title,omitempty"`
+}
+
+// Result holds the metadata discovered for a media URL
+type Result struct {
+	Container   string
+	Duration    float64
+	Live        bool
+	Width       int
+	Height      int
+	VideoCodec  string
+	AudioCodec  string
+	Variants    []Variant
+	AudioTracks []AudioTrack
+	Chapters    []Chapter
+}
+
+// Options configures a Prober
+type Options struct {
+	// Timeout bounds a whole probe including follow-up requests
+	Timeout time.Duration
+	// AllowPrivateNetworks disables the SSRF address check
+	AllowPrivateNetworks bool
+	// MaxConcurrent limits the number of probes running at the same time
+	MaxConcurrent int
+	// Client overrides the HTTP client, e.g. for fixture servers
+	Client *http.Client
+}
+
+// Prober reads media headers and manifests to extract stream metadata
+type Prober struct {
+	client  *http.Client
+	timeout time.Duration
+	sem     chan struct{}
+}
+
+var globalProber *Prober
+
+// NewProber creates a new prober
+func NewProber(opts Options) *Prober {
+	if opts.Timeout <= 0 {
+		opts.Timeout = 15 * time.Second
+	}
+	if opts.MaxConcurrent <= 0 {
+		opts.MaxConcurrent = 4
+	}
+
+	client := opts.Client
+	if client == nil {
+		client = utils.NewSafeHTTPClient(opts.Timeout, opts.AllowPrivateNetworks)
+	}
+
+	return &Prober{
+		client:  client,
+		timeout: opts.Timeout,
+		sem:     make(chan struct{}, opts.MaxConcurrent),
+	}
+}
+
+// InitProber initializes the global prober
+func InitProber(opts Options) {
+	globalProber = NewProber(opts)
+}
+
+// GetProber returns the global prober, or nil when probing is disabled
+func GetProber() *Prober {
+	return globalProber
+}
+
+// Probe fetches the start of a media URL and extracts its metadata
+func (p *Prober) Probe(ctx context.Context, rawURL string) (*Result, error) {
+	select {
+	case p.sem <- struct{}{}:
+		defer func() { <-p.sem }()
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, p.timeout)
+	defer cancel()
+
+	target, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid url: %w", err)
+	}
+	if err := utils.ValidateOutboundURL(target); err != nil {
+		return nil, err
+	}
+
+	head, err := p.fetchRange(ctx, target, 0, headBytes)
+	if err != nil {
+		return nil, err
+	}
+
+	switch sniff(head) {
+	case ContainerHLS:
+		body, err := p.fetchManifest(ctx, head)
+		if err != nil {
+			return nil, err
+		}
+		return p.probeHLS(ctx, head.url, body)
+	case ContainerDASH:
+		body, err := p.fetchManifest(ctx, head)
+		if err != nil {
+			return nil, err
+		}
+		return probeDASH(body)
+	case ContainerMP4:
+		return p.probeMP4(ctx, head)
+	case ContainerWebM:
+		return probeWebM(head.body)
+	default:
+		return nil, ErrUnsupported
+	}
+}
+
+// response is a (possibly partial) HTTP response body
+type response struct {
+	url         *url.URL
+	body        []byte
+	offset      int64
+	totalSize   int64
+	contentType string
+}
+
+// complete reports whether the body holds the whole resource
+func (r *response) complete() bool {
+	return r.offset == 0 && r.totalSize >= 0 && int64(len(r.body)) >= r.totalSize
+}
+
+// fetchRange requests length bytes starting at offset. A server which ignores
+// the Range header can only be read from the start, reading past it would
+// download everything before the offset.
+func (p *Prober) fetchRange(ctx context.Context, target *url.URL, offset, length int64) (*response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	if length > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", offset, offset+length-1))
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	result := &response{
+		url:         resp.Request.URL,
+		totalSize:   -1,
+		contentType: resp.Header.Get("Content-Type"),
+	}
+
+	switch resp.StatusCode {
+	case http.StatusPartialContent:
+		start, total, ok := parseContentRange(resp.Header.Get("Content-Range"))
+		if !ok {
+			return nil, fmt.Errorf("invalid Content-Range header")
+		}
+		result.offset = start
+		result.totalSize = total
+	case http.StatusOK:
+		if offset > 0 {
+			return nil, ErrRangeNotSupported
+		}
+		result.totalSize = resp.ContentLength
+	default:
+		return nil, fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+
+	limit := length
+	if limit <= 0 {
+		limit = maxManifestBytes
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, limit))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+	result.body = body
+
+	return result, nil
+}
+
+// fetchManifest returns the full body of a text manifest whose head was read
+func (p *Prober) fetchManifest(ctx context.Context, head *response) ([]byte, error) {
+	if head.complete() || (head.totalSize < 0 && len(head.body) < headBytes) {
+		return head.body, nil
+	}
+	if head.totalSize > maxManifestBytes {
+		return nil, fmt.Errorf("manifest exceeds %d bytes", maxManifestBytes)
+	}
+
+	full, err := p.fetchRange(ctx, head.url, 0, 0)
+	if err != nil {
+		return nil, err
+	}
+	return full.body, nil
+}
+
+func (p *Prober) fetchText(ctx context.Context, target *url.URL) (*response, error) {
+	return p.fetchRange(ctx, target, 0, 0)
+}
+
+// sniff detects the container type from the first bytes of a response
+func sniff(head *response) string {
+	body := bytes.TrimPrefix(head.body, []byte("\ufeff"))
+	trimmed := bytes.TrimSpace(body)
+
+	switch {
+	case bytes.HasPrefix(trimmed, []byte("#EXTM3U")):
+		return ContainerHLS
+	case bytes.HasPrefix(trimmed, []byte("<")) && bytes.Contains(trimmed[:min(len(trimmed), 4096)], []byte("<MPD")):
+		return ContainerDASH
+	case len(body) >= 4 && bytes.Equal(body[:4], []byte{0x1A, 0x45, 0xDF, 0xA3}):
+		return ContainerWebM
+	case len(body) >= 8 && isMP4BoxType(string(body[4:8])):
+		return ContainerMP4
+	}
+
+	contentType := strings.ToLower(head.contentType)
+	switch {
+	case strings.Contains(contentType, "mpegurl"):
+		return ContainerHLS
+	case strings.Contains(contentType, "dash+xml"):
+		return ContainerDASH
+	}
+
+	switch strings.ToLower(path.Ext(head.url.Path)) {
+	case ".m3u8":
+		return ContainerHLS
+	case ".mpd":
+		return ContainerDASH
+	}
+
+	return ""
+}
+
+// parseContentRange parses a "bytes start-end/total" header value
+func parseContentRange(value string) (int64, int64, bool) {
+	value = strings.TrimSpace(value)
+	if !strings.HasPrefix(value, "bytes ") {
+		return 0, 0, false
+	}
+	rangePart, totalPart, ok := strings.Cut(strings.TrimPrefix(value, "bytes "), "/")
+	if !ok {
+		return 0, 0, false
+	}
+	startPart, _, ok := strings.Cut(rangePart, "-")
+	if !ok {
+		return 0, 0, false
+	}
+
+	start, err := strconv.ParseInt(startPart, 10, 64)
+	if err != nil {
+		return 0, 0, false
+	}
+	total := int64(-1)
+	if totalPart != "*" {
+		total, err = strconv.ParseInt(totalPart, 10, 64)
+		if err != nil {
+			return 0, 0, false
+		}
+	}
+	return start, total, true
+}
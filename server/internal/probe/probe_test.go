@@ -0,0 +1,348 @@
+package probe
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// fixtureServer serves the manifests in testdata and generated media files.
+// Files under /range/ answer range requests, files under /full/ are always
+// sent whole like by servers which ignore the Range header.
+type fixtureServer struct {
+	*httptest.Server
+	files map[string][]byte
+	// ranged counts the requests which asked for a range
+	ranged atomic.Int32
+}
+
+func newFixtureServer(t *testing.T, files map[string][]byte) *fixtureServer {
+	t.Helper()
+
+	server := &fixtureServer{files: files}
+	mux := http.NewServeMux()
+	mux.Handle("/testdata/", http.StripPrefix("/testdata/", http.FileServer(http.Dir("testdata"))))
+	mux.HandleFunc("/range/", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Range") != "" {
+			server.ranged.Add(1)
+		}
+		data, ok := server.files[strings.TrimPrefix(r.URL.Path, "/range/")]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		http.ServeContent(w, r, r.URL.Path, time.Time{}, bytes.NewReader(data))
+	})
+	mux.HandleFunc("/full/", func(w http.ResponseWriter, r *http.Request) {
+		data, ok := server.files[strings.TrimPrefix(r.URL.Path, "/full/")]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.Write(data)
+	})
+
+	server.Server = httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return server
+}
+
+func newTestProber(server *fixtureServer) *Prober {
+	return NewProber(Options{Timeout: 5 * time.Second, Client: server.Client()})
+}
+
+// buildBox builds an ISO BMFF box
+func buildBox(boxType string, payloads ...[]byte) []byte {
+	payload := bytes.Join(payloads, nil)
+	box := make([]byte, 8, 8+len(payload))
+	binary.BigEndian.PutUint32(box[0:4], uint32(8+len(payload)))
+	copy(box[4:8], boxType)
+	return append(box, payload...)
+}
+
+// mp4Track builds a trak box of a handler type with a codec, video tracks
+// with a width and height and audio tracks with a language
+func mp4Track(handler, codec string, width, height int, language string) []byte {
+	tkhd := make([]byte, 84)
+	binary.BigEndian.PutUint32(tkhd[76:80], uint32(width)<<16)
+	binary.BigEndian.PutUint32(tkhd[80:84], uint32(height)<<16)
+
+	mdhd := make([]byte, 24)
+	binary.BigEndian.PutUint32(mdhd[12:16], 1000)
+	if language != "" {
+		packed := uint16(language[0]-0x60)<<10 | uint16(language[1]-0x60)<<5 | uint16(language[2]-0x60)
+		binary.BigEndian.PutUint16(mdhd[20:22], packed)
+	}
+
+	hdlr := make([]byte, 24)
+	copy(hdlr[8:12], handler)
+
+	stsd := make([]byte, 16)
+	binary.BigEndian.PutUint32(stsd[4:8], 1)
+	copy(stsd[12:16], codec)
+
+	return buildBox("trak",
+		buildBox("tkhd", tkhd),
+		buildBox("mdia",
+			buildBox("mdhd", mdhd),
+			buildBox("hdlr", hdlr),
+			buildBox("minf", buildBox("stbl", buildBox("stsd", stsd))),
+		),
+	)
+}
+
+// mp4File builds an MP4 file lasting 90 seconds with mdatBytes of media,
+// its moov box before the media when faststart is set and after it otherwise
+func mp4File(mdatBytes int, faststart bool) []byte {
+	mvhd := make([]byte, 100)
+	binary.BigEndian.PutUint32(mvhd[12:16], 1000)
+	binary.BigEndian.PutUint32(mvhd[16:20], 90000)
+
+	ftyp := buildBox("ftyp", []byte("isom\x00\x00\x02\x00isomiso2avc1mp41"))
+	moov := buildBox("moov",
+		buildBox("mvhd", mvhd),
+		mp4Track("vide", "avc1", 1280, 720, ""),
+		mp4Track("soun", "mp4a", 0, 0, "eng"),
+	)
+	mdat := buildBox("mdat", make([]byte, mdatBytes))
+
+	if faststart {
+		return bytes.Join([][]byte{ftyp, moov, mdat}, nil)
+	}
+	return bytes.Join([][]byte{ftyp, mdat, moov}, nil)
+}
+
+// ebml builds a Matroska element with an 8 byte size
+func ebml(id uint64, payloads ...[]byte) []byte {
+	payload := bytes.Join(payloads, nil)
+
+	var element []byte
+	for shift := 24; shift >= 0; shift -= 8 {
+		if b := byte(id >> shift); b != 0 || len(element) > 0 {
+			element = append(element, b)
+		}
+	}
+	size := make([]byte, 8)
+	binary.BigEndian.PutUint64(size, uint64(len(payload)))
+	size[0] = 0x01
+	element = append(element, size...)
+	return append(element, payload...)
+}
+
+func ebmlUint(id uint64, value uint64) []byte {
+	data := make([]byte, 8)
+	binary.BigEndian.PutUint64(data, value)
+	return ebml(id, data)
+}
+
+func ebmlFloat(id uint64, value float64) []byte {
+	data := make([]byte, 8)
+	binary.BigEndian.PutUint64(data, math.Float64bits(value))
+	return ebml(id, data)
+}
+
+// webmFile builds a WebM file lasting 12.5 seconds with a VP9 and an Opus
+// track
+func webmFile() []byte {
+	return bytes.Join([][]byte{
+		ebml(ebmlHeaderID, ebml(ebmlDocTypeID, []byte("webm"))),
+		ebml(segmentID,
+			ebml(infoID,
+				ebmlUint(timecodeScaleID, 1000000),
+				ebmlFloat(durationID, 12500),
+			),
+			ebml(tracksID,
+				ebml(trackEntryID,
+					ebmlUint(trackTypeID, matroskaVideo),
+					ebml(codecIDID, []byte("V_VP9")),
+					ebml(videoID,
+						ebmlUint(pixelWidthID, 640),
+						ebmlUint(pixelHeightID, 360),
+					),
+				),
+				ebml(trackEntryID,
+					ebmlUint(trackTypeID, matroskaAudio),
+					ebml(codecIDID, []byte("A_OPUS")),
+					ebml(languageID, []byte("ger")),
+					ebml(trackNameID, []byte("Deutsch")),
+				),
+			),
+		),
+	}, nil)
+}
+
+func TestProbeHLSMaster(t *testing.T) {
+	server := newFixtureServer(t, nil)
+
+	result, err := newTestProber(server).Probe(context.Background(), server.URL+"/testdata/master.m3u8")
+	if err != nil {
+		t.Fatalf("Probe() error = %v", err)
+	}
+
+	if result.Container != ContainerHLS || result.Live {
+		t.Errorf("Container = %q, Live = %v, want %q and not live", result.Container, result.Live, ContainerHLS)
+	}
+	if result.Duration != 24.5 {
+		t.Errorf("Duration = %v, want 24.5 from the first variant", result.Duration)
+	}
+	if result.Width != 1280 || result.Height != 720 || result.VideoCodec != "avc1.4d401f" || result.AudioCodec != "mp4a.40.2" {
+		t.Errorf("best variant = %dx%d %q %q, want 1280x720 avc1.4d401f mp4a.40.2",
+			result.Width, result.Height, result.VideoCodec, result.AudioCodec)
+	}
+
+	wantVariants := []Variant{
+		{URL: server.URL + "/testdata/media_480.m3u8", Bandwidth: 800000, Width: 854, Height: 480, Codecs: "avc1.4d401e,mp4a.40.2"},
+		{URL: server.URL + "/testdata/media_720.m3u8", Bandwidth: 2500000, Width: 1280, Height: 720, Codecs: "avc1.4d401f,mp4a.40.2", FrameRate: 29.97},
+	}
+	if !reflect.DeepEqual(result.Variants, wantVariants) {
+		t.Errorf("Variants = %+v, want %+v", result.Variants, wantVariants)
+	}
+
+	wantTracks := []AudioTrack{
+		{Language: "en", Name: "English", Default: true},
+		{Language: "de", Name: "Deutsch"},
+	}
+	if !reflect.DeepEqual(result.AudioTracks, wantTracks) {
+		t.Errorf("AudioTracks = %+v, want %+v", result.AudioTracks, wantTracks)
+	}
+}
+
+func TestProbeHLSLive(t *testing.T) {
+	server := newFixtureServer(t, nil)
+
+	result, err := newTestProber(server).Probe(context.Background(), server.URL+"/testdata/live.m3u8")
+	if err != nil {
+		t.Fatalf("Probe() error = %v", err)
+	}
+	if !result.Live || result.Duration != 12 {
+		t.Errorf("Live = %v, Duration = %v, want live with 12 seconds listed", result.Live, result.Duration)
+	}
+}
+
+func TestProbeDASH(t *testing.T) {
+	server := newFixtureServer(t, nil)
+
+	result, err := newTestProber(server).Probe(context.Background(), server.URL+"/testdata/manifest.mpd")
+	if err != nil {
+		t.Fatalf("Probe() error = %v", err)
+	}
+
+	if result.Container != ContainerDASH || result.Live || result.Duration != 90.5 {
+		t.Errorf("Container = %q, Live = %v, Duration = %v, want %q, not live, 90.5",
+			result.Container, result.Live, result.Duration, ContainerDASH)
+	}
+	if result.Width != 1920 || result.Height != 1080 || result.VideoCodec != "avc1.640028" || result.AudioCodec != "mp4a.40.2" {
+		t.Errorf("best representation = %dx%d %q %q, want 1920x1080 avc1.640028 mp4a.40.2",
+			result.Width, result.Height, result.VideoCodec, result.AudioCodec)
+	}
+	if len(result.Variants) != 2 || math.Abs(result.Variants[0].FrameRate-29.97) > 0.01 {
+		t.Errorf("Variants = %+v, want 2 at 29.97 fps", result.Variants)
+	}
+
+	wantTracks := []AudioTrack{{Language: "en", Name: "English", Codec: "mp4a.40.2", Default: true}}
+	if !reflect.DeepEqual(result.AudioTracks, wantTracks) {
+		t.Errorf("AudioTracks = %+v, want %+v", result.AudioTracks, wantTracks)
+	}
+}
+
+func TestProbeMP4(t *testing.T) {
+	// The trailing moov is past the first read, so it takes range requests
+	server := newFixtureServer(t, map[string][]byte{
+		"faststart.mp4": mp4File(1024, true),
+		"trailing.mp4":  mp4File(2*headBytes, false),
+	})
+	prober := newTestProber(server)
+
+	want := &Result{
+		Container:   ContainerMP4,
+		Duration:    90,
+		Width:       1280,
+		Height:      720,
+		VideoCodec:  "avc1",
+		AudioCodec:  "mp4a",
+		AudioTracks: []AudioTrack{{Language: "eng", Codec: "mp4a", Default: true}},
+	}
+
+	for _, path := range []string{"/range/faststart.mp4", "/range/trailing.mp4", "/full/faststart.mp4"} {
+		t.Run(path, func(t *testing.T) {
+			result, err := prober.Probe(context.Background(), server.URL+path)
+			if err != nil {
+				t.Fatalf("Probe() error = %v", err)
+			}
+			if !reflect.DeepEqual(result, want) {
+				t.Errorf("Probe() = %+v, want %+v", result, want)
+			}
+		})
+	}
+
+	if server.ranged.Load() < 3 {
+		t.Errorf("range requests = %d, want the head of both files and the trailing moov", server.ranged.Load())
+	}
+}
+
+func TestProbeMP4WithoutRangeSupport(t *testing.T) {
+	// Reaching the trailing moov would take downloading all media before it
+	server := newFixtureServer(t, map[string][]byte{
+		"trailing.mp4": mp4File(2*headBytes, false),
+	})
+
+	_, err := newTestProber(server).Probe(context.Background(), server.URL+"/full/trailing.mp4")
+	if !errors.Is(err, ErrRangeNotSupported) {
+		t.Fatalf("Probe() error = %v, want %v", err, ErrRangeNotSupported)
+	}
+}
+
+func TestProbeWebM(t *testing.T) {
+	server := newFixtureServer(t, map[string][]byte{"clip.webm": webmFile()})
+
+	for _, path := range []string{"/range/clip.webm", "/full/clip.webm"} {
+		t.Run(path, func(t *testing.T) {
+			result, err := newTestProber(server).Probe(context.Background(), server.URL+path)
+			if err != nil {
+				t.Fatalf("Probe() error = %v", err)
+			}
+
+			want := &Result{
+				Container:   ContainerWebM,
+				Duration:    12.5,
+				Width:       640,
+				Height:      360,
+				VideoCodec:  "V_VP9",
+				AudioCodec:  "A_OPUS",
+				AudioTracks: []AudioTrack{{Language: "ger", Name: "Deutsch", Codec: "A_OPUS", Default: true}},
+			}
+			if !reflect.DeepEqual(result, want) {
+				t.Errorf("Probe() = %+v, want %+v", result, want)
+			}
+		})
+	}
+}
+
+func TestProbeUnsupported(t *testing.T) {
+	server := newFixtureServer(t, map[string][]byte{"notes.txt": []byte("just some text")})
+
+	_, err := newTestProber(server).Probe(context.Background(), server.URL+"/range/notes.txt")
+	if !errors.Is(err, ErrUnsupported) {
+		t.Fatalf("Probe() error = %v, want %v", err, ErrUnsupported)
+	}
+}
+
+func TestProbeRefusesPrivateAddresses(t *testing.T) {
+	server := newFixtureServer(t, map[string][]byte{"faststart.mp4": mp4File(1024, true)})
+
+	// Without the fixture client the SSRF check rejects the loopback server
+	prober := NewProber(Options{Timeout: 5 * time.Second})
+	if _, err := prober.Probe(context.Background(), server.URL+"/range/faststart.mp4"); err == nil {
+		t.Fatal("Probe() of a loopback address succeeded, want it refused")
+	}
+}
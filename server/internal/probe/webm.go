@@ -0,0 +1,280 @@
+package probe
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"strings"
+)
+
+// Matroska element IDs used by the prober
+const (
+	ebmlHeaderID     = 0x1A45DFA3
+	ebmlDocTypeID    = 0x4282
+	segmentID        = 0x18538067
+	infoID           = 0x1549A966
+	timecodeScaleID  = 0x2AD7B1
+	durationID       = 0x4489
+	tracksID         = 0x1654AE6B
+	trackEntryID     = 0xAE
+	trackTypeID      = 0x83
+	codecIDID        = 0x86
+	languageID       = 0x22B59C
+	languageBCP47ID  = 0x22B59D
+	trackNameID      = 0x536E
+	flagDefaultID    = 0x88
+	videoID          = 0xE0
+	pixelWidthID     = 0xB0
+	pixelHeightID    = 0xBA
+	chaptersID       = 0x1043A770
+	editionEntryID   = 0x45B9
+	chapterAtomID    = 0xB6
+	chapterStartID   = 0x91
+	chapterEndID     = 0x92
+	chapterHiddenID  = 0x98
+	chapterDisplayID = 0x80
+	chapterStringID  = 0x85
+	matroskaVideo    = 1
+	matroskaAudio    = 2
+	unknownEBMLSize  = -1
+	defaultTimescale = 1000000
+)
+
+type ebmlElement struct {
+	id   uint64
+	data []byte
+	// size is unknownEBMLSize for live streams and unfinished segments
+	size int64
+}
+
+// readVint reads an EBML variable length integer. keepMarker keeps the
+// length marker bit, which is how element IDs are usually written.
+func readVint(data []byte, keepMarker bool) (uint64, int, bool) {
+	if len(data) == 0 || data[0] == 0 {
+		return 0, 0, false
+	}
+
+	length := 1
+	for mask := byte(0x80); data[0]&mask == 0; mask >>= 1 {
+		length++
+	}
+	if length > 8 || len(data) < length {
+		return 0, 0, false
+	}
+
+	value := uint64(data[0])
+	if !keepMarker {
+		value &= uint64(0xFF >> length)
+	}
+	for _, b := range data[1:length] {
+		value = value<<8 | uint64(b)
+	}
+	return value, length, true
+}
+
+// readElements splits data into sibling elements. Elements cut off by the end
+// of data are returned with the available bytes only.
+func readElements(data []byte) []ebmlElement {
+	var elements []ebmlElement
+	for len(data) > 0 {
+		id, idLength, ok := readVint(data, true)
+		if !ok {
+			break
+		}
+		size, sizeLength, ok := readVint(data[idLength:], false)
+		if !ok {
+			break
+		}
+		header := idLength + sizeLength
+
+		element := ebmlElement{id: id, size: int64(size)}
+		if size == (uint64(1)<<(7*sizeLength))-1 {
+			element.size = unknownEBMLSize
+		}
+
+		end := len(data)
+		if element.size != unknownEBMLSize && int64(header)+element.size < int64(end) {
+			end = header + int(element.size)
+		}
+		element.data = data[header:end]
+		elements = append(elements, element)
+
+		if element.size == unknownEBMLSize {
+			break
+		}
+		data = data[end:]
+	}
+	return elements
+}
+
+func readUint(data []byte) uint64 {
+	var value uint64
+	for _, b := range data {
+		value = value<<8 | uint64(b)
+	}
+	return value
+}
+
+func readFloat(data []byte) float64 {
+	switch len(data) {
+	case 4:
+		return float64(math.Float32frombits(binary.BigEndian.Uint32(data)))
+	case 8:
+		return math.Float64frombits(binary.BigEndian.Uint64(data))
+	default:
+		return 0
+	}
+}
+
+func probeWebM(head []byte) (*Result, error) {
+	elements := readElements(head)
+	if len(elements) == 0 || elements[0].id != ebmlHeaderID {
+		return nil, fmt.Errorf("missing EBML header")
+	}
+
+	result := &Result{Container: ContainerMKV}
+	for _, element := range readElements(elements[0].data) {
+		if element.id == ebmlDocTypeID && string(element.data) == "webm" {
+			result.Container = ContainerWebM
+		}
+	}
+
+	var segment []byte
+	for _, element := range elements[1:] {
+		if element.id == segmentID {
+			segment = element.data
+			break
+		}
+	}
+	if segment == nil {
+		return nil, fmt.Errorf("missing segment")
+	}
+
+	timescale := uint64(defaultTimescale)
+	var duration float64
+	for _, element := range readElements(segment) {
+		switch element.id {
+		case infoID:
+			for _, child := range readElements(element.data) {
+				switch child.id {
+				case timecodeScaleID:
+					if value := readUint(child.data); value > 0 {
+						timescale = value
+					}
+				case durationID:
+					duration = readFloat(child.data)
+				}
+			}
+		case tracksID:
+			for _, entry := range readElements(element.data) {
+				if entry.id == trackEntryID {
+					parseTrackEntry(entry.data, result)
+				}
+			}
+		case chaptersID:
+			// Only the first edition is used, further editions are alternatives
+			for _, edition := range readElements(element.data) {
+				if edition.id == editionEntryID {
+					result.Chapters = parseEdition(edition.data)
+					break
+				}
+			}
+		}
+	}
+
+	if duration > 0 {
+		result.Duration = duration * float64(timescale) / 1e9
+	} else {
+		result.Live = true
+	}
+
+	return result, nil
+}
+
+func parseTrackEntry(data []byte, result *Result) {
+	var trackType uint64
+	var codec, language, name string
+	var width, height int
+	isDefault := true
+
+	for _, element := range readElements(data) {
+		switch element.id {
+		case trackTypeID:
+			trackType = readUint(element.data)
+		case codecIDID:
+			codec = strings.TrimRight(string(element.data), "\x00")
+		case languageID:
+			if language == "" {
+				language = strings.TrimRight(string(element.data), "\x00")
+			}
+		case languageBCP47ID:
+			language = strings.TrimRight(string(element.data), "\x00")
+		case trackNameID:
+			name = strings.TrimRight(string(element.data), "\x00")
+		case flagDefaultID:
+			isDefault = readUint(element.data) != 0
+		case videoID:
+			for _, child := range readElements(element.data) {
+				switch child.id {
+				case pixelWidthID:
+					width = int(readUint(child.data))
+				case pixelHeightID:
+					height = int(readUint(child.data))
+				}
+			}
+		}
+	}
+
+	switch trackType {
+	case matroskaVideo:
+		if result.VideoCodec == "" {
+			result.VideoCodec = codec
+			result.Width = width
+			result.Height = height
+		}
+	case matroskaAudio:
+		if result.AudioCodec == "" {
+			result.AudioCodec = codec
+		}
+		result.AudioTracks = append(result.AudioTracks, AudioTrack{
+			Language: language,
+			Name:     name,
+			Codec:    codec,
+			Default:  isDefault,
+		})
+	}
+}
+
+// parseEdition reads the chapter atoms of a Matroska edition, times are
+// stored in nanoseconds regardless of the segment timescale
+func parseEdition(data []byte) []Chapter {
+	var chapters []Chapter
+	for _, atom := range readElements(data) {
+		if atom.id != chapterAtomID {
+			continue
+		}
+
+		var chapter Chapter
+		hidden := false
+		for _, element := range readElements(atom.data) {
+			switch element.id {
+			case chapterStartID:
+				chapter.Start = float64(readUint(element.data)) / 1e9
+			case chapterEndID:
+				chapter.End = float64(readUint(element.data)) / 1e9
+			case chapterHiddenID:
+				hidden = readUint(element.data) != 0
+			case chapterDisplayID:
+				for _, child := range readElements(element.data) {
+					if child.id == chapterStringID && chapter.Title == "" {
+						chapter.Title = strings.TrimRight(string(child.data), "\x00")
+					}
+				}
+			}
+		}
+		if !hidden {
+			chapters = append(chapters, chapter)
+		}
+	}
+	return chapters
+}
@@ -0,0 +1,85 @@
+package proxy
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// limiter is a token bucket shared by the streams of one room. Reads take
+// tokens up front and wait off the debt, so concurrent streams split the
+// rate between them. The bucket holds at most one second of traffic.
+type limiter struct {
+	mu      sync.Mutex
+	rate    float64
+	tokens  float64
+	last    time.Time
+	streams int
+}
+
+func newLimiter(bytesPerSecond int64) *limiter {
+	return &limiter{
+		rate:   float64(bytesPerSecond),
+		tokens: float64(bytesPerSecond),
+		last:   time.Now(),
+	}
+}
+
+// wait blocks until n bytes may be sent
+func (l *limiter) wait(ctx context.Context, n int) error {
+	l.mu.Lock()
+	now := time.Now()
+	l.tokens += now.Sub(l.last).Seconds() * l.rate
+	if l.tokens > l.rate {
+		l.tokens = l.rate
+	}
+	l.last = now
+	l.tokens -= float64(n)
+
+	var delay time.Duration
+	if l.tokens < 0 {
+		delay = time.Duration(-l.tokens / l.rate * float64(time.Second))
+	}
+	l.mu.Unlock()
+
+	if delay == 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// acquireLimiter returns the limiter of a room, creating it for the first
+// stream. Every call must be paired with releaseLimiter.
+func (p *Proxy) acquireLimiter(roomID uint) *limiter {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	l, ok := p.limiters[roomID]
+	if !ok {
+		l = newLimiter(p.roomBandwidth)
+		p.limiters[roomID] = l
+	}
+	l.streams++
+	return l
+}
+
+// releaseLimiter drops the limiter of a room once its last stream ended
+func (p *Proxy) releaseLimiter(roomID uint) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if l, ok := p.limiters[roomID]; ok {
+		l.streams--
+		if l.streams <= 0 {
+			delete(p.limiters, roomID)
+		}
+	}
+}
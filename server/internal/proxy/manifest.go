@@ -0,0 +1,108 @@
+package proxy
+
+import (
+	"bytes"
+	"html"
+	"mime"
+	"net/url"
+	"path"
+	"regexp"
+	"strings"
+	"sync-player-server/internal/mediaurl"
+)
+
+// Manifest kinds the proxy rewrites
+const (
+	manifestHLS  = "hls"
+	manifestDASH = "dash"
+)
+
+var (
+	hlsURIAttribute  = regexp.MustCompile(`URI="([^"]*)"`)
+	dashBaseURL      = regexp.MustCompile(`(<BaseURL[^>]*>)([^<]*)(</BaseURL>)`)
+	dashURLAttribute = regexp.MustCompile(`\b(media|initialization|sourceURL|href|index)="([^"]*)"`)
+)
+
+// manifestKind tells whether a response is an HLS playlist or a DASH MPD
+// from its content type, or its extension when the type is generic
+func manifestKind(contentType string, target *url.URL) string {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	switch mediaType {
+	case "application/vnd.apple.mpegurl", "application/x-mpegurl", "audio/mpegurl", "audio/x-mpegurl":
+		return manifestHLS
+	case "application/dash+xml":
+		return manifestDASH
+	case "", "application/octet-stream", "text/plain", "binary/octet-stream":
+		switch strings.ToLower(path.Ext(target.Path)) {
+		case ".m3u8", ".m3u":
+			return manifestHLS
+		case ".mpd":
+			return manifestDASH
+		}
+	}
+	return ""
+}
+
+// rewriteHLS points every URI of a playlist, segment lines as well as URI
+// attributes of tags such as keys and renditions, at the proxy
+func rewriteHLS(body []byte, base *url.URL, rewrite func(*url.URL) string) []byte {
+	var out bytes.Buffer
+	lines := strings.Split(string(body), "\n")
+	for i, line := range lines {
+		trimmed := strings.TrimSpace(strings.TrimSuffix(line, "\r"))
+		switch {
+		case trimmed == "":
+			out.WriteString(line)
+		case strings.HasPrefix(trimmed, "#"):
+			out.WriteString(hlsURIAttribute.ReplaceAllStringFunc(line, func(match string) string {
+				ref := hlsURIAttribute.FindStringSubmatch(match)[1]
+				return `URI="` + rewriteReference(base, ref, rewrite) + `"`
+			}))
+		default:
+			out.WriteString(rewriteReference(base, trimmed, rewrite))
+		}
+		if i < len(lines)-1 {
+			out.WriteByte('\n')
+		}
+	}
+	return out.Bytes()
+}
+
+// rewriteDASH points the absolute and root relative URLs of an MPD at the
+// proxy. Other relative URLs resolve against the proxied URL of the MPD,
+// which mirrors the upstream directory, but lose its query, so the encoded
+// query pair access is added to those naming segments. Relative BaseURLs
+// only prefix them and stay as they are.
+func rewriteDASH(body []byte, base *url.URL, rewrite func(*url.URL) string, access string) []byte {
+	rewriteValue := func(escaped string, segment bool) string {
+		ref := html.UnescapeString(strings.TrimSpace(escaped))
+		if !strings.HasPrefix(ref, "/") && !strings.Contains(ref, "://") {
+			if !segment || ref == "" || strings.HasPrefix(ref, "data:") {
+				return escaped
+			}
+			return html.EscapeString(mediaurl.AppendQuery(ref, access))
+		}
+		return html.EscapeString(rewriteReference(base, ref, rewrite))
+	}
+
+	content := dashBaseURL.ReplaceAllStringFunc(string(body), func(match string) string {
+		parts := dashBaseURL.FindStringSubmatch(match)
+		return parts[1] + rewriteValue(parts[2], false) + parts[3]
+	})
+	content = dashURLAttribute.ReplaceAllStringFunc(content, func(match string) string {
+		parts := dashURLAttribute.FindStringSubmatch(match)
+		return parts[1] + `="` + rewriteValue(parts[2], true) + `"`
+	})
+	return []byte(content)
+}
+
+// rewriteReference resolves a manifest reference against the manifest URL
+// and returns its proxied form, references which are not web URLs such as
+// data URIs stay as they are
+func rewriteReference(base *url.URL, ref string, rewrite func(*url.URL) string) string {
+	u, err := base.Parse(ref)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return ref
+	}
+	return rewrite(u)
+}
@@ -0,0 +1,314 @@
+package proxy
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"sync-player-server/internal/mediaurl"
+	"sync-player-server/internal/utils"
+	"time"
+)
+
+const (
+	maxManifestBytes = 4 * 1024 * 1024
+	copyBufferBytes  = 32 * 1024
+	signatureBytes   = 16
+)
+
+// ErrInvalidToken is returned when a proxy path was not issued for the source
+var ErrInvalidToken = errors.New("invalid proxy token")
+
+// requestHeaders are passed from the player to the upstream server
+var requestHeaders = []string{"Range", "If-Range", "If-None-Match", "If-Modified-Since", "Accept"}
+
+// responseHeaders are passed from the upstream server to the player
+var responseHeaders = []string{
+	"Content-Type", "Content-Length", "Content-Range", "Accept-Ranges",
+	"ETag", "Last-Modified", "Cache-Control", "Expires",
+}
+
+// Options configures a Proxy
+type Options struct {
+	// PathPrefix is the route the proxy is served under, e.g. /api/proxy
+	PathPrefix string
+	// Secret signs the upstream directories in proxy paths
+	Secret []byte
+	// Timeout bounds connecting and waiting for the upstream response
+	// headers, streams themselves run as long as the player reads
+	Timeout time.Duration
+	// RoomBandwidth caps the bytes per second streamed to a room, zero means unlimited
+	RoomBandwidth int64
+	// AllowPrivateNetworks disables the SSRF address check
+	AllowPrivateNetworks bool
+	// Client overrides the HTTP client, e.g. for fixture servers
+	Client *http.Client
+}
+
+// Proxy streams the video sources of room playlists through the server for
+// players which cannot load them directly, e.g. because of CORS, hotlink
+// protection or mixed content.
+//
+// Proxy paths have the form {prefix}/{sourceID}/{token}/{file}, where the
+// token holds a signed upstream directory. Relative references in manifests
+// thereby resolve to further proxy paths within the same directory.
+type Proxy struct {
+	client        *http.Client
+	prefix        string
+	key           []byte
+	roomBandwidth int64
+
+	mu       sync.Mutex
+	limiters map[uint]*limiter
+}
+
+var globalProxy *Proxy
+
+// NewProxy creates a new proxy
+func NewProxy(opts Options) *Proxy {
+	if opts.Timeout <= 0 {
+		opts.Timeout = 15 * time.Second
+	}
+
+	client := opts.Client
+	if client == nil {
+		client = utils.NewSafeHTTPClient(opts.Timeout, opts.AllowPrivateNetworks)
+		// The timeout still bounds the response headers through the transport
+		client.Timeout = 0
+	}
+
+	mac := hmac.New(sha256.New, opts.Secret)
+	mac.Write([]byte("media-proxy"))
+
+	return &Proxy{
+		client:        client,
+		prefix:        strings.TrimSuffix(opts.PathPrefix, "/"),
+		key:           mac.Sum(nil),
+		roomBandwidth: opts.RoomBandwidth,
+		limiters:      make(map[uint]*limiter),
+	}
+}
+
+// InitProxy initializes the global proxy
+func InitProxy(opts Options) {
+	globalProxy = NewProxy(opts)
+}
+
+// GetProxy returns the global proxy, or nil when proxying is disabled
+func GetProxy() *Proxy {
+	return globalProxy
+}
+
+// Path returns the proxy path of an upstream URL for a video source
+func (p *Proxy) Path(sourceID uint, target *url.URL) string {
+	escaped := target.EscapedPath()
+	if escaped == "" {
+		escaped = "/"
+	}
+	slash := strings.LastIndex(escaped, "/")
+	dir := target.Scheme + "://" + target.Host + escaped[:slash+1]
+
+	proxyPath := fmt.Sprintf("%s/%d/%s/%s", p.prefix, sourceID, p.token(sourceID, dir), escaped[slash+1:])
+	if target.RawQuery != "" {
+		proxyPath += "?" + target.RawQuery
+	}
+	return proxyPath
+}
+
+// Target returns the upstream URL of a proxy path, given its token, the
+// escaped path after the token and the query
+func (p *Proxy) Target(sourceID uint, token, escapedPath, rawQuery string) (*url.URL, error) {
+	encodedDir, _, ok := strings.Cut(token, ".")
+	if !ok || !hmac.Equal([]byte(token), []byte(p.token(sourceID, decodeDir(encodedDir)))) {
+		return nil, ErrInvalidToken
+	}
+
+	// Dot segments could climb out of the signed directory
+	for _, segment := range strings.Split(escapedPath, "/") {
+		if unescaped, err := url.PathUnescape(segment); err != nil || unescaped == "." || unescaped == ".." {
+			return nil, ErrInvalidToken
+		}
+	}
+
+	target, err := url.Parse(decodeDir(encodedDir) + escapedPath)
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+	target.RawQuery = rawQuery
+	if err := utils.ValidateOutboundURL(target); err != nil {
+		return nil, err
+	}
+	return target, nil
+}
+
+func (p *Proxy) token(sourceID uint, dir string) string {
+	mac := hmac.New(sha256.New, p.key)
+	mac.Write([]byte(strconv.FormatUint(uint64(sourceID), 10) + "\n" + dir))
+	return base64.RawURLEncoding.EncodeToString([]byte(dir)) + "." +
+		base64.RawURLEncoding.EncodeToString(mac.Sum(nil)[:signatureBytes])
+}
+
+func decodeDir(encoded string) string {
+	dir, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return ""
+	}
+	return string(dir)
+}
+
+// Serve fetches an upstream URL of a video source with the source's extra
+// headers and streams it to the player. Manifests are rewritten so that the
+// URLs in them go through the proxy as well, everything else is passed on
+// as it comes, including partial responses to Range requests. The encoded
+// query pair access is added to the rewritten URLs so that they carry the
+// access token of the manifest. The extra headers, which may hold
+// credentials, are only sent to the origin of the source URL, not to the
+// other hosts a manifest refers to.
+func (p *Proxy) Serve(w http.ResponseWriter, r *http.Request, roomID, sourceID uint, source, target *url.URL, headers map[string]string, access string) {
+	req, err := http.NewRequestWithContext(r.Context(), r.Method, target.String(), nil)
+	if err != nil {
+		http.Error(w, "Invalid upstream URL", http.StatusBadRequest)
+		return
+	}
+	if sameOrigin(source, target) {
+		for name, value := range headers {
+			req.Header.Set(name, value)
+		}
+	}
+	for _, name := range requestHeaders {
+		if value := r.Header.Get(name); value != "" {
+			req.Header.Set(name, value)
+		}
+	}
+	// Manifests are rewritten as a whole
+	if manifestKind("", target) != "" {
+		req.Header.Del("Range")
+		req.Header.Del("If-Range")
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		if errors.Is(err, utils.ErrBlockedAddress) {
+			http.Error(w, "Upstream address is not allowed", http.StatusForbidden)
+			return
+		}
+		if r.Context().Err() == nil {
+			http.Error(w, "Failed to reach upstream server", http.StatusBadGateway)
+		}
+		return
+	}
+	defer resp.Body.Close()
+
+	// Redirects were followed, references are relative to the final URL
+	if resp.Request != nil && resp.Request.URL != nil {
+		target = resp.Request.URL
+	}
+
+	kind := manifestKind(resp.Header.Get("Content-Type"), target)
+	if kind != "" && resp.StatusCode == http.StatusOK && r.Method != http.MethodHead {
+		p.serveManifest(w, resp, kind, sourceID, target, access)
+		return
+	}
+
+	for _, name := range responseHeaders {
+		if value := resp.Header.Get(name); value != "" {
+			w.Header().Set(name, value)
+		}
+	}
+	w.WriteHeader(resp.StatusCode)
+	if r.Method == http.MethodHead {
+		return
+	}
+
+	p.stream(r.Context(), w, resp.Body, roomID)
+}
+
+func (p *Proxy) serveManifest(w http.ResponseWriter, resp *http.Response, kind string, sourceID uint, base *url.URL, access string) {
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxManifestBytes+1))
+	if err != nil {
+		http.Error(w, "Failed to read upstream manifest", http.StatusBadGateway)
+		return
+	}
+	if len(body) > maxManifestBytes {
+		http.Error(w, "Upstream manifest is too large", http.StatusBadGateway)
+		return
+	}
+
+	rewrite := func(u *url.URL) string {
+		return mediaurl.AppendQuery(p.Path(sourceID, u), access)
+	}
+	if kind == manifestHLS {
+		body = rewriteHLS(body, base, rewrite)
+	} else {
+		body = rewriteDASH(body, base, rewrite, access)
+	}
+
+	w.Header().Set("Content-Type", resp.Header.Get("Content-Type"))
+	if cacheControl := resp.Header.Get("Cache-Control"); cacheControl != "" {
+		w.Header().Set("Cache-Control", cacheControl)
+	}
+	w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+	w.WriteHeader(http.StatusOK)
+	w.Write(body)
+}
+
+// stream copies an upstream body to the player within the bandwidth of the room
+func (p *Proxy) stream(ctx context.Context, w http.ResponseWriter, body io.Reader, roomID uint) {
+	var l *limiter
+	if p.roomBandwidth > 0 {
+		l = p.acquireLimiter(roomID)
+		defer p.releaseLimiter(roomID)
+	}
+
+	flusher, _ := w.(http.Flusher)
+	buf := make([]byte, copyBufferBytes)
+	for {
+		n, err := body.Read(buf)
+		if n > 0 {
+			if l != nil {
+				if err := l.wait(ctx, n); err != nil {
+					return
+				}
+			}
+			if _, err := w.Write(buf[:n]); err != nil {
+				return
+			}
+			if flusher != nil {
+				flusher.Flush()
+			}
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// sameOrigin reports whether two URLs have the same scheme, host and port
+func sameOrigin(a, b *url.URL) bool {
+	return strings.EqualFold(a.Scheme, b.Scheme) &&
+		strings.EqualFold(a.Hostname(), b.Hostname()) &&
+		originPort(a) == originPort(b)
+}
+
+// originPort returns the port of a URL, the default one of its scheme when
+// it has none
+func originPort(u *url.URL) string {
+	if port := u.Port(); port != "" {
+		return port
+	}
+	switch strings.ToLower(u.Scheme) {
+	case "http":
+		return "80"
+	case "https":
+		return "443"
+	}
+	return ""
+}
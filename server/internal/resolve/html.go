@@ -0,0 +1,295 @@
+package resolve
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+const maxPageBytes = 2 * 1024 * 1024
+
+// HTMLResolver finds the media of a web page in its HTML5 <video> elements,
+// schema.org VideoObjects in JSON-LD and OpenGraph og:video properties.
+// Links which already point at media resolve to themselves.
+type HTMLResolver struct {
+	client *http.Client
+}
+
+// NewHTMLResolver creates a resolver fetching pages with the given client
+func NewHTMLResolver(client *http.Client) *HTMLResolver {
+	return &HTMLResolver{client: client}
+}
+
+// Name implements Resolver
+func (r *HTMLResolver) Name() string {
+	return "html"
+}
+
+// Match implements Resolver
+func (r *HTMLResolver) Match(link *url.URL) bool {
+	return link.Scheme == "http" || link.Scheme == "https"
+}
+
+// Resolve implements Resolver
+func (r *HTMLResolver) Resolve(ctx context.Context, link *url.URL) (*Result, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, link.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "text/html,application/xhtml+xml;q=0.9,*/*;q=0.5")
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	switch {
+	case isMediaType(mediaType):
+		return &Result{Sources: []Source{{URL: link.String(), MimeType: mediaType}}}, nil
+	case mediaType != "" && mediaType != "text/html" && mediaType != "application/xhtml+xml":
+		return nil, ErrNoMedia
+	}
+
+	// The page may have been redirected, its URLs are relative to where it ended up
+	pageURL := link
+	if resp.Request != nil && resp.Request.URL != nil {
+		pageURL = resp.Request.URL
+	}
+
+	return parsePage(io.LimitReader(resp.Body, maxPageBytes), pageURL), nil
+}
+
+// isMediaType reports whether a content type is media a player can load
+func isMediaType(mediaType string) bool {
+	switch mediaType {
+	case "application/vnd.apple.mpegurl", "application/x-mpegurl", "audio/mpegurl", "audio/x-mpegurl",
+		"application/dash+xml":
+		return true
+	}
+	return strings.HasPrefix(mediaType, "video/")
+}
+
+// ogVideo collects the structured og:video properties of one video, which
+// follow the og:video property that starts it
+type ogVideo struct {
+	url       string
+	secureURL string
+	mimeType  string
+	width     int
+	height    int
+}
+
+// parsePage extracts the title and media sources of an HTML page. Sources of
+// <video> elements come first as they are what the page itself plays,
+// followed by those of JSON-LD and OpenGraph.
+func parsePage(body io.Reader, pageURL *url.URL) *Result {
+	result := &Result{}
+	base := pageURL
+
+	var videoSources, jsonLDSources []Source
+	var ogVideos []*ogVideo
+	var current *ogVideo
+	var ogTitle, jsonLDTitle, pageTitle string
+	var duration float64
+
+	inVideo := 0
+	inTitle := false
+	inJSONLD := false
+
+	tokenizer := html.NewTokenizer(body)
+	for {
+		tokenType := tokenizer.Next()
+		if tokenType == html.ErrorToken {
+			break
+		}
+
+		token := tokenizer.Token()
+		switch tokenType {
+		case html.TextToken:
+			if inTitle && pageTitle == "" {
+				pageTitle = token.Data
+			}
+			if inJSONLD {
+				sources, title := jsonLDVideos(token.Data, base)
+				jsonLDSources = append(jsonLDSources, sources...)
+				if jsonLDTitle == "" {
+					jsonLDTitle = title
+				}
+			}
+
+		case html.EndTagToken:
+			switch token.Data {
+			case "video":
+				if inVideo > 0 {
+					inVideo--
+				}
+			case "title":
+				inTitle = false
+			case "script":
+				inJSONLD = false
+			}
+
+		case html.StartTagToken, html.SelfClosingTagToken:
+			attrs := make(map[string]string, len(token.Attr))
+			for _, attr := range token.Attr {
+				attrs[attr.Key] = strings.TrimSpace(attr.Val)
+			}
+
+			switch token.Data {
+			case "base":
+				if href := attrs["href"]; href != "" && base == pageURL {
+					if u, err := pageURL.Parse(href); err == nil {
+						base = u
+					}
+				}
+
+			case "title":
+				inTitle = tokenType == html.StartTagToken
+
+			case "script":
+				mediaType, _, _ := mime.ParseMediaType(attrs["type"])
+				inJSONLD = tokenType == html.StartTagToken && mediaType == "application/ld+json"
+
+			case "video":
+				if src := attrs["src"]; src != "" {
+					videoSources = append(videoSources, Source{
+						URL:   resolveReference(base, src),
+						Label: sourceLabel(attrs, 0),
+					})
+				}
+				if tokenType == html.StartTagToken {
+					inVideo++
+				}
+
+			case "source":
+				if src := attrs["src"]; src != "" && inVideo > 0 && !isEmbedType(attrs["type"]) {
+					videoSources = append(videoSources, Source{
+						URL:      resolveReference(base, src),
+						Label:    sourceLabel(attrs, 0),
+						MimeType: attrs["type"],
+					})
+				}
+
+			case "meta":
+				property := attrs["property"]
+				if property == "" {
+					property = attrs["name"]
+				}
+				content := attrs["content"]
+				if content == "" {
+					continue
+				}
+
+				switch strings.ToLower(property) {
+				case "og:title":
+					ogTitle = content
+				case "og:video", "og:video:url":
+					current = &ogVideo{url: resolveReference(base, content)}
+					ogVideos = append(ogVideos, current)
+				case "og:video:secure_url":
+					if current == nil || current.secureURL != "" {
+						current = &ogVideo{}
+						ogVideos = append(ogVideos, current)
+					}
+					current.secureURL = resolveReference(base, content)
+				case "og:video:type":
+					if current != nil {
+						current.mimeType = content
+					}
+				case "og:video:width":
+					if current != nil {
+						current.width, _ = strconv.Atoi(content)
+					}
+				case "og:video:height":
+					if current != nil {
+						current.height, _ = strconv.Atoi(content)
+					}
+				case "video:duration", "og:video:duration":
+					duration, _ = strconv.ParseFloat(content, 64)
+				}
+			}
+		}
+	}
+
+	result.Sources = append(videoSources, jsonLDSources...)
+	for _, video := range ogVideos {
+		// Players embedded in an iframe or plugin are not media
+		if isEmbedType(video.mimeType) {
+			continue
+		}
+		source := Source{
+			URL:      video.secureURL,
+			MimeType: video.mimeType,
+			Width:    video.width,
+			Height:   video.height,
+		}
+		if source.URL == "" {
+			source.URL = video.url
+		}
+		source.Label = sourceLabel(nil, video.height)
+		result.Sources = append(result.Sources, source)
+	}
+
+	if duration > 0 {
+		for i := range result.Sources {
+			if result.Sources[i].Duration == 0 {
+				result.Sources[i].Duration = duration
+			}
+		}
+	}
+
+	result.Title = ogTitle
+	if result.Title == "" {
+		result.Title = jsonLDTitle
+	}
+	if result.Title == "" {
+		result.Title = pageTitle
+	}
+
+	return result
+}
+
+// sourceLabel names a source after its label or title attribute, falling back
+// to its resolution
+func sourceLabel(attrs map[string]string, height int) string {
+	for _, key := range []string{"label", "title"} {
+		if attrs[key] != "" {
+			return attrs[key]
+		}
+	}
+	for _, key := range []string{"size", "res"} {
+		if value, err := strconv.Atoi(attrs[key]); err == nil && value > 0 {
+			height = value
+		}
+	}
+	if height > 0 {
+		return fmt.Sprintf("%dp", height)
+	}
+	return ""
+}
+
+func isEmbedType(mimeType string) bool {
+	mediaType, _, _ := mime.ParseMediaType(mimeType)
+	return mediaType == "text/html" || mediaType == "application/x-shockwave-flash"
+}
+
+func resolveReference(base *url.URL, ref string) string {
+	u, err := base.Parse(ref)
+	if err != nil {
+		return ""
+	}
+	return u.String()
+}
@@ -0,0 +1,128 @@
+package resolve
+
+import (
+	"encoding/json"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// isoDurationPattern matches the ISO 8601 durations schema.org uses, such as
+// PT1H2M3.5S
+var isoDurationPattern = regexp.MustCompile(`^P(?:(\d+)D)?(?:T(?:(\d+)H)?(?:(\d+)M)?(?:(\d+(?:\.\d+)?)S)?)?$`)
+
+// jsonLDVideos extracts the schema.org VideoObjects of a JSON-LD script,
+// which may be nested in other objects, listed or in a @graph. It returns
+// their sources and the name of the first one.
+func jsonLDVideos(script string, base *url.URL) ([]Source, string) {
+	var data interface{}
+	if err := json.Unmarshal([]byte(script), &data); err != nil {
+		return nil, ""
+	}
+
+	var sources []Source
+	var title string
+	var walk func(value interface{})
+	walk = func(value interface{}) {
+		switch value := value.(type) {
+		case []interface{}:
+			for _, item := range value {
+				walk(item)
+			}
+		case map[string]interface{}:
+			if hasJSONLDType(value["@type"], "VideoObject") {
+				if contentURL := jsonLDString(value["contentUrl"]); contentURL != "" {
+					height := jsonLDInt(value["height"])
+					sources = append(sources, Source{
+						URL:      resolveReference(base, contentURL),
+						Label:    sourceLabel(nil, height),
+						MimeType: jsonLDString(value["encodingFormat"]),
+						Width:    jsonLDInt(value["width"]),
+						Height:   height,
+						Duration: parseISODuration(jsonLDString(value["duration"])),
+					})
+					if title == "" {
+						title = jsonLDString(value["name"])
+					}
+				}
+			}
+			// Keys are walked in order so that the sources keep one order
+			keys := make([]string, 0, len(value))
+			for key := range value {
+				if !strings.HasPrefix(key, "@") || key == "@graph" {
+					keys = append(keys, key)
+				}
+			}
+			sort.Strings(keys)
+			for _, key := range keys {
+				walk(value[key])
+			}
+		}
+	}
+	walk(data)
+
+	return sources, title
+}
+
+// hasJSONLDType reports whether a @type, a name or a list of names, is the
+// given type
+func hasJSONLDType(value interface{}, name string) bool {
+	switch value := value.(type) {
+	case string:
+		return value == name || value == "https://schema.org/"+name || value == "http://schema.org/"+name
+	case []interface{}:
+		for _, item := range value {
+			if hasJSONLDType(item, name) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func jsonLDString(value interface{}) string {
+	switch value := value.(type) {
+	case string:
+		return strings.TrimSpace(value)
+	case []interface{}:
+		if len(value) > 0 {
+			return jsonLDString(value[0])
+		}
+	}
+	return ""
+}
+
+// jsonLDInt reads a number given as a number, a string or a
+// QuantitativeValue
+func jsonLDInt(value interface{}) int {
+	switch value := value.(type) {
+	case float64:
+		return int(value)
+	case string:
+		number, _ := strconv.Atoi(strings.TrimSuffix(strings.TrimSpace(value), "px"))
+		return number
+	case map[string]interface{}:
+		return jsonLDInt(value["value"])
+	}
+	return 0
+}
+
+// parseISODuration returns the seconds of an ISO 8601 duration, zero when it
+// is not one
+func parseISODuration(value string) float64 {
+	match := isoDurationPattern.FindStringSubmatch(value)
+	if match == nil {
+		return 0
+	}
+
+	var seconds float64
+	for i, unit := range []float64{24 * 3600, 3600, 60, 1} {
+		if match[i+1] != "" {
+			number, _ := strconv.ParseFloat(match[i+1], 64)
+			seconds += number * unit
+		}
+	}
+	return seconds
+}
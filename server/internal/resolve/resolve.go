@@ -0,0 +1,168 @@
+package resolve
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync-player-server/internal/utils"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	maxTitleLength = 255
+	maxLabelLength = 100
+)
+
+// ErrNoMedia is returned when a link does not lead to playable media
+var ErrNoMedia = errors.New("no playable media found")
+
+// Source is a direct media URL found for a link
+type Source struct {
+	URL      string  `json:"url"`
+	Label    string  `json:"label,omitempty"`
+	MimeType string  `json:"mimeType,omitempty"`
+	Width    int     `json:"width,omitempty"`
+	Height   int     `json:"height,omitempty"`
+	Duration float64 `json:"duration,omitempty"`
+}
+
+// Result holds what a resolver found for a link
+type Result struct {
+	Resolver string   `json:"resolver"`
+	Title    string   `json:"title,omitempty"`
+	Sources  []Source `json:"sources"`
+}
+
+// Resolver turns links to pages, such as video pages and share links, into
+// direct media sources
+type Resolver interface {
+	// Name identifies the resolver on the sources it found
+	Name() string
+	// Match reports whether the resolver handles a link
+	Match(link *url.URL) bool
+	// Resolve returns the media of a link, or ErrNoMedia when it has none
+	Resolve(ctx context.Context, link *url.URL) (*Result, error)
+}
+
+// Options configures a Registry
+type Options struct {
+	// Timeout bounds resolving a whole link
+	Timeout time.Duration
+	// AllowPrivateNetworks disables the SSRF address check
+	AllowPrivateNetworks bool
+	// Client overrides the HTTP client, e.g. for fixture servers
+	Client *http.Client
+}
+
+// Registry runs a link through its resolvers in order until one finds media
+type Registry struct {
+	resolvers []Resolver
+	timeout   time.Duration
+}
+
+var globalRegistry *Registry
+
+// NewRegistry creates a registry of the given resolvers followed by the
+// generic HTML resolver, which matches every web link
+func NewRegistry(opts Options, resolvers ...Resolver) *Registry {
+	if opts.Timeout <= 0 {
+		opts.Timeout = 10 * time.Second
+	}
+
+	client := opts.Client
+	if client == nil {
+		client = utils.NewSafeHTTPClient(opts.Timeout, opts.AllowPrivateNetworks)
+	}
+
+	return &Registry{
+		resolvers: append(resolvers, NewHTMLResolver(client)),
+		timeout:   opts.Timeout,
+	}
+}
+
+// InitRegistry initializes the global registry
+func InitRegistry(opts Options, resolvers ...Resolver) {
+	globalRegistry = NewRegistry(opts, resolvers...)
+}
+
+// GetRegistry returns the global registry, or nil when resolving is disabled
+func GetRegistry() *Registry {
+	return globalRegistry
+}
+
+// Resolve finds the media of a link. A resolver which fails or finds nothing
+// hands the link on to the next one, the error of the last failing resolver
+// is returned when none succeeds.
+func (r *Registry) Resolve(ctx context.Context, rawURL string) (*Result, error) {
+	link, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid url: %w", err)
+	}
+	if err := utils.ValidateOutboundURL(link); err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	lastErr := ErrNoMedia
+	for _, resolver := range r.resolvers {
+		if !resolver.Match(link) {
+			continue
+		}
+
+		result, err := resolver.Resolve(ctx, link)
+		if err != nil {
+			if !errors.Is(err, ErrNoMedia) {
+				lastErr = fmt.Errorf("%s: %w", resolver.Name(), err)
+			}
+			continue
+		}
+
+		result.Resolver = resolver.Name()
+		if cleanResult(result, link) {
+			return result, nil
+		}
+	}
+
+	return nil, lastErr
+}
+
+// cleanResult makes the sources of a result absolute, drops those which are
+// not web URLs or repeat an earlier one, and trims the title and labels. It
+// reports whether any source is left.
+func cleanResult(result *Result, link *url.URL) bool {
+	seen := make(map[string]bool, len(result.Sources))
+	sources := make([]Source, 0, len(result.Sources))
+	for _, source := range result.Sources {
+		u, err := link.Parse(strings.TrimSpace(source.URL))
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			continue
+		}
+		source.URL = u.String()
+
+		key := utils.NormalizeMediaURL(source.URL)
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+
+		source.Label = truncate(strings.TrimSpace(source.Label), maxLabelLength)
+		sources = append(sources, source)
+	}
+
+	result.Sources = sources
+	result.Title = truncate(strings.Join(strings.Fields(result.Title), " "), maxTitleLength)
+	return len(sources) > 0
+}
+
+func truncate(value string, maxRunes int) string {
+	if utf8.RuneCountInString(value) <= maxRunes {
+		return value
+	}
+	return string([]rune(value)[:maxRunes])
+}
@@ -0,0 +1,136 @@
+package resolve
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+// newFixtureServer serves the pages in testdata as HTML, a video file and a
+// JSON document
+func newFixtureServer(t *testing.T) *httptest.Server {
+	t.Helper()
+
+	mux := http.NewServeMux()
+	mux.Handle("/pages/", http.StripPrefix("/pages/", http.FileServer(http.Dir("testdata"))))
+	mux.HandleFunc("/direct", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "video/mp4")
+		w.Write([]byte("not really a video"))
+	})
+	mux.HandleFunc("/data", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"video": "/media/data.mp4"}`))
+	})
+
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestRegistryResolve(t *testing.T) {
+	server := newFixtureServer(t)
+	registry := NewRegistry(Options{Client: server.Client()})
+
+	tests := []struct {
+		name  string
+		path  string
+		title string
+		want  []Source
+	}{
+		{
+			name:  "og:video",
+			path:  "/pages/og_video.html",
+			title: "OpenGraph title",
+			want: []Source{
+				{URL: server.URL + "/media/og-720.mp4", Label: "720p", MimeType: "video/mp4", Width: 1280, Height: 720, Duration: 120},
+			},
+		},
+		{
+			name:  "video and source elements",
+			path:  "/pages/video_tag.html",
+			title: "Video tag page",
+			want: []Source{
+				{URL: server.URL + "/assets/main.mp4", Label: "Main"},
+				{URL: server.URL + "/assets/hd.mp4", Label: "HD", MimeType: "video/mp4"},
+				{URL: server.URL + "/assets/sd.webm", Label: "480p", MimeType: "video/webm"},
+			},
+		},
+		{
+			name:  "JSON-LD VideoObject",
+			path:  "/pages/json_ld.html",
+			title: "JSON-LD title",
+			want: []Source{
+				{URL: server.URL + "/media/ld-1080.mp4", Label: "1080p", MimeType: "video/mp4", Width: 1920, Height: 1080, Duration: 90},
+			},
+		},
+		{
+			name: "direct media",
+			path: "/direct",
+			want: []Source{
+				{URL: server.URL + "/direct", MimeType: "video/mp4"},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			result, err := registry.Resolve(context.Background(), server.URL+test.path)
+			if err != nil {
+				t.Fatalf("Resolve() error = %v", err)
+			}
+			if result.Resolver != "html" {
+				t.Errorf("Resolver = %q, want %q", result.Resolver, "html")
+			}
+			if result.Title != test.title {
+				t.Errorf("Title = %q, want %q", result.Title, test.title)
+			}
+			if !reflect.DeepEqual(result.Sources, test.want) {
+				t.Errorf("Sources = %+v, want %+v", result.Sources, test.want)
+			}
+		})
+	}
+}
+
+func TestRegistryResolveNoMedia(t *testing.T) {
+	server := newFixtureServer(t)
+	registry := NewRegistry(Options{Client: server.Client()})
+
+	for _, path := range []string{"/pages/no_media.html", "/data"} {
+		t.Run(path, func(t *testing.T) {
+			_, err := registry.Resolve(context.Background(), server.URL+path)
+			if !errors.Is(err, ErrNoMedia) {
+				t.Fatalf("Resolve() error = %v, want %v", err, ErrNoMedia)
+			}
+		})
+	}
+}
+
+func TestRegistryResolveUpstreamError(t *testing.T) {
+	server := newFixtureServer(t)
+	registry := NewRegistry(Options{Client: server.Client()})
+
+	_, err := registry.Resolve(context.Background(), server.URL+"/pages/missing.html")
+	if err == nil || errors.Is(err, ErrNoMedia) {
+		t.Fatalf("Resolve() error = %v, want the status of the page", err)
+	}
+}
+
+func TestParseISODuration(t *testing.T) {
+	tests := map[string]float64{
+		"PT1M30S":   90,
+		"PT1H":      3600,
+		"P1DT2S":    86402,
+		"PT0.5S":    0.5,
+		"1:30":      0,
+		"":          0,
+		"PT1H2M3S ": 0,
+	}
+	for value, want := range tests {
+		if got := parseISODuration(value); got != want {
+			t.Errorf("parseISODuration(%q) = %v, want %v", value, got, want)
+		}
+	}
+}
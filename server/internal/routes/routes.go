@@ -3,6 +3,7 @@ package routes
 import (
 	"sync-player-server/internal/handlers"
 	"sync-player-server/internal/middleware"
+	"sync-player-server/internal/models"
 	"sync-player-server/internal/sync/adapters"
 
 	"github.com/gin-gonic/gin"
@@ -10,9 +11,9 @@ import (
 
 // SetupRoutes configures all routes
 func SetupRoutes(r *gin.Engine, wsAdapter *adapters.WebSocketAdapter, sseAdapter *adapters.SSEAdapter) {
-	// Try JWT first, then fall back to cookie for backward compatibility
+	// Room routes are only opened by a validated token, the userInfo cookie
+	// is not signed and proves nothing
 	r.Use(middleware.OptionalJWTAuth())
-	r.Use(middleware.ParseUserInfo())
 
 	r.GET("/health", func(c *gin.Context) {
 		c.JSON(200, gin.H{"status": "ok!"})
@@ -23,8 +24,22 @@ func SetupRoutes(r *gin.Engine, wsAdapter *adapters.WebSocketAdapter, sseAdapter
 	{
 		userGroup := apiGroup.Group("/user")
 		{
+			userGroup.POST("/register", handlers.UserRegister)
 			userGroup.POST("/login", handlers.UserLogin)
 			userGroup.GET("/query", handlers.UserQuery)
+			// Takes the session token of logging in as well as room tokens
+			userGroup.POST("/changePassword", handlers.UserChangePassword)
+		}
+
+		// Sessions are read from the token of the request, which need not
+		// be for a room
+		sessionGroup := apiGroup.Group("/session")
+		{
+			sessionGroup.POST("/refresh", handlers.SessionRefresh)
+			sessionGroup.GET("/list", handlers.SessionList)
+			sessionGroup.POST("/revoke", handlers.SessionRevoke)
+			sessionGroup.POST("/revokeOthers", handlers.SessionRevokeOthers)
+			sessionGroup.POST("/logout", handlers.SessionLogout)
 		}
 
 		roomGroup := apiGroup.Group("/room")
@@ -32,28 +47,154 @@ func SetupRoutes(r *gin.Engine, wsAdapter *adapters.WebSocketAdapter, sseAdapter
 			roomGroup.POST("/create", handlers.RoomCreate)
 			roomGroup.GET("/query", handlers.RoomQuery)
 			roomGroup.POST("/join", handlers.RoomJoin)
-			roomGroup.POST("/leave", handlers.RoomLeave)
+			roomGroup.POST("/leave", middleware.RequirePermission(models.PermissionView), handlers.RoomLeave)
+			roomGroup.POST("/changePassword", middleware.RequirePermission(models.PermissionManageSettings), handlers.RoomChangePassword)
 			roomGroup.GET("/queryOnlineUsers", handlers.RoomQueryOnlineUsers)
+			// Public rooms are listed without an account
+			roomGroup.GET("/list", handlers.RoomList)
+			roomGroup.GET("/settings", middleware.RequirePermission(models.PermissionView), handlers.RoomSettings)
+			roomGroup.POST("/updateSettings", middleware.RequirePermission(models.PermissionManageSettings), handlers.RoomUpdateSettings)
+		}
+
+		// Room routes require the role of the caller in their room to grant
+		// the permission of the route
+		view := middleware.RequirePermission(models.PermissionView)
+		controlPlayback := middleware.RequirePermission(models.PermissionControlPlayback)
+		editPlaylist := middleware.RequirePermission(models.PermissionEditPlaylist)
+		managePlaylist := middleware.RequirePermission(models.PermissionManagePlaylist)
+
+		memberGroup := apiGroup.Group("/member")
+		{
+			memberGroup.GET("/list", view, handlers.MemberList)
+			memberGroup.GET("/permissions", view, handlers.MemberPermissions)
+			memberGroup.POST("/grant", middleware.RequirePermission(models.PermissionAssignRoles), handlers.MemberGrant)
+			memberGroup.POST("/revoke", middleware.RequirePermission(models.PermissionAssignRoles), handlers.MemberRevoke)
+			memberGroup.POST("/kick", middleware.RequirePermission(models.PermissionManageMembers), handlers.MemberKick)
+			memberGroup.POST("/ban", middleware.RequirePermission(models.PermissionManageMembers), handlers.MemberBan)
+			memberGroup.POST("/unban", middleware.RequirePermission(models.PermissionManageMembers), handlers.MemberUnban)
+			memberGroup.GET("/bans", middleware.RequirePermission(models.PermissionManageMembers), handlers.MemberBans)
+		}
+
+		// Invites are joined with the session token of logging in
+		inviteGroup := apiGroup.Group("/invite")
+		{
+			inviteGroup.POST("/create", middleware.RequirePermission(models.PermissionAssignRoles), handlers.InviteCreate)
+			inviteGroup.GET("/list", middleware.RequirePermission(models.PermissionAssignRoles), handlers.InviteList)
+			inviteGroup.POST("/revoke", middleware.RequirePermission(models.PermissionAssignRoles), handlers.InviteRevoke)
+			inviteGroup.POST("/join", handlers.InviteJoin)
 		}
 
 		playlistGroup := apiGroup.Group("/playlist")
-		playlistGroup.Use(middleware.RequireAuth())
 		{
-			playlistGroup.POST("/add", handlers.PlaylistAdd)
-			playlistGroup.GET("/query", handlers.PlaylistQuery)
-			playlistGroup.DELETE("/delete", handlers.PlaylistDelete)
-			playlistGroup.DELETE("/clear", handlers.PlaylistClear)
-			playlistGroup.POST("/updateOrder", handlers.PlaylistUpdateOrder)
-			playlistGroup.POST("/switch", handlers.PlaylistSwitch)
+			playlistGroup.POST("/add", editPlaylist, handlers.PlaylistAdd)
+			playlistGroup.GET("/query", view, handlers.PlaylistQuery)
+			playlistGroup.POST("/update", editPlaylist, handlers.PlaylistUpdate)
+			playlistGroup.POST("/bulkAdd", editPlaylist, handlers.PlaylistBulkAdd)
+			playlistGroup.POST("/resolve", editPlaylist, handlers.PlaylistResolve)
+			playlistGroup.POST("/addLink", editPlaylist, handlers.PlaylistAddLink)
+			playlistGroup.DELETE("/delete", editPlaylist, handlers.PlaylistDelete)
+			playlistGroup.DELETE("/clear", managePlaylist, handlers.PlaylistClear)
+			playlistGroup.GET("/trash", view, handlers.PlaylistTrashQuery)
+			playlistGroup.POST("/restore", editPlaylist, handlers.PlaylistRestore)
+			playlistGroup.POST("/undo", editPlaylist, handlers.PlaylistUndo)
+			playlistGroup.DELETE("/purge", managePlaylist, handlers.PlaylistPurge)
+			playlistGroup.POST("/updateOrder", editPlaylist, handlers.PlaylistUpdateOrder)
+			playlistGroup.POST("/move", editPlaylist, handlers.PlaylistMove)
+			playlistGroup.POST("/switch", controlPlayback, handlers.PlaylistSwitch)
+			playlistGroup.POST("/import", editPlaylist, handlers.PlaylistImport)
+			playlistGroup.GET("/export", view, handlers.PlaylistExport)
+			playlistGroup.POST("/reportSourceError", view, handlers.PlaylistReportSourceError)
+			playlistGroup.POST("/upvote", editPlaylist, handlers.PlaylistUpvote)
+			playlistGroup.DELETE("/upvote", editPlaylist, handlers.PlaylistRemoveUpvote)
+			playlistGroup.POST("/voteSkip", editPlaylist, handlers.PlaylistVoteSkip)
+			playlistGroup.DELETE("/voteSkip", editPlaylist, handlers.PlaylistRemoveSkipVote)
+			playlistGroup.GET("/votes", view, handlers.PlaylistQueryVotes)
+			playlistGroup.POST("/queueMode", managePlaylist, handlers.PlaylistSetQueueMode)
+		}
+
+		// Media is opened by the signed URLs minted with the playlist
+		proxyGroup := apiGroup.Group("/proxy")
+		{
+			proxyGroup.GET("/:sourceId", handlers.ProxyEntry)
+			proxyGroup.HEAD("/:sourceId", handlers.ProxyEntry)
+			proxyGroup.GET("/:sourceId/:token/*path", handlers.ProxyStream)
+			proxyGroup.HEAD("/:sourceId/:token/*path", handlers.ProxyStream)
+		}
+
+		uploadGroup := apiGroup.Group("/upload")
+		// tus clients discover the protocol before authenticating
+		uploadGroup.OPTIONS("", handlers.UploadOptions)
+		{
+			uploadGroup.POST("", editPlaylist, handlers.UploadCreate)
+			uploadGroup.GET("/list", editPlaylist, handlers.UploadList)
+			uploadGroup.HEAD("/:key", editPlaylist, handlers.UploadHead)
+			uploadGroup.PATCH("/:key", editPlaylist, handlers.UploadPatch)
+			uploadGroup.DELETE("/:key", editPlaylist, handlers.UploadDelete)
+		}
+
+		transcodeGroup := apiGroup.Group("/transcode")
+		// Renditions are opened by the signed URLs minted with the playlist
+		transcodeGroup.GET("/media/:key/*file", handlers.TranscodeMedia)
+		transcodeGroup.HEAD("/media/:key/*file", handlers.TranscodeMedia)
+		{
+			transcodeGroup.POST("/create", editPlaylist, handlers.TranscodeCreate)
+			transcodeGroup.GET("/query", view, handlers.TranscodeQuery)
+			transcodeGroup.POST("/cancel", editPlaylist, handlers.TranscodeCancel)
+		}
+
+		// Uploads are opened by the signed URLs minted with the playlist
+		mediaGroup := apiGroup.Group("/media")
+		{
+			mediaGroup.GET("/:key/*name", handlers.MediaServe)
+			mediaGroup.HEAD("/:key/*name", handlers.MediaServe)
+		}
+
+		subtitleGroup := apiGroup.Group("/subtitle")
+		{
+			subtitleGroup.POST("/add", editPlaylist, handlers.SubtitleAdd)
+			subtitleGroup.POST("/upload", editPlaylist, handlers.SubtitleUpload)
+			subtitleGroup.GET("/query", view, handlers.SubtitleQuery)
+			subtitleGroup.GET("/content", view, handlers.SubtitleContent)
+			subtitleGroup.DELETE("/delete", editPlaylist, handlers.SubtitleDelete)
+		}
+
+		markerGroup := apiGroup.Group("/marker")
+		{
+			markerGroup.POST("/add", editPlaylist, handlers.MarkerAdd)
+			markerGroup.GET("/query", view, handlers.MarkerQuery)
+			markerGroup.POST("/update", editPlaylist, handlers.MarkerUpdate)
+			markerGroup.DELETE("/delete", editPlaylist, handlers.MarkerDelete)
+			markerGroup.POST("/jump", controlPlayback, handlers.MarkerJump)
+			markerGroup.POST("/importChapters", editPlaylist, handlers.MarkerImportChapters)
+		}
+
+		historyGroup := apiGroup.Group("/history")
+		{
+			historyGroup.GET("/room", view, handlers.HistoryQueryRoom)
+			historyGroup.GET("/user", view, handlers.HistoryQueryUser)
+			historyGroup.POST("/requeue", editPlaylist, handlers.HistoryRequeue)
+		}
+
+		savedPlaylistGroup := apiGroup.Group("/savedPlaylist")
+		// Shared playlists are readable without an account
+		savedPlaylistGroup.GET("/shared", handlers.SavedPlaylistShared)
+		{
+			savedPlaylistGroup.POST("/save", view, handlers.SavedPlaylistSave)
+			savedPlaylistGroup.GET("/list", view, handlers.SavedPlaylistList)
+			savedPlaylistGroup.GET("/query", view, handlers.SavedPlaylistQuery)
+			savedPlaylistGroup.POST("/load", view, handlers.SavedPlaylistLoad)
+			savedPlaylistGroup.POST("/rename", view, handlers.SavedPlaylistRename)
+			savedPlaylistGroup.POST("/share", view, handlers.SavedPlaylistShare)
+			savedPlaylistGroup.DELETE("/delete", view, handlers.SavedPlaylistDelete)
 		}
 
 		syncGroup := apiGroup.Group("/sync")
-		syncGroup.Use(middleware.RequireAuth())
 		{
-			syncGroup.POST("/updateTime", handlers.SyncUpdateTime)
-			syncGroup.GET("/query", handlers.SyncQuery)
-			syncGroup.POST("/updatePause", handlers.SyncUpdatePause)
-			syncGroup.GET("/protocol", handlers.SyncProtocol)
+			syncGroup.POST("/updateTime", controlPlayback, handlers.SyncUpdateTime)
+			syncGroup.GET("/query", view, handlers.SyncQuery)
+			syncGroup.POST("/updatePause", controlPlayback, handlers.SyncUpdatePause)
+			syncGroup.POST("/updateSubtitle", controlPlayback, handlers.SyncUpdateSubtitle)
+			syncGroup.GET("/protocol", view, handlers.SyncProtocol)
 		}
 	}
 
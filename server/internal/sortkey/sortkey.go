@@ -0,0 +1,266 @@
+package sortkey
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Keys order items by plain string comparison, so an item can be moved or
+// inserted anywhere by generating one key between its new neighbours without
+// touching any other item.
+//
+// A key is an integer part followed by an optional fraction. The first letter
+// of the integer part encodes its length: 'n' to 'z' start positive integers
+// of 1 to 13 digits, 'm' down to 'a' negative ones. Appending or prepending
+// therefore only increments or decrements the integer and keeps keys short,
+// inserting between two neighbours extends the fraction. The fraction never
+// ends in '0' so that there is always room for a key before it.
+//
+// Only digits and lowercase letters are used, which sort the same in every
+// database collation.
+const digits = "0123456789abcdefghijklmnopqrstuvwxyz"
+
+const (
+	zero     = "n0"
+	smallest = "a0000000000000"
+)
+
+// RebalanceLength is the longest key worth keeping. Inserting into the same
+// gap again and again grows keys by about one character every six inserts,
+// a list holding a longer key should be renumbered with Sequence.
+const RebalanceLength = 32
+
+// ErrExhausted is returned when no key exists beyond the smallest or largest
+// integer, which takes trillions of appends to a single room
+var ErrExhausted = errors.New("sort key space exhausted")
+
+// Between returns a key which sorts after a and before b. An empty a means
+// the start of the list, an empty b its end.
+func Between(a, b string) (string, error) {
+	if a != "" {
+		if err := validate(a); err != nil {
+			return "", err
+		}
+	}
+	if b != "" {
+		if err := validate(b); err != nil {
+			return "", err
+		}
+	}
+	if a != "" && b != "" && a >= b {
+		return "", fmt.Errorf("sort key %q is not before %q", a, b)
+	}
+
+	if a == "" {
+		if b == "" {
+			return zero, nil
+		}
+		ib := integerPart(b)
+		fb := b[len(ib):]
+		if ib == smallest {
+			return ib + midpoint("", fb), nil
+		}
+		if ib < b {
+			return ib, nil
+		}
+		if key, ok := decrementInteger(ib); ok {
+			if key == smallest {
+				// The smallest integer only takes keys with a fraction
+				return key + midpoint("", ""), nil
+			}
+			return key, nil
+		}
+		return "", ErrExhausted
+	}
+
+	ia := integerPart(a)
+	fa := a[len(ia):]
+	if b == "" {
+		if key, ok := incrementInteger(ia); ok {
+			return key, nil
+		}
+		return ia + midpoint(fa, ""), nil
+	}
+
+	ib := integerPart(b)
+	fb := b[len(ib):]
+	if ia == ib {
+		return ia + midpoint(fa, fb), nil
+	}
+	key, ok := incrementInteger(ia)
+	if !ok {
+		return "", ErrExhausted
+	}
+	if key < b {
+		return key, nil
+	}
+	return ia + midpoint(fa, ""), nil
+}
+
+// Sequence returns count increasing keys starting at the beginning of an
+// empty list
+func Sequence(count int) ([]string, error) {
+	keys := make([]string, 0, count)
+	previous := ""
+	for i := 0; i < count; i++ {
+		key, err := Between(previous, "")
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+		previous = key
+	}
+	return keys, nil
+}
+
+// midpoint returns a fraction between the fractions a and b, an empty b
+// meaning one. a must sort before b and neither may end in '0'.
+func midpoint(a, b string) string {
+	if b != "" {
+		// Keep the common prefix and find a midpoint in what follows
+		n := 0
+		for n < len(b) && digitAt(a, n) == b[n] {
+			n++
+		}
+		if n > 0 {
+			rest := ""
+			if n < len(a) {
+				rest = a[n:]
+			}
+			return b[:n] + midpoint(rest, b[n:])
+		}
+	}
+
+	digitA := 0
+	if a != "" {
+		digitA = strings.IndexByte(digits, a[0])
+	}
+	digitB := len(digits)
+	if b != "" {
+		digitB = strings.IndexByte(digits, b[0])
+	}
+
+	if digitB-digitA > 1 {
+		return string(digits[(digitA+digitB+1)/2])
+	}
+	// The first digits are consecutive
+	if len(b) > 1 {
+		return b[:1]
+	}
+	rest := ""
+	if len(a) > 1 {
+		rest = a[1:]
+	}
+	return string(digits[digitA]) + midpoint(rest, "")
+}
+
+func digitAt(s string, i int) byte {
+	if i < len(s) {
+		return s[i]
+	}
+	return '0'
+}
+
+func integerLength(head byte) (int, error) {
+	switch {
+	case head >= 'n' && head <= 'z':
+		return int(head-'n') + 2, nil
+	case head >= 'a' && head <= 'm':
+		return int('m'-head) + 2, nil
+	}
+	return 0, fmt.Errorf("invalid sort key head %q", head)
+}
+
+func integerPart(key string) string {
+	length, _ := integerLength(key[0])
+	return key[:length]
+}
+
+func validate(key string) error {
+	length, err := integerLength(key[0])
+	if err != nil {
+		return err
+	}
+	if len(key) < length {
+		return fmt.Errorf("invalid sort key %q", key)
+	}
+	for i := 1; i < len(key); i++ {
+		if strings.IndexByte(digits, key[i]) < 0 {
+			return fmt.Errorf("invalid sort key %q", key)
+		}
+	}
+	if key == smallest {
+		return fmt.Errorf("invalid sort key %q", key)
+	}
+	if len(key) > length && key[len(key)-1] == '0' {
+		return fmt.Errorf("invalid sort key %q", key)
+	}
+	return nil
+}
+
+func incrementInteger(integer string) (string, bool) {
+	head := integer[0]
+	digs := []byte(integer[1:])
+
+	carry := true
+	for i := len(digs) - 1; carry && i >= 0; i-- {
+		d := strings.IndexByte(digits, digs[i]) + 1
+		if d == len(digits) {
+			digs[i] = digits[0]
+		} else {
+			digs[i] = digits[d]
+			carry = false
+		}
+	}
+	if !carry {
+		return string(head) + string(digs), true
+	}
+
+	switch head {
+	case 'm':
+		return zero, true
+	case 'z':
+		return "", false
+	}
+	head++
+	if head > 'n' {
+		digs = append(digs, digits[0])
+	} else {
+		digs = digs[:len(digs)-1]
+	}
+	return string(head) + string(digs), true
+}
+
+func decrementInteger(integer string) (string, bool) {
+	head := integer[0]
+	digs := []byte(integer[1:])
+
+	borrow := true
+	for i := len(digs) - 1; borrow && i >= 0; i-- {
+		d := strings.IndexByte(digits, digs[i]) - 1
+		if d == -1 {
+			digs[i] = digits[len(digits)-1]
+		} else {
+			digs[i] = digits[d]
+			borrow = false
+		}
+	}
+	if !borrow {
+		return string(head) + string(digs), true
+	}
+
+	switch head {
+	case 'n':
+		return "m" + string(digits[len(digits)-1]), true
+	case 'a':
+		return "", false
+	}
+	head--
+	if head < 'm' {
+		digs = append(digs, digits[len(digits)-1])
+	} else {
+		digs = digs[:len(digs)-1]
+	}
+	return string(head) + string(digs), true
+}
@@ -0,0 +1,182 @@
+package sortkey
+
+import (
+	"testing"
+)
+
+func mustBetween(t *testing.T, a, b string) string {
+	t.Helper()
+
+	key, err := Between(a, b)
+	if err != nil {
+		t.Fatalf("Between(%q, %q) error = %v", a, b, err)
+	}
+	if err := validate(key); err != nil {
+		t.Fatalf("Between(%q, %q) = %q, which is not a valid key: %v", a, b, key, err)
+	}
+	if a != "" && key <= a {
+		t.Fatalf("Between(%q, %q) = %q, which is not after %q", a, b, key, a)
+	}
+	if b != "" && key >= b {
+		t.Fatalf("Between(%q, %q) = %q, which is not before %q", a, b, key, b)
+	}
+	return key
+}
+
+func TestBetweenEmptyBounds(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want string
+	}{
+		{"", "", "n0"},
+		{"n0", "", "n1"},
+		{"nz", "", "o00"},
+		{"", "n0", "mz"},
+		{"", "n1", "n0"},
+		{"", "n0i", "n0"},
+		{"mz", "", "n0"},
+	}
+	for _, test := range tests {
+		if got := mustBetween(t, test.a, test.b); got != test.want {
+			t.Errorf("Between(%q, %q) = %q, want %q", test.a, test.b, got, test.want)
+		}
+	}
+}
+
+func TestBetweenAdjacentKeys(t *testing.T) {
+	tests := []struct {
+		a, b string
+	}{
+		{"n0", "n1"},
+		{"nz", "o10"},
+		{"mz", "n0"},
+		{"n0", "n01"},
+		{"n01", "n02"},
+		{"n0y", "n0z"},
+		{"n0i", "n0j"},
+		{"n0z", "n1"},
+		{"n0zzz", "n1"},
+		{"n0", "n00001"},
+	}
+	for _, test := range tests {
+		mustBetween(t, test.a, test.b)
+	}
+}
+
+func TestBetweenInvalid(t *testing.T) {
+	tests := []struct {
+		a, b string
+	}{
+		{"n1", "n0"},
+		{"n0", "n0"},
+		{"n10", ""},
+		{"", "n"},
+		{"N0", ""},
+		{"n0", "n0-"},
+		{smallest, ""},
+	}
+	for _, test := range tests {
+		if key, err := Between(test.a, test.b); err == nil {
+			t.Errorf("Between(%q, %q) = %q, want an error", test.a, test.b, key)
+		}
+	}
+}
+
+func TestBetweenIntegerLimits(t *testing.T) {
+	if key := mustBetween(t, "", "a0000000000001"); key[:len(smallest)] != smallest {
+		t.Errorf("Between before the second integer = %q, want a fraction of the smallest", key)
+	}
+	if key := mustBetween(t, "", "a00000000000001"); key[:len(smallest)] != smallest {
+		t.Errorf("Between before the smallest integer = %q, want a fraction of it", key)
+	}
+	if key := mustBetween(t, "zzzzzzzzzzzzzz", ""); key[:14] != "zzzzzzzzzzzzzz" {
+		t.Errorf("Between after the largest integer = %q, want a fraction of it", key)
+	}
+	if _, err := Between("a0000000000000", "a0000000000001"); err == nil {
+		t.Error("Between after the smallest integer, which is not a key, want an error")
+	}
+}
+
+func TestSequenceOrdering(t *testing.T) {
+	keys, err := Sequence(2000)
+	if err != nil {
+		t.Fatalf("Sequence() error = %v", err)
+	}
+	if len(keys) != 2000 {
+		t.Fatalf("Sequence() returned %d keys, want 2000", len(keys))
+	}
+	for i, key := range keys {
+		if err := validate(key); err != nil {
+			t.Fatalf("keys[%d] = %q is not valid: %v", i, key, err)
+		}
+		if i > 0 && key <= keys[i-1] {
+			t.Fatalf("keys[%d] = %q does not sort after %q", i, key, keys[i-1])
+		}
+	}
+	if last := keys[len(keys)-1]; len(last) > 4 {
+		t.Errorf("last key %q is longer than 4 characters", last)
+	}
+}
+
+func TestPrependOrdering(t *testing.T) {
+	first := mustBetween(t, "", "")
+	for i := 0; i < 2000; i++ {
+		first = mustBetween(t, "", first)
+	}
+	if len(first) > 4 {
+		t.Errorf("first key %q is longer than 4 characters", first)
+	}
+}
+
+func TestSameGapGrowth(t *testing.T) {
+	// Moving items again and again right after the same item keeps
+	// splitting one gap, which is the worst case for key length
+	lo := mustBetween(t, "", "")
+	hi := mustBetween(t, lo, "")
+	previous := 0
+	moves := 0
+	for ; moves < 1000; moves++ {
+		key := mustBetween(t, lo, hi)
+		if moves > 0 && len(key) > previous+1 {
+			t.Fatalf("move %d grew the key from %d to %d characters", moves, previous, len(key))
+		}
+		previous = len(key)
+		hi = key
+		if len(key) > RebalanceLength {
+			break
+		}
+	}
+	if moves < 100 {
+		t.Errorf("keys grew past %d characters after %d moves, want at least 100", RebalanceLength, moves)
+	}
+	if moves == 1000 {
+		t.Errorf("keys stayed within %d characters for 1000 moves", RebalanceLength)
+	}
+
+	// Alternating sides of the gap grows keys the same way
+	lo, hi = "n0", "n1"
+	for i := 0; i < 500; i++ {
+		key := mustBetween(t, lo, hi)
+		if i%2 == 0 {
+			lo = key
+		} else {
+			hi = key
+		}
+	}
+}
+
+func TestSequenceAfterRebalance(t *testing.T) {
+	keys, err := Sequence(500)
+	if err != nil {
+		t.Fatalf("Sequence() error = %v", err)
+	}
+	for _, key := range keys {
+		if len(key) > RebalanceLength {
+			t.Fatalf("Sequence() key %q is longer than %d characters", key, RebalanceLength)
+		}
+	}
+	// A renumbered list has room for new keys in every gap
+	for i := 1; i < len(keys); i++ {
+		mustBetween(t, keys[i-1], keys[i])
+	}
+}
@@ -0,0 +1,93 @@
+package storage
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// LocalStorage stores files in a directory of the local filesystem
+type LocalStorage struct {
+	root string
+}
+
+// NewLocalStorage creates a storage in root, creating the directory when it
+// does not exist
+func NewLocalStorage(root string) (*LocalStorage, error) {
+	if err := os.MkdirAll(root, 0o755); err != nil {
+		return nil, err
+	}
+	return &LocalStorage{root: root}, nil
+}
+
+func (s *LocalStorage) path(key string) (string, error) {
+	if err := ValidateKey(key); err != nil {
+		return "", err
+	}
+	return filepath.Join(s.root, key), nil
+}
+
+// Append implements Storage
+func (s *LocalStorage) Append(key string, offset int64, data io.Reader) (int64, error) {
+	path, err := s.path(key)
+	if err != nil {
+		return 0, err
+	}
+
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE, 0o644)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	// A write cut short before its offset was recorded left bytes behind
+	if err := file.Truncate(offset); err != nil {
+		return 0, err
+	}
+	if _, err := file.Seek(offset, io.SeekStart); err != nil {
+		return 0, err
+	}
+
+	written, err := io.Copy(file, data)
+	if err != nil {
+		return written, err
+	}
+	return written, file.Sync()
+}
+
+// Open implements Storage
+func (s *LocalStorage) Open(key string) (File, error) {
+	path, err := s.path(key)
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return file, nil
+}
+
+// LocalPath implements LocalPather
+func (s *LocalStorage) LocalPath(key string) (string, error) {
+	return s.path(key)
+}
+
+// Delete implements Storage
+func (s *LocalStorage) Delete(key string) error {
+	path, err := s.path(key)
+	if err != nil {
+		return err
+	}
+
+	if err := os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,64 @@
+package storage
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"regexp"
+)
+
+var (
+	// ErrNotFound is returned when no file is stored under a key
+	ErrNotFound = errors.New("file not found")
+	// ErrInvalidKey is returned for keys which are not safe to store under
+	ErrInvalidKey = errors.New("invalid storage key")
+)
+
+var keyPattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,128}$`)
+
+// File is a stored file opened for reading
+type File interface {
+	io.ReadSeekCloser
+	Stat() (fs.FileInfo, error)
+}
+
+// Storage keeps uploaded media files under opaque keys
+type Storage interface {
+	// Append writes data to the file stored under key starting at offset,
+	// creating the file when needed and dropping anything stored past
+	// offset. It returns the number of bytes written, also when the data
+	// ends early with an error.
+	Append(key string, offset int64, data io.Reader) (int64, error)
+	// Open opens the file stored under key
+	Open(key string) (File, error)
+	// Delete removes the file stored under key, a missing file is no error
+	Delete(key string) error
+}
+
+// LocalPather is implemented by storages which keep files on the local
+// filesystem, so that external tools can read them in place
+type LocalPather interface {
+	// LocalPath returns the path of the file stored under key
+	LocalPath(key string) (string, error)
+}
+
+var globalStorage Storage
+
+// InitStorage sets the global storage
+func InitStorage(s Storage) {
+	globalStorage = s
+}
+
+// GetStorage returns the global storage, or nil when uploads are disabled
+func GetStorage() Storage {
+	return globalStorage
+}
+
+// ValidateKey checks that a key only holds letters, digits, dashes and
+// underscores
+func ValidateKey(key string) error {
+	if !keyPattern.MatchString(key) {
+		return ErrInvalidKey
+	}
+	return nil
+}
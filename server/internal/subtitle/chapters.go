@@ -0,0 +1,92 @@
+package subtitle
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Chapter is a titled time range read from a chapter file, times are in seconds
+type Chapter struct {
+	Start float64
+	End   float64
+	Title string
+}
+
+var vttTimingPattern = regexp.MustCompile(`(?:(\d+):)?(\d{2}):(\d{2})\.(\d{3})\s+-->\s+(?:(\d+):)?(\d{2}):(\d{2})\.(\d{3})`)
+
+// ParseChapters reads the cues of a WebVTT chapters file. SRT files are
+// accepted as well since chapter lists are often shared in that format.
+func ParseChapters(content []byte) ([]Chapter, error) {
+	format, err := DetectFormat("", content)
+	if err != nil {
+		return nil, err
+	}
+
+	var cues []cue
+	switch format {
+	case FormatWebVTT:
+		cues = parseWebVTT(decode(content))
+	case FormatSRT:
+		cues, err = parseSRT(decode(content))
+	default:
+		return nil, fmt.Errorf("chapters must be a WebVTT or SRT file")
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(cues) == 0 {
+		return nil, fmt.Errorf("chapter file contains no cues")
+	}
+
+	chapters := make([]Chapter, 0, len(cues))
+	for _, c := range cues {
+		chapters = append(chapters, Chapter{
+			Start: float64(c.start) / 1000,
+			End:   float64(c.end) / 1000,
+			Title: unescapeText(strings.ReplaceAll(c.text, "\n", " ")),
+		})
+	}
+	return chapters, nil
+}
+
+func parseWebVTT(text string) []cue {
+	var cues []cue
+
+	for _, block := range blankLinePattern.Split(strings.TrimSpace(text), -1) {
+		lines := strings.Split(strings.TrimSpace(block), "\n")
+
+		// The timing line is either the first line or follows the cue identifier
+		timingLine := -1
+		for i := 0; i < len(lines) && i < 2; i++ {
+			if vttTimingPattern.MatchString(lines[i]) {
+				timingLine = i
+				break
+			}
+		}
+		if timingLine < 0 {
+			continue
+		}
+
+		match := vttTimingPattern.FindStringSubmatch(lines[timingLine])
+		start := timestampMillis(match[1], match[2], match[3], match[4])
+		end := timestampMillis(match[5], match[6], match[7], match[8])
+		if end <= start {
+			continue
+		}
+
+		cues = append(cues, cue{
+			start: start,
+			end:   end,
+			text:  strings.TrimSpace(strings.Join(lines[timingLine+1:], "\n")),
+		})
+	}
+
+	return cues
+}
+
+// unescapeText reverts escapeText and drops cue markup
+func unescapeText(text string) string {
+	text = htmlTag.ReplaceAllString(text, "")
+	return strings.NewReplacer("&lt;", "<", "&gt;", ">", "&amp;", "&", "&nbsp;", " ").Replace(text)
+}
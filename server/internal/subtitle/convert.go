@@ -0,0 +1,308 @@
+package subtitle
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Format represents a subtitle file format
+type Format string
+
+const (
+	FormatWebVTT Format = "vtt"
+	FormatSRT    Format = "srt"
+	FormatASS    Format = "ass"
+	FormatSSA    Format = "ssa"
+)
+
+// DetectFormat determines the subtitle format from the file name, falling
+// back to the content when the extension is unknown
+func DetectFormat(filename string, content []byte) (Format, error) {
+	switch strings.ToLower(path.Ext(filename)) {
+	case ".vtt":
+		return FormatWebVTT, nil
+	case ".srt":
+		return FormatSRT, nil
+	case ".ass":
+		return FormatASS, nil
+	case ".ssa":
+		return FormatSSA, nil
+	}
+
+	text := strings.TrimSpace(decode(content))
+	switch {
+	case strings.HasPrefix(text, "WEBVTT"):
+		return FormatWebVTT, nil
+	case strings.HasPrefix(text, "[Script Info]"):
+		return FormatASS, nil
+	case srtTimingPattern.MatchString(text):
+		return FormatSRT, nil
+	}
+	return "", fmt.Errorf("unsupported subtitle format")
+}
+
+// ToWebVTT converts subtitle content in the given format to WebVTT
+func ToWebVTT(format Format, content []byte) (string, error) {
+	text := decode(content)
+
+	var cues []cue
+	var err error
+	switch format {
+	case FormatWebVTT:
+		return normalizeWebVTT(text)
+	case FormatSRT:
+		cues, err = parseSRT(text)
+	case FormatASS, FormatSSA:
+		cues, err = parseASS(text)
+	default:
+		return "", fmt.Errorf("unsupported subtitle format: %s", format)
+	}
+	if err != nil {
+		return "", err
+	}
+	if len(cues) == 0 {
+		return "", fmt.Errorf("subtitle file contains no cues")
+	}
+
+	var buf strings.Builder
+	buf.WriteString("WEBVTT\n")
+	for _, c := range cues {
+		fmt.Fprintf(&buf, "\n%s --> %s\n%s\n", formatTimestamp(c.start), formatTimestamp(c.end), c.text)
+	}
+	return buf.String(), nil
+}
+
+// cue is a single timed subtitle, times are in milliseconds
+type cue struct {
+	start int64
+	end   int64
+	text  string
+}
+
+// decode converts content to a UTF-8 string with unix line endings,
+// treating content which is not valid UTF-8 as Latin-1
+func decode(content []byte) string {
+	content = bytes.TrimPrefix(content, []byte("\ufeff"))
+
+	var text string
+	if utf8.Valid(content) {
+		text = string(content)
+	} else {
+		runes := make([]rune, len(content))
+		for i, b := range content {
+			runes[i] = rune(b)
+		}
+		text = string(runes)
+	}
+
+	return strings.NewReplacer("\r\n", "\n", "\r", "\n").Replace(text)
+}
+
+func normalizeWebVTT(text string) (string, error) {
+	if !strings.HasPrefix(strings.TrimLeft(text, " \t\n"), "WEBVTT") {
+		return "", fmt.Errorf("missing WEBVTT header")
+	}
+	return strings.TrimLeft(text, " \t\n"), nil
+}
+
+var blankLinePattern = regexp.MustCompile(`\n\s*\n`)
+
+var srtTimingPattern = regexp.MustCompile(`(\d+):(\d{1,2}):(\d{1,2})[,.](\d{1,3})\s*-->\s*(\d+):(\d{1,2}):(\d{1,2})[,.](\d{1,3})`)
+
+func parseSRT(text string) ([]cue, error) {
+	var cues []cue
+
+	blocks := blankLinePattern.Split(strings.TrimSpace(text), -1)
+	for _, block := range blocks {
+		lines := strings.Split(strings.TrimSpace(block), "\n")
+
+		timingLine := -1
+		for i, line := range lines {
+			if srtTimingPattern.MatchString(line) {
+				timingLine = i
+				break
+			}
+		}
+		if timingLine < 0 {
+			continue
+		}
+
+		match := srtTimingPattern.FindStringSubmatch(lines[timingLine])
+		start := timestampMillis(match[1], match[2], match[3], match[4])
+		end := timestampMillis(match[5], match[6], match[7], match[8])
+		if end <= start {
+			continue
+		}
+
+		textLines := make([]string, 0, len(lines)-timingLine-1)
+		for _, line := range lines[timingLine+1:] {
+			if line = cleanSRTLine(line); line != "" {
+				textLines = append(textLines, line)
+			}
+		}
+		if len(textLines) == 0 {
+			continue
+		}
+
+		cues = append(cues, cue{start: start, end: end, text: strings.Join(textLines, "\n")})
+	}
+
+	return cues, nil
+}
+
+var (
+	srtPositionTag = regexp.MustCompile(`\{\\[^}]*\}`)
+	htmlTag        = regexp.MustCompile(`</?([a-zA-Z]+)[^>]*>`)
+)
+
+// cleanSRTLine removes markup WebVTT does not understand and escapes the rest
+func cleanSRTLine(line string) string {
+	line = srtPositionTag.ReplaceAllString(line, "")
+
+	// Keep the simple styling tags WebVTT supports, drop everything else
+	var buf strings.Builder
+	last := 0
+	for _, loc := range htmlTag.FindAllStringSubmatchIndex(line, -1) {
+		buf.WriteString(escapeText(line[last:loc[0]]))
+		tag := strings.ToLower(line[loc[2]:loc[3]])
+		if tag == "i" || tag == "b" || tag == "u" {
+			if strings.HasPrefix(line[loc[0]:], "</") {
+				buf.WriteString("</" + tag + ">")
+			} else {
+				buf.WriteString("<" + tag + ">")
+			}
+		}
+		last = loc[1]
+	}
+	buf.WriteString(escapeText(line[last:]))
+
+	return strings.TrimSpace(buf.String())
+}
+
+func parseASS(text string) ([]cue, error) {
+	var cues []cue
+	var fields []string
+	inEvents := false
+
+	scanner := bufio.NewScanner(strings.NewReader(text))
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if strings.HasPrefix(line, "[") {
+			inEvents = strings.EqualFold(line, "[Events]")
+			continue
+		}
+		if !inEvents {
+			continue
+		}
+
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		value = strings.TrimSpace(value)
+
+		switch strings.TrimSpace(key) {
+		case "Format":
+			fields = nil
+			for _, field := range strings.Split(value, ",") {
+				fields = append(fields, strings.TrimSpace(field))
+			}
+		case "Dialogue":
+			if len(fields) == 0 {
+				return nil, fmt.Errorf("dialogue line before format line")
+			}
+			values := strings.SplitN(value, ",", len(fields))
+			if len(values) != len(fields) {
+				continue
+			}
+
+			var start, end int64 = -1, -1
+			var dialogue string
+			for i, field := range fields {
+				switch field {
+				case "Start":
+					start = parseASSTimestamp(values[i])
+				case "End":
+					end = parseASSTimestamp(values[i])
+				case "Text":
+					dialogue = values[i]
+				}
+			}
+			if start < 0 || end <= start {
+				continue
+			}
+
+			if dialogue = cleanASSText(dialogue); dialogue != "" {
+				cues = append(cues, cue{start: start, end: end, text: dialogue})
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	// ASS files are not required to list events in order
+	sort.SliceStable(cues, func(i, j int) bool {
+		return cues[i].start < cues[j].start
+	})
+	return cues, nil
+}
+
+var assOverrideTag = regexp.MustCompile(`\{[^}]*\}`)
+
+func cleanASSText(text string) string {
+	text = assOverrideTag.ReplaceAllString(text, "")
+	text = strings.NewReplacer(`\N`, "\n", `\n`, "\n", `\h`, " ").Replace(text)
+
+	lines := strings.Split(text, "\n")
+	cleaned := make([]string, 0, len(lines))
+	for _, line := range lines {
+		if line = strings.TrimSpace(line); line != "" {
+			cleaned = append(cleaned, escapeText(line))
+		}
+	}
+	return strings.Join(cleaned, "\n")
+}
+
+// parseASSTimestamp parses an H:MM:SS.cc timestamp into milliseconds
+func parseASSTimestamp(value string) int64 {
+	parts := strings.Split(strings.TrimSpace(value), ":")
+	if len(parts) != 3 {
+		return -1
+	}
+	seconds, fraction, _ := strings.Cut(parts[2], ".")
+	return timestampMillis(parts[0], parts[1], seconds, fraction)
+}
+
+// timestampMillis combines timestamp components into milliseconds. The
+// fraction is interpreted as a decimal fraction of a second.
+func timestampMillis(hours, minutes, seconds, fraction string) int64 {
+	h, _ := strconv.ParseInt(hours, 10, 64)
+	m, _ := strconv.ParseInt(minutes, 10, 64)
+	s, _ := strconv.ParseInt(seconds, 10, 64)
+
+	fraction = (fraction + "000")[:3]
+	ms, _ := strconv.ParseInt(fraction, 10, 64)
+
+	return ((h*60+m)*60+s)*1000 + ms
+}
+
+func formatTimestamp(millis int64) string {
+	hours := millis / 3600000
+	minutes := millis / 60000 % 60
+	seconds := millis / 1000 % 60
+	return fmt.Sprintf("%02d:%02d:%02d.%03d", hours, minutes, seconds, millis%1000)
+}
+
+// escapeText escapes the characters which have a meaning in WebVTT cue text
+func escapeText(text string) string {
+	return strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;").Replace(text)
+}
@@ -0,0 +1,45 @@
+package adapters
+
+import (
+	"errors"
+	"sync-player-server/internal/database"
+	"sync-player-server/internal/utils"
+)
+
+var (
+	errMissingToken   = errors.New("token is required")
+	errInvalidToken   = errors.New("invalid or expired token")
+	errSessionRevoked = errors.New("session expired or revoked")
+	errNoRoom         = errors.New("token is not valid for a room")
+)
+
+// tokenErrorMessages are what clients are told when their token is refused
+var tokenErrorMessages = map[error]string{
+	errMissingToken:   "Token is required",
+	errInvalidToken:   "Invalid or expired token",
+	errSessionRevoked: "Session expired or revoked",
+	errNoRoom:         "Token is not valid for a room",
+}
+
+// authenticateToken validates the access token a client connects with. Its
+// session has to be active and still be in the room of the token.
+func authenticateToken(token string) (*utils.JWTClaims, error) {
+	if token == "" {
+		return nil, errMissingToken
+	}
+	claims, err := utils.ValidateJWT(token)
+	if err != nil {
+		return nil, errInvalidToken
+	}
+	if claims.RoomID == 0 {
+		return nil, errNoRoom
+	}
+	session, err := database.GetActiveSession(claims.SessionID)
+	if err != nil || session.UserID != claims.UserID {
+		return nil, errSessionRevoked
+	}
+	if session.RoomID != claims.RoomID {
+		return nil, errNoRoom
+	}
+	return claims, nil
+}
@@ -8,7 +8,6 @@ import (
 	"sync"
 	"sync-player-server/internal/config"
 	"sync-player-server/internal/database"
-	"sync-player-server/internal/utils"
 	synctypes "sync-player-server/internal/sync"
 	"time"
 
@@ -17,11 +16,15 @@ import (
 
 // SSEClient represents an SSE client connection
 type SSEClient struct {
-	UserID   uint
-	RoomID   uint
-	Writer   gin.ResponseWriter
-	Flusher  http.Flusher
-	Done     chan bool
+	UserID    uint
+	RoomID    uint
+	SessionID uint
+	Writer    gin.ResponseWriter
+	Flusher   http.Flusher
+	Done      chan bool
+	// writeMu keeps the heartbeat and concurrent broadcasts from
+	// interleaving their events
+	writeMu sync.Mutex
 }
 
 // SSEAdapter implements ISyncAdapter using Server-Sent Events
@@ -39,9 +42,7 @@ func NewSSEAdapter() *SSEAdapter {
 
 // HandleSSEConnect handles SSE connection requests
 func (a *SSEAdapter) HandleSSEConnect(c *gin.Context) {
-	var userID, roomID uint
-
-	// Try JWT authentication first
+	// EventSource cannot set headers, so the token may come as a parameter
 	token := c.Query("token")
 	if token == "" {
 		// Try from Authorization header
@@ -54,29 +55,15 @@ func (a *SSEAdapter) HandleSSEConnect(c *gin.Context) {
 		}
 	}
 
-	if token != "" {
-		// Use JWT authentication
-		claims, err := utils.ValidateJWT(token)
-		if err != nil {
-			c.JSON(401, gin.H{"error": "Invalid or expired token"})
-			return
-		}
-		userID = claims.UserID
-		roomID = claims.RoomID
-	} else {
-		// Fallback to userId/roomId query parameters for backward compatibility
-		userIDStr := c.Query("userId")
-		roomIDStr := c.Query("roomId")
-
-		if _, err := fmt.Sscanf(userIDStr, "%d", &userID); err != nil {
-			c.JSON(400, gin.H{"error": "Invalid userId"})
-			return
-		}
-		if _, err := fmt.Sscanf(roomIDStr, "%d", &roomID); err != nil {
-			c.JSON(400, gin.H{"error": "Invalid roomId"})
-			return
-		}
+	// Only tokens of an active session open the room, so that kicked members
+	// and revoked sessions stay out
+	claims, err := authenticateToken(token)
+	if err != nil {
+		c.JSON(401, gin.H{"error": tokenErrorMessages[err]})
+		return
 	}
+	userID := claims.UserID
+	roomID := claims.RoomID
 
 	// Set SSE headers
 	c.Writer.Header().Set("Content-Type", "text/event-stream")
@@ -91,11 +78,12 @@ func (a *SSEAdapter) HandleSSEConnect(c *gin.Context) {
 	}
 
 	client := &SSEClient{
-		UserID:  userID,
-		RoomID:  roomID,
-		Writer:  c.Writer,
-		Flusher: flusher,
-		Done:    make(chan bool),
+		UserID:    userID,
+		RoomID:    roomID,
+		SessionID: claims.SessionID,
+		Writer:    c.Writer,
+		Flusher:   flusher,
+		Done:      make(chan bool),
 	}
 
 	// Register client
@@ -120,15 +108,14 @@ func (a *SSEAdapter) HandleSSEConnect(c *gin.Context) {
 	for {
 		select {
 		case <-c.Request.Context().Done():
-			a.handleDisconnect(roomID, userID)
+			a.handleDisconnect(client)
 			return
 		case <-client.Done:
-			a.handleDisconnect(roomID, userID)
+			a.handleDisconnect(client)
 			return
 		case <-ticker.C:
 			// Send heartbeat
-			fmt.Fprintf(client.Writer, ":\n\n")
-			client.Flusher.Flush()
+			client.write(":\n\n")
 		}
 	}
 }
@@ -145,20 +132,30 @@ func (a *SSEAdapter) sendEvent(client *SSEClient, eventType string, data interfa
 		return
 	}
 
-	fmt.Fprintf(client.Writer, "data: %s\n\n", jsonData)
-	client.Flusher.Flush()
+	client.write(fmt.Sprintf("data: %s\n\n", jsonData))
+}
+
+// write sends text to the client once the writes before it are done
+func (c *SSEClient) write(text string) {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	c.Writer.WriteString(text)
+	c.Flusher.Flush()
 }
 
-func (a *SSEAdapter) handleDisconnect(roomID, userID uint) {
+func (a *SSEAdapter) handleDisconnect(client *SSEClient) {
 	a.mu.Lock()
 	defer a.mu.Unlock()
 
-	if a.connections[roomID] != nil {
-		delete(a.connections[roomID], userID)
+	// The client may have been closed already, or replaced by a new
+	// connection of the same user
+	if a.connections[client.RoomID][client.UserID] != client {
+		return
 	}
+	delete(a.connections[client.RoomID], client.UserID)
 
-	database.SetMemberOnline(roomID, userID, false)
-	config.Logger.Infof("User %d disconnected from room %d", userID, roomID)
+	database.SetMemberOnline(client.RoomID, client.UserID, false)
+	config.Logger.Infof("User %d disconnected from room %d", client.UserID, client.RoomID)
 }
 
 // Broadcast sends a message to all users in a room except excluded users
@@ -217,6 +214,40 @@ func (a *SSEAdapter) GetUserIDsInRoom(roomID uint) []uint {
 	return userIDs
 }
 
+// CloseConnections closes the connections matching filter, sending the
+// clients a disconnect event with the reason first
+func (a *SSEAdapter) CloseConnections(filter synctypes.ConnectionFilter, reason string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	for roomID, clients := range a.connections {
+		for userID, client := range clients {
+			if !filter.Matches(roomID, userID, client.SessionID) {
+				continue
+			}
+			a.sendEvent(client, "disconnect", map[string]interface{}{"reason": reason})
+			delete(clients, userID)
+			close(client.Done)
+			database.SetMemberOnline(roomID, userID, false)
+			config.Logger.Infof("Closed connection of user %d in room %d: %s", userID, roomID, reason)
+		}
+	}
+}
+
+// GetSessionIDs returns the sessions of the connections
+func (a *SSEAdapter) GetSessionIDs() []uint {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	var sessionIDs []uint
+	for _, clients := range a.connections {
+		for _, client := range clients {
+			sessionIDs = append(sessionIDs, client.SessionID)
+		}
+	}
+	return sessionIDs
+}
+
 // Start starts the adapter
 func (a *SSEAdapter) Start() error {
 	config.Logger.Info("SSE adapter started")
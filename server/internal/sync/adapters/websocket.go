@@ -6,46 +6,84 @@ import (
 	"sync"
 	"sync-player-server/internal/config"
 	"sync-player-server/internal/database"
-	"sync-player-server/internal/utils"
 	synctypes "sync-player-server/internal/sync"
+	"time"
+	"unicode/utf8"
 
 	"github.com/gin-gonic/gin"
 	"github.com/gorilla/websocket"
 )
 
+// maxCloseReasonLength is the most a close frame has room for after its code
+const maxCloseReasonLength = 123
+
+// writeWait is how long a write may wait for a slow client, which would
+// otherwise hold up every broadcast to its room
+const writeWait = 10 * time.Second
+
 var upgrader = websocket.Upgrader{
 	CheckOrigin: func(r *http.Request) bool {
 		return true
 	},
 }
 
+// wsConnection is a WebSocket connection with the lock of its writers.
+// A connection supports one concurrent writer, and broadcasts of requests
+// and background jobs reach the same connection at the same time.
+type wsConnection struct {
+	conn    *websocket.Conn
+	writeMu sync.Mutex
+}
+
+// writeJSON sends a message once the writes before it are done
+func (c *wsConnection) writeJSON(v interface{}) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	c.conn.SetWriteDeadline(time.Now().Add(writeWait))
+	return c.conn.WriteJSON(v)
+}
+
+// closeWithReason sends a close frame with the reason and closes the
+// connection
+func (c *wsConnection) closeWithReason(code int, reason string) {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	deadline := time.Now().Add(time.Second)
+	c.conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, closeReason(reason)), deadline)
+	c.conn.Close()
+}
+
 // WebSocketAdapter implements ISyncAdapter using WebSocket
 type WebSocketAdapter struct {
-	connections map[uint]map[uint]*websocket.Conn
-	mu          sync.RWMutex
+	connections map[uint]map[uint]*wsConnection
+	// sessions holds the session of the connections authenticated with a token
+	sessions map[*wsConnection]uint
+	mu       sync.RWMutex
 }
 
 // NewWebSocketAdapter creates a new WebSocket adapter
 func NewWebSocketAdapter() *WebSocketAdapter {
 	return &WebSocketAdapter{
-		connections: make(map[uint]map[uint]*websocket.Conn),
+		connections: make(map[uint]map[uint]*wsConnection),
+		sessions:    make(map[*wsConnection]uint),
 	}
 }
 
 // HandleWebSocket handles WebSocket connections
 func (a *WebSocketAdapter) HandleWebSocket(c *gin.Context) {
-	conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
+	ws, err := upgrader.Upgrade(c.Writer, c.Request, nil)
 	if err != nil {
 		config.Logger.Errorf("Failed to upgrade WebSocket: %v", err)
 		return
 	}
-	defer conn.Close()
+	defer ws.Close()
+	conn := &wsConnection{conn: ws}
 
 	config.Logger.Info("New client connected")
-	conn.WriteJSON(map[string]string{"type": "connected"})
+	conn.writeJSON(map[string]string{"type": "connected"})
 
 	for {
-		_, message, err := conn.ReadMessage()
+		_, message, err := ws.ReadMessage()
 		if err != nil {
 			a.handleClose(conn)
 			break
@@ -55,7 +93,7 @@ func (a *WebSocketAdapter) HandleWebSocket(c *gin.Context) {
 	}
 }
 
-func (a *WebSocketAdapter) handleMessage(conn *websocket.Conn, message []byte) {
+func (a *WebSocketAdapter) handleMessage(conn *wsConnection, message []byte) {
 	var data struct {
 		Type    string          `json:"type"`
 		Payload json.RawMessage `json:"payload"`
@@ -68,48 +106,45 @@ func (a *WebSocketAdapter) handleMessage(conn *websocket.Conn, message []byte) {
 
 	if data.Type == "auth" {
 		var payload struct {
-			Token  string `json:"token"`
-			UserID uint   `json:"userId"`
-			RoomID uint   `json:"roomId"`
+			Token string `json:"token"`
 		}
 		if err := json.Unmarshal(data.Payload, &payload); err == nil {
-			// If token is provided, use JWT authentication
-			if payload.Token != "" {
-				claims, err := utils.ValidateJWT(payload.Token)
-				if err != nil {
-					config.Logger.Errorf("Invalid JWT token: %v", err)
-					conn.WriteJSON(map[string]string{
-						"type":  "error",
-						"error": "Invalid or expired token",
-					})
-					return
-				}
-				a.handleAuth(conn, claims.UserID, claims.RoomID)
-			} else {
-				// Fallback to userId/roomId for backward compatibility
-				a.handleAuth(conn, payload.UserID, payload.RoomID)
+			// Only tokens of an active session open the room, so that kicked
+			// members and revoked sessions stay out
+			claims, err := authenticateToken(payload.Token)
+			if err != nil {
+				config.Logger.Errorf("Refused WebSocket token: %v", err)
+				conn.writeJSON(map[string]string{
+					"type":  "error",
+					"error": tokenErrorMessages[err],
+				})
+				return
 			}
+			a.handleAuth(conn, claims.UserID, claims.RoomID, claims.SessionID)
 		}
 	}
 }
 
-func (a *WebSocketAdapter) handleAuth(conn *websocket.Conn, userID, roomID uint) {
+func (a *WebSocketAdapter) handleAuth(conn *wsConnection, userID, roomID, sessionID uint) {
 	a.mu.Lock()
 	defer a.mu.Unlock()
 
 	if a.connections[roomID] == nil {
-		a.connections[roomID] = make(map[uint]*websocket.Conn)
+		a.connections[roomID] = make(map[uint]*wsConnection)
 	}
 	a.connections[roomID][userID] = conn
+	a.sessions[conn] = sessionID
 
 	database.SetMemberOnline(roomID, userID, true)
 	config.Logger.Infof("User %d connected to room %d", userID, roomID)
 }
 
-func (a *WebSocketAdapter) handleClose(conn *websocket.Conn) {
+func (a *WebSocketAdapter) handleClose(conn *wsConnection) {
 	a.mu.Lock()
 	defer a.mu.Unlock()
 
+	delete(a.sessions, conn)
+
 	for roomID, users := range a.connections {
 		for userID, c := range users {
 			if c == conn {
@@ -139,7 +174,7 @@ func (a *WebSocketAdapter) Broadcast(roomID uint, message synctypes.SyncMessage,
 
 	for userID, conn := range roomConnections {
 		if !excludeMap[userID] {
-			conn.WriteJSON(message)
+			conn.writeJSON(message)
 		}
 	}
 }
@@ -156,7 +191,7 @@ func (a *WebSocketAdapter) SendToUsers(roomID uint, userIDs []uint, message sync
 
 	for _, userID := range userIDs {
 		if conn, ok := roomConnections[userID]; ok {
-			conn.WriteJSON(message)
+			conn.writeJSON(message)
 		}
 	}
 }
@@ -178,6 +213,39 @@ func (a *WebSocketAdapter) GetUserIDsInRoom(roomID uint) []uint {
 	return userIDs
 }
 
+// CloseConnections closes the connections matching filter, telling the
+// clients the reason in the close frame
+func (a *WebSocketAdapter) CloseConnections(filter synctypes.ConnectionFilter, reason string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	for roomID, users := range a.connections {
+		for userID, conn := range users {
+			sessionID := a.sessions[conn]
+			if !filter.Matches(roomID, userID, sessionID) {
+				continue
+			}
+			conn.closeWithReason(websocket.ClosePolicyViolation, reason)
+			delete(users, userID)
+			delete(a.sessions, conn)
+			database.SetMemberOnline(roomID, userID, false)
+			config.Logger.Infof("Closed connection of user %d in room %d: %s", userID, roomID, reason)
+		}
+	}
+}
+
+// GetSessionIDs returns the sessions of the connections
+func (a *WebSocketAdapter) GetSessionIDs() []uint {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	sessionIDs := make([]uint, 0, len(a.sessions))
+	for _, sessionID := range a.sessions {
+		sessionIDs = append(sessionIDs, sessionID)
+	}
+	return sessionIDs
+}
+
 // Start starts the adapter
 func (a *WebSocketAdapter) Start() error {
 	config.Logger.Info("WebSocket adapter started")
@@ -191,11 +259,25 @@ func (a *WebSocketAdapter) Stop() error {
 
 	for roomID, users := range a.connections {
 		for userID, conn := range users {
-			conn.Close()
+			conn.conn.Close()
 			database.SetMemberOnline(roomID, userID, false)
 		}
 	}
-	a.connections = make(map[uint]map[uint]*websocket.Conn)
+	a.connections = make(map[uint]map[uint]*wsConnection)
+	a.sessions = make(map[*wsConnection]uint)
 	config.Logger.Info("WebSocket adapter stopped")
 	return nil
 }
+
+// closeReason shortens a reason to fit a close frame without splitting a
+// character
+func closeReason(reason string) string {
+	if len(reason) <= maxCloseReasonLength {
+		return reason
+	}
+	end := maxCloseReasonLength
+	for end > 0 && !utf8.RuneStart(reason[end]) {
+		end--
+	}
+	return reason[:end]
+}
@@ -1,8 +1,14 @@
 package sync
 
+import (
+	"sync-player-server/internal/config"
+	"time"
+)
+
 // SyncManager implements ISyncManager
 type SyncManager struct {
 	adapter ISyncAdapter
+	stop    chan struct{}
 }
 
 var globalSyncManager *SyncManager
@@ -36,6 +42,65 @@ func (m *SyncManager) GetUserIDsInRoom(roomID uint) []uint {
 	return []uint{}
 }
 
+// CloseConnections closes the connections matching filter, telling the
+// clients the reason
+func (m *SyncManager) CloseConnections(filter ConnectionFilter, reason string) {
+	if m.adapter != nil {
+		m.adapter.CloseConnections(filter, reason)
+	}
+}
+
+// StartSessionCheck closes, every interval, the connections whose session
+// is no longer active. active returns those of the given sessions which are.
+func (m *SyncManager) StartSessionCheck(interval time.Duration, active func(sessionIDs []uint) ([]uint, error)) {
+	m.stop = make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-m.stop:
+				return
+			case <-ticker.C:
+				m.checkSessions(active)
+			}
+		}
+	}()
+}
+
+// StopSessionCheck stops checking the sessions of connections
+func (m *SyncManager) StopSessionCheck() {
+	if m.stop != nil {
+		close(m.stop)
+		m.stop = nil
+	}
+}
+
+func (m *SyncManager) checkSessions(active func(sessionIDs []uint) ([]uint, error)) {
+	if m.adapter == nil {
+		return
+	}
+	sessionIDs := m.adapter.GetSessionIDs()
+	if len(sessionIDs) == 0 {
+		return
+	}
+	activeIDs, err := active(sessionIDs)
+	if err != nil {
+		config.Logger.Errorf("Failed to check sessions of connections: %v", err)
+		return
+	}
+
+	isActive := make(map[uint]bool, len(activeIDs))
+	for _, id := range activeIDs {
+		isActive[id] = true
+	}
+	for _, id := range sessionIDs {
+		if !isActive[id] {
+			m.adapter.CloseConnections(ConnectionFilter{SessionID: id}, "Session expired or revoked")
+		}
+	}
+}
+
 // GetAdapter returns the underlying adapter (for registering routes)
 func (m *SyncManager) GetAdapter() ISyncAdapter {
 	return m.adapter
@@ -6,6 +6,25 @@ type SyncMessage struct {
 	Payload interface{} `json:"payload,omitempty"`
 }
 
+// ConnectionFilter selects live connections by the room, user and session
+// they were authenticated for. Zero fields match any value, but a filter
+// without any field set matches no connection.
+type ConnectionFilter struct {
+	RoomID    uint
+	UserID    uint
+	SessionID uint
+}
+
+// Matches reports whether a connection is selected by the filter
+func (f ConnectionFilter) Matches(roomID, userID, sessionID uint) bool {
+	if f.RoomID == 0 && f.UserID == 0 && f.SessionID == 0 {
+		return false
+	}
+	return (f.RoomID == 0 || f.RoomID == roomID) &&
+		(f.UserID == 0 || f.UserID == userID) &&
+		(f.SessionID == 0 || f.SessionID == sessionID)
+}
+
 // ISyncAdapter defines the interface for sync adapters (WebSocket/SSE)
 type ISyncAdapter interface {
 	// Broadcast sends a message to all users in a room except excluded users
@@ -17,6 +36,14 @@ type ISyncAdapter interface {
 	// GetUserIDsInRoom returns all user IDs currently connected in a room
 	GetUserIDsInRoom(roomID uint) []uint
 
+	// CloseConnections closes the connections matching filter, telling the
+	// clients the reason
+	CloseConnections(filter ConnectionFilter, reason string)
+
+	// GetSessionIDs returns the sessions of the connections which were
+	// authenticated with a token
+	GetSessionIDs() []uint
+
 	// Start starts the adapter
 	Start() error
 
@@ -34,4 +61,8 @@ type ISyncManager interface {
 
 	// GetUserIDsInRoom returns all user IDs currently connected in a room
 	GetUserIDsInRoom(roomID uint) []uint
+
+	// CloseConnections closes the connections matching filter, telling the
+	// clients the reason
+	CloseConnections(filter ConnectionFilter, reason string)
 }
@@ -0,0 +1,158 @@
+package transcode
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var durationPattern = regexp.MustCompile(`Duration: (\d+):(\d{2}):(\d{2}(?:\.\d+)?)`)
+
+// FFmpegExecutor packages renditions with an ffmpeg binary, encoding H.264
+// and AAC on the CPU
+type FFmpegExecutor struct {
+	// Path of the ffmpeg binary, looked up in PATH when it has no slash
+	Path string
+	// Threads ffmpeg may use for encoding, zero lets it decide
+	Threads int
+}
+
+// Run implements Executor
+func (e *FFmpegExecutor) Run(ctx context.Context, task Task, progress func(float64)) error {
+	cmd := exec.CommandContext(ctx, e.Path, e.args(task)...)
+
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		return err
+	}
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("failed to start ffmpeg: %w", err)
+	}
+
+	// ffmpeg prints the duration of the input to stderr and, last, the
+	// reason it failed
+	duration := make(chan float64, 1)
+	lastLine := make(chan string, 1)
+	go func() {
+		var last string
+		found := task.Duration > 0
+		scanner := bufio.NewScanner(stderr)
+		for scanner.Scan() {
+			line := strings.TrimSpace(scanner.Text())
+			if line == "" {
+				continue
+			}
+			last = line
+			if !found {
+				if seconds, ok := parseDuration(line); ok {
+					found = true
+					duration <- seconds
+				}
+			}
+		}
+		lastLine <- last
+	}()
+
+	total := task.Duration
+	scanner := bufio.NewScanner(stdout)
+	for scanner.Scan() {
+		// Older ffmpeg releases call the microseconds out_time_ms
+		key, value, _ := strings.Cut(scanner.Text(), "=")
+		if key != "out_time_us" && key != "out_time_ms" {
+			continue
+		}
+		if total <= 0 {
+			select {
+			case total = <-duration:
+			default:
+				continue
+			}
+		}
+		micros, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || micros < 0 {
+			continue
+		}
+		progress(min(float64(micros)/1e6/total, 1))
+	}
+	// Keep reading so that ffmpeg never blocks on a full pipe
+	io.Copy(io.Discard, stdout)
+
+	last := <-lastLine
+	if err := cmd.Wait(); err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) && last != "" {
+			return fmt.Errorf("ffmpeg: %s", last)
+		}
+		return fmt.Errorf("ffmpeg: %w", err)
+	}
+	progress(1)
+	return nil
+}
+
+func (e *FFmpegExecutor) args(task Task) []string {
+	rendition := task.Rendition
+	args := []string{"-hide_banner", "-nostdin", "-nostats", "-y", "-progress", "pipe:1"}
+
+	if strings.HasPrefix(task.Input, "http://") || strings.HasPrefix(task.Input, "https://") {
+		// A remote playlist must not lead ffmpeg to local files
+		args = append(args, "-protocol_whitelist", "http,https,tcp,tls,crypto")
+		if len(task.Headers) > 0 {
+			var headers strings.Builder
+			for name, value := range task.Headers {
+				headers.WriteString(name + ": " + value + "\r\n")
+			}
+			args = append(args, "-headers", headers.String())
+		}
+	}
+	args = append(args, "-i", task.Input)
+
+	args = append(args,
+		"-map", "0:v:0", "-map", "0:a:0?",
+		"-vf", fmt.Sprintf("scale=-2:'trunc(min(%d,ih)/2)*2'", rendition.Height),
+		"-c:v", "libx264", "-preset", "veryfast", "-profile:v", "high", "-pix_fmt", "yuv420p",
+		"-b:v", fmt.Sprintf("%dk", rendition.VideoBitrate),
+		"-maxrate", fmt.Sprintf("%dk", rendition.VideoBitrate*3/2),
+		"-bufsize", fmt.Sprintf("%dk", rendition.VideoBitrate*2),
+		"-force_key_frames", "expr:gte(t,n_forced*6)",
+		"-c:a", "aac", "-ac", "2",
+		"-b:a", fmt.Sprintf("%dk", rendition.AudioBitrate),
+	)
+	if e.Threads > 0 {
+		args = append(args, "-threads", strconv.Itoa(e.Threads))
+	}
+
+	return append(args,
+		"-f", "hls",
+		"-hls_time", "6",
+		"-hls_playlist_type", "vod",
+		"-hls_segment_filename", filepath.Join(task.OutputDir, "segment_%05d.ts"),
+		filepath.Join(task.OutputDir, PlaylistName),
+	)
+}
+
+// parseDuration reads the duration ffmpeg logs for its input
+func parseDuration(line string) (float64, bool) {
+	match := durationPattern.FindStringSubmatch(line)
+	if match == nil {
+		return 0, false
+	}
+	hours, _ := strconv.Atoi(match[1])
+	minutes, _ := strconv.Atoi(match[2])
+	seconds, _ := strconv.ParseFloat(match[3], 64)
+	total := float64(hours*3600+minutes*60) + seconds
+	return total, total > 0
+}
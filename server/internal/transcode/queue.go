@@ -0,0 +1,461 @@
+package transcode
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	gosync "sync"
+	"sync-player-server/internal/config"
+	"sync-player-server/internal/database"
+	"sync-player-server/internal/models"
+	"sync-player-server/internal/probe"
+	"sync-player-server/internal/storage"
+	"sync-player-server/internal/sync"
+	"sync-player-server/internal/utils"
+	"time"
+)
+
+var (
+	// ErrJobNotActive is returned when canceling a job which already ended
+	ErrJobNotActive = errors.New("transcode job is not queued or running")
+	// ErrInvalidPath is returned for output paths outside a job's renditions
+	ErrInvalidPath = errors.New("invalid transcode output path")
+
+	errCanceled = errors.New("transcode job canceled")
+	errStopped  = errors.New("transcode queue stopped")
+)
+
+var outputNamePattern = regexp.MustCompile(`^[A-Za-z0-9_-][A-Za-z0-9_.-]*$`)
+
+// progressInterval limits how often the progress of a job is stored and
+// broadcast to its room
+const progressInterval = time.Second
+
+// Options configures a Queue
+type Options struct {
+	Executor Executor
+	// OutputDir holds one directory of renditions per job
+	OutputDir string
+	// Workers is the number of jobs running at the same time
+	Workers int
+	// Renditions are packaged when a job names none
+	Renditions []string
+	// AllowPrivateNetworks disables the SSRF address check for remote inputs
+	AllowPrivateNetworks bool
+}
+
+// Queue runs transcode jobs stored in the database on a fixed number of
+// workers. Jobs which were running when the server stopped run again on the
+// next start, keeping the renditions they already finished.
+type Queue struct {
+	opts Options
+	wake chan struct{}
+	stop chan struct{}
+	wg   gosync.WaitGroup
+
+	mu      gosync.Mutex
+	running map[uint]context.CancelCauseFunc
+}
+
+var globalQueue *Queue
+
+// NewQueue creates a new transcode queue
+func NewQueue(opts Options) (*Queue, error) {
+	if opts.Executor == nil {
+		return nil, errors.New("transcode queue needs an executor")
+	}
+	if opts.Workers <= 0 {
+		opts.Workers = 1
+	}
+	if _, err := SelectRenditions(opts.Renditions, 0); err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(opts.OutputDir, 0o755); err != nil {
+		return nil, err
+	}
+
+	return &Queue{
+		opts:    opts,
+		wake:    make(chan struct{}, 1),
+		stop:    make(chan struct{}),
+		running: make(map[uint]context.CancelCauseFunc),
+	}, nil
+}
+
+// InitQueue initializes the global transcode queue
+func InitQueue(opts Options) (*Queue, error) {
+	queue, err := NewQueue(opts)
+	if err != nil {
+		return nil, err
+	}
+	globalQueue = queue
+	return globalQueue, nil
+}
+
+// GetQueue returns the global transcode queue, or nil when transcoding is
+// disabled
+func GetQueue() *Queue {
+	return globalQueue
+}
+
+// DefaultRenditions returns the renditions packaged when a job names none
+func (q *Queue) DefaultRenditions() []string {
+	return q.opts.Renditions
+}
+
+// Start requeues the jobs interrupted by the last shutdown and starts the
+// workers
+func (q *Queue) Start() {
+	requeued, err := database.RequeueRunningTranscodeJobs()
+	if err != nil {
+		config.Logger.Errorf("Failed to requeue transcode jobs: %v", err)
+	} else if requeued > 0 {
+		config.Logger.Infof("Requeued %d interrupted transcode jobs", requeued)
+	}
+
+	for i := 0; i < q.opts.Workers; i++ {
+		q.wg.Add(1)
+		go q.work()
+	}
+	config.Logger.Infof("Transcode queue running with %d workers", q.opts.Workers)
+}
+
+// Stop stops the workers. Running jobs are interrupted and run again on the
+// next start.
+func (q *Queue) Stop() {
+	select {
+	case <-q.stop:
+		return
+	default:
+		close(q.stop)
+	}
+
+	q.mu.Lock()
+	for _, cancel := range q.running {
+		cancel(errStopped)
+	}
+	q.mu.Unlock()
+
+	q.wg.Wait()
+}
+
+// Notify wakes a worker to pick up a newly queued job
+func (q *Queue) Notify() {
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Cancel cancels a queued job or stops a running one
+func (q *Queue) Cancel(jobID uint) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if cancel, ok := q.running[jobID]; ok {
+		cancel(errCanceled)
+		return nil
+	}
+
+	canceled, err := database.CancelQueuedTranscodeJob(jobID)
+	if err != nil {
+		return err
+	}
+	if !canceled {
+		return ErrJobNotActive
+	}
+	return nil
+}
+
+// OutputPath returns the path of a file in the output of a job, such as
+// 720p/index.m3u8
+func (q *Queue) OutputPath(jobKey, name string) (string, error) {
+	if err := storage.ValidateKey(jobKey); err != nil {
+		return "", ErrInvalidPath
+	}
+	rendition, file, ok := strings.Cut(strings.TrimPrefix(name, "/"), "/")
+	if !ok || !outputNamePattern.MatchString(rendition) || !outputNamePattern.MatchString(file) {
+		return "", ErrInvalidPath
+	}
+	return filepath.Join(q.opts.OutputDir, jobKey, rendition, file), nil
+}
+
+// RemoveOutput deletes the renditions of a job
+func (q *Queue) RemoveOutput(jobKey string) error {
+	if err := storage.ValidateKey(jobKey); err != nil {
+		return ErrInvalidPath
+	}
+	return os.RemoveAll(filepath.Join(q.opts.OutputDir, jobKey))
+}
+
+func (q *Queue) work() {
+	defer q.wg.Done()
+
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+
+	for {
+		job, ctx, err := q.claim()
+		if err != nil {
+			config.Logger.Errorf("Failed to claim transcode job: %v", err)
+		}
+		if job != nil {
+			q.run(ctx, job)
+			q.mu.Lock()
+			delete(q.running, job.ID)
+			q.mu.Unlock()
+			continue
+		}
+
+		select {
+		case <-q.stop:
+			return
+		case <-q.wake:
+		case <-ticker.C:
+		}
+	}
+}
+
+// claim takes the next queued job, registering it as running in the same
+// step so that Cancel never misses it
+func (q *Queue) claim() (*models.TranscodeJob, context.Context, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	select {
+	case <-q.stop:
+		return nil, nil, nil
+	default:
+	}
+
+	job, err := database.ClaimNextTranscodeJob()
+	if err != nil || job == nil {
+		return nil, nil, err
+	}
+
+	ctx, cancel := context.WithCancelCause(context.Background())
+	q.running[job.ID] = cancel
+	return job, ctx, nil
+}
+
+func (q *Queue) run(ctx context.Context, job *models.TranscodeJob) {
+	config.Logger.Infof("Transcode job %d started for video source %d", job.ID, job.SourceID)
+	q.broadcastProgress(job)
+
+	source, err := database.GetVideoSourceByID(job.SourceID)
+	if err != nil {
+		q.fail(job, errors.New("video source was removed"))
+		return
+	}
+
+	input, err := q.input(source)
+	if err != nil {
+		q.fail(job, err)
+		return
+	}
+
+	done := make(map[string]bool, len(job.DoneRenditions))
+	for _, name := range job.DoneRenditions {
+		done[name] = true
+	}
+
+	count := float64(len(job.Renditions))
+	for i, name := range job.Renditions {
+		if done[name] {
+			continue
+		}
+		rendition, ok := LookupRendition(name)
+		if !ok {
+			q.fail(job, fmt.Errorf("unknown rendition %s", name))
+			return
+		}
+
+		outputDir := filepath.Join(q.opts.OutputDir, job.JobKey, name)
+		if err := os.RemoveAll(outputDir); err == nil {
+			err = os.MkdirAll(outputDir, 0o755)
+		}
+		if err != nil {
+			q.fail(job, err)
+			return
+		}
+
+		job.CurrentRendition = name
+		job.Progress = float64(i) / count
+		q.saveProgress(job)
+
+		var lastReport time.Time
+		err := q.opts.Executor.Run(ctx, Task{
+			Input:     input,
+			Headers:   source.ProxyHeaders,
+			Duration:  source.Duration,
+			Rendition: rendition,
+			OutputDir: outputDir,
+		}, func(progress float64) {
+			if time.Since(lastReport) < progressInterval {
+				return
+			}
+			lastReport = time.Now()
+			job.Progress = (float64(i) + progress) / count
+			q.saveProgress(job)
+		})
+		if err != nil {
+			os.RemoveAll(outputDir)
+			switch context.Cause(ctx) {
+			case errStopped:
+				config.Logger.Infof("Transcode job %d interrupted by shutdown", job.ID)
+			case errCanceled:
+				q.finish(job, models.TranscodeStatusCanceled, "")
+			default:
+				q.fail(job, err)
+			}
+			return
+		}
+
+		if err := q.attach(job, source, rendition); err != nil {
+			os.RemoveAll(outputDir)
+			q.fail(job, err)
+			return
+		}
+	}
+
+	job.Progress = 1
+	q.finish(job, models.TranscodeStatusCompleted, "")
+}
+
+// input returns what the executor reads a source from, the file of an
+// upload or the URL of a source hosted elsewhere
+func (q *Queue) input(source *models.VideoSource) (string, error) {
+	if source.UploadID != nil {
+		upload, err := database.GetMediaUploadByID(*source.UploadID)
+		if err != nil {
+			return "", errors.New("upload was removed")
+		}
+		pather, ok := storage.GetStorage().(storage.LocalPather)
+		if !ok {
+			return "", errors.New("upload storage is not on the local filesystem")
+		}
+		path, err := pather.LocalPath(upload.UploadKey)
+		if err != nil {
+			return "", err
+		}
+		// Keys may start with a dash, which ffmpeg would take for an option
+		return filepath.Abs(path)
+	}
+
+	target, err := url.Parse(source.URL)
+	if err != nil || (target.Scheme != "http" && target.Scheme != "https") {
+		return "", errors.New("video source URL cannot be transcoded")
+	}
+	if !q.opts.AllowPrivateNetworks {
+		if err := utils.ValidateOutboundURL(target); err != nil {
+			return "", err
+		}
+	}
+	return source.URL, nil
+}
+
+// attach adds a finished rendition to the playlist item of its job
+func (q *Queue) attach(job *models.TranscodeJob, source *models.VideoSource, rendition Rendition) error {
+	height := rendition.Height
+	if source.Height > 0 && source.Height < height {
+		height = source.Height
+	}
+
+	_, err := database.UpdatePlaylistItem(job.RoomID, job.PlaylistItemID, database.PlaylistItemUpdate{
+		AddSources: []database.VideoSourceInput{{
+			URL:            job.BaseURL + "/api/transcode/media/" + job.JobKey + "/" + rendition.Name + "/" + PlaylistName,
+			Label:          rendition.Name,
+			TranscodeJobID: &job.ID,
+			MediaInfo: models.MediaInfo{
+				Duration:   source.Duration,
+				Container:  probe.ContainerHLS,
+				Height:     height,
+				VideoCodec: "h264",
+				AudioCodec: "aac",
+			},
+		}},
+	})
+	if errors.Is(err, database.ErrPlaylistItemNotFound) {
+		return errors.New("playlist item was removed")
+	}
+	if err != nil {
+		return err
+	}
+
+	job.DoneRenditions = append(job.DoneRenditions, rendition.Name)
+	if err := database.UpdateTranscodeDoneRenditions(job.ID, job.DoneRenditions); err != nil {
+		config.Logger.Errorf("Failed to store transcode job %d renditions: %v", job.ID, err)
+	}
+
+	syncManager := sync.GetSyncManager()
+	if syncManager != nil {
+		syncManager.Broadcast(job.RoomID, sync.SyncMessage{
+			Type: "updatePlaylist",
+		}, nil)
+	}
+	return nil
+}
+
+func (q *Queue) saveProgress(job *models.TranscodeJob) {
+	if err := database.UpdateTranscodeProgress(job.ID, job.Progress, job.CurrentRendition); err != nil {
+		config.Logger.Errorf("Failed to store transcode job %d progress: %v", job.ID, err)
+	}
+	q.broadcastProgress(job)
+}
+
+func (q *Queue) fail(job *models.TranscodeJob, err error) {
+	config.Logger.Warnf("Transcode job %d failed: %v", job.ID, err)
+	q.finish(job, models.TranscodeStatusFailed, truncate(err.Error(), 255))
+}
+
+func (q *Queue) finish(job *models.TranscodeJob, status models.TranscodeStatus, errMsg string) {
+	job.Status = status
+	job.Error = errMsg
+	job.CurrentRendition = ""
+	if err := database.FinishTranscodeJob(job.ID, status, job.Progress, errMsg); err != nil {
+		config.Logger.Errorf("Failed to store transcode job %d result: %v", job.ID, err)
+	}
+	// Renditions already attached stay, the playlist item serves them
+	if len(job.DoneRenditions) == 0 {
+		if err := q.RemoveOutput(job.JobKey); err != nil {
+			config.Logger.Warnf("Failed to remove transcode job %d output: %v", job.ID, err)
+		}
+	}
+	if status != models.TranscodeStatusFailed {
+		config.Logger.Infof("Transcode job %d %s", job.ID, status)
+	}
+	q.broadcastProgress(job)
+}
+
+// broadcastProgress tells the room of a job how far it got
+func (q *Queue) broadcastProgress(job *models.TranscodeJob) {
+	syncManager := sync.GetSyncManager()
+	if syncManager == nil {
+		return
+	}
+	syncManager.Broadcast(job.RoomID, sync.SyncMessage{
+		Type: "transcodeProgress",
+		Payload: map[string]interface{}{
+			"jobId":            job.ID,
+			"videoId":          job.PlaylistItemID,
+			"sourceId":         job.SourceID,
+			"status":           job.Status,
+			"progress":         job.Progress,
+			"currentRendition": job.CurrentRendition,
+			"doneRenditions":   job.DoneRenditions,
+			"error":            job.Error,
+		},
+	}, nil)
+}
+
+func truncate(value string, maxLength int) string {
+	if len(value) <= maxLength {
+		return value
+	}
+	return value[:maxLength]
+}
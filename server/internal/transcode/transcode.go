@@ -0,0 +1,92 @@
+package transcode
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// PlaylistName is the name of the HLS playlist an executor writes into the
+// output directory of a rendition
+const PlaylistName = "index.m3u8"
+
+// Rendition describes one HLS rendition a source is packaged as
+type Rendition struct {
+	Name string
+	// Height of the video, sources which are smaller are not scaled up
+	Height int
+	// VideoBitrate and AudioBitrate in kilobits per second
+	VideoBitrate int
+	AudioBitrate int
+}
+
+var renditions = map[string]Rendition{
+	"1080p": {Name: "1080p", Height: 1080, VideoBitrate: 5000, AudioBitrate: 192},
+	"720p":  {Name: "720p", Height: 720, VideoBitrate: 2800, AudioBitrate: 128},
+	"480p":  {Name: "480p", Height: 480, VideoBitrate: 1400, AudioBitrate: 128},
+	"360p":  {Name: "360p", Height: 360, VideoBitrate: 800, AudioBitrate: 96},
+}
+
+// LookupRendition returns the rendition with a name such as 720p
+func LookupRendition(name string) (Rendition, bool) {
+	rendition, ok := renditions[name]
+	return rendition, ok
+}
+
+// SelectRenditions returns the renditions of names which are not taller than
+// a source of height, tallest first. When every one is taller, the smallest
+// is kept so that the source is still packaged. A height of zero means the
+// height of the source is unknown.
+func SelectRenditions(names []string, height int) ([]string, error) {
+	selected := make([]Rendition, 0, len(names))
+	seen := make(map[string]bool, len(names))
+	for _, name := range names {
+		name = strings.TrimSpace(name)
+		rendition, ok := LookupRendition(name)
+		if !ok {
+			return nil, fmt.Errorf("unknown rendition %s", name)
+		}
+		if !seen[name] {
+			seen[name] = true
+			selected = append(selected, rendition)
+		}
+	}
+	if len(selected) == 0 {
+		return nil, fmt.Errorf("no renditions given")
+	}
+	sort.Slice(selected, func(i, j int) bool {
+		return selected[i].Height > selected[j].Height
+	})
+
+	result := make([]string, 0, len(selected))
+	for _, rendition := range selected {
+		if height <= 0 || rendition.Height <= height {
+			result = append(result, rendition.Name)
+		}
+	}
+	if len(result) == 0 {
+		result = append(result, selected[len(selected)-1].Name)
+	}
+	return result, nil
+}
+
+// Task is the packaging of one source as one rendition
+type Task struct {
+	// Input is a local file path or an http(s) URL
+	Input string
+	// Headers are sent along when Input is a URL
+	Headers map[string]string
+	// Duration of the source in seconds if known, for reporting progress
+	Duration  float64
+	Rendition Rendition
+	// OutputDir receives the playlist and its segments
+	OutputDir string
+}
+
+// Executor runs the tool which transcodes and packages a rendition
+type Executor interface {
+	// Run packages a rendition, calling progress with the share done from 0
+	// to 1 as it goes. It stops when ctx is canceled.
+	Run(ctx context.Context, task Task, progress func(float64)) error
+}
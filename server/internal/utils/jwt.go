@@ -13,25 +13,31 @@ type JWTClaims struct {
 	UserID   uint   `json:"sub"`
 	Username string `json:"username"`
 	RoomID   uint   `json:"room_id"`
-	Role     string `json:"role"`
+	// Role is the role of the user in the room when the token was issued,
+	// permissions are checked against the current one
+	Role string `json:"role"`
+	// SessionID is the session the token was issued for, revoking it
+	// revokes the token
+	SessionID uint `json:"sid"`
 	jwt.RegisteredClaims
 }
 
-// GenerateJWT generates a new JWT token for a user
-func GenerateJWT(userID uint, username string, roomID uint, isAdmin bool) (string, error) {
-	role := "user"
-	if isAdmin {
-		role = "admin"
+// GenerateJWT generates a new short-lived access token for a user's session
+// with their role in the room, an empty role for tokens without a room
+func GenerateJWT(userID uint, username string, roomID uint, role string, sessionID uint) (string, error) {
+	if role == "" {
+		role = "user"
 	}
 
 	claims := JWTClaims{
-		UserID:   userID,
-		Username: username,
-		RoomID:   roomID,
-		Role:     role,
+		UserID:    userID,
+		Username:  username,
+		RoomID:    roomID,
+		Role:      role,
+		SessionID: sessionID,
 		RegisteredClaims: jwt.RegisteredClaims{
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour * time.Duration(config.Env.JWTExpiryHours))),
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(AccessTokenTTL())),
 		},
 	}
 
@@ -64,3 +70,8 @@ func ValidateJWT(tokenString string) (*JWTClaims, error) {
 
 	return nil, fmt.Errorf("invalid token")
 }
+
+// AccessTokenTTL returns how long access tokens are valid
+func AccessTokenTTL() time.Duration {
+	return time.Duration(config.Env.JWTAccessTTLMinutes) * time.Minute
+}
@@ -0,0 +1,129 @@
+package utils
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+)
+
+// MediaURLPolicy decides which URLs members may add as video or subtitle
+// sources. Host patterns match a host exactly, or any subdomain when they
+// start with "*.". Denied hosts win over allowed ones, an empty allow list
+// allows every host.
+type MediaURLPolicy struct {
+	Schemes      []string
+	AllowedHosts []string
+	DeniedHosts  []string
+	MaxLength    int
+}
+
+// NewMediaURLPolicy builds a policy from comma separated lists
+func NewMediaURLPolicy(schemes, allowedHosts, deniedHosts string, maxLength int) *MediaURLPolicy {
+	return &MediaURLPolicy{
+		Schemes:      splitList(schemes),
+		AllowedHosts: splitList(allowedHosts),
+		DeniedHosts:  splitList(deniedHosts),
+		MaxLength:    maxLength,
+	}
+}
+
+// Check returns why a URL may not be added, nil when it may
+func (p *MediaURLPolicy) Check(rawURL string) error {
+	if rawURL == "" {
+		return fmt.Errorf("URL is required")
+	}
+	if p.MaxLength > 0 && len(rawURL) > p.MaxLength {
+		return fmt.Errorf("URL is longer than %d characters", p.MaxLength)
+	}
+
+	u, err := url.Parse(rawURL)
+	if err != nil || !u.IsAbs() {
+		return fmt.Errorf("URL must be absolute")
+	}
+
+	scheme := strings.ToLower(u.Scheme)
+	if !containsFold(p.Schemes, scheme) {
+		return fmt.Errorf("URL scheme %s is not allowed", scheme)
+	}
+	if u.Host == "" {
+		return fmt.Errorf("URL must have a host")
+	}
+
+	host := normalizeHost(u.Hostname())
+	for _, pattern := range p.DeniedHosts {
+		if matchHost(pattern, host) {
+			return fmt.Errorf("Host %s is not allowed", host)
+		}
+	}
+	if len(p.AllowedHosts) == 0 {
+		return nil
+	}
+	for _, pattern := range p.AllowedHosts {
+		if matchHost(pattern, host) {
+			return nil
+		}
+	}
+	return fmt.Errorf("Host %s is not allowed", host)
+}
+
+// NormalizeMediaURL returns the form of a URL used to detect duplicates:
+// lowercase scheme and host, no default port and no fragment
+func NormalizeMediaURL(rawURL string) string {
+	u, err := url.Parse(strings.TrimSpace(rawURL))
+	if err != nil || u.Host == "" {
+		return strings.TrimSpace(rawURL)
+	}
+
+	u.Scheme = strings.ToLower(u.Scheme)
+	host := normalizeHost(u.Hostname())
+	port := u.Port()
+	if (u.Scheme == "http" && port == "80") || (u.Scheme == "https" && port == "443") {
+		port = ""
+	}
+	switch {
+	case port != "":
+		u.Host = net.JoinHostPort(host, port)
+	case strings.Contains(host, ":"):
+		u.Host = "[" + host + "]"
+	default:
+		u.Host = host
+	}
+	u.Fragment = ""
+	u.RawFragment = ""
+	if u.Path == "" {
+		u.Path = "/"
+	}
+	return u.String()
+}
+
+func matchHost(pattern, host string) bool {
+	pattern = normalizeHost(pattern)
+	if suffix, ok := strings.CutPrefix(pattern, "*."); ok {
+		return strings.HasSuffix(host, "."+suffix)
+	}
+	return host == pattern
+}
+
+func normalizeHost(host string) string {
+	return strings.TrimSuffix(strings.ToLower(host), ".")
+}
+
+func containsFold(values []string, value string) bool {
+	for _, v := range values {
+		if strings.EqualFold(v, value) {
+			return true
+		}
+	}
+	return false
+}
+
+func splitList(value string) []string {
+	var values []string
+	for _, part := range strings.Split(value, ",") {
+		if part = strings.TrimSpace(part); part != "" {
+			values = append(values, part)
+		}
+	}
+	return values
+}
@@ -0,0 +1,85 @@
+package utils
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+)
+
+// Argon2id parameters of new hashes, the minimum OWASP recommends with
+// 19 MiB of memory. Hashes stored with other parameters still verify and
+// are reported for rehashing.
+const (
+	argon2Memory  = 19 * 1024
+	argon2Time    = 2
+	argon2Threads = 1
+	argon2SaltLen = 16
+	argon2KeyLen  = 32
+)
+
+const argon2Prefix = "$argon2id$"
+
+// HashPassword hashes a password with argon2id and a random salt, encoded in
+// the PHC string format: $argon2id$v=19$m=...,t=...,p=...$salt$key
+func HashPassword(password string) (string, error) {
+	salt := make([]byte, argon2SaltLen)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	key := argon2.IDKey([]byte(password), salt, argon2Time, argon2Memory, argon2Threads, argon2KeyLen)
+
+	return fmt.Sprintf("%sv=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2Prefix, argon2.Version, argon2Memory, argon2Time, argon2Threads,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key),
+	), nil
+}
+
+// VerifyPassword checks a password against a stored hash in constant time.
+// Values stored before passwords were hashed are compared as plaintext.
+// needsRehash reports a match whose stored value should be replaced with a
+// fresh HashPassword, because it is plaintext or uses older parameters.
+func VerifyPassword(stored, password string) (ok bool, needsRehash bool) {
+	if !strings.HasPrefix(stored, argon2Prefix) {
+		// Compare digests so that the time taken does not leak the length
+		storedSum := sha256.Sum256([]byte(stored))
+		passwordSum := sha256.Sum256([]byte(password))
+		ok = subtle.ConstantTimeCompare(storedSum[:], passwordSum[:]) == 1
+		return ok, ok
+	}
+
+	var version int
+	var memory, time uint32
+	var threads uint8
+	parts := strings.Split(stored, "$")
+	if len(parts) != 6 {
+		return false, false
+	}
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return false, false
+	}
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &memory, &time, &threads); err != nil || time == 0 {
+		return false, false
+	}
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return false, false
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil || len(key) == 0 {
+		return false, false
+	}
+
+	computed := argon2.IDKey([]byte(password), salt, time, memory, threads, uint32(len(key)))
+	if subtle.ConstantTimeCompare(computed, key) != 1 {
+		return false, false
+	}
+	needsRehash = memory != argon2Memory || time != argon2Time || threads != argon2Threads ||
+		len(salt) != argon2SaltLen || len(key) != argon2KeyLen
+	return true, needsRehash
+}